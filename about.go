@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// aboutFields are the About fields shown by "doc2gdoc about"
+const aboutFields = "user(displayName, emailAddress), storageQuota, maxUploadSize, importFormats, exportFormats"
+
+// runAboutCommand implements "doc2gdoc about [-json]"
+func runAboutCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("about", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the Drive About resource as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc about [-json]")
+		flags.PrintDefaults()
+	}
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	about, err := svc.Drive.About.Get().Fields(aboutFields).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read account information: %w", classifyAPIError(err))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(about)
+	}
+
+	profile := config.Profile
+	if profile == "" {
+		profile = "(default)"
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if u := about.User; u != nil {
+		fmt.Fprintf(tw, "User:\t%s <%s>\n", u.DisplayName, u.EmailAddress)
+	}
+	fmt.Fprintf(tw, "Profile:\t%s\n", profile)
+	if q := about.StorageQuota; q != nil {
+		fmt.Fprintf(tw, "Storage:\t%s\n", storageSummary(q))
+		fmt.Fprintf(tw, "  In Drive:\t%s\n", formatBytes(q.UsageInDrive))
+		fmt.Fprintf(tw, "  In trash:\t%s\n", formatBytes(q.UsageInDriveTrash))
+	}
+	if about.MaxUploadSize > 0 {
+		fmt.Fprintf(tw, "Max upload size:\t%s\n", formatBytes(about.MaxUploadSize))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Print(tr("Import formats:\n"))
+	printFormats(about.ImportFormats)
+	fmt.Println()
+	fmt.Print(tr("Export formats:\n"))
+	printFormats(about.ExportFormats)
+	return nil
+}
+
+// storageSummary describes the used storage and the limit, if there is one
+func storageSummary(q *drive.AboutStorageQuota) string {
+	if q.Limit == 0 {
+		return formatBytes(q.Usage) + " used, no limit"
+	}
+	return fmt.Sprintf("%s used of %s (%.0f%%)", formatBytes(q.Usage), formatBytes(q.Limit),
+		float64(q.Usage)*100/float64(q.Limit))
+}
+
+// printFormats lists a MIME type map of About, naming Google Workspace types
+func printFormats(formats map[string][]string) {
+	keys := make([]string, 0, len(formats))
+	for k := range formats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, k := range keys {
+		targets := make([]string, len(formats[k]))
+		for i, t := range formats[k] {
+			targets[i] = formatName(t)
+		}
+		fmt.Fprintf(tw, "  %s\t-> %s\n", formatName(k), strings.Join(targets, ", "))
+	}
+	tw.Flush()
+}
+
+// formatName returns the display name of Google Workspace types, or the
+// MIME type
+func formatName(mimeType string) string {
+	if name, ok := targetNames[mimeType]; ok {
+		return name
+	}
+	return mimeType
+}
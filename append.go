@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// appendSeparators are the -separator values of "doc2gdoc append"
+var appendSeparators = []string{"none", "rule", "date", "both"}
+
+// docLinkRe extracts the ID from a Google Docs link
+var docLinkRe = regexp.MustCompile(`/document/d/([a-zA-Z0-9_-]+)`)
+
+// runAppendCommand implements "doc2gdoc append <file> -doc-id <id>"
+func runAppendCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("append", flag.ExitOnError)
+	docID := flags.String("doc-id", "", "ID or link of the Google Doc to append to")
+	separator := flags.String("separator", "none", "What separates the appended content from the document: none, rule, date or both")
+	dateFormat := flags.String("date-format", "2006-01-02 15:04", "Go time layout of the date separator")
+	normalize := flags.Bool("normalize-headings", false, "Fix skipped heading levels")
+	number := flags.Bool("number-headings", false, "Prefix headings with outline numbers")
+	dryRun := flags.Bool("dry-run", false, "Only show what would be appended without changing the document")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc append <file.md|-> -doc-id <id> [-separator none|rule|date|both] [-dry-run]")
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || *docID == "" {
+		flags.Usage()
+		return fmt.Errorf("please specify a file and -doc-id")
+	}
+	if !slices.Contains(appendSeparators, *separator) {
+		return fmt.Errorf("unknown -separator %q, expected %s", *separator, strings.Join(appendSeparators, ", "))
+	}
+	id := *docID
+	if m := docLinkRe.FindStringSubmatch(id); m != nil {
+		id = m[1]
+	}
+
+	source := positional[0]
+	if source != stdinPath {
+		if sourceMimeTypes[strings.ToLower(filepath.Ext(source))] != "text/markdown" {
+			return fmt.Errorf("%s: %w, only Markdown can be appended", source, ErrUnsupportedFileType)
+		}
+	}
+	// Filters redact the source as they do an upload, and a failing one
+	// stops the append
+	readPath := source
+	if len(config.Filters) > 0 {
+		out, cleanup, err := applyFilters(source, source, config.Filters)
+		if err != nil {
+			return err
+		}
+		if out != "" {
+			defer cleanup()
+			readPath = out
+		}
+	}
+	content, err := readAppendSource(readPath)
+	if err != nil {
+		return err
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	doc, err := svc.Files.GetFile(ctx, id, "id, name, mimeType, webViewLink")
+	if err != nil {
+		return fmt.Errorf("unable to get %s: %w", id, classifyAPIError(err))
+	}
+	if doc.MimeType != docMimeType {
+		return fmt.Errorf("%s is not a Google Doc", doc.Name)
+	}
+	if *dryRun {
+		fmt.Print(tr("[dry-run] append %s (%d bytes) to %s: %s\n", source, len(content), doc.Name, doc.WebViewLink))
+		return nil
+	}
+
+	w, err := newDocWriter(ctx, svc.Docs, doc.Id, config.Styles)
+	if err != nil {
+		return err
+	}
+	// A new document only holds its final empty paragraph, which needs no
+	// separator before the content
+	if w.index > 1 {
+		if *separator == "rule" || *separator == "both" {
+			w.rule()
+		}
+		if *separator == "date" || *separator == "both" {
+			start, end := w.paragraph([]mdRun{{Text: time.Now().Format(*dateFormat), Bold: true}}, "NORMAL_TEXT")
+			w.shade(start, end)
+		}
+	}
+	blocks := markdownBlocks(content, ConvertOptions{NormalizeHeadings: *normalize, NumberHeadings: *number})
+	err = w.writeMarkdown(blocks)
+	svc.Audit.record(withAuditSource(ctx, source), auditUpdate, doc.Id, doc.Name, err)
+	if err != nil {
+		return err
+	}
+	fmt.Print(tr("Appended %s to %s: %s\n", source, doc.Name, doc.WebViewLink))
+	return nil
+}
+
+// readAppendSource reads the file to append, or standard input for "-"
+func readAppendSource(source string) (string, error) {
+	var r io.Reader = os.Stdin
+	if source != stdinPath {
+		f, err := os.Open(source)
+		if err != nil {
+			return "", fmt.Errorf("unable to open file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("unable to read file: %v", err)
+	}
+	return string(content), nil
+}
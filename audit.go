@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Audited actions
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditTrash  = "trash"
+	auditDelete = "delete"
+	auditMove   = "move"
+	auditCopy   = "copy"
+	auditShare  = "share"
+)
+
+// auditActions are the -action values of "doc2gdoc audit show"
+var auditActions = []string{auditCreate, auditUpdate, auditTrash, auditDelete, auditMove, auditCopy, auditShare}
+
+// AuditEntry is a line of the audit log
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is the email address of the account that acted, empty if it
+	// could not be looked up
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// Source is the local file or Drive file the action came from, if any
+	Source string `json:"source,omitempty"`
+	// Target is the ID of the file acted on, empty if creating it failed
+	Target string `json:"target,omitempty"`
+	// Name is the file name, or who a share is with
+	Name    string `json:"name,omitempty"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// auditLogger appends entries to the audit log, a JSON lines file that is
+// only ever appended to
+type auditLogger struct {
+	mu   sync.Mutex
+	file string
+}
+
+// auditLog is the audit log of this run, disabled if its file is empty
+var auditLog = &auditLogger{}
+
+func (l *auditLogger) add(entry AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == "" {
+		return
+	}
+	b, err := json.Marshal(entry)
+	if err == nil {
+		err = appendLine(l.file, b)
+	}
+	if err != nil {
+		logger.Error("Unable to write audit log", "file", l.file, "err", err)
+	}
+}
+
+// appendLine appends b and a newline to file in a single write, so lines
+// of concurrent processes don't interleave
+func appendLine(file string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditor records the mutations made with one account's Drive client
+type auditor struct {
+	srv   *drive.Service
+	once  sync.Once
+	actor string
+}
+
+// record adds an entry for action on the file target to the audit log. A
+// nil auditor, as with fake Drive clients, records nothing.
+func (a *auditor) record(ctx context.Context, action string, target string, name string, err error) {
+	if a == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:    time.Now().UTC(),
+		Actor:   a.account(ctx),
+		Action:  action,
+		Source:  auditSource(ctx),
+		Target:  target,
+		Name:    name,
+		Outcome: "ok",
+	}
+	if err != nil {
+		entry.Outcome, entry.Error = "failed", err.Error()
+	}
+	auditLog.add(entry)
+}
+
+// account looks up the email address of the account once
+func (a *auditor) account(ctx context.Context) string {
+	if auditLog.file == "" {
+		return ""
+	}
+	a.once.Do(func() {
+		about, err := a.srv.About.Get().Fields("user(emailAddress)").Context(ctx).Do()
+		if err != nil {
+			logger.Warn("Unable to look up the account for the audit log", "err", err)
+			return
+		}
+		if about.User != nil {
+			a.actor = about.User.EmailAddress
+		}
+	})
+	return a.actor
+}
+
+type auditSourceKey struct{}
+
+// withAuditSource returns ctx recording source as the origin of the
+// actions taken with it
+func withAuditSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, auditSourceKey{}, source)
+}
+
+func auditSource(ctx context.Context) string {
+	source, _ := ctx.Value(auditSourceKey{}).(string)
+	return source
+}
+
+// runAuditCommand implements "doc2gdoc audit show"
+func runAuditCommand(config Config, args []string) error {
+	if len(args) < 1 || args[0] != "show" {
+		return fmt.Errorf("usage: doc2gdoc audit show [-since 2024-01-01|24h] [-action create] [-json]")
+	}
+	flags := flag.NewFlagSet("audit show", flag.ExitOnError)
+	since := flags.String("since", "", "Only show entries from this date, time or duration ago, e.g. 2024-01-01 or 24h")
+	action := flags.String("action", "", "Only show this action: "+strings.Join(auditActions, ", "))
+	failed := flags.Bool("failed", false, "Only show failed actions")
+	asJSON := flags.Bool("json", false, "Print the entries as JSON lines")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc audit show [-since 2024-01-01|24h] [-action create] [-failed] [-json]")
+		flags.PrintDefaults()
+	}
+	if _, err := parseInterspersed(flags, args[1:]); err != nil {
+		return err
+	}
+	if *action != "" && !slices.Contains(auditActions, *action) {
+		return fmt.Errorf("unknown -action %q, expected %s", *action, strings.Join(auditActions, ", "))
+	}
+	var from time.Time
+	if *since != "" {
+		var err error
+		if from, err = parseSince(*since); err != nil {
+			return err
+		}
+	}
+	if config.AuditLogFile == "" {
+		return fmt.Errorf("the audit log is disabled")
+	}
+
+	f, err := os.Open(config.AuditLogFile)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Print(tr("No audit log entries\n"))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if !*asJSON {
+		fmt.Fprintln(tw, "TIME\tACTOR\tACTION\tSOURCE\tTARGET\tNAME\tOUTCOME")
+	}
+	enc := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			logger.Warn("Skipping unreadable audit log line", "line", line, "err", err)
+			continue
+		}
+		if e.Time.Before(from) || (*action != "" && e.Action != *action) || (*failed && e.Outcome == "ok") {
+			continue
+		}
+		if *asJSON {
+			enc.Encode(e)
+			continue
+		}
+		outcome := e.Outcome
+		if e.Error != "" {
+			outcome += ": " + e.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), dash(e.Actor), e.Action,
+			dash(e.Source), dash(e.Target), dash(e.Name), outcome)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read audit log: %v", err)
+	}
+	if !*asJSON {
+		return tw.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// profilesDir holds one directory per account profile, each with its own
+// token.json and optionally its own credentials.json
+func profilesDir() string {
+	return filepath.Join(configDir(), "profiles")
+}
+
+// applyProfile points the token file, and the credentials file if the
+// profile has one, at the profile's directory
+func applyProfile(config *Config, name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	dir := filepath.Join(profilesDir(), name)
+	config.Profile = name
+	config.TokenFile = filepath.Join(dir, "token.json")
+	if creds := filepath.Join(dir, "credentials.json"); fileExists(creds) {
+		config.CredentialsFile = creds
+	}
+	return nil
+}
+
+// reloginHint tells how to log in again as the profile of config
+func reloginHint(config Config) string {
+	if config.Profile == "" {
+		return `run "doc2gdoc auth login"`
+	}
+	return fmt.Sprintf(`run "doc2gdoc auth login -profile %s"`, config.Profile)
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// runAuthCommand implements "doc2gdoc auth list|login|logout [profile]"
+func runAuthCommand(ctx context.Context, config Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: doc2gdoc auth list|login|logout [profile]")
+	}
+
+	if args[0] == "list" {
+		entries, err := os.ReadDir(profilesDir())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to read profiles: %v", err)
+		}
+		if len(entries) == 0 {
+			fmt.Print(tr("No profiles, create one with \"doc2gdoc auth login -profile <name>\"\n"))
+			return nil
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			mark := " "
+			if e.Name() == config.Profile {
+				mark = "*"
+			}
+			status := "logged out"
+			profileConfig := config
+			if err := applyProfile(&profileConfig, e.Name()); err != nil {
+				continue
+			}
+			if store, err := newTokenStore(profileConfig); err == nil {
+				if _, err := store.Load(); err == nil {
+					status = "logged in"
+				}
+			}
+			fmt.Printf("%s %s (%s)\n", mark, e.Name(), status)
+		}
+		return nil
+	}
+
+	profile := config.Profile
+	if len(args) > 1 {
+		profile = args[1]
+	}
+	// Without a profile, the token next to the credentials in the config
+	// directory is used, as by the other commands
+	if profile != "" {
+		if err := applyProfile(&config, profile); err != nil {
+			return err
+		}
+	} else {
+		profile = "default"
+	}
+	store, err := newTokenStore(config)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "login":
+		oauthConfig, err := readOAuthConfig(config.CredentialsFile)
+		if err != nil {
+			return err
+		}
+		tok, err := getTokenFromWeb(ctx, oauthConfig)
+		if err != nil {
+			return err
+		}
+		if err := store.Save(tok); err != nil {
+			return err
+		}
+		fmt.Print(tr("Logged in as profile %s\n", profile))
+	case "logout":
+		if err := store.Delete(); err != nil {
+			if errors.Is(err, errNoToken) {
+				return fmt.Errorf("profile %s is not logged in", profile)
+			}
+			return fmt.Errorf("unable to remove token: %v", err)
+		}
+		fmt.Print(tr("Logged out of profile %s\n", profile))
+	default:
+		return fmt.Errorf("unknown auth command %q, expected list, login or logout", args[0])
+	}
+	return nil
+}
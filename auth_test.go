@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+type failingTransport struct{ err error }
+
+func (t failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+func TestReloginHintNamesProfile(t *testing.T) {
+	if got := reloginHint(Config{}); got != `run "doc2gdoc auth login"` {
+		t.Errorf("hint without a profile = %s", got)
+	}
+	hint := reloginHint(Config{Profile: "work"})
+	if hint != `run "doc2gdoc auth login -profile work"` {
+		t.Errorf("hint for profile work = %s", hint)
+	}
+	// The suggested command selects the profile it names
+	args := strings.Fields(strings.Trim(strings.TrimPrefix(hint, "run "), `"`))[1:]
+	var profile string
+	rest, err := splitGlobalFlags(args, map[string]globalFlag{"profile": stringFlag(&profile)})
+	if err != nil || profile != "work" || strings.Join(rest, " ") != "auth login" {
+		t.Errorf("splitGlobalFlags(%q) = %q, %q, %v", args, profile, rest, err)
+	}
+
+	invalidGrant := &oauth2.RetrieveError{ErrorCode: "invalid_grant"}
+	rt := wrapTransport(Config{}, hint, failingTransport{invalidGrant})
+	req, _ := http.NewRequest(http.MethodGet, "https://www.googleapis.com/drive/v3/files", nil)
+	_, err = rt.RoundTrip(req)
+	if !errors.Is(err, ErrTokenExpired) || !strings.Contains(err.Error(), "-profile work") {
+		t.Errorf("failed refresh = %v, want ErrTokenExpired naming the profile", err)
+	}
+}
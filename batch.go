@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// expandFileArgs expands glob patterns in file arguments itself, so patterns
+// work the same in shells that don't expand them, like cmd.exe
+func expandFileArgs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		// Windows takes slashes too; converting them keeps printed paths uniform
+		arg = filepath.FromSlash(arg)
+		if !strings.ContainsAny(arg, "*?[") {
+			files = append(files, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", arg, err)
+		}
+		n := len(files)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && !info.IsDir() {
+				files = append(files, m)
+			}
+		}
+		if len(files) == n {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+	}
+	return files, nil
+}
+
+// convertOrQueue converts one file, queueing it for "doc2gdoc retry" when
+// the failure is transient, and reports the outcome
+func convertOrQueue(ctx context.Context, svc *Services, config Config, filePath string, drivePath string, opts ConvertOptions) (*ConvertResult, error) {
+	start := time.Now()
+	fileCtx := ctx
+	if config.FileTimeout > 0 {
+		var cancel context.CancelFunc
+		fileCtx, cancel = context.WithTimeout(ctx, config.FileTimeout)
+		defer cancel()
+	}
+	result, err := convertToGoogleDocs(fileCtx, svc, filePath, drivePath, opts)
+	if err != nil && ctx.Err() == nil && errors.Is(fileCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s: %v", errFileTimeout, config.FileTimeout, err)
+	}
+	if !opts.DryRun {
+		reportConversion(ctx, config, filePath, result, err, time.Since(start))
+	}
+	if err == nil {
+		return result, nil
+	}
+	errorReport.add(filePath, drivePath, err)
+	if ctx.Err() != nil {
+		logger.Warn("Interrupted, file was not fully converted", "file", filePath)
+	}
+	// Standard input is gone after this run, so it cannot be retried
+	if isRetryable(ctx, err) && filePath != stdinPath && !opts.DryRun {
+		if qerr := enqueueRetry(config.StateFile, filePath, drivePath, opts, err); qerr != nil {
+			logger.Error("Unable to queue for retry", "err", qerr)
+		} else {
+			logger.Warn("Queued for retry, run \"doc2gdoc retry\" later", "file", filePath)
+		}
+	}
+	return result, err
+}
+
+// reportConversion counts a finished conversion in metrics and notifies the
+// webhook of it
+func reportConversion(ctx context.Context, config Config, source string, result *ConvertResult, err error, duration time.Duration) {
+	event := newWebhookEvent(source, result, err, duration)
+	metrics.conversion(event.Status)
+	notifyWebhook(ctx, config, event)
+}
+
+// convertBatch converts several files into one Drive folder and prints a
+// summary table. Failures don't stop the batch. Converted files are
+// recorded in journal, and skipped if it resumes a run.
+func convertBatch(ctx context.Context, svc *Services, config Config, journal *Journal, files []string, drivePath string, opts ConvertOptions) error {
+	type result struct {
+		file   string
+		status string
+		detail string
+	}
+	var results []result
+	var errs []error
+	converted, failed := 0, 0
+	brk := breaker{limit: config.BreakAfter}
+
+	for i, file := range files {
+		if ctx.Err() != nil {
+			for _, f := range files[i:] {
+				results = append(results, result{f, "not started", ""})
+			}
+			break
+		}
+		if progressEnabled {
+			fmt.Print(tr("[%d/%d] %s (%d converted, %d failed)\n", i+1, len(files), file, converted, failed))
+		}
+		entry, hash, done := journal.Completed(file, drivePath)
+		if done {
+			results = append(results, result{file, "done", "converted in an earlier run (File ID: " + entry.FileID + ")"})
+			converted++
+			continue
+		}
+		res, err := convertOrQueue(ctx, svc, config, file, drivePath, opts)
+		brk.record(ctx, err)
+		if err != nil {
+			status := "failed"
+			if isRetryable(ctx, err) {
+				status = "queued"
+			}
+			results = append(results, result{file, status, err.Error()})
+			errs = append(errs, err)
+			failed++
+			// Every later file would likely fail the same way
+			if errors.Is(err, ErrTokenExpired) || brk.tripped() {
+				for _, f := range files[i+1:] {
+					results = append(results, result{f, "not started", ""})
+				}
+				break
+			}
+			continue
+		}
+		if err := journal.Record(file, drivePath, hash, res); err != nil {
+			logger.Error("Unable to record in journal", "file", file, "err", err)
+		}
+		results = append(results, result{file, "ok", ""})
+		converted++
+	}
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSTATUS\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.file, r.status, r.detail)
+	}
+	tw.Flush()
+	fmt.Print(tr("%d of %d file(s) converted\n", converted, len(files)))
+	brk.report()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := stoppedForAuth(journal, errs); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &BatchError{Failed: failed, Total: len(files), Unit: "file(s)", Errs: errs}
+	}
+	return nil
+}
+
+// stoppedForAuth returns the error of a run that stopped because the token
+// was revoked or expired, after telling how to log in and resume, or nil.
+// Converted files are in the journal, if the run keeps one, so -resume
+// skips them.
+func stoppedForAuth(journal *Journal, errs []error) error {
+	if len(errs) == 0 || !errors.Is(errs[len(errs)-1], ErrTokenExpired) {
+		return nil
+	}
+	err := errs[len(errs)-1]
+	if journal != nil {
+		fmt.Print(tr("Re-authentication required: log in again and rerun with -resume to convert the rest\n"))
+	} else {
+		fmt.Print(tr("Re-authentication required: log in again and rerun\n"))
+	}
+	return fmt.Errorf("stopped: %w", err)
+}
+
+// breaker stops a run after limit consecutive transient failures, which
+// likely share a cause the rest of the run would run into as well
+type breaker struct {
+	limit  int
+	streak int
+}
+
+// record counts the outcome of a conversion
+func (b *breaker) record(ctx context.Context, err error) {
+	if err != nil && isRetryable(ctx, err) {
+		b.streak++
+	} else {
+		b.streak = 0
+	}
+}
+
+// tripped reports whether the run should stop
+func (b *breaker) tripped() bool {
+	return b.limit > 0 && b.streak >= b.limit
+}
+
+// report tells why the run stopped, if the breaker tripped
+func (b *breaker) report() {
+	if b.tripped() {
+		fmt.Print(tr("Stopped after %d consecutive transient failures, the rest were not started\n", b.streak))
+	}
+}
@@ -0,0 +1,10 @@
+//go:build darwin
+
+package main
+
+import "os/exec"
+
+// openBrowser opens a URL in the default browser
+func openBrowser(url string) error {
+	return exec.Command("open", url).Start()
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !darwin
+
+package main
+
+import "os/exec"
+
+// openBrowser opens a URL in the default browser through xdg-open
+func openBrowser(url string) error {
+	return exec.Command("xdg-open", url).Start()
+}
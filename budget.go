@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Practical limits for a single Doc. Docs accepts about 1.02 million
+// characters, but gets slow for readers well before that.
+const (
+	budgetMaxBytes      = 10 << 20
+	budgetMaxChars      = 500000
+	budgetMaxElements   = 10000
+	budgetMaxTableCells = 5000
+	budgetMaxImages     = 200
+)
+
+// checkBudget returns a warning for every practical Docs limit the source
+// would exceed. Structure is only counted for Markdown; other formats are
+// checked by size. The file is rewound afterwards.
+func checkBudget(file *os.File, sourceMime string) ([]string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	if info.Size() > budgetMaxBytes {
+		warnings = append(warnings, fmt.Sprintf("source is %d MB, more than the %d MB budget", info.Size()>>20, budgetMaxBytes>>20))
+	}
+	if sourceMime != "text/markdown" {
+		return warnings, nil
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	_, body, _ := splitFrontMatter(string(content))
+	return append(warnings, markdownBudget(body)...), nil
+}
+
+// markdownBudget counts the characters, elements, table cells and images
+// of Markdown source
+func markdownBudget(body string) []string {
+	blocks := parseMarkdown(body)
+	elements, cells := len(blocks), 0
+	for _, b := range blocks {
+		for _, row := range b.Rows {
+			cells += len(row)
+		}
+	}
+	images := 0
+	for _, m := range mdRefRe.FindAllStringSubmatch(body, -1) {
+		if m[1] == "!" {
+			images++
+		}
+	}
+	chars := utf16Len(body)
+
+	var warnings []string
+	if chars > budgetMaxChars {
+		warnings = append(warnings, fmt.Sprintf("%d characters, more than the %d budget", chars, budgetMaxChars))
+	}
+	if elements > budgetMaxElements {
+		warnings = append(warnings, fmt.Sprintf("%d paragraphs and other elements, more than the %d budget", elements, budgetMaxElements))
+	}
+	if cells > budgetMaxTableCells {
+		warnings = append(warnings, fmt.Sprintf("%d table cells, more than the %d budget", cells, budgetMaxTableCells))
+	}
+	if images > budgetMaxImages {
+		warnings = append(warnings, fmt.Sprintf("%d images, more than the %d budget", images, budgetMaxImages))
+	}
+	return warnings
+}
+
+// budgetAdvice is printed after budget warnings
+const budgetAdvice = "Large documents are slow to open and edit, consider splitting the source into smaller files"
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// sourceHashProperty is the appProperties key holding the SHA-256 of the
+// local file a document was converted from
+const sourceHashProperty = "source_sha256"
+
+// fileSHA256 hashes a file's content and rewinds it for the upload
+func fileSHA256(file *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
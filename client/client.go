@@ -0,0 +1,331 @@
+// Package client calls the HTTP API of "doc2gdoc serve", so services can
+// convert files on a central doc2gdoc server:
+//
+//	c := client.New("https://doc2gdoc.internal:8080", client.WithToken(token))
+//	job, err := c.Convert(ctx, "notes.md", "/Team/Notes")
+//	if err == nil {
+//		job, err = c.Wait(ctx, job.ID)
+//	}
+//
+// Uploads are streamed, so large files are never held in memory.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Job states
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// defaultPollInterval is how often Wait asks for the state of a job
+const defaultPollInterval = 2 * time.Second
+
+// Job is a conversion queued on the server
+type Job struct {
+	ID            string     `json:"id"`
+	Status        string     `json:"status"`
+	Source        string     `json:"source"`
+	DrivePath     string     `json:"drive_path"`
+	BytesUploaded int64      `json:"bytes_uploaded"`
+	BytesTotal    int64      `json:"bytes_total"`
+	Result        *Result    `json:"result,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job has finished, successfully or not
+func (j *Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Result is the document a job converted into
+type Result struct {
+	// Status is created, updated or skipped
+	Status string `json:"status"`
+	Name   string `json:"name"`
+	FileID string `json:"file_id,omitempty"`
+	Link   string `json:"link,omitempty"`
+	// Location is the Drive path of the document
+	Location string `json:"location"`
+}
+
+// Folder is a folder listed by Folders
+type Folder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Error is an error answered by the server
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("doc2gdoc: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// JobError is returned by Wait for a job that failed
+type JobError struct {
+	Job *Job
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("doc2gdoc: job %s failed: %s", e.Job.ID, e.Job.Error)
+}
+
+// Client calls a doc2gdoc server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	token      string
+	apiKey     string
+	httpClient *http.Client
+	poll       time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken sends the bearer token the server was started with
+// (-auth-token)
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithAPIKey names the tenant of a multi-tenant server by its API key
+// (-tenant-keys)
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithPollInterval sets how often Wait asks for the state of a job
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Client) { c.poll = d }
+}
+
+// New returns a client of the server at baseURL, e.g. http://host:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		poll:       defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ConvertOptions are the optional fields of a conversion
+type ConvertOptions struct {
+	// Title names the document (default: the file name without extension)
+	Title string
+	// Target forces the Google Workspace type: doc, sheet or slide
+	Target string
+	// OnConflict is skip, overwrite, rename or version (default: always
+	// create a new document)
+	OnConflict string
+}
+
+// Convert uploads the local file and queues its conversion into the Drive
+// path dest, the server's default path if empty. The returned job is
+// usually still queued, see Wait.
+func (c *Client) Convert(ctx context.Context, file string, dest string, opts ...ConvertOptions) (*Job, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.ConvertReader(ctx, filepath.Base(file), f, dest, opts...)
+}
+
+// ConvertReader is Convert for a source read from r, named name; the name's
+// extension tells the server the source type
+func (c *Client) ConvertReader(ctx context.Context, name string, r io.Reader, dest string, opts ...ConvertOptions) (*Job, error) {
+	var o ConvertOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeConvertForm(mw, name, r, dest, o))
+	}()
+
+	// Stops the writer if the server answered before reading it all
+	defer pr.Close()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/convert", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var job Job
+	if err := c.do(req, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// writeConvertForm streams the multipart body of POST /convert
+func writeConvertForm(mw *multipart.Writer, name string, r io.Reader, dest string, o ConvertOptions) error {
+	for _, field := range [][2]string{{"path", dest}, {"title", o.Title}, {"target", o.Target}, {"on_conflict", o.OnConflict}} {
+		if field[1] == "" {
+			continue
+		}
+		if err := mw.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// Job returns the current state of a job
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := c.do(req, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Jobs lists the jobs of the caller, oldest first
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/jobs", nil)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	if err := c.do(req, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Wait polls a job until it finishes. A failed job is returned along with
+// a *JobError.
+func (c *Client) Wait(ctx context.Context, id string) (*Job, error) {
+	ticker := time.NewTicker(c.poll)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status == StatusFailed {
+			return job, &JobError{Job: job}
+		}
+		if job.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Folders lists the folders in the Drive path dest, the server's default
+// path if empty, and returns the ID of dest
+func (c *Client) Folders(ctx context.Context, dest string) (string, []Folder, error) {
+	query := ""
+	if dest != "" {
+		query = "?path=" + url.QueryEscape(dest)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, "/folders"+query, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	var res struct {
+		ID      string   `json:"id"`
+		Folders []Folder `json:"folders"`
+	}
+	if err := c.do(req, &res); err != nil {
+		return "", nil, err
+	}
+	return res.ID, res.Folders, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	return req, nil
+}
+
+// do sends req and decodes the JSON answer into v, or returns the error
+// the server answered
+func (c *Client) do(req *http.Request, v any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Error string `json:"error"`
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(b, &body) != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(b))
+		}
+		if body.Error == "" {
+			body.Error = http.StatusText(resp.StatusCode)
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("doc2gdoc: unable to parse response: %v", err)
+	}
+	return nil
+}
+
+// IsNotFound reports whether err is the server answering 404, e.g. for a
+// missing job or Drive folder
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
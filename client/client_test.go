@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertAndWait(t *testing.T) {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-API-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"missing or invalid bearer token"}`)
+			return
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		b, _ := io.ReadAll(f)
+		if header.Filename != "notes.md" || string(b) != "# Notes\n" {
+			t.Errorf("uploaded %s %q", header.Filename, b)
+		}
+		if r.FormValue("path") != "/Team" || r.FormValue("on_conflict") != "overwrite" {
+			t.Errorf("path %q, on_conflict %q", r.FormValue("path"), r.FormValue("on_conflict"))
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"j1","status":"queued","source":"notes.md","drive_path":"/Team"}`)
+	})
+	mux.HandleFunc("/jobs/j1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 2 {
+			io.WriteString(w, `{"id":"j1","status":"running"}`)
+			return
+		}
+		io.WriteString(w, `{"id":"j1","status":"succeeded","result":{"status":"created","name":"notes","file_id":"doc1"}}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	c := New(ts.URL+"/", WithToken("secret"), WithAPIKey("key"), WithPollInterval(time.Millisecond))
+	ctx := context.Background()
+	job, err := c.ConvertReader(ctx, "notes.md", strings.NewReader("# Notes\n"), "/Team", ConvertOptions{OnConflict: "overwrite"})
+	if err != nil {
+		t.Fatalf("ConvertReader: %v", err)
+	}
+	if job.ID != "j1" || job.Status != StatusQueued {
+		t.Fatalf("job = %+v", job)
+	}
+	job, err = c.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if job.Result == nil || job.Result.FileID != "doc1" {
+		t.Fatalf("result = %+v", job.Result)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"no job missing"}`)
+	})
+	mux.HandleFunc("/jobs/bad", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id":"bad","status":"failed","error":"unsupported file type"}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	c := New(ts.URL)
+
+	_, err := c.Job(context.Background(), "missing")
+	if !IsNotFound(err) || !strings.Contains(err.Error(), "no job missing") {
+		t.Errorf("Job(missing) = %v", err)
+	}
+	job, err := c.Wait(context.Background(), "bad")
+	var jobErr *JobError
+	if !errors.As(err, &jobErr) || job.Error != "unsupported file type" {
+		t.Errorf("Wait(bad) = %+v, %v", job, err)
+	}
+}
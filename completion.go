@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// completionCacheTTL is how long listed Drive folders are offered without
+// asking Drive again
+const completionCacheTTL = 10 * time.Minute
+
+// completionTimeout bounds a completion, so a slow network doesn't hang
+// the shell
+const completionTimeout = 5 * time.Second
+
+// completeFiles is printed alone when the shell should complete local files
+const completeFiles = ":files"
+
+// completionCommands are the subcommands offered as the first argument
+var completionCommands = []string{
+	"about", "append", "audit", "auth", "completion", "cp", "daemon", "export-tree", "find", "jobs", "lint", "list", "meta", "mv",
+	"provenance", "pull", "retry", "revisions", "rm", "serve", "state", "sync", "ui",
+	"upload", "watch",
+}
+
+// drivePathFlags are the flags whose value is a Drive path
+var drivePathFlags = map[string]bool{"path": true, "also-publish": true, "also-link-in": true}
+
+// drivePathCommands take Drive paths as arguments
+var drivePathCommands = map[string]bool{"cp": true, "export-tree": true, "list": true, "mv": true, "revisions": true, "rm": true}
+
+// flagUsagePattern matches the flag names in the output of -h
+var flagUsagePattern = regexp.MustCompile(`(?m)^\s+-([\w-]+)`)
+
+// completionScripts are printed by "doc2gdoc completion <shell>". They
+// call "doc2gdoc __complete" with the words up to the cursor.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for doc2gdoc
+# Load with: source <(doc2gdoc completion bash)
+_doc2gdoc() {
+	local cur words cword IFS=$'\n'
+	if declare -F _get_comp_words_by_ref >/dev/null; then
+		_get_comp_words_by_ref -n =: cur words cword
+	else
+		cur=${COMP_WORDS[COMP_CWORD]} words=("${COMP_WORDS[@]}") cword=$COMP_CWORD
+	fi
+	local out
+	out=$(doc2gdoc __complete "${words[@]:1:cword}" 2>/dev/null)
+	if [[ $out == ":files" ]]; then
+		compopt -o filenames 2>/dev/null
+		COMPREPLY=($(compgen -f -- "$cur"))
+		return
+	fi
+	COMPREPLY=($out)
+	if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+		compopt -o nospace 2>/dev/null
+	fi
+	if declare -F __ltrim_colon_completions >/dev/null; then
+		__ltrim_colon_completions "$cur"
+	fi
+}
+complete -F _doc2gdoc doc2gdoc
+`,
+	"zsh": `#compdef doc2gdoc
+# zsh completion for doc2gdoc
+# Load with: source <(doc2gdoc completion zsh)
+_doc2gdoc() {
+	local -a out dirs others
+	out=("${(@f)$(doc2gdoc __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ $out[1] == ":files" ]]; then
+		_files
+		return
+	fi
+	dirs=(${(M)out:#*/})
+	others=(${out:#*/})
+	(( $#dirs )) && compadd -S '' -- $dirs
+	(( $#others )) && compadd -- $others
+}
+compdef _doc2gdoc doc2gdoc
+`,
+	"fish": `# fish completion for doc2gdoc
+# Load with: doc2gdoc completion fish | source
+function __doc2gdoc_complete
+	set -l tokens (commandline -opc) (commandline -ct)
+	set -l out (doc2gdoc __complete $tokens[2..-1] 2>/dev/null)
+	if test "$out[1]" = ":files"
+		__fish_complete_path (commandline -ct)
+		return
+	end
+	printf '%s\n' $out
+end
+complete -c doc2gdoc -f -a '(__doc2gdoc_complete)'
+`,
+}
+
+// runCompletionCommand implements "doc2gdoc completion bash|zsh|fish"
+func runCompletionCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: doc2gdoc completion bash|zsh|fish")
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown shell %q, expected bash, zsh or fish", args[0])
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// runCompleteCommand implements "doc2gdoc __complete <words>", called by the
+// completion scripts with the words after doc2gdoc, the last one being
+// completed. It prints candidates one per line, or completeFiles.
+func runCompleteCommand(ctx context.Context, config Config, words []string) {
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	for _, c := range completeWords(ctx, config, words) {
+		fmt.Println(c)
+	}
+}
+
+func completeWords(ctx context.Context, config Config, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	prev := ""
+	if len(words) > 1 {
+		prev = words[len(words)-2]
+	}
+	command := ""
+	if len(words) > 1 && slices.Contains(completionCommands, words[0]) {
+		command = words[0]
+	}
+
+	if len(words) == 1 && !strings.HasPrefix(cur, "-") {
+		var out []string
+		for _, c := range completionCommands {
+			if strings.HasPrefix(c, cur) {
+				out = append(out, c)
+			}
+		}
+		if len(out) > 0 {
+			return out
+		}
+		return []string{completeFiles}
+	}
+
+	// -path <value>, and -path=<value> with the flag kept
+	if strings.HasPrefix(prev, "-") && drivePathFlags[strings.TrimLeft(prev, "-")] {
+		return completeDrivePath(ctx, config, cur)
+	}
+	if name, value, ok := strings.Cut(cur, "="); ok && strings.HasPrefix(name, "-") {
+		if !drivePathFlags[strings.TrimLeft(name, "-")] {
+			return nil
+		}
+		var out []string
+		for _, c := range completeDrivePath(ctx, config, value) {
+			out = append(out, name+"="+c)
+		}
+		return out
+	}
+	if strings.HasPrefix(cur, "-") {
+		return completeFlags(ctx, command, cur)
+	}
+	if drivePathCommands[command] && strings.HasPrefix(cur, "/") {
+		return completeDrivePath(ctx, config, cur)
+	}
+	return []string{completeFiles}
+}
+
+// completeFlags offers the flags of command (the upload flags if empty),
+// read from its -h output so they never fall behind
+func completeFlags(ctx context.Context, command string, cur string) []string {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	var args []string
+	if command != "" {
+		args = append(args, command)
+	}
+	out, _ := exec.CommandContext(ctx, exe, append(args, "-h")...).CombinedOutput()
+
+	dashes := "-"
+	if strings.HasPrefix(cur, "--") {
+		dashes = "--"
+	}
+	var flags []string
+	seen := map[string]bool{}
+	for _, m := range flagUsagePattern.FindAllSubmatch(out, -1) {
+		name := dashes + string(m[1])
+		if !seen[name] && strings.HasPrefix(name, cur) {
+			seen[name] = true
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// completeDrivePath offers the folders under the folder value ends in
+func completeDrivePath(ctx context.Context, config Config, value string) []string {
+	i := strings.LastIndex(value, "/")
+	if i < 0 {
+		var out []string
+		for _, p := range []string{"/", starredPrefix, computersPrefix, drivePrefix, idPrefix} {
+			if strings.HasPrefix(p, value) {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	dir, prefix := value[:i+1], value[i+1:]
+	names := completionFolders(ctx, config, dir)
+	var out []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !strings.Contains(name, "/") {
+			out = append(out, dir+name+"/")
+		}
+	}
+	return out
+}
+
+// completionCache maps Drive paths to the names of their folders
+type completionCache map[string]struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Folders   []string  `json:"folders"`
+}
+
+// completionFolders lists the folder names under dir, from the completion
+// cache while it is fresh. It never authorizes interactively: without a
+// stored token there is nothing to offer.
+func completionFolders(ctx context.Context, config Config, dir string) []string {
+	cacheFile := defaultCompletionCacheFile()
+	cache := completionCache{}
+	if b, err := os.ReadFile(cacheFile); err == nil {
+		json.Unmarshal(b, &cache)
+	}
+	key := config.Profile + "|" + dir
+	if entry, ok := cache[key]; ok && time.Since(entry.FetchedAt) < completionCacheTTL {
+		return entry.Folders
+	}
+
+	if _, err := os.Stat(config.CredentialsFile); err == nil {
+		store, err := newTokenStore(config)
+		if err != nil {
+			return nil
+		}
+		if _, err := store.Load(); err != nil {
+			return nil
+		}
+	}
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return nil
+	}
+	parentID, err := svc.Folders.FindOrCreate(ctx, dir, createNone)
+	if err != nil {
+		return nil
+	}
+	query := buildQuery(
+		"mimeType = "+quoteQuery(folderMimeType),
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
+	files, err := svc.Files.ListFiles(ctx, query, "name", 1000, 0)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	entry := cache[key]
+	entry.FetchedAt, entry.Folders = time.Now(), names
+	cache[key] = entry
+	for k, e := range cache {
+		if time.Since(e.FetchedAt) >= completionCacheTTL {
+			delete(cache, k)
+		}
+	}
+	if err := writeCompletionCache(cacheFile, cache); err != nil {
+		logger.Debug("Unable to write completion cache", "err", err)
+	}
+	return names
+}
+
+func writeCompletionCache(cacheFile string, cache completionCache) error {
+	if cacheFile == "" {
+		return errors.New("no config directory")
+	}
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0700); err != nil {
+		return err
+	}
+	tmp := cacheFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cacheFile)
+}
+
+// defaultCompletionCacheFile is completion-cache.json in the config
+// directory
+func defaultCompletionCacheFile() string {
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "completion-cache.json")
+	}
+	return ""
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of config.yaml. Relative paths are resolved
+// against the directory holding the config file.
+type fileConfig struct {
+	Credentials string `yaml:"credentials"`
+	Token       string `yaml:"token"`
+	DefaultPath string `yaml:"default_path"`
+	FolderCache string `yaml:"folder_cache"`
+	State       string `yaml:"state"`
+	// AuditLog is the JSON lines file mutations are recorded in, "off"
+	// disables it
+	AuditLog string `yaml:"audit_log"`
+	// Preprocess are per-extension commands transforming sources before upload
+	Preprocess []PreprocessRule `yaml:"preprocess"`
+	// Filters redact patterns from text sources before upload, and
+	// RedactionReport is a JSON lines file recording each redaction
+	Filters         []FilterRule `yaml:"filters"`
+	RedactionReport string       `yaml:"redaction_report"`
+	// Order sets which files of a batch are converted first
+	Order []OrderRule `yaml:"order"`
+	// Destinations are folders every conversion is also published to
+	Destinations []Destination `yaml:"destinations"`
+	// Styles maps Markdown elements (h1, code, ...) to Docs styles and fonts
+	Styles     map[string]StyleRule `yaml:"styles"`
+	Profile    string               `yaml:"profile"`
+	TokenStore string               `yaml:"token_store"`
+	QPS        string               `yaml:"qps"`
+	Burst      string               `yaml:"burst"`
+	// MaxUploadRate is e.g. 5MB/s, shared by concurrent uploads if
+	// ShareUploadRate is set
+	MaxUploadRate   string `yaml:"max_upload_rate"`
+	ShareUploadRate bool   `yaml:"share_upload_rate"`
+	Webhook         struct {
+		URL    string `yaml:"url"`
+		Secret string `yaml:"secret"`
+	} `yaml:"webhook"`
+	// HTTP configures the client used for Google APIs
+	HTTP struct {
+		Proxy   string `yaml:"proxy"`
+		CACert  string `yaml:"ca_cert"`
+		Timeout string `yaml:"timeout"`
+		Debug   bool   `yaml:"debug"`
+	} `yaml:"http"`
+	// Daemon holds the recurring jobs of "doc2gdoc daemon"
+	Daemon struct {
+		State string      `yaml:"state"`
+		Logs  string      `yaml:"logs"`
+		Jobs  []DaemonJob `yaml:"jobs"`
+	} `yaml:"daemon"`
+}
+
+// configDir returns $XDG_CONFIG_HOME/doc2gdoc, ~/.config/doc2gdoc by default
+func configDir() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "doc2gdoc")
+}
+
+// configFilePath returns $DOC2GDOC_CONFIG, or config.yaml in configDir
+func configFilePath() string {
+	if p := os.Getenv("DOC2GDOC_CONFIG"); p != "" {
+		return p
+	}
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "config.yaml")
+	}
+	return ""
+}
+
+// loadConfig layers the config file and environment variables over the
+// defaults; command line flags are applied on top by the caller
+func loadConfig() (Config, error) {
+	config := Config{
+		CredentialsFile:   "credentials.json",
+		TokenFile:         "token.json",
+		StateFile:         defaultStateFile(),
+		ImportFormatsFile: defaultImportFormatsFile(),
+		AuditLogFile:      defaultAuditLogFile(),
+		DaemonStateFile:   filepath.Join(defaultDaemonDir(), "state.json"),
+		DaemonLogDir:      filepath.Join(defaultDaemonDir(), "logs"),
+	}
+
+	if p := configFilePath(); p != "" {
+		b, err := os.ReadFile(p)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return config, fmt.Errorf("unable to read config file: %v", err)
+		default:
+			var fc fileConfig
+			if err := yaml.Unmarshal(b, &fc); err != nil {
+				return config, fmt.Errorf("unable to parse config file %s: %v", p, err)
+			}
+			dir := filepath.Dir(p)
+			setPath(&config.CredentialsFile, fc.Credentials, dir)
+			setPath(&config.TokenFile, fc.Token, dir)
+			setPath(&config.FolderCacheFile, fc.FolderCache, dir)
+			setPath(&config.StateFile, fc.State, dir)
+			setAuditLog(&config, fc.AuditLog, dir)
+			if fc.DefaultPath != "" {
+				config.DefaultPath = fc.DefaultPath
+			}
+			config.Profile = fc.Profile
+			config.TokenStorage = fc.TokenStore
+			config.WebhookURL = fc.Webhook.URL
+			config.WebhookSecret = fc.Webhook.Secret
+			if err := setRateOptions(&config, fc.QPS, fc.Burst, fc.MaxUploadRate); err != nil {
+				return config, fmt.Errorf("invalid config file %s: %v", p, err)
+			}
+			config.ShareUploadRate = fc.ShareUploadRate
+			setPath(&config.CACertFile, fc.HTTP.CACert, dir)
+			if err := setHTTPOptions(&config, fc.HTTP.Proxy, fc.HTTP.Timeout); err != nil {
+				return config, fmt.Errorf("invalid config file %s: %v", p, err)
+			}
+			config.DebugHTTP = fc.HTTP.Debug
+			config.Preprocess = fc.Preprocess
+			if err := validateStyles(fc.Styles); err != nil {
+				return config, fmt.Errorf("invalid config file %s: %v", p, err)
+			}
+			config.Styles = fc.Styles
+			if err := validateFilters(fc.Filters); err != nil {
+				return config, fmt.Errorf("invalid config file %s: %v", p, err)
+			}
+			config.Filters = fc.Filters
+			if err := validateOrder(fc.Order); err != nil {
+				return config, fmt.Errorf("invalid config file %s: %v", p, err)
+			}
+			config.Order = fc.Order
+			if err := validateDestinations(fc.Destinations); err != nil {
+				return config, fmt.Errorf("invalid config file %s: %v", p, err)
+			}
+			config.Destinations = fc.Destinations
+			setPath(&config.RedactionReport, fc.RedactionReport, dir)
+			setPath(&config.DaemonStateFile, fc.Daemon.State, dir)
+			setPath(&config.DaemonLogDir, fc.Daemon.Logs, dir)
+			for _, job := range fc.Daemon.Jobs {
+				setPath(&job.Source, job.Source, dir)
+				config.DaemonJobs = append(config.DaemonJobs, job)
+			}
+		}
+	}
+
+	setPath(&config.CredentialsFile, os.Getenv("DOC2GDOC_CREDENTIALS"), "")
+	setPath(&config.TokenFile, os.Getenv("DOC2GDOC_TOKEN"), "")
+	setPath(&config.StateFile, os.Getenv("DOC2GDOC_STATE"), "")
+	setAuditLog(&config, os.Getenv("DOC2GDOC_AUDIT_LOG"), "")
+	if p := os.Getenv("DOC2GDOC_DEFAULT_PATH"); p != "" {
+		config.DefaultPath = p
+	}
+	if p := os.Getenv("DOC2GDOC_PROFILE"); p != "" {
+		config.Profile = p
+	}
+	if s := os.Getenv("DOC2GDOC_TOKEN_STORE"); s != "" {
+		config.TokenStorage = s
+	}
+	if u := os.Getenv("DOC2GDOC_WEBHOOK_URL"); u != "" {
+		config.WebhookURL = u
+	}
+	if s := os.Getenv("DOC2GDOC_WEBHOOK_SECRET"); s != "" {
+		config.WebhookSecret = s
+	}
+	if err := setRateOptions(&config, os.Getenv("DOC2GDOC_QPS"), os.Getenv("DOC2GDOC_BURST"), os.Getenv("DOC2GDOC_MAX_UPLOAD_RATE")); err != nil {
+		return config, err
+	}
+	setPath(&config.CACertFile, os.Getenv("DOC2GDOC_CA_CERT"), "")
+	if err := setHTTPOptions(&config, "", os.Getenv("DOC2GDOC_HTTP_TIMEOUT")); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// setRateOptions applies the qps, burst and upload rate values that are
+// not empty
+func setRateOptions(config *Config, qps string, burst string, uploadRate string) error {
+	for _, opt := range [][2]string{{"qps", qps}, {"burst", burst}, {"max-upload-rate", uploadRate}} {
+		if opt[1] == "" {
+			continue
+		}
+		if err := setRateOption(config, opt[0], opt[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setHTTPOptions applies the proxy and timeout values that are not empty
+func setHTTPOptions(config *Config, proxy string, timeout string) error {
+	for _, opt := range [][2]string{{"proxy", proxy}, {"http-timeout", timeout}} {
+		if opt[1] == "" {
+			continue
+		}
+		if err := setHTTPOption(config, opt[0], opt[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPath sets *dst to value if it is not empty, expanding a leading ~ and
+// resolving relative paths against dir
+func setPath(dst *string, value string, dir string) {
+	if value == "" {
+		return
+	}
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			value = filepath.Join(home, value[1:])
+		}
+	}
+	if dir != "" && !filepath.IsAbs(value) {
+		value = filepath.Join(dir, value)
+	}
+	*dst = value
+}
+
+// defaultAuditLogFile returns audit.jsonl in configDir
+func defaultAuditLogFile() string {
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "audit.jsonl")
+	}
+	return "audit.jsonl"
+}
+
+// setAuditLog sets the audit log file like setPath, "off" disabling it
+func setAuditLog(config *Config, value string, dir string) {
+	if value == "off" {
+		config.AuditLogFile = ""
+		return
+	}
+	setPath(&config.AuditLogFile, value, dir)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Strategies for -on-conflict, applied when a file with the same name and
+// type already exists in the target folder
+const (
+	// conflictSkip leaves the existing document untouched
+	conflictSkip = "skip"
+	// conflictOverwrite replaces the content of the existing document,
+	// keeping its ID and share links
+	conflictOverwrite = "overwrite"
+	// conflictRename creates a new document with a numbered name
+	conflictRename = "rename"
+	// conflictVersion keeps a copy of the existing document, then
+	// overwrites it
+	conflictVersion = "version"
+)
+
+// versionOfProperty marks the copy conflictVersion keeps of a document,
+// pointing at the document. Sync leaves such copies alone.
+const versionOfProperty = "version_of"
+
+// validateConflictStrategy checks an -on-conflict value; empty means always
+// create a new document
+func validateConflictStrategy(strategy string) error {
+	switch strategy {
+	case "", conflictSkip, conflictOverwrite, conflictRename, conflictVersion:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict strategy %q, expected skip, overwrite, rename or version", strategy)
+}
+
+// keepVersion copies a document next to itself before it is overwritten.
+// Drive never keeps revisions of Google Docs forever, and Markdown updates
+// rewrite the document, so the copy is the only lasting version.
+func keepVersion(ctx context.Context, svc *Services, existing *drive.File, name string, parentID string) error {
+	versionName := fmt.Sprintf("%s (version %s)", name, time.Now().Format("2006-01-02 15:04:05"))
+	res, err := svc.Files.CopyFile(ctx, existing.Id, &drive.File{
+		Name:          versionName,
+		Parents:       []string{parentID},
+		AppProperties: map[string]string{versionOfProperty: existing.Id},
+	}, "id")
+	if err != nil {
+		return fmt.Errorf("unable to keep a version of %s: %w", name, classifyAPIError(err))
+	}
+	fmt.Print(tr("Kept the previous version as %s (File ID: %s)\n", versionName, res.Id))
+	return nil
+}
+
+// findExistingFile looks for a file with the given name and type in a folder
+func findExistingFile(ctx context.Context, api DriveAPI, parentID string, name string, mimeType string) (*drive.File, error) {
+	query := buildQuery(
+		"name = "+quoteQuery(name),
+		"mimeType = "+quoteQuery(mimeType),
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
+
+	files, err := api.ListFiles(ctx, query, "id, name, appProperties", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search existing file: %v", err)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return files[0], nil
+}
+
+// uniqueName finds a free name in a folder by appending " (2)", " (3)", ...
+func uniqueName(ctx context.Context, api DriveAPI, parentID string, name string, mimeType string) (string, error) {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		existing, err := findExistingFile(ctx, api, parentID, candidate, mimeType)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+}
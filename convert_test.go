@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSource writes a local source file and returns its path
+func writeSource(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestConvertConflictStrategies(t *testing.T) {
+	tests := []struct {
+		onConflict string
+		status     string
+		sameDoc    bool
+		name       string
+		// content is what the first document holds afterwards
+		content string
+	}{
+		{onConflict: "", status: convertCreated, name: "notes", content: "first"},
+		{onConflict: conflictOverwrite, status: convertUpdated, sameDoc: true, name: "notes", content: "second"},
+		{onConflict: conflictSkip, status: convertSkipped, sameDoc: true, name: "notes", content: "first"},
+		{onConflict: conflictRename, status: convertCreated, name: "notes (2)", content: "first"},
+	}
+	for _, tt := range tests {
+		t.Run("on-conflict="+tt.onConflict, func(t *testing.T) {
+			ctx := context.Background()
+			fake := NewFakeDrive()
+			svc := newTestServices(t, fake)
+			dir := t.TempDir()
+			source := writeSource(t, dir, "notes.txt", "first")
+			opts := ConvertOptions{OnConflict: tt.onConflict}
+
+			first, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Status != convertCreated || first.Name != "notes" {
+				t.Fatalf("first conversion: %s %q, want created notes", first.Status, first.Name)
+			}
+
+			writeSource(t, dir, "notes.txt", "second")
+			again, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Status != tt.status || again.Name != tt.name {
+				t.Errorf("second conversion: %s %q, want %s %q", again.Status, again.Name, tt.status, tt.name)
+			}
+			if (again.FileID == first.FileID) != tt.sameDoc {
+				t.Errorf("second conversion went to %s, first was %s", again.FileID, first.FileID)
+			}
+			if got := string(fake.Content(first.FileID)); got != tt.content {
+				t.Errorf("first document holds %q, want %q", got, tt.content)
+			}
+			if !tt.sameDoc {
+				if got := string(fake.Content(again.FileID)); got != "second" {
+					t.Errorf("new document holds %q, want the changed file", got)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertSkipUnchangedUpdatesChangedFiles(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := newTestServices(t, fake)
+	source := writeSource(t, t.TempDir(), "notes.txt", "first")
+	opts := ConvertOptions{SkipUnchanged: true}
+
+	first, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Status != convertSkipped || again.FileID != first.FileID {
+		t.Errorf("unchanged rerun: %s %s, want skipped %s", again.Status, again.FileID, first.FileID)
+	}
+
+	writeSource(t, filepath.Dir(source), "notes.txt", "second")
+	changed, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Status != convertUpdated || changed.FileID != first.FileID {
+		t.Errorf("changed rerun: %s %s, want updated %s", changed.Status, changed.FileID, first.FileID)
+	}
+	if got := string(fake.Content(first.FileID)); got != "second" {
+		t.Errorf("document holds %q, want the changed file", got)
+	}
+}
+
+func TestConvertVersionKeepsCopy(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := newTestServices(t, fake)
+	dir := t.TempDir()
+	source := writeSource(t, dir, "notes.txt", "first")
+	opts := ConvertOptions{OnConflict: conflictVersion}
+
+	doc, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSource(t, dir, "notes.txt", "second")
+	updated, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.FileID != doc.FileID || string(fake.Content(doc.FileID)) != "second" {
+		t.Errorf("update went to %s holding %q, want %s with the new content", updated.FileID, fake.Content(doc.FileID), doc.FileID)
+	}
+
+	files, err := fake.ListFiles(ctx, "trashed = false", "id", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []string
+	for _, f := range files {
+		if f.AppProperties[versionOfProperty] == doc.FileID {
+			versions = append(versions, string(fake.Content(f.Id)))
+		}
+	}
+	if len(versions) != 1 || versions[0] != "first" {
+		t.Errorf("kept versions %q, want the first content", versions)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/sheets/v4"
+)
+
+// csvChunkRows is how many rows of a tab are written per Sheets request
+const csvChunkRows = 5000
+
+// tabsHashProperty is the appProperties key holding the hash of the files
+// written to the other tabs of a -tabs spreadsheet, see tabsSHA256
+const tabsHashProperty = "tabs_sha256"
+
+// CSVOptions controls how CSV and TSV sources are read into Sheets
+type CSVOptions struct {
+	// Delimiter separates fields (default: tab for .tsv, comma otherwise)
+	Delimiter string
+	// Encoding is the character set of the source, e.g. big5 or
+	// windows-1252 (default: UTF-8)
+	Encoding string
+	// Header bolds and freezes the first row
+	Header bool
+	// SheetName renames the first tab, which Drive names after the file
+	SheetName string
+}
+
+// isCSV reports whether path is a CSV or TSV file by its extension
+func isCSV(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".csv" || ext == ".tsv"
+}
+
+// validateCSVOptions checks the delimiter and encoding
+func validateCSVOptions(opts CSVOptions) error {
+	if _, err := parseDelimiter(opts.Delimiter, ""); err != nil {
+		return err
+	}
+	if opts.Encoding != "" {
+		if _, err := htmlindex.Get(opts.Encoding); err != nil {
+			return fmt.Errorf("unknown encoding %q, expected e.g. utf-8, big5, shift_jis or windows-1252", opts.Encoding)
+		}
+	}
+	return nil
+}
+
+// parseDelimiter returns the field delimiter for path: a single character,
+// or tab written as \t or "tab"
+func parseDelimiter(delimiter string, path string) (rune, error) {
+	switch delimiter {
+	case "":
+		if strings.EqualFold(filepath.Ext(path), ".tsv") {
+			return '\t', nil
+		}
+		return ',', nil
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter %q, expected a single character such as ; or \\t", delimiter)
+	}
+	return r, nil
+}
+
+// readCSV parses a CSV or TSV file with the delimiter and encoding of opts.
+// Rows may have different lengths.
+func readCSV(path string, opts CSVOptions) ([][]string, error) {
+	delimiter, err := parseDelimiter(opts.Delimiter, path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if opts.Encoding != "" {
+		enc, err := htmlindex.Get(opts.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("unknown encoding %q", opts.Encoding)
+		}
+		r = transform.NewReader(f, enc.NewDecoder())
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(b, []byte("\ufeff"))))
+	cr.Comma = delimiter
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return rows, nil
+}
+
+// normalizeCSV rewrites a source with another delimiter or encoding as UTF-8
+// CSV, which Drive imports, in a temporary directory. It returns the new
+// file and a cleanup function removing it.
+func normalizeCSV(path string, opts CSVOptions) (string, func(), error) {
+	rows, err := readCSV(path, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "doc2gdoc-csv-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create temporary directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	base := filepath.Base(path)
+	out := filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+".csv")
+	f, err := os.Create(out)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("unable to write CSV: %v", err)
+	}
+	w := csv.NewWriter(f)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("unable to write CSV: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("unable to write CSV: %v", err)
+	}
+	return out, cleanup, nil
+}
+
+// formatSheet renames the first tab of a spreadsheet and styles its header
+func formatSheet(ctx context.Context, srv *sheets.Service, spreadsheetID string, opts CSVOptions) error {
+	ss, err := srv.Spreadsheets.Get(spreadsheetID).Fields("sheets.properties").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read spreadsheet: %w", classifyAPIError(err))
+	}
+	if len(ss.Sheets) == 0 {
+		return nil
+	}
+	requests := sheetRequests(ss.Sheets[0].Properties.SheetId, opts.SheetName, opts.Header)
+	if len(requests) == 0 {
+		return nil
+	}
+	_, err = srv.Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).
+		Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to format spreadsheet: %w", classifyAPIError(err))
+	}
+	return nil
+}
+
+// sheetRequests renames a tab if title is set, and bolds and freezes its
+// first row if header is set
+func sheetRequests(sheetID int64, title string, header bool) []*sheets.Request {
+	var requests []*sheets.Request
+	if title != "" {
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Properties: &sheets.SheetProperties{SheetId: sheetID, Title: title},
+				Fields:     "title",
+			},
+		})
+	}
+	if header {
+		requests = append(requests,
+			&sheets.Request{
+				UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+					Properties: &sheets.SheetProperties{
+						SheetId:        sheetID,
+						GridProperties: &sheets.GridProperties{FrozenRowCount: 1},
+					},
+					Fields: "gridProperties.frozenRowCount",
+				},
+			},
+			&sheets.Request{
+				RepeatCell: &sheets.RepeatCellRequest{
+					Range: &sheets.GridRange{SheetId: sheetID, StartRowIndex: 0, EndRowIndex: 1},
+					Cell: &sheets.CellData{
+						UserEnteredFormat: &sheets.CellFormat{TextFormat: &sheets.TextFormat{Bold: true}},
+					},
+					Fields: "userEnteredFormat.textFormat.bold",
+				},
+			})
+	}
+	return requests
+}
+
+// convertCSVTabs converts several CSV or TSV files into one spreadsheet
+// named name, one tab per file. The first file creates or updates the
+// spreadsheet; the others are written to tabs named after them, replacing
+// the content of tabs that already exist.
+//
+// With -skip-unchanged the spreadsheet is left alone only if none of the
+// files changed. Updating the first file replaces the whole spreadsheet, so
+// any change rewrites every tab.
+func convertCSVTabs(ctx context.Context, svc *Services, config Config, files []string, drivePath string, name string, opts ConvertOptions) error {
+	for _, f := range files {
+		if !isCSV(f) {
+			return fmt.Errorf("-tabs needs CSV or TSV files, not %s", f)
+		}
+	}
+	titles := tabTitles(files)
+	tabsHash, err := tabsSHA256(files[1:], titles[1:])
+	if err != nil {
+		return err
+	}
+
+	first := opts
+	first.Title = name
+	first.Target = "sheet"
+	first.CSV.SheetName = titles[0]
+	start := time.Now()
+	result, err := convertToGoogleDocs(ctx, svc, files[0], drivePath, first)
+	write := err == nil && result.Status != convertSkipped
+	if err == nil && !write && opts.SkipUnchanged && opts.OnConflict != conflictSkip {
+		// The first file is unchanged, the other tabs may not be
+		var f *drive.File
+		f, err = svc.Files.GetFile(ctx, result.FileID, "appProperties")
+		if err != nil {
+			err = fmt.Errorf("unable to read spreadsheet: %w", classifyAPIError(err))
+		} else if f.AppProperties[tabsHashProperty] != tabsHash {
+			write = true
+			result.Status = convertUpdated
+		}
+	}
+	if write {
+		if opts.DryRun {
+			for i, f := range files[1:] {
+				fmt.Print(tr("[dry-run] add tab %s from %s\n", titles[i+1], f))
+			}
+		} else {
+			err = appendCSVTabs(ctx, svc.Sheets, result.FileID, files[1:], titles[1:], opts.CSV, opts.Filters)
+			if err == nil {
+				_, err = svc.Files.UpdateFile(ctx, result.FileID, &drive.File{AppProperties: map[string]string{tabsHashProperty: tabsHash}}, nil, UploadOptions{Fields: "id"})
+				if err != nil {
+					err = fmt.Errorf("unable to record the tabs of %s: %w", name, classifyAPIError(err))
+				}
+			}
+		}
+	}
+	if !opts.DryRun {
+		reportConversion(ctx, config, files[0], result, err, time.Since(start))
+	}
+	if err != nil {
+		return err
+	}
+	if !opts.DryRun && write {
+		fmt.Print(tr("Added %d tabs to %s\n", len(files)-1, name))
+	}
+	return nil
+}
+
+// tabsSHA256 hashes the files written to the other tabs along with their
+// titles, so renaming or reordering them counts as a change too
+func tabsSHA256(files []string, titles []string) (string, error) {
+	h := sha256.New()
+	for i, f := range files {
+		hash, err := localFileSHA256(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%s\n", titles[i], hash)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// appendCSVTabs writes each file into the tab of the same index in titles,
+// redacted by filters like an upload
+func appendCSVTabs(ctx context.Context, srv *sheets.Service, spreadsheetID string, files []string, titles []string, opts CSVOptions, filters []FilterRule) error {
+	ss, err := srv.Spreadsheets.Get(spreadsheetID).Fields("sheets.properties").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read spreadsheet: %w", classifyAPIError(err))
+	}
+	sheetIDs := map[string]int64{}
+	for _, s := range ss.Sheets {
+		sheetIDs[s.Properties.Title] = s.Properties.SheetId
+	}
+
+	for i, file := range files {
+		rows, err := readFilteredCSV(file, opts, filters)
+		if err != nil {
+			return err
+		}
+		title := titles[i]
+		a1 := "'" + strings.ReplaceAll(title, "'", "''") + "'"
+
+		sheetID, ok := sheetIDs[title]
+		if ok {
+			if _, err := srv.Spreadsheets.Values.Clear(spreadsheetID, a1, &sheets.ClearValuesRequest{}).Context(ctx).Do(); err != nil {
+				return fmt.Errorf("unable to clear tab %s: %w", title, classifyAPIError(err))
+			}
+		} else {
+			res, err := srv.Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+				Requests: []*sheets.Request{{
+					AddSheet: &sheets.AddSheetRequest{Properties: &sheets.SheetProperties{Title: title}},
+				}},
+			}).Context(ctx).Do()
+			if err != nil {
+				return fmt.Errorf("unable to add tab %s: %w", title, classifyAPIError(err))
+			}
+			sheetID = res.Replies[0].AddSheet.Properties.SheetId
+		}
+
+		for start := 0; start < len(rows); start += csvChunkRows {
+			chunk := rows[start:min(start+csvChunkRows, len(rows))]
+			values := make([][]interface{}, len(chunk))
+			for r, row := range chunk {
+				values[r] = make([]interface{}, len(row))
+				for c, cell := range row {
+					values[r][c] = cell
+				}
+			}
+			// USER_ENTERED parses numbers and dates like Drive's import does
+			_, err := srv.Spreadsheets.Values.Update(spreadsheetID, fmt.Sprintf("%s!A%d", a1, start+1), &sheets.ValueRange{Values: values}).
+				ValueInputOption("USER_ENTERED").
+				Context(ctx).
+				Do()
+			if err != nil {
+				return fmt.Errorf("unable to write tab %s: %w", title, classifyAPIError(err))
+			}
+		}
+
+		if requests := sheetRequests(sheetID, "", opts.Header); len(requests) > 0 {
+			_, err := srv.Spreadsheets.BatchUpdate(spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).
+				Context(ctx).Do()
+			if err != nil {
+				return fmt.Errorf("unable to format tab %s: %w", title, classifyAPIError(err))
+			}
+		}
+		logger.Info("Added tab", "tab", title, "file", file, "rows", len(rows))
+	}
+	return nil
+}
+
+// readFilteredCSV reads a CSV or TSV file after running filters over it.
+// As for an upload, they see the file as UTF-8, and a filter that fails
+// fails the tab rather than letting the unredacted rows through.
+func readFilteredCSV(file string, opts CSVOptions, filters []FilterRule) ([][]string, error) {
+	if len(filters) == 0 {
+		return readCSV(file, opts)
+	}
+	path := file
+	if opts.Delimiter != "" || opts.Encoding != "" {
+		out, cleanup, err := normalizeCSV(file, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		path = out
+		opts.Delimiter, opts.Encoding = "", ""
+	}
+	out, cleanup, err := applyFilters(path, file, filters)
+	if err != nil {
+		return nil, err
+	}
+	if out != "" {
+		defer cleanup()
+		path = out
+	}
+	return readCSV(path, opts)
+}
+
+// tabTitles names a tab after each file without its extension, replacing
+// characters Sheets doesn't allow in tab names and numbering duplicates
+func tabTitles(files []string) []string {
+	replacer := strings.NewReplacer("[", "(", "]", ")", "*", "_", "?", "_", "/", "_", "\\", "_", ":", "_")
+	seen := map[string]int{}
+	titles := make([]string, len(files))
+	for i, f := range files {
+		base := filepath.Base(f)
+		title := replacer.Replace(strings.TrimSuffix(base, filepath.Ext(base)))
+		if len([]rune(title)) > 90 {
+			title = string([]rune(title)[:90])
+		}
+		seen[strings.ToLower(title)]++
+		if n := seen[strings.ToLower(title)]; n > 1 {
+			title = fmt.Sprintf("%s (%d)", title, n)
+		}
+		titles[i] = title
+	}
+	return titles
+}
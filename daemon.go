@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Daemon job modes
+const (
+	// daemonSync mirrors the source directory like "doc2gdoc sync"
+	daemonSync = "sync"
+	// daemonConvert converts the files of the source directory or pattern,
+	// skipping unchanged ones
+	daemonConvert = "convert"
+)
+
+// daemonJobPattern limits job names, which also name their log files
+var daemonJobPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// DaemonJob is a recurring job from the daemon section of config.yaml
+type DaemonJob struct {
+	Name string `yaml:"name" json:"name"`
+	// Source is a local directory, or a file pattern for convert jobs
+	Source string `yaml:"source" json:"source"`
+	Path   string `yaml:"path" json:"path"`
+	// Schedule is a cron expression like "0 */6 * * *", or @hourly,
+	// @daily, @every 30m and the like
+	Schedule string `yaml:"schedule" json:"schedule"`
+	// Mode is sync (the default) or convert
+	Mode string `yaml:"mode" json:"mode"`
+	// Delete trashes remote documents whose source was removed, in sync mode
+	Delete bool `yaml:"delete" json:"delete"`
+}
+
+// daemonJobState is how the last run of a job went
+type daemonJobState struct {
+	LastRun  *time.Time    `json:"last_run,omitempty"`
+	Status   string        `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	NextRun  *time.Time    `json:"next_run,omitempty"`
+}
+
+// daemonState is what "doc2gdoc daemon status" reads, written by the daemon
+// after every run
+type daemonState struct {
+	PID       int                       `json:"pid"`
+	StartedAt time.Time                 `json:"started_at"`
+	Jobs      map[string]daemonJobState `json:"jobs"`
+}
+
+// runDaemonCommand implements "doc2gdoc daemon [-once] [job...]" and
+// "doc2gdoc daemon status"
+func runDaemonCommand(ctx context.Context, config Config, args []string) error {
+	if len(args) > 0 && args[0] == "status" {
+		return runDaemonStatus(config, args[1:])
+	}
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	once := flags.Bool("once", false, "Run the jobs once now and exit instead of waiting for their schedule")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc daemon [-once] [job...]\n       doc2gdoc daemon status [-json]\n\nJobs are defined in the daemon section of the config file.")
+		flags.PrintDefaults()
+	}
+	names, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+
+	jobs, schedules, err := daemonJobs(config, names)
+	if err != nil {
+		return err
+	}
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	// Redrawn progress bars and login prompts would only garble the job logs
+	progressEnabled = false
+	authPromptEnabled = false
+	if err := os.MkdirAll(config.DaemonLogDir, 0700); err != nil {
+		return fmt.Errorf("unable to create log directory: %v", err)
+	}
+
+	state := loadDaemonState(config.DaemonStateFile)
+	state.PID, state.StartedAt = os.Getpid(), time.Now().UTC()
+	if state.Jobs == nil {
+		state.Jobs = map[string]daemonJobState{}
+	}
+
+	if *once {
+		var failed int
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := runDaemonJob(ctx, svc, config, job, &state, time.Time{}); err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d job(s) failed, see the logs in %s", failed, config.DaemonLogDir)
+		}
+		return nil
+	}
+
+	next := map[string]time.Time{}
+	now := time.Now()
+	for _, job := range jobs {
+		next[job.Name] = schedules[job.Name].Next(now)
+	}
+	fmt.Print(tr("Running %d job(s), logs in %s\n", len(jobs), config.DaemonLogDir))
+	for {
+		// Jobs run one at a time; one that came due meanwhile runs next,
+		// once, however many of its runs were missed
+		var due *DaemonJob
+		for i, job := range jobs {
+			if due == nil || next[job.Name].Before(next[due.Name]) {
+				due = &jobs[i]
+			}
+		}
+		for _, job := range jobs {
+			js := state.Jobs[job.Name]
+			t := next[job.Name]
+			js.NextRun = &t
+			state.Jobs[job.Name] = js
+		}
+		if err := saveDaemonState(config.DaemonStateFile, state); err != nil {
+			logger.Warn("Unable to save daemon state", "err", err)
+		}
+
+		timer := time.NewTimer(time.Until(next[due.Name]))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		next[due.Name] = schedules[due.Name].Next(time.Now())
+		runDaemonJob(ctx, svc, config, *due, &state, next[due.Name])
+	}
+}
+
+// daemonJobs validates the configured jobs and parses their schedules.
+// names selects some of them.
+func daemonJobs(config Config, names []string) ([]DaemonJob, map[string]cron.Schedule, error) {
+	if len(config.DaemonJobs) == 0 {
+		return nil, nil, fmt.Errorf("no jobs in the daemon section of %s", configFilePath())
+	}
+	byName := map[string]DaemonJob{}
+	schedules := map[string]cron.Schedule{}
+	var jobs []DaemonJob
+	for _, job := range config.DaemonJobs {
+		if !daemonJobPattern.MatchString(job.Name) {
+			return nil, nil, fmt.Errorf("invalid daemon job name %q, use letters, digits, dots, dashes and underscores", job.Name)
+		}
+		if _, ok := byName[job.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate daemon job %s", job.Name)
+		}
+		if job.Source == "" {
+			return nil, nil, fmt.Errorf("daemon job %s has no source", job.Name)
+		}
+		switch job.Mode {
+		case "":
+			job.Mode = daemonSync
+		case daemonSync, daemonConvert:
+		default:
+			return nil, nil, fmt.Errorf("daemon job %s: unknown mode %q, expected sync or convert", job.Name, job.Mode)
+		}
+		if job.Path == "" {
+			job.Path = config.DefaultPath
+		}
+		schedule, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return nil, nil, fmt.Errorf("daemon job %s: invalid schedule %q: %v", job.Name, job.Schedule, err)
+		}
+		byName[job.Name], schedules[job.Name] = job, schedule
+		jobs = append(jobs, job)
+	}
+	if len(names) == 0 {
+		return jobs, schedules, nil
+	}
+	jobs = nil
+	for _, name := range names {
+		job, ok := byName[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("no daemon job %s", name)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, schedules, nil
+}
+
+// runDaemonJob runs a job with its output and diagnostics appended to its
+// log file, and records the outcome in state
+func runDaemonJob(ctx context.Context, svc *Services, config Config, job DaemonJob, state *daemonState, nextRun time.Time) error {
+	logFile, err := os.OpenFile(daemonLogPath(config, job.Name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		logger.Error("Unable to open job log", "job", job.Name, "err", err)
+		return err
+	}
+	defer logFile.Close()
+
+	start := time.Now()
+	fmt.Fprintf(logFile, "=== %s %s started\n", start.Format(time.RFC3339), job.Name)
+	logger.Info("Job started", "job", job.Name)
+
+	err = withJobOutput(logFile, func() error {
+		if job.Mode == daemonConvert {
+			return daemonConvertFiles(ctx, svc, config, job)
+		}
+		return syncDirectory(ctx, svc, job.Source, job.Path, SyncOptions{
+			Delete:    job.Delete,
+			StateFile: config.StateFile,
+			Filters:   config.Filters,
+		})
+	})
+
+	duration := time.Since(start).Round(time.Second)
+	js := daemonJobState{Status: "ok", Duration: duration}
+	js.LastRun = &start
+	if !nextRun.IsZero() {
+		js.NextRun = &nextRun
+	}
+	if err != nil {
+		js.Status, js.Error = "failed", err.Error()
+		fmt.Fprintf(logFile, "=== %s %s failed after %s: %v\n", time.Now().Format(time.RFC3339), job.Name, duration, err)
+		logger.Warn("Job failed", "job", job.Name, "err", err)
+	} else {
+		fmt.Fprintf(logFile, "=== %s %s finished after %s\n", time.Now().Format(time.RFC3339), job.Name, duration)
+		logger.Info("Job finished", "job", job.Name, "duration", duration)
+	}
+	state.Jobs[job.Name] = js
+	if err := saveDaemonState(config.DaemonStateFile, *state); err != nil {
+		logger.Warn("Unable to save daemon state", "err", err)
+	}
+	return err
+}
+
+// jobOutputMu serializes the jobs redirecting stdout and the logger
+var jobOutputMu sync.Mutex
+
+// withJobOutput runs fn with stdout and the logger writing to w, and
+// restores them when fn returns or panics. Jobs holding the redirection run
+// one at a time, so their output never interleaves.
+func withJobOutput(w *os.File, fn func() error) error {
+	jobOutputMu.Lock()
+	defer jobOutputMu.Unlock()
+	stdout, daemonLogger := os.Stdout, logger
+	defer func() { os.Stdout, logger = stdout, daemonLogger }()
+	os.Stdout = w
+	logger = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	return fn()
+}
+
+// daemonConvertFiles converts the files a convert job's source names: the
+// files directly in a directory, or those matching a pattern
+func daemonConvertFiles(ctx context.Context, svc *Services, config Config, job DaemonJob) error {
+	pattern := job.Source
+	if info, err := os.Stat(job.Source); err == nil && info.IsDir() {
+		pattern = filepath.Join(job.Source, "*")
+	}
+	files, err := expandFileArgs([]string{pattern})
+	if err != nil {
+		return err
+	}
+	return convertBatch(ctx, svc, config, nil, files, job.Path, ConvertOptions{
+		OnConflict:    conflictOverwrite,
+		SkipUnchanged: true,
+		StateFile:     config.StateFile,
+		Filters:       config.Filters,
+	})
+}
+
+// runDaemonStatus implements "doc2gdoc daemon status [-json]"
+func runDaemonStatus(config Config, args []string) error {
+	flags := flag.NewFlagSet("daemon status", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the status as JSON")
+	if _, err := parseInterspersed(flags, args); err != nil {
+		return err
+	}
+	state := loadDaemonState(config.DaemonStateFile)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(state)
+	}
+
+	if state.PID != 0 {
+		fmt.Print(tr("Daemon started %s (PID %d)\n\n", state.StartedAt.Local().Format("2006-01-02 15:04:05"), state.PID))
+	}
+	names := make([]string, 0, len(config.DaemonJobs))
+	schedules := map[string]string{}
+	for _, job := range config.DaemonJobs {
+		names = append(names, job.Name)
+		schedules[job.Name] = job.Schedule
+	}
+	for name := range state.Jobs {
+		if _, ok := schedules[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tSCHEDULE\tLAST RUN\tSTATUS\tDURATION\tNEXT RUN\tLOG")
+	for _, name := range names {
+		js := state.Jobs[name]
+		status := js.Status
+		if status == "" {
+			status = "never run"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, dash(schedules[name]), formatDaemonTime(js.LastRun),
+			status, dash(durationString(js.Duration)), formatDaemonTime(js.NextRun), daemonLogPath(config, name))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if js := state.Jobs[name]; js.Error != "" {
+			fmt.Printf("\n%s: %s\n", name, js.Error)
+		}
+	}
+	return nil
+}
+
+func formatDaemonTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// daemonLogPath is the log file of a job
+func daemonLogPath(config Config, name string) string {
+	return filepath.Join(config.DaemonLogDir, name+".log")
+}
+
+func loadDaemonState(stateFile string) daemonState {
+	var state daemonState
+	b, err := os.ReadFile(stateFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("Unable to read daemon state", "err", err)
+		}
+		return state
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		logger.Warn("Unable to parse daemon state", "file", stateFile, "err", err)
+	}
+	return state
+}
+
+func saveDaemonState(stateFile string, state daemonState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0700); err != nil {
+		return err
+	}
+	tmp := stateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, stateFile)
+}
+
+// defaultDaemonDir is the daemon directory in the config directory, holding
+// its state and job logs
+func defaultDaemonDir() string {
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "daemon")
+	}
+	return "daemon"
+}
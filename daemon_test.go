@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithJobOutputRestores(t *testing.T) {
+	stdout, daemonLogger := os.Stdout, logger
+	logFile, err := os.Create(filepath.Join(t.TempDir(), "job.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+
+	func() {
+		defer func() { recover() }()
+		withJobOutput(logFile, func() error {
+			logger.Info("inside the job")
+			panic("job panicked")
+		})
+	}()
+	if os.Stdout != stdout || logger != daemonLogger {
+		t.Error("stdout and the logger were not restored after a panic")
+	}
+	b, err := os.ReadFile(logFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "inside the job") {
+		t.Errorf("job log = %q, want the job's diagnostics", b)
+	}
+}
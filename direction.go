@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"unicode"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// Text direction settings for -direction
+const (
+	// directionAuto detects right-to-left documents from their text
+	directionAuto = "auto"
+	directionRTL  = "rtl"
+	directionLTR  = "ltr"
+)
+
+// rtlThreshold is the share of right-to-left letters above which a document
+// is treated as right-to-left
+const rtlThreshold = 0.3
+
+// validateDirection checks a -direction value; empty keeps the imported direction
+func validateDirection(direction string) error {
+	switch direction {
+	case "", directionAuto, directionRTL, directionLTR:
+		return nil
+	}
+	return fmt.Errorf("unknown direction %q, expected auto, rtl or ltr", direction)
+}
+
+// isRTLLetter reports whether r belongs to a right-to-left script
+func isRTLLetter(r rune) bool {
+	return unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko)
+}
+
+// isMostlyRTL reports whether most letters of text are right-to-left
+func isMostlyRTL(text string) bool {
+	var letters, rtl int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if isRTLLetter(r) {
+			rtl++
+		}
+	}
+	return letters > 0 && float64(rtl)/float64(letters) > rtlThreshold
+}
+
+// collectParagraphs returns every paragraph in the content, including those
+// inside table cells
+func collectParagraphs(content []*docs.StructuralElement) []*docs.StructuralElement {
+	var paragraphs []*docs.StructuralElement
+	for _, el := range content {
+		switch {
+		case el.Paragraph != nil:
+			paragraphs = append(paragraphs, el)
+		case el.Table != nil:
+			for _, row := range el.Table.TableRows {
+				for _, cell := range row.TableCells {
+					paragraphs = append(paragraphs, collectParagraphs(cell.Content)...)
+				}
+			}
+		}
+	}
+	return paragraphs
+}
+
+// paragraphText joins the text runs of a paragraph
+func paragraphText(p *docs.Paragraph) string {
+	var text string
+	for _, el := range p.Elements {
+		if el.TextRun != nil {
+			text += el.TextRun.Content
+		}
+	}
+	return text
+}
+
+// applyTextDirection sets the direction of every paragraph in a document,
+// which Drive's import frequently gets wrong for Hebrew and Arabic. With
+// directionAuto the document is only changed if it is mostly right-to-left.
+// Left or right alignment is reset to START so text follows the direction,
+// while centered and justified paragraphs keep their alignment.
+func applyTextDirection(ctx context.Context, srv *docs.Service, docID string, direction string) error {
+	doc, err := srv.Documents.Get(docID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read document: %v", err)
+	}
+	paragraphs := collectParagraphs(doc.Body.Content)
+
+	if direction == directionAuto {
+		var text string
+		for _, el := range paragraphs {
+			text += paragraphText(el.Paragraph)
+		}
+		if !isMostlyRTL(text) {
+			return nil
+		}
+		direction = directionRTL
+		logger.Info("Detected right-to-left text")
+	}
+
+	style := &docs.ParagraphStyle{Direction: "LEFT_TO_RIGHT", Alignment: "START"}
+	if direction == directionRTL {
+		style.Direction = "RIGHT_TO_LEFT"
+	}
+
+	var requests []*docs.Request
+	for _, el := range paragraphs {
+		fields := "direction"
+		if a := el.Paragraph.ParagraphStyle.Alignment; a != "CENTER" && a != "JUSTIFIED" {
+			fields += ",alignment"
+		}
+		requests = append(requests, &docs.Request{
+			UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+				Range:          &docs.Range{StartIndex: el.StartIndex, EndIndex: el.EndIndex},
+				ParagraphStyle: style,
+				Fields:         fields,
+			},
+		})
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	_, err = srv.Documents.BatchUpdate(docID, &docs.BatchUpdateDocumentRequest{Requests: requests}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to set text direction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf16"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// codeFontFamily is the monospace font used for inline code and code blocks
+const codeFontFamily = "Courier New"
+
+// docWriter appends formatted content to the end of a Google Doc body.
+// Requests are buffered and sent in batches; indices are UTF-16 offsets
+// as required by the Docs API.
+type docWriter struct {
+	ctx      context.Context
+	srv      *docs.Service
+	docID    string
+	index    int64
+	requests []*docs.Request
+	// styles maps Markdown elements to fonts and named styles; block is the
+	// rule of the block being written
+	styles map[string]StyleRule
+	block  StyleRule
+}
+
+func newDocWriter(ctx context.Context, srv *docs.Service, docID string, styles map[string]StyleRule) (*docWriter, error) {
+	w := &docWriter{ctx: ctx, srv: srv, docID: docID, styles: styles}
+	if err := w.sync(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int64 {
+	return int64(len(utf16.Encode([]rune(s))))
+}
+
+// flush sends buffered requests
+func (w *docWriter) flush() error {
+	if len(w.requests) == 0 {
+		return nil
+	}
+	_, err := w.srv.Documents.BatchUpdate(w.docID, &docs.BatchUpdateDocumentRequest{
+		Requests: w.requests,
+	}).Context(w.ctx).Do()
+	w.requests = nil
+	if err != nil {
+		return fmt.Errorf("unable to update document: %w", classifyAPIError(err))
+	}
+	return nil
+}
+
+// sync flushes pending requests and re-reads the insertion index, which is
+// needed after requests that shift content in ways we don't track (bullets
+// removing leading tabs, tables)
+func (w *docWriter) sync() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	doc, err := w.srv.Documents.Get(w.docID).Context(w.ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read document: %v", err)
+	}
+	content := doc.Body.Content
+	// Insert before the trailing newline of the last paragraph
+	w.index = content[len(content)-1].EndIndex - 1
+	return nil
+}
+
+// clear deletes all body content, leaving the final empty paragraph
+func (w *docWriter) clear() error {
+	if w.index > 1 {
+		w.requests = append(w.requests, &docs.Request{
+			DeleteContentRange: &docs.DeleteContentRangeRequest{
+				Range: &docs.Range{StartIndex: 1, EndIndex: w.index},
+			},
+		})
+	}
+	return w.sync()
+}
+
+// insertText inserts text at the current index and returns its range
+func (w *docWriter) insertText(text string) (int64, int64) {
+	start := w.index
+	w.requests = append(w.requests, &docs.Request{
+		InsertText: &docs.InsertTextRequest{
+			Location: &docs.Location{Index: start},
+			Text:     text,
+		},
+	})
+	w.index += utf16Len(text)
+	return start, w.index
+}
+
+// insertRuns inserts formatted runs at the current index. Every run gets an
+// explicit text style, since inserted text otherwise inherits the style of
+// the text before it.
+func (w *docWriter) insertRuns(runs []mdRun) {
+	for _, r := range runs {
+		if r.Text == "" {
+			continue
+		}
+		start, end := w.insertText(r.Text)
+		w.styleText(start, end, w.textStyleForRun(r))
+	}
+}
+
+func (w *docWriter) textStyleForRun(r mdRun) *docs.TextStyle {
+	style := &docs.TextStyle{Bold: r.Bold, Italic: r.Italic}
+	w.block.apply(style)
+	if r.Link != "" {
+		style.Link = &docs.Link{Url: r.Link}
+	}
+	if r.Code {
+		code := w.styles["inline_code"]
+		style.WeightedFontFamily = &docs.WeightedFontFamily{FontFamily: codeFontFamily}
+		code.apply(style)
+		style.BackgroundColor, _ = parseHexColor(code.Background)
+	}
+	return style
+}
+
+func (w *docWriter) styleText(start, end int64, style *docs.TextStyle) {
+	w.requests = append(w.requests, &docs.Request{
+		UpdateTextStyle: &docs.UpdateTextStyleRequest{
+			Range:     &docs.Range{StartIndex: start, EndIndex: end},
+			TextStyle: style,
+			Fields:    "bold,italic,link,weightedFontFamily,fontSize,foregroundColor,backgroundColor",
+		},
+	})
+}
+
+func (w *docWriter) styleParagraph(start, end int64, style *docs.ParagraphStyle, fields string) {
+	w.requests = append(w.requests, &docs.Request{
+		UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+			Range:          &docs.Range{StartIndex: start, EndIndex: end},
+			ParagraphStyle: style,
+			Fields:         fields,
+		},
+	})
+}
+
+// paragraph appends a paragraph with the given named style
+func (w *docWriter) paragraph(runs []mdRun, namedStyle string) (int64, int64) {
+	start := w.index
+	w.insertRuns(runs)
+	w.insertText("\n")
+	w.styleParagraph(start, w.index, &docs.ParagraphStyle{NamedStyleType: namedStyle}, "namedStyleType")
+	return start, w.index
+}
+
+// list appends consecutive list items as one bulleted or numbered list
+func (w *docWriter) list(items []mdBlock) error {
+	start := w.index
+	for _, item := range items {
+		// Leading tabs set the nesting level and are removed by the API
+		for i := 0; i < item.Level; i++ {
+			w.insertText("\t")
+		}
+		w.insertRuns(parseInline(item.Text))
+		w.insertText("\n")
+	}
+	w.styleParagraph(start, w.index, &docs.ParagraphStyle{NamedStyleType: w.block.namedStyle("NORMAL_TEXT")}, "namedStyleType")
+	w.shade(start, w.index)
+
+	preset := "BULLET_DISC_CIRCLE_SQUARE"
+	if items[0].Ordered {
+		preset = "NUMBERED_DECIMAL_ALPHA_ROMAN"
+	}
+	w.requests = append(w.requests, &docs.Request{
+		CreateParagraphBullets: &docs.CreateParagraphBulletsRequest{
+			Range:        &docs.Range{StartIndex: start, EndIndex: w.index},
+			BulletPreset: preset,
+		},
+	})
+	return w.sync()
+}
+
+// shade sets the background of the current block's rule on its paragraphs
+func (w *docWriter) shade(start, end int64) {
+	if shading := w.block.shading(); shading != nil {
+		w.styleParagraph(start, end, &docs.ParagraphStyle{Shading: shading}, "shading")
+	}
+}
+
+// codeBlock appends preformatted text in a monospace font on a shaded
+// background, unless the code style sets others
+func (w *docWriter) codeBlock(code string) {
+	start := w.index
+	w.insertText(code + "\n")
+	style := &docs.TextStyle{
+		WeightedFontFamily: &docs.WeightedFontFamily{FontFamily: codeFontFamily},
+	}
+	w.block.apply(style)
+	w.styleText(start, w.index, style)
+	shading := w.block.shading()
+	if shading == nil {
+		shading = &docs.Shading{
+			BackgroundColor: &docs.OptionalColor{
+				Color: &docs.Color{RgbColor: &docs.RgbColor{Red: 0.95, Green: 0.95, Blue: 0.95}},
+			},
+		}
+	}
+	w.styleParagraph(start, w.index, &docs.ParagraphStyle{
+		NamedStyleType: w.block.namedStyle("NORMAL_TEXT"),
+		Shading:        shading,
+	}, "namedStyleType,shading")
+}
+
+// rule appends an empty paragraph with a bottom border, since the Docs API
+// cannot insert horizontal rules
+func (w *docWriter) rule() {
+	start := w.index
+	w.insertText("\n")
+	w.styleParagraph(start, w.index, &docs.ParagraphStyle{
+		NamedStyleType: "NORMAL_TEXT",
+		BorderBottom: &docs.ParagraphBorder{
+			Width:     &docs.Dimension{Magnitude: 1, Unit: "PT"},
+			DashStyle: "SOLID",
+			Padding:   &docs.Dimension{Magnitude: 1, Unit: "PT"},
+			Color: &docs.OptionalColor{
+				Color: &docs.Color{RgbColor: &docs.RgbColor{Red: 0.6, Green: 0.6, Blue: 0.6}},
+			},
+		},
+	}, "namedStyleType,borderBottom")
+}
+
+// table appends a table; the first row is rendered bold as a header
+func (w *docWriter) table(rows [][]string) error {
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	w.requests = append(w.requests, &docs.Request{
+		InsertTable: &docs.InsertTableRequest{
+			Rows:                 int64(len(rows)),
+			Columns:              int64(columns),
+			EndOfSegmentLocation: &docs.EndOfSegmentLocation{},
+		},
+	})
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	doc, err := w.srv.Documents.Get(w.docID).Context(w.ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read document: %v", err)
+	}
+	var table *docs.Table
+	for _, el := range doc.Body.Content {
+		if el.Table != nil {
+			table = el.Table
+		}
+	}
+	if table == nil {
+		return fmt.Errorf("inserted table not found in document")
+	}
+
+	// Fill cells back to front so earlier indices stay valid
+	for r := len(rows) - 1; r >= 0; r-- {
+		for c := len(rows[r]) - 1; c >= 0; c-- {
+			runs := parseInline(rows[r][c])
+			if r == 0 {
+				for i := range runs {
+					runs[i].Bold = true
+				}
+			}
+			w.index = table.TableRows[r].TableCells[c].Content[0].StartIndex
+			w.insertRuns(runs)
+		}
+	}
+	return w.sync()
+}
+
+// writeMarkdown renders parsed Markdown blocks into the document, styled by
+// the writer's styles
+func (w *docWriter) writeMarkdown(blocks []mdBlock) error {
+	defer func() { w.block = StyleRule{} }()
+	for i := 0; i < len(blocks); i++ {
+		b := blocks[i]
+		w.block = w.styles[styleElement(b)]
+		switch b.Kind {
+		case mdHeading:
+			start, end := w.paragraph(parseInline(b.Text), w.block.namedStyle(fmt.Sprintf("HEADING_%d", b.Level)))
+			w.shade(start, end)
+		case mdParagraph:
+			start, end := w.paragraph(parseInline(b.Text), w.block.namedStyle("NORMAL_TEXT"))
+			w.shade(start, end)
+		case mdQuote:
+			start, end := w.paragraph(parseInline(b.Text), w.block.namedStyle("NORMAL_TEXT"))
+			w.shade(start, end)
+			w.styleParagraph(start, end, &docs.ParagraphStyle{
+				IndentStart:     &docs.Dimension{Magnitude: 36, Unit: "PT"},
+				IndentFirstLine: &docs.Dimension{Magnitude: 36, Unit: "PT"},
+			}, "indentStart,indentFirstLine")
+		case mdCode:
+			w.codeBlock(b.Text)
+		case mdRule:
+			w.rule()
+		case mdListItem:
+			// Group items into one list until a top-level item switches between
+			// bullets and numbers
+			j := i + 1
+			for j < len(blocks) && blocks[j].Kind == mdListItem && (blocks[j].Level > 0 || blocks[j].Ordered == b.Ordered) {
+				j++
+			}
+			if err := w.list(blocks[i:j]); err != nil {
+				return err
+			}
+			i = j - 1
+		case mdTable:
+			if err := w.table(b.Rows); err != nil {
+				return err
+			}
+		}
+	}
+	return w.flush()
+}
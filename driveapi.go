@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// DriveAPI is the part of the Drive API that doc2gdoc uses for files.
+// driveAdapter implements it with *drive.Service, and the tests' FakeDrive
+// keeps files in memory so that logic can run offline.
+type DriveAPI interface {
+	// CreateFile creates file, uploading media as its content if not nil
+	CreateFile(ctx context.Context, file *drive.File, media io.Reader, opts UploadOptions) (*drive.File, error)
+	// UpdateFile updates the metadata set in file, and the content if media
+	// is not nil
+	UpdateFile(ctx context.Context, fileID string, file *drive.File, media io.Reader, opts UploadOptions) (*drive.File, error)
+	DeleteFile(ctx context.Context, fileID string) error
+	// GetFile returns the selected fields of a file, e.g. "id, name"
+	GetFile(ctx context.Context, fileID string, fields string) (*drive.File, error)
+	// CopyFile copies a file, with the metadata set in file changed
+	CopyFile(ctx context.Context, fileID string, file *drive.File, fields string) (*drive.File, error)
+	// CreatePermission shares a file
+	CreatePermission(ctx context.Context, fileID string, perm *drive.Permission) error
+	// ListFiles returns the files matching a query built with buildQuery.
+	// fields selects the fields of each file, e.g. "id, name".
+	ListFiles(ctx context.Context, query string, fields string, pageSize int64, maxResults int) ([]*drive.File, error)
+	// Export downloads a Google Workspace file converted to mimeType
+	Export(ctx context.Context, fileID string, mimeType string) (io.ReadCloser, error)
+	// SharedDrives returns the shared drive with ID nameOrID, or else the
+	// shared drives named nameOrID
+	SharedDrives(ctx context.Context, nameOrID string) ([]*drive.Drive, error)
+}
+
+// UploadOptions are the optional settings of CreateFile and UpdateFile
+type UploadOptions struct {
+	// MediaType is the content type of the media, detected if empty
+	MediaType string
+	// Fields selects the fields of the returned file
+	Fields string
+	// OCRLanguage hints the language of text recognized in images and PDFs
+	OCRLanguage string
+	// Progress is called as a resumable upload proceeds
+	Progress googleapi.ProgressUpdater
+	// AddParents and RemoveParents move the file in UpdateFile; each is a
+	// comma-separated list of folder IDs
+	AddParents    string
+	RemoveParents string
+}
+
+// driveAdapter implements DriveAPI with the Drive API, searching and
+// writing across shared drives
+type driveAdapter struct {
+	srv *drive.Service
+	// upload throttles media uploads when set
+	upload *uploadThrottle
+	// audit records the creations, updates and deletions
+	audit *auditor
+}
+
+func (a driveAdapter) CreateFile(ctx context.Context, file *drive.File, media io.Reader, opts UploadOptions) (*drive.File, error) {
+	call := a.srv.Files.Create(file).SupportsAllDrives(true).Context(ctx)
+	if media != nil {
+		call = call.Media(a.upload.reader(ctx, media), googleapi.ContentType(opts.MediaType)).ProgressUpdater(opts.Progress)
+	}
+	if opts.OCRLanguage != "" {
+		call = call.OcrLanguage(opts.OCRLanguage)
+	}
+	if opts.Fields != "" {
+		call = call.Fields(googleapi.Field(opts.Fields))
+	}
+	res, err := call.Do()
+	a.audit.record(ctx, auditCreate, copyID(res), file.Name, err)
+	return res, err
+}
+
+func (a driveAdapter) UpdateFile(ctx context.Context, fileID string, file *drive.File, media io.Reader, opts UploadOptions) (*drive.File, error) {
+	call := a.srv.Files.Update(fileID, file).SupportsAllDrives(true).Context(ctx)
+	if media != nil {
+		call = call.Media(a.upload.reader(ctx, media), googleapi.ContentType(opts.MediaType)).ProgressUpdater(opts.Progress)
+	}
+	if opts.OCRLanguage != "" {
+		call = call.OcrLanguage(opts.OCRLanguage)
+	}
+	if opts.Fields != "" {
+		call = call.Fields(googleapi.Field(opts.Fields))
+	}
+	if opts.AddParents != "" {
+		call = call.AddParents(opts.AddParents)
+	}
+	if opts.RemoveParents != "" {
+		call = call.RemoveParents(opts.RemoveParents)
+	}
+	res, err := call.Do()
+	action := auditUpdate
+	switch {
+	case file.Trashed:
+		action = auditTrash
+	case opts.AddParents != "":
+		action = auditMove
+	}
+	a.audit.record(ctx, action, fileID, file.Name, err)
+	return res, err
+}
+
+// GenerateIDs reserves IDs for files created later
+func (a driveAdapter) GenerateIDs(ctx context.Context, count int64) ([]string, error) {
+	res, err := a.srv.Files.GenerateIds().Count(count).Space("drive").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return res.Ids, nil
+}
+
+func (a driveAdapter) DeleteFile(ctx context.Context, fileID string) error {
+	err := a.srv.Files.Delete(fileID).SupportsAllDrives(true).Context(ctx).Do()
+	a.audit.record(ctx, auditDelete, fileID, "", err)
+	return err
+}
+
+func (a driveAdapter) GetFile(ctx context.Context, fileID string, fields string) (*drive.File, error) {
+	return a.srv.Files.Get(fileID).Fields(googleapi.Field(fields)).SupportsAllDrives(true).Context(ctx).Do()
+}
+
+func (a driveAdapter) CopyFile(ctx context.Context, fileID string, file *drive.File, fields string) (*drive.File, error) {
+	call := a.srv.Files.Copy(fileID, file).SupportsAllDrives(true).Context(ctx)
+	if fields != "" {
+		call = call.Fields(googleapi.Field(fields))
+	}
+	res, err := call.Do()
+	a.audit.record(ctx, auditCopy, copyID(res), file.Name, err)
+	return res, err
+}
+
+func (a driveAdapter) CreatePermission(ctx context.Context, fileID string, perm *drive.Permission) error {
+	_, err := a.srv.Permissions.Create(fileID, perm).SupportsAllDrives(true).Context(ctx).Do()
+	who := perm.EmailAddress
+	if perm.Type == "anyone" {
+		who = "anyone"
+	}
+	a.audit.record(ctx, auditShare, fileID, who+":"+perm.Role, err)
+	return err
+}
+
+func (a driveAdapter) ListFiles(ctx context.Context, query string, fields string, pageSize int64, maxResults int) ([]*drive.File, error) {
+	call := filesList(a.srv, query).Fields(googleapi.Field("nextPageToken, files(" + fields + ")"))
+	return listAllFiles(ctx, call, pageSize, maxResults)
+}
+
+func (a driveAdapter) Export(ctx context.Context, fileID string, mimeType string) (io.ReadCloser, error) {
+	resp, err := a.srv.Files.Export(fileID, mimeType).Context(ctx).Download()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (a driveAdapter) SharedDrives(ctx context.Context, nameOrID string) ([]*drive.Drive, error) {
+	if d, err := a.srv.Drives.Get(nameOrID).Fields("id").Context(ctx).Do(); err == nil {
+		return []*drive.Drive{d}, nil
+	}
+
+	var drives []*drive.Drive
+	err := a.srv.Drives.List().
+		Q("name = "+quoteQuery(nameOrID)).
+		Fields("nextPageToken, drives(id, name)").
+		Pages(ctx, func(page *drive.DriveList) error {
+			drives = append(drives, page.Drives...)
+			return nil
+		})
+	return drives, err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestMoveDriveFile(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := &Services{Files: fake}
+
+	from, err := fake.CreateFile(ctx, &drive.File{Name: "from", MimeType: folderMimeType}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := fake.CreateFile(ctx, &drive.File{Name: "to", MimeType: folderMimeType}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := fake.CreateFile(ctx, &drive.File{Name: "notes", Parents: []string{from.Id}}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveDriveFile(ctx, svc, doc, "renamed", to.Id); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := fake.GetFile(ctx, doc.Id, "name, parents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Name != "renamed" || !slices.Equal(moved.Parents, []string{to.Id}) {
+		t.Errorf("moved to %q in %q, want renamed in [%s]", moved.Name, moved.Parents, to.Id)
+	}
+}
+
+func TestShareFile(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := &Services{Files: fake}
+
+	doc, err := fake.CreateFile(ctx, &drive.File{Name: "notes"}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares := []Share{{Email: "ann@example.com", Role: "writer"}}
+	if err := shareFile(ctx, svc, doc.Id, shares, "reader"); err != nil {
+		t.Fatal(err)
+	}
+
+	perms := fake.Permissions(doc.Id)
+	if len(perms) != 2 {
+		t.Fatalf("created %d permissions, want 2", len(perms))
+	}
+	if p := perms[0]; p.Type != "user" || p.EmailAddress != "ann@example.com" || p.Role != "writer" {
+		t.Errorf("first permission = %+v, want ann@example.com as writer", p)
+	}
+	if p := perms[1]; p.Type != "anyone" || p.Role != "reader" {
+		t.Errorf("second permission = %+v, want anyone as reader", p)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	for _, name := range []string{"notes", "notes (2)"} {
+		if _, err := fake.CreateFile(ctx, &drive.File{Name: name, MimeType: docMimeType}, nil, UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A file of another type does not take the name
+	if _, err := fake.CreateFile(ctx, &drive.File{Name: "notes (3)", MimeType: sheetMimeType}, nil, UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err := findExistingFile(ctx, fake, "root", "notes", docMimeType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing == nil || existing.Name != "notes" {
+		t.Errorf("findExistingFile = %v, want notes", existing)
+	}
+	name, err := uniqueName(ctx, fake, "root", "notes", docMimeType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "notes (3)" {
+		t.Errorf("uniqueName = %q, want notes (3)", name)
+	}
+}
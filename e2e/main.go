@@ -0,0 +1,261 @@
+//go:build e2e
+
+// Command e2e runs doc2gdoc against the real Drive API. It converts fixtures
+// into a disposable folder, checks the resulting folders and exported
+// content, and deletes the folder afterwards.
+//
+//	DOC2GDOC_E2E_CREDENTIALS=credentials.json DOC2GDOC_E2E_TOKEN=token.json make e2e
+//
+// The token must already exist, e.g. from a normal doc2gdoc run.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+const (
+	folderMimeType = "application/vnd.google-apps.folder"
+	docMimeType    = "application/vnd.google-apps.document"
+	sheetMimeType  = "application/vnd.google-apps.spreadsheet"
+)
+
+// queryEscaper and quoteQuery are copies of the tool's, which this separate
+// command cannot import
+var queryEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// quoteQuery quotes a value for a Drive search query
+func quoteQuery(value string) string {
+	return "'" + queryEscaper.Replace(value) + "'"
+}
+
+// fixtures are written to a temporary directory before the run
+var fixtures = map[string]string{
+	"notes.md":         "# Release notes\n\nSome **bold** text.\n\n- first\n- second\n\n| Name | Value |\n|------|-------|\n| a | 1 |\n",
+	"data.csv":         "name,value\nalpha,1\nbeta,2\n",
+	"sync/one.md":      "# One\n",
+	"sync/sub/two.txt": "Two\n",
+}
+
+type harness struct {
+	ctx      context.Context
+	srv      *drive.Service
+	work     string
+	bin      string
+	creds    string
+	token    string
+	rootName string
+	failures int
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run executes the checks and returns the exit code
+func run() int {
+	keep := flag.Bool("keep", false, "Keep the test folder instead of deleting it")
+	flag.Parse()
+
+	creds := os.Getenv("DOC2GDOC_E2E_CREDENTIALS")
+	token := os.Getenv("DOC2GDOC_E2E_TOKEN")
+	if creds == "" || token == "" {
+		log.Fatal("DOC2GDOC_E2E_CREDENTIALS and DOC2GDOC_E2E_TOKEN must be set")
+	}
+	creds, _ = filepath.Abs(creds)
+	token, _ = filepath.Abs(token)
+
+	ctx := context.Background()
+	srv, err := newDriveService(ctx, creds, token)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	work, err := os.MkdirTemp("", "doc2gdoc-e2e")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(work)
+
+	h := &harness{
+		ctx:      ctx,
+		work:     work,
+		srv:      srv,
+		bin:      filepath.Join(work, "doc2gdoc"),
+		creds:    creds,
+		token:    token,
+		rootName: fmt.Sprintf("doc2gdoc-e2e-%d", time.Now().Unix()),
+	}
+	if out, err := exec.Command("go", "build", "-o", h.bin, ".").CombinedOutput(); err != nil {
+		log.Fatalf("unable to build doc2gdoc: %v\n%s", err, out)
+	}
+	src := filepath.Join(work, "src")
+	for name, content := range fixtures {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Printf("Using test folder %s\n", h.rootName)
+	defer func() {
+		if *keep {
+			fmt.Printf("Kept test folder %s\n", h.rootName)
+			return
+		}
+		h.cleanup()
+	}()
+
+	h.doc2gdoc("convert markdown", "-path", "/"+h.rootName+"/nested/deeper", filepath.Join(src, "notes.md"))
+	h.doc2gdoc("convert csv", "-path", "/"+h.rootName+"/sheets", filepath.Join(src, "data.csv"))
+	h.doc2gdoc("sync", "sync", filepath.Join(src, "sync"), "-path", "/"+h.rootName+"/synced")
+
+	// Converted and synced documents are named without the extension
+	if f := h.find(docMimeType, h.rootName, "nested", "deeper", "notes"); f != nil {
+		h.expectExport(f, "text/plain", "Release notes", "bold", "first", "Value")
+	}
+	if f := h.find(sheetMimeType, h.rootName, "sheets", "data"); f != nil {
+		h.expectExport(f, "text/csv", "alpha,1", "beta,2")
+	}
+	h.find(docMimeType, h.rootName, "synced", "one")
+	h.find(docMimeType, h.rootName, "synced", "sub", "two")
+
+	if h.failures > 0 {
+		fmt.Printf("FAIL: %d check(s) failed\n", h.failures)
+		return 1
+	}
+	fmt.Println("PASS")
+	return 0
+}
+
+// newDriveService authorizes with an existing token; the harness never
+// starts the interactive flow
+func newDriveService(ctx context.Context, credsFile, tokenFile string) (*drive.Service, error) {
+	b, err := os.ReadFile(credsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials: %v", err)
+	}
+	config, err := google.ConfigFromJSON(b, drive.DriveFileScope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+	}
+	f, err := os.Open(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token: %v", err)
+	}
+	defer f.Close()
+	tok := &oauth2.Token{}
+	if err := json.NewDecoder(f).Decode(tok); err != nil {
+		return nil, fmt.Errorf("unable to parse token: %v", err)
+	}
+	return drive.NewService(ctx, option.WithHTTPClient(config.Client(ctx, tok)))
+}
+
+// doc2gdoc runs the built binary with the test credentials
+func (h *harness) doc2gdoc(name string, args ...string) {
+	cmd := exec.Command(h.bin, args...)
+	// Run in the scratch directory with an empty config directory, so local
+	// registry, queue and config files are neither used nor touched
+	cmd.Dir = h.work
+	cmd.Env = append(os.Environ(),
+		"DOC2GDOC_CREDENTIALS="+h.creds,
+		"DOC2GDOC_TOKEN="+h.token,
+		"XDG_CONFIG_HOME="+filepath.Join(h.work, "config"),
+		"DOC2GDOC_CONFIG=",
+		"DOC2GDOC_PROFILE=",
+		"DOC2GDOC_TOKEN_STORE=",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		h.fail("%s: %v\n%s", name, err, out)
+		return
+	}
+	fmt.Printf("ok   %s\n", name)
+}
+
+// find walks a folder path from My Drive and returns the final file if it
+// has the expected type
+func (h *harness) find(mimeType string, names ...string) *drive.File {
+	parent := "root"
+	var file *drive.File
+	for i, name := range names {
+		want := folderMimeType
+		if i == len(names)-1 {
+			want = mimeType
+		}
+		q := fmt.Sprintf("name = %s and %s in parents and mimeType = %s and trashed = false",
+			quoteQuery(name), quoteQuery(parent), quoteQuery(want))
+		res, err := h.srv.Files.List().Q(q).Fields("files(id, name, mimeType)").Context(h.ctx).Do()
+		if err != nil {
+			h.fail("list %s: %v", name, err)
+			return nil
+		}
+		if len(res.Files) != 1 {
+			h.fail("expected one %s named %s under %s, found %d", want, name, strings.Join(names[:i], "/"), len(res.Files))
+			return nil
+		}
+		file = res.Files[0]
+		parent = file.Id
+	}
+	fmt.Printf("ok   found %s\n", strings.Join(names, "/"))
+	return file
+}
+
+// expectExport exports a file and checks that it contains every snippet
+func (h *harness) expectExport(f *drive.File, mimeType string, snippets ...string) {
+	resp, err := h.srv.Files.Export(f.Id, mimeType).Context(h.ctx).Download()
+	if err != nil {
+		h.fail("export %s: %v", f.Name, err)
+		return
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.fail("export %s: %v", f.Name, err)
+		return
+	}
+	for _, s := range snippets {
+		if !strings.Contains(string(b), s) {
+			h.fail("export of %s does not contain %q:\n%s", f.Name, s, b)
+			return
+		}
+	}
+	fmt.Printf("ok   content of %s\n", f.Name)
+}
+
+func (h *harness) fail(format string, args ...any) {
+	h.failures++
+	fmt.Printf("FAIL "+format+"\n", args...)
+}
+
+// cleanup permanently deletes the test folder and everything in it
+func (h *harness) cleanup() {
+	q := fmt.Sprintf("name = %s and 'root' in parents and mimeType = %s", quoteQuery(h.rootName), quoteQuery(folderMimeType))
+	res, err := h.srv.Files.List().Q(q).Fields("files(id)").Context(h.ctx).Do()
+	if err != nil {
+		fmt.Printf("Warning: unable to find test folder for cleanup: %v\n", err)
+		return
+	}
+	for _, f := range res.Files {
+		if err := h.srv.Files.Delete(f.Id).Context(h.ctx).Do(); err != nil {
+			fmt.Printf("Warning: unable to delete test folder %s: %v\n", f.Id, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Errors for common failure modes, matched with errors.Is. They are wrapped
+// with the details of the failure.
+var (
+	// ErrCredentialsMissing means there is neither a credentials file nor
+	// Application Default Credentials
+	ErrCredentialsMissing = errors.New("credentials missing")
+	// ErrTokenExpired means the stored token was revoked or expired and
+	// could not be refreshed, so "doc2gdoc auth login" is needed
+	ErrTokenExpired = errors.New("token expired")
+	// ErrFolderNotFound means a folder is missing and may not be created
+	ErrFolderNotFound = errors.New("folder not found")
+	// ErrFileNotFound means a Drive path names no file
+	ErrFileNotFound = errors.New("file not found")
+	// ErrUnsupportedFileType means the source cannot be imported by Drive
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+	// ErrAmbiguousFolder means several folders share a name in -strict mode
+	ErrAmbiguousFolder = errors.New("ambiguous folder")
+)
+
+// quotaReasons are the Drive error reasons reported as a QuotaError
+var quotaReasons = map[string]bool{
+	"storageQuotaExceeded":     true,
+	"quotaExceeded":            true,
+	"dailyLimitExceeded":       true,
+	"rateLimitExceeded":        true,
+	"userRateLimitExceeded":    true,
+	"sharingRateLimitExceeded": true,
+}
+
+// QuotaError is returned when Drive rejects a request because a storage or
+// rate quota was exceeded. Rate limits clear by themselves, storage quotas
+// do not.
+type QuotaError struct {
+	Reason string
+	Err    error
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded (%s): %v", e.Reason, e.Err)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+// classifyAPIError wraps a Drive or Docs error in a QuotaError when it
+// reports an exceeded quota, and returns other errors unchanged
+func classifyAPIError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	for _, e := range apiErr.Errors {
+		if quotaReasons[e.Reason] {
+			return &QuotaError{Reason: e.Reason, Err: err}
+		}
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return &QuotaError{Reason: "tooManyRequests", Err: err}
+	}
+	return err
+}
+
+// isNotFound reports whether err is a missing local file or a 404 from a
+// Google API
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.Is(err, os.ErrNotExist) || (errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound)
+}
+
+// tokenErrorTransport marks failed token refreshes with ErrTokenExpired. The
+// oauth2 transport refreshes the token before each request, so this is the
+// one place that sees the refresh fail. relogin tells how to log in again.
+type tokenErrorTransport struct {
+	base    http.RoundTripper
+	relogin string
+}
+
+func (t tokenErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if isInvalidGrant(err) {
+		return nil, fmt.Errorf("%w, %s: %w", ErrTokenExpired, t.relogin, err)
+	}
+	return resp, err
+}
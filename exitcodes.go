@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Exit codes, so scripts can branch on the kind of failure
+const (
+	exitFailure = 1
+	// exitUsage means invalid flags or arguments, like the flag package
+	// exits with
+	exitUsage = 2
+	// exitAuth means there are no credentials, or the token was revoked
+	exitAuth = 3
+	// exitNotFound means a folder or file does not exist
+	exitNotFound = 4
+	// exitQuota means Drive refused a request over a storage or rate quota
+	exitQuota = 5
+	// exitPartial means some files of a batch failed and others didn't
+	exitPartial = 6
+	// exitUnsupported means Drive cannot convert the source type
+	exitUnsupported = 7
+)
+
+// Error kinds in the -errors-json report, matching the exit codes
+var errorKinds = map[int]string{
+	exitFailure:     "failed",
+	exitUsage:       "usage",
+	exitAuth:        "auth",
+	exitNotFound:    "not_found",
+	exitQuota:       "quota",
+	exitPartial:     "partial",
+	exitUnsupported: "unsupported",
+}
+
+// usageError is an invalid flag or argument
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+
+func (e *usageError) Unwrap() error { return e.err }
+
+// usageErr marks err as caused by invalid flags or arguments
+func usageErr(err error) error {
+	return &usageError{err: err}
+}
+
+// BatchError is returned when files of a batch or rows of a manifest failed
+type BatchError struct {
+	Failed int
+	Total  int
+	// Unit names what failed in the message, e.g. file(s)
+	Unit string
+	// Errs are the failures, one per failed item
+	Errs []error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d %s failed", e.Failed, e.Unit)
+}
+
+// exitCode maps an error to the exit code of its kind
+func exitCode(err error) int {
+	var quotaErr *QuotaError
+	var batchErr *BatchError
+	var usage *usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.As(err, &batchErr):
+		if batchErr.Failed < batchErr.Total {
+			return exitPartial
+		}
+		// Everything failed: for one reason, or for several
+		code := 0
+		for _, e := range batchErr.Errs {
+			if c := exitCode(e); code == 0 || code == c {
+				code = c
+				continue
+			}
+			return exitFailure
+		}
+		if code == 0 {
+			return exitFailure
+		}
+		return code
+	case errors.Is(err, ErrCredentialsMissing), errors.Is(err, ErrTokenExpired):
+		return exitAuth
+	case errors.Is(err, ErrFolderNotFound), errors.Is(err, ErrFileNotFound), isNotFound(err):
+		return exitNotFound
+	case errors.As(err, &quotaErr):
+		return exitQuota
+	case errors.Is(err, ErrUnsupportedFileType):
+		return exitUnsupported
+	}
+	return exitFailure
+}
+
+// fatal logs err, prefixed with msg unless it is empty, and exits with its
+// exit code, writing the -errors-json report first
+func fatal(msg string, err error) {
+	code := exitCode(err)
+	errorReport.finish(err, code)
+	if msg == "" {
+		log.Print(err)
+	} else {
+		log.Printf("%s: %v", tr(msg), err)
+	}
+	os.Exit(code)
+}
+
+// reportedError is an entry of the -errors-json report
+type reportedError struct {
+	// File is the local source, empty for failures not tied to a file
+	File      string `json:"file,omitempty"`
+	DrivePath string `json:"drive_path,omitempty"`
+	Kind      string `json:"kind"`
+	ExitCode  int    `json:"exit_code"`
+	Error     string `json:"error"`
+}
+
+// errorReporter collects the per-file failures of a run for -errors-json
+type errorReporter struct {
+	mu     sync.Mutex
+	file   string
+	errors []reportedError
+}
+
+// errorReport is the report of this run, written if -errors-json is set
+var errorReport = &errorReporter{}
+
+// add records the failure of one file
+func (r *errorReporter) add(file string, drivePath string, err error) {
+	code := exitCode(err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Long-running commands would otherwise collect errors forever
+	if r.file == "" {
+		return
+	}
+	r.errors = append(r.errors, reportedError{File: file, DrivePath: drivePath, Kind: errorKinds[code], ExitCode: code, Error: err.Error()})
+}
+
+// finish writes the report for a run that ended with err, nil on success.
+// A failure no file was recorded for is reported on its own.
+func (r *errorReporter) finish(err error, code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == "" {
+		return
+	}
+	errs := r.errors
+	if err != nil && len(errs) == 0 {
+		errs = append(errs, reportedError{Kind: errorKinds[code], ExitCode: code, Error: err.Error()})
+	}
+	report := struct {
+		ExitCode int             `json:"exit_code"`
+		Errors   []reportedError `json:"errors"`
+	}{code, errs}
+	if report.Errors == nil {
+		report.Errors = []reportedError{}
+	}
+	b, jerr := json.MarshalIndent(report, "", "  ")
+	if jerr == nil {
+		jerr = os.WriteFile(r.file, append(b, '\n'), 0644)
+	}
+	if jerr != nil {
+		logger.Error("Unable to write -errors-json report", "file", r.file, "err", jerr)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// treeExporter exports the Google Workspace documents of a Drive folder tree
+// into a local directory
+type treeExporter struct {
+	svc *Services
+	// formats are the export formats by Google Workspace type
+	formats map[string]pullFormat
+	// since skips documents modified before it, if not zero
+	since time.Time
+	// drivePath is the exported folder, for messages
+	drivePath string
+
+	exported, unchanged, older, other int
+	errs                              []error
+}
+
+// runExportTreeCommand implements "doc2gdoc export-tree <drive path> <local dir>"
+func runExportTreeCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("export-tree", flag.ExitOnError)
+	format := flags.String("format", "md", "Export format of Docs: md, docx, odt, html, txt or pdf")
+	sheetFormat := flags.String("sheet-format", "xlsx", "Export format of Sheets: xlsx, ods, csv or pdf")
+	slideFormat := flags.String("slide-format", "pptx", "Export format of Slides: pptx, odp or pdf")
+	since := flags.String("since", "", "Only export documents modified on or after this date, e.g. 2024-01-01 or 2024-01-01T12:00:00Z")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc export-tree <drive path> <local dir> [-format md] [-sheet-format xlsx] [-slide-format pptx] [-since 2024-01-01]")
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		flags.Usage()
+		return fmt.Errorf("please specify a Drive folder and a local directory")
+	}
+
+	e := &treeExporter{formats: map[string]pullFormat{}, drivePath: positional[0]}
+	for _, f := range []struct {
+		mimeType, name string
+		allowed        []string
+	}{
+		{docMimeType, *format, []string{"md", "docx", "odt", "html", "txt", "pdf"}},
+		{sheetMimeType, *sheetFormat, []string{"xlsx", "ods", "csv", "pdf"}},
+		{slideMimeType, *slideFormat, []string{"pptx", "odp", "pdf"}},
+	} {
+		pf, err := exportFormat(f.mimeType, f.name)
+		if err != nil || !slices.Contains(f.allowed, f.name) {
+			return fmt.Errorf("unknown %s format %q, expected %s", targetNames[f.mimeType], f.name, strings.Join(f.allowed, ", "))
+		}
+		e.formats[f.mimeType] = pf
+	}
+	if *since != "" {
+		if e.since, err = parseSince(*since); err != nil {
+			return err
+		}
+	}
+
+	localDir := positional[1]
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %v", err)
+	}
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	e.svc = svc
+	rootID, err := svc.Folders.FindOrCreate(ctx, e.drivePath, createNone)
+	if err != nil {
+		return fmt.Errorf("unable to find Drive folder: %w", err)
+	}
+	nodes, err := listTree(ctx, svc.Files, rootID, true, 0)
+	if err != nil {
+		return err
+	}
+
+	e.walk(ctx, nodes, localDir, "")
+	summary := tr("%d exported, %d unchanged, %d failed", e.exported, e.unchanged, len(e.errs))
+	if !e.since.IsZero() {
+		summary += tr(", %d modified before -since", e.older)
+	}
+	if e.other > 0 {
+		summary += tr(", %d other file(s) not exported", e.other)
+	}
+	if err := ctx.Err(); err != nil {
+		fmt.Print(tr("Export interrupted after %s\n", summary))
+		return err
+	}
+	fmt.Print(tr("Export finished: %s\n", summary))
+	if len(e.errs) > 0 {
+		return &BatchError{Failed: len(e.errs), Total: e.exported + e.unchanged + len(e.errs), Unit: "document(s)", Errs: e.errs}
+	}
+	return nil
+}
+
+// walk recreates the folders of nodes under dir and exports their
+// documents. rel is the Drive path of dir below the exported folder.
+func (e *treeExporter) walk(ctx context.Context, nodes []*listNode, dir string, rel string) {
+	// Drive allows several files of one name in a folder, a directory doesn't
+	used := map[string]bool{}
+	localName := func(name string, ext string, id string) string {
+		n := pullFileName(name) + ext
+		if used[strings.ToLower(n)] {
+			n = pullFileName(name) + "_" + id + ext
+		}
+		used[strings.ToLower(n)] = true
+		return n
+	}
+
+	for _, n := range nodes {
+		if ctx.Err() != nil {
+			return
+		}
+		f := n.file
+		if f.MimeType == folderMimeType {
+			e.walk(ctx, n.children, filepath.Join(dir, localName(f.Name, "", f.Id)), path.Join(rel, f.Name))
+			continue
+		}
+		format, ok := e.formats[f.MimeType]
+		if !ok {
+			logger.Debug("Not a document, skipped", "file", path.Join(rel, f.Name), "mime_type", f.MimeType)
+			e.other++
+			continue
+		}
+		local := filepath.Join(dir, localName(f.Name, format.ext, f.Id))
+		modified, perr := time.Parse(time.RFC3339, f.ModifiedTime)
+		if perr == nil && !e.since.IsZero() && modified.Before(e.since) {
+			e.older++
+			continue
+		}
+		// The local file keeps the document's modified time, so a rerun
+		// only exports what changed since
+		if info, err := os.Stat(local); err == nil && perr == nil && info.ModTime().Equal(modified) {
+			e.unchanged++
+			continue
+		}
+
+		if err := exportToFile(ctx, e.svc.Files, f.Id, format.mimeType, local); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("Unable to export", "doc", path.Join(rel, f.Name), "err", err)
+			errorReport.add(local, path.Join(e.drivePath, rel, f.Name), err)
+			e.errs = append(e.errs, err)
+			continue
+		}
+		if perr == nil {
+			if err := os.Chtimes(local, modified, modified); err != nil {
+				logger.Warn("Unable to set modified time", "file", local, "err", err)
+			}
+		}
+		fmt.Print(tr("Exported %s to %s\n", path.Join(rel, f.Name), local))
+		e.exported++
+	}
+}
+
+// parseSince parses a -since date, date and time, or duration before now
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -since %q, expected a date like 2024-01-01 or a duration like 24h", s)
+	}
+	return t, nil
+}
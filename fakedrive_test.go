@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// FakeDrive is an in-memory DriveAPI for tests. It understands the query
+// clauses this package builds: name, mimeType, starred and trashed
+// comparisons and "in parents". "'me' in owners" always matches.
+type FakeDrive struct {
+	mu      sync.Mutex
+	nextID  int
+	files   map[string]*drive.File
+	content map[string][]byte
+	drives  []*drive.Drive
+	perms   map[string][]*drive.Permission
+}
+
+// NewFakeDrive returns an empty fake whose My Drive root has the ID "root"
+func NewFakeDrive() *FakeDrive {
+	return &FakeDrive{
+		files:   map[string]*drive.File{},
+		content: map[string][]byte{},
+		perms:   map[string][]*drive.Permission{},
+	}
+}
+
+// AddSharedDrive adds a shared drive and returns its ID, which is also the
+// ID of its root folder
+func (f *FakeDrive) AddSharedDrive(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := &drive.Drive{Id: f.newID(), Name: name}
+	f.drives = append(f.drives, d)
+	return d.Id
+}
+
+// Content returns the last media uploaded for a file
+func (f *FakeDrive) Content(fileID string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.content[fileID]
+}
+
+// Permissions returns the permissions created for a file
+func (f *FakeDrive) Permissions(fileID string) []*drive.Permission {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.perms[fileID]
+}
+
+func (f *FakeDrive) newID() string {
+	f.nextID++
+	return fmt.Sprintf("fake-%d", f.nextID)
+}
+
+func notFound(fileID string) error {
+	return &googleapi.Error{Code: 404, Message: "File not found: " + fileID}
+}
+
+func (f *FakeDrive) CreateFile(ctx context.Context, file *drive.File, media io.Reader, opts UploadOptions) (*drive.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	created := *file
+	created.Id = f.newID()
+	created.CreatedTime = time.Now().UTC().Format(time.RFC3339)
+	created.WebViewLink = "https://drive.google.com/open?id=" + created.Id
+	if len(created.Parents) == 0 {
+		created.Parents = []string{"root"}
+	}
+	if media != nil {
+		b, err := io.ReadAll(media)
+		if err != nil {
+			return nil, err
+		}
+		f.content[created.Id] = b
+	}
+	f.files[created.Id] = &created
+	res := created
+	return &res, nil
+}
+
+func (f *FakeDrive) UpdateFile(ctx context.Context, fileID string, file *drive.File, media io.Reader, opts UploadOptions) (*drive.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.files[fileID]
+	if !ok {
+		return nil, notFound(fileID)
+	}
+	if file.Name != "" {
+		existing.Name = file.Name
+	}
+	if file.Description != "" {
+		existing.Description = file.Description
+	}
+	if file.Trashed {
+		existing.Trashed = true
+	}
+	if file.Starred || slices.Contains(file.ForceSendFields, "Starred") {
+		existing.Starred = file.Starred
+	}
+	if opts.RemoveParents != "" {
+		existing.Parents = slices.DeleteFunc(existing.Parents, func(p string) bool {
+			return slices.Contains(strings.Split(opts.RemoveParents, ","), p)
+		})
+	}
+	if opts.AddParents != "" {
+		existing.Parents = append(existing.Parents, strings.Split(opts.AddParents, ",")...)
+	}
+	for k, v := range file.AppProperties {
+		if existing.AppProperties == nil {
+			existing.AppProperties = map[string]string{}
+		}
+		existing.AppProperties[k] = v
+	}
+	if media != nil {
+		b, err := io.ReadAll(media)
+		if err != nil {
+			return nil, err
+		}
+		f.content[fileID] = b
+	}
+	res := *existing
+	return &res, nil
+}
+
+func (f *FakeDrive) DeleteFile(ctx context.Context, fileID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.files[fileID]; !ok {
+		return notFound(fileID)
+	}
+	delete(f.files, fileID)
+	delete(f.content, fileID)
+	return nil
+}
+
+func (f *FakeDrive) GetFile(ctx context.Context, fileID string, fields string) (*drive.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.files[fileID]
+	if !ok {
+		return nil, notFound(fileID)
+	}
+	res := *existing
+	return &res, nil
+}
+
+func (f *FakeDrive) CopyFile(ctx context.Context, fileID string, file *drive.File, fields string) (*drive.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	existing, ok := f.files[fileID]
+	if !ok {
+		return nil, notFound(fileID)
+	}
+	copied := *existing
+	copied.Id = f.newID()
+	copied.CreatedTime = time.Now().UTC().Format(time.RFC3339)
+	copied.WebViewLink = "https://drive.google.com/open?id=" + copied.Id
+	if file.Name != "" {
+		copied.Name = file.Name
+	}
+	if len(file.Parents) > 0 {
+		copied.Parents = file.Parents
+	}
+	copied.AppProperties = map[string]string{}
+	for k, v := range existing.AppProperties {
+		copied.AppProperties[k] = v
+	}
+	for k, v := range file.AppProperties {
+		copied.AppProperties[k] = v
+	}
+	f.files[copied.Id] = &copied
+	f.content[copied.Id] = f.content[fileID]
+	res := copied
+	return &res, nil
+}
+
+func (f *FakeDrive) CreatePermission(ctx context.Context, fileID string, perm *drive.Permission) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.files[fileID]; !ok {
+		return notFound(fileID)
+	}
+	f.perms[fileID] = append(f.perms[fileID], perm)
+	return nil
+}
+
+func (f *FakeDrive) ListFiles(ctx context.Context, query string, fields string, pageSize int64, maxResults int) ([]*drive.File, error) {
+	clauses, err := splitQueryClauses(query)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var files []*drive.File
+	for _, file := range f.files {
+		ok, err := matchQuery(file, clauses)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res := *file
+			files = append(files, &res)
+		}
+	}
+	// Creation order, like a Drive listing without orderBy
+	sort.Slice(files, func(i, j int) bool {
+		return fakeIDOrder(files[i].Id) < fakeIDOrder(files[j].Id)
+	})
+	if maxResults > 0 && len(files) > maxResults {
+		files = files[:maxResults]
+	}
+	return files, nil
+}
+
+func (f *FakeDrive) Export(ctx context.Context, fileID string, mimeType string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.files[fileID]; !ok {
+		return nil, notFound(fileID)
+	}
+	return io.NopCloser(bytes.NewReader(f.content[fileID])), nil
+}
+
+func (f *FakeDrive) SharedDrives(ctx context.Context, nameOrID string) ([]*drive.Drive, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var drives []*drive.Drive
+	for _, d := range f.drives {
+		if d.Id == nameOrID {
+			return []*drive.Drive{d}, nil
+		}
+		if d.Name == nameOrID {
+			drives = append(drives, d)
+		}
+	}
+	return drives, nil
+}
+
+// fakeIDOrder returns the sequence number of a fake file ID
+func fakeIDOrder(id string) int {
+	var n int
+	fmt.Sscanf(id, "fake-%d", &n)
+	return n
+}
+
+// splitQueryClauses splits a query on " and " outside quoted strings
+func splitQueryClauses(query string) ([]string, error) {
+	var clauses []string
+	var cur strings.Builder
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(query):
+			cur.WriteByte(c)
+			i++
+			cur.WriteByte(query[i])
+			continue
+		case c == '\'':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(query[i:], " and "):
+			clauses = append(clauses, cur.String())
+			cur.Reset()
+			i += len(" and ") - 1
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated string in query %q", query)
+	}
+	return append(clauses, cur.String()), nil
+}
+
+// unquoteQuery reverses quoteQuery
+func unquoteQuery(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return "", false
+	}
+	return strings.NewReplacer(`\\`, `\`, `\'`, `'`).Replace(s[1 : len(s)-1]), true
+}
+
+// matchQuery reports whether file matches every clause
+func matchQuery(file *drive.File, clauses []string) (bool, error) {
+	for _, clause := range clauses {
+		if value, ok := strings.CutSuffix(clause, " in parents"); ok {
+			parent, ok := unquoteQuery(value)
+			if !ok {
+				return false, fmt.Errorf("unsupported query clause %q", clause)
+			}
+			found := false
+			for _, p := range file.Parents {
+				found = found || p == parent
+			}
+			if !found {
+				return false, nil
+			}
+			continue
+		}
+		if clause == "'me' in owners" {
+			continue
+		}
+
+		fields := strings.SplitN(clause, " ", 3)
+		if len(fields) != 3 || (fields[1] != "=" && fields[1] != "!=") {
+			return false, fmt.Errorf("unsupported query clause %q", clause)
+		}
+		var actual string
+		switch fields[0] {
+		case "name":
+			actual = quoteQuery(file.Name)
+		case "mimeType":
+			actual = quoteQuery(file.MimeType)
+		case "trashed":
+			actual = fmt.Sprint(file.Trashed)
+		case "starred":
+			actual = fmt.Sprint(file.Starred)
+		default:
+			return false, fmt.Errorf("unsupported query field %q", fields[0])
+		}
+		if (actual == fields[2]) != (fields[1] == "=") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRedaction replaces matches of rules without a replacement
+const defaultRedaction = "[REDACTED]"
+
+// builtinFilters are the patterns FilterRule.Builtin names
+var builtinFilters = map[string]string{
+	"email":          `[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`,
+	"aws_access_key": `\b(AKIA|ASIA)[0-9A-Z]{16}\b`,
+	"google_api_key": `\bAIza[0-9A-Za-z_-]{35}\b`,
+	"github_token":   `\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	"private_key":    `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	"us_ssn":         `\b\d{3}-\d{2}-\d{4}\b`,
+	"tw_national_id": `\b[A-Z][12]\d{8}\b`,
+}
+
+// FilterRule redacts the matches of a regular expression from text sources
+// before they are uploaded
+type FilterRule struct {
+	// Name identifies the rule in the report (default: Builtin or Pattern)
+	Name string `yaml:"name" json:"name,omitempty"`
+	// Pattern is a Go regular expression; Builtin names one of
+	// builtinFilters instead
+	Pattern string `yaml:"pattern" json:"pattern,omitempty"`
+	Builtin string `yaml:"builtin" json:"builtin,omitempty"`
+	// Replace is the replacement, which may refer to groups as ${1}
+	// (default: [REDACTED])
+	Replace string `yaml:"replace" json:"replace,omitempty"`
+	// Ext limits the rule to sources with these extensions
+	Ext []string `yaml:"ext" json:"ext,omitempty"`
+}
+
+// name returns the name of the rule in the report
+func (r FilterRule) name() string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.Builtin != "":
+		return r.Builtin
+	}
+	return r.Pattern
+}
+
+// compile returns the regular expression of the rule
+func (r FilterRule) compile() (*regexp.Regexp, error) {
+	pattern := r.Pattern
+	if r.Builtin != "" {
+		if r.Pattern != "" {
+			return nil, fmt.Errorf("filter %s: set either pattern or builtin, not both", r.name())
+		}
+		var ok bool
+		if pattern, ok = builtinFilters[r.Builtin]; !ok {
+			names := make([]string, 0, len(builtinFilters))
+			for name := range builtinFilters {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("filter %s: unknown builtin %q, expected one of %s", r.name(), r.Builtin, strings.Join(names, ", "))
+		}
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("filter %s: pattern or builtin is required", r.name())
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %v", r.name(), err)
+	}
+	return re, nil
+}
+
+// matches reports whether the rule applies to sources named filePath
+func (r FilterRule) matches(filePath string) bool {
+	if len(r.Ext) == 0 {
+		return true
+	}
+	ext := filepath.Ext(filePath)
+	for _, e := range r.Ext {
+		if strings.EqualFold(normalizeExt(e), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFilters checks that every rule compiles
+func validateFilters(rules []FilterRule) error {
+	for _, r := range rules {
+		if _, err := r.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redaction is what one rule redacted from a source. The matched text
+// itself is never recorded.
+type Redaction struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Rule   string    `json:"rule"`
+	Count  int       `json:"count"`
+	// Lines are the line numbers of the matches, one per match
+	Lines []int `json:"lines"`
+}
+
+// isTextSource reports whether a source is text the filters can edit:
+// by its extension, or by sniffing content if the extension is unknown
+func isTextSource(filePath string, content []byte) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	mimeType, ok := sourceMimeTypes[ext]
+	if !ok {
+		mimeType = mime.TypeByExtension(ext)
+	}
+	if mimeType == "" || mimeType == unknownMimeType {
+		mimeType = http.DetectContentType(content)
+	}
+	return strings.HasPrefix(mimeType, "text/")
+}
+
+// applyFilters redacts the matches of rules from the text source at
+// uploadPath, named filePath. It returns the redacted copy and a cleanup
+// function removing it, or "" if nothing was redacted. Standard input is
+// always copied, since reading it consumes it.
+func applyFilters(uploadPath string, filePath string, rules []FilterRule) (string, func(), error) {
+	var content []byte
+	var err error
+	if uploadPath == stdinPath {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(uploadPath)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read file: %v", err)
+	}
+
+	var redactions []Redaction
+	if isTextSource(uploadPath, content) {
+		for _, r := range rules {
+			if !r.matches(filePath) {
+				continue
+			}
+			re, err := r.compile()
+			if err != nil {
+				return "", nil, err
+			}
+			locs := re.FindAllIndex(content, -1)
+			if len(locs) == 0 {
+				continue
+			}
+			red := Redaction{Time: time.Now().UTC(), Source: filePath, Rule: r.name(), Count: len(locs)}
+			for _, loc := range locs {
+				red.Lines = append(red.Lines, bytes.Count(content[:loc[0]], []byte("\n"))+1)
+			}
+			replace := r.Replace
+			if replace == "" {
+				replace = defaultRedaction
+			}
+			content = re.ReplaceAll(content, []byte(replace))
+			redactions = append(redactions, red)
+		}
+	}
+	if len(redactions) == 0 && uploadPath != stdinPath {
+		return "", nil, nil
+	}
+
+	dir, err := os.MkdirTemp("", "doc2gdoc-filter-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create temporary directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	name := filepath.Base(uploadPath)
+	if uploadPath == stdinPath {
+		name = "stdin"
+	}
+	out := filepath.Join(dir, name)
+	if err := os.WriteFile(out, content, 0600); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("unable to write filtered file: %v", err)
+	}
+
+	for _, red := range redactions {
+		logger.Info("Redacted", "file", filePath, "rule", red.Rule, "count", red.Count, "lines", red.Lines)
+	}
+	if err := redactionReport.add(redactions); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return out, cleanup, nil
+}
+
+// redactionReporter appends redactions to a JSON lines file
+type redactionReporter struct {
+	mu   sync.Mutex
+	file string
+}
+
+// redactionReport is the report of this run, written if the config file
+// sets redaction_report
+var redactionReport = &redactionReporter{}
+
+// add appends redactions to the report. A report that cannot be written
+// fails the upload, since the redactions would go unrecorded.
+func (r *redactionReporter) add(redactions []Redaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == "" || len(redactions) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(r.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open redaction report: %v", err)
+	}
+	enc := json.NewEncoder(f)
+	for _, red := range redactions {
+		if err := enc.Encode(red); err != nil {
+			f.Close()
+			return fmt.Errorf("unable to write redaction report: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write redaction report: %v", err)
+	}
+	return nil
+}
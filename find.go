@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// appProperties written on every converted file besides sourceHashProperty,
+// so everything the tool uploaded can be found again
+const (
+	sourcePathProperty  = "source_path"
+	convertedByProperty = "converted_by"
+	convertedAtProperty = "converted_at"
+	// convertedByValue is the converted_by of our uploads
+	convertedByValue = "doc2gdoc"
+)
+
+// maxPropertyBytes is the Drive limit on the key and value of a property
+// together
+const maxPropertyBytes = 124
+
+// findFields are the file fields shown by "doc2gdoc find"
+const findFields = "id, name, mimeType, modifiedTime, webViewLink, appProperties"
+
+// sourceProperties are the appProperties tagging a file converted from
+// source. Paths too long for a property keep their end, the most specific
+// part.
+func sourceProperties(source string, hash string) map[string]string {
+	props := map[string]string{
+		sourceHashProperty:  hash,
+		convertedByProperty: convertedByValue,
+		convertedAtProperty: time.Now().UTC().Format(time.RFC3339),
+	}
+	if source != stdinPath {
+		p := filepath.ToSlash(absPath(source))
+		for len(sourcePathProperty)+len(p) > maxPropertyBytes {
+			_, size := utf8.DecodeRuneInString(p)
+			p = p[size:]
+		}
+		props[sourcePathProperty] = p
+	}
+	return props
+}
+
+// runFindCommand implements "doc2gdoc find [flags]"
+func runFindCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	ours := flags.Bool("converted-by-us", false, "Only find files converted by doc2gdoc, which tags them converted_by=doc2gdoc (older uploads have no tag)")
+	name := flags.String("name", "", "Only find files whose name contains this text")
+	fileType := flags.String("type", "all", "Only find files of this type: doc, sheet, slide, folder or all")
+	source := flags.String("source", "", "Only find files converted from a source path matching this glob, e.g. '*/docs/*.md'")
+	maxResults := flags.Int("max-results", 0, "Stop after this many results (0 means no limit)")
+	asJSON := flags.Bool("json", false, "Print the files as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc find [-converted-by-us] [-name text] [-type doc|sheet|slide|folder|all] [-source glob] [-json]")
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+	if *fileType != "all" {
+		if _, ok := listTypes[*fileType]; !ok {
+			return fmt.Errorf("unknown type %q, expected doc, sheet, slide, folder or all", *fileType)
+		}
+	}
+	if _, err := path.Match(*source, ""); err != nil {
+		return fmt.Errorf("invalid -source pattern %q: %v", *source, err)
+	}
+
+	clauses := []string{"trashed = false"}
+	if *ours || *source != "" {
+		clauses = append(clauses, fmt.Sprintf("appProperties has { key=%s and value=%s }",
+			quoteQuery(convertedByProperty), quoteQuery(convertedByValue)))
+	}
+	if *name != "" {
+		clauses = append(clauses, "name contains "+quoteQuery(*name))
+	}
+	if *fileType != "all" {
+		clauses = append(clauses, "mimeType = "+quoteQuery(listTypes[*fileType]))
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	files, err := svc.Files.ListFiles(ctx, buildQuery(clauses...), findFields, 0, *maxResults)
+	if err != nil {
+		return fmt.Errorf("unable to search files: %w", classifyAPIError(err))
+	}
+	if *source != "" {
+		var matched []*drive.File
+		for _, f := range files {
+			if ok, _ := path.Match(*source, f.AppProperties[sourcePathProperty]); ok {
+				matched = append(matched, f)
+			}
+		}
+		files = matched
+	}
+
+	if *asJSON {
+		type found struct {
+			ID          string `json:"id"`
+			Name        string `json:"name"`
+			Type        string `json:"type"`
+			Source      string `json:"source,omitempty"`
+			ConvertedAt string `json:"converted_at,omitempty"`
+			Link        string `json:"link,omitempty"`
+		}
+		out := make([]found, 0, len(files))
+		for _, f := range files {
+			out = append(out, found{
+				ID:          f.Id,
+				Name:        f.Name,
+				Type:        listTypeName(f.MimeType),
+				Source:      f.AppProperties[sourcePathProperty],
+				ConvertedAt: f.AppProperties[convertedAtProperty],
+				Link:        f.WebViewLink,
+			})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tID\tCONVERTED\tSOURCE")
+	for _, f := range files {
+		source := f.AppProperties[sourcePathProperty]
+		if source == "" {
+			source = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Name, listTypeName(f.MimeType), f.Id,
+			listModified(f.AppProperties[convertedAtProperty]), source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Print(tr("%d file(s)\n", len(files)))
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Several runners publishing to the same tree coordinate folder creation
+// through marker files in the parent folder. Every runner creates a marker;
+// the oldest live marker holds the lock and the others wait for it to go.
+const (
+	lockFileName = ".doc2gdoc-lock"
+	// lockTTL is how long a marker counts as live, so a crashed runner
+	// cannot block the others forever
+	lockTTL = 2 * time.Minute
+	// lockPollInterval is how often a waiting runner checks the markers
+	lockPollInterval = 2 * time.Second
+)
+
+// lockFolder acquires the folder creation lock of parentID and returns the
+// function that releases it
+func (r *FolderResolver) lockFolder(ctx context.Context, parentID string) (func(), error) {
+	marker, err := r.api.CreateFile(ctx, &drive.File{
+		Name:    lockFileName,
+		Parents: []string{parentID},
+	}, nil, UploadOptions{Fields: "id"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create lock marker: %w", err)
+	}
+	unlock := func() {
+		// Release even when ctx was cancelled
+		if err := r.api.DeleteFile(context.Background(), marker.Id); err != nil {
+			logger.Warn("Unable to remove lock marker", "id", marker.Id, "err", err)
+		}
+	}
+
+	query := buildQuery(
+		"name = "+quoteQuery(lockFileName),
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
+	waiting := false
+	for {
+		markers, err := r.api.ListFiles(ctx, query, "id, createdTime", 0, 0)
+		if err != nil {
+			unlock()
+			return nil, fmt.Errorf("unable to read lock markers: %w", err)
+		}
+		if holder := lockHolder(markers, time.Now()); holder == "" || holder == marker.Id {
+			return unlock, nil
+		}
+
+		if !waiting {
+			logger.Info("Waiting for another runner to finish creating folders")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			unlock()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// lockHolder returns the ID of the oldest marker that has not expired, using
+// the ID to break ties
+func lockHolder(markers []*drive.File, now time.Time) string {
+	var live []*drive.File
+	for _, m := range markers {
+		created, err := time.Parse(time.RFC3339, m.CreatedTime)
+		if err == nil && now.Sub(created) < lockTTL {
+			live = append(live, m)
+		}
+	}
+	if len(live) == 0 {
+		return ""
+	}
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].CreatedTime != live[j].CreatedTime {
+			return live[i].CreatedTime < live[j].CreatedTime
+		}
+		return live[i].Id < live[j].Id
+	})
+	return live[0].Id
+}
+
+// folderCreateAttempts is how often creating a folder is tried when Drive
+// fails transiently
+const folderCreateAttempts = 3
+
+const (
+	// folderRetryDelay is the pause after the first failed folder create,
+	// doubled per attempt
+	folderRetryDelay = 250 * time.Millisecond
+	// folderRetryMaxDelay caps the pause, which may be spent holding the
+	// parent's lock
+	folderRetryMaxDelay = 2 * time.Second
+)
+
+// folderRetryBackoff returns the pause before the next folder create
+func folderRetryBackoff(attempts int) time.Duration {
+	delay := folderRetryDelay
+	for i := 1; i < attempts && delay < folderRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, folderRetryMaxDelay)
+}
+
+// idGenerator is implemented by a DriveAPI that can reserve file IDs
+type idGenerator interface {
+	GenerateIDs(ctx context.Context, count int64) ([]string, error)
+}
+
+// createFolder creates a folder under parentID once per process: workers
+// missing the same folder at the same time share one creation, and later
+// ones reuse its result.
+func (r *FolderResolver) createFolder(ctx context.Context, parentID string, name string) (string, error) {
+	key := parentID + "/" + name
+	id, err, _ := r.flights.Do(key, func() (any, error) {
+		r.mu.Lock()
+		id, ok := r.created[key]
+		r.mu.Unlock()
+		if ok {
+			return id, nil
+		}
+		id, err := r.createFolderOnce(ctx, parentID, name)
+		if err != nil {
+			return "", err
+		}
+		r.mu.Lock()
+		r.created[key] = id
+		r.mu.Unlock()
+		return id, nil
+	})
+	return id.(string), err
+}
+
+// createFolderOnce creates a folder under parentID. With locking enabled
+// it holds the parent's lock and first checks whether another runner
+// created the folder in the meantime.
+//
+// A failed create may still have happened, so before trying again it looks
+// for the folder. The folder gets an ID reserved up front where the API
+// allows, so a retry of a create that went through fails with a conflict
+// instead of making a duplicate.
+func (r *FolderResolver) createFolderOnce(ctx context.Context, parentID string, name string) (string, error) {
+	if r.locking {
+		unlock, err := r.lockFolder(ctx, parentID)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+
+		existing, err := findExistingFile(ctx, r.api, parentID, name, folderMimeType)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			logger.Info("Folder was created by another runner", "name", name, "id", existing.Id)
+			return existing.Id, nil
+		}
+	}
+
+	folder := &drive.File{
+		Name:     name,
+		MimeType: folderMimeType,
+		Parents:  []string{parentID},
+	}
+	if gen, ok := r.api.(idGenerator); ok {
+		if ids, err := gen.GenerateIDs(ctx, 1); err == nil && len(ids) == 1 {
+			folder.Id = ids[0]
+		} else {
+			logger.Debug("Unable to reserve a folder ID", "err", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		createdFolder, err := r.api.CreateFile(ctx, folder, nil, UploadOptions{Fields: "id"})
+		if err == nil {
+			logger.Info("Created folder", "name", name, "id", createdFolder.Id)
+			return createdFolder.Id, nil
+		}
+		var apiErr *googleapi.Error
+		if folder.Id != "" && attempt > 1 && errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+			logger.Info("Folder was created by an earlier attempt", "name", name, "id", folder.Id)
+			return folder.Id, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		existing, ferr := findExistingFile(ctx, r.api, parentID, name, folderMimeType)
+		if ferr == nil && existing != nil {
+			logger.Info("Folder exists after a failed create", "name", name, "id", existing.Id, "err", err)
+			return existing.Id, nil
+		}
+		if !isRetryable(ctx, err) || attempt == folderCreateAttempts {
+			return "", fmt.Errorf("unable to create folder %s: %w", name, classifyAPIError(err))
+		}
+		logger.Warn("Retrying folder creation", "name", name, "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(folderRetryBackoff(attempt)):
+		}
+	}
+}
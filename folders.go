@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/api/drive/v3"
+)
+
+// Path prefixes anchoring a path somewhere other than the My Drive root:
+// "starred:Reports/2024" starts at a starred folder,
+// "computers:My Laptop/Documents" starts at a synced machine folder,
+// "drive:Engineering/Specs" starts at the root of a shared drive, and
+// "id:1AbC/Specs" starts at a folder known by ID, e.g. from a share link
+const (
+	starredPrefix   = "starred:"
+	computersPrefix = "computers:"
+	drivePrefix     = "drive:"
+	idPrefix        = "id:"
+)
+
+// filesList starts a Files.List call that also searches shared drives
+func filesList(srv *drive.Service, query string) *drive.FilesListCall {
+	return srv.Files.List().
+		Q(query).
+		Corpora("allDrives").
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true)
+}
+
+// errMaxResults stops pagination once -max-results files were read
+var errMaxResults = errors.New("max results reached")
+
+// listAllFiles reads every page of a Files.List call. pageSize sets the
+// page size when positive, and maxResults caps the number of files returned
+// when positive. The call's fields must include nextPageToken.
+func listAllFiles(ctx context.Context, call *drive.FilesListCall, pageSize int64, maxResults int) ([]*drive.File, error) {
+	if pageSize > 0 {
+		call = call.PageSize(pageSize)
+	}
+
+	var files []*drive.File
+	err := call.Pages(ctx, func(page *drive.FileList) error {
+		for _, file := range page.Files {
+			if maxResults > 0 && len(files) >= maxResults {
+				return errMaxResults
+			}
+			files = append(files, file)
+		}
+		return nil
+	})
+	if errors.Is(err, errMaxResults) {
+		logger.Warn("Stopped listing at -max-results", "results", maxResults)
+		return files, nil
+	}
+	return files, err
+}
+
+// Folder creation modes for -create-mode
+const (
+	// createAll creates every missing folder along the path
+	createAll = "all"
+	// createLeaf only creates the last folder of the path
+	createLeaf = "leaf"
+	// createNone never creates folders
+	createNone = "none"
+)
+
+// validateCreateMode checks a -create-mode value; empty means createAll
+func validateCreateMode(mode string) error {
+	switch mode {
+	case "", createAll, createLeaf, createNone:
+		return nil
+	}
+	return fmt.Errorf("unknown create mode %q, expected all, leaf or none", mode)
+}
+
+// Ways of choosing among folders sharing a name, for -prefer
+const (
+	preferNewest = "newest"
+	preferOldest = "oldest"
+	// preferIDPrefix picks the folder with the given ID, e.g. id:1AbC
+	preferIDPrefix = "id:"
+)
+
+// validatePrefer checks a -prefer value; empty means the first folder Drive
+// lists
+func validatePrefer(prefer string) error {
+	switch {
+	case prefer == "", prefer == preferNewest, prefer == preferOldest:
+		return nil
+	case strings.HasPrefix(prefer, preferIDPrefix) && len(prefer) > len(preferIDPrefix):
+		return nil
+	}
+	return fmt.Errorf("unknown -prefer %q, expected newest, oldest or id:<folder id>", prefer)
+}
+
+// FolderResolver resolves Drive folder paths to folder IDs, creating missing
+// folders as allowed. Every resolved path and its parents are cached in
+// memory keyed by normalized path, and optionally in a cache file so later
+// runs skip the lookups entirely.
+type FolderResolver struct {
+	api       DriveAPI
+	cacheFile string
+	// locking coordinates folder creation with other runners, see lockFolder
+	locking bool
+	// strict fails on folders sharing a name that prefer doesn't settle
+	strict bool
+	// prefer chooses among folders sharing a name, see validatePrefer
+	prefer string
+
+	// flights makes concurrent creations of one folder share a request
+	flights singleflight.Group
+
+	mu    sync.Mutex
+	cache map[string]string
+	// created are the folders this process created, by parent ID and name
+	created map[string]string
+}
+
+// NewFolderResolver creates a resolver, loading cacheFile if it is set
+func NewFolderResolver(api DriveAPI, cacheFile string) (*FolderResolver, error) {
+	r := &FolderResolver{api: api, cacheFile: cacheFile, cache: map[string]string{}, created: map[string]string{}}
+	if cacheFile == "" {
+		return r, nil
+	}
+
+	b, err := os.ReadFile(cacheFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read folder cache: %v", err)
+	}
+	if err := json.Unmarshal(b, &r.cache); err != nil {
+		return nil, fmt.Errorf("unable to parse folder cache: %v", err)
+	}
+	return r, nil
+}
+
+// backslashSeparates makes backslashes separate Drive folders like
+// slashes, as Windows users type paths
+var backslashSeparates = runtime.GOOS == "windows"
+
+// cleanDrivePath normalizes a Drive path typed on the command line. On
+// Windows backslashes separate folders too, so a folder with a backslash in
+// its name is only reached through its ID there (id:<folder id>); elsewhere
+// the backslash is part of the name. Repeated and trailing separators are
+// dropped. Drive paths never go through filepath, which would turn them
+// into local paths.
+func cleanDrivePath(p string) string {
+	if backslashSeparates {
+		p = strings.ReplaceAll(p, `\`, "/")
+	}
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	if len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+// splitFolderPath splits a path into its anchor (e.g. "starred:Reports", or
+// empty for the My Drive root) and its folder names, dropping empty segments
+func splitFolderPath(folderPath string) (string, []string) {
+	folderPath = cleanDrivePath(folderPath)
+	anchor := ""
+	for _, prefix := range []string{starredPrefix, computersPrefix, drivePrefix, idPrefix} {
+		if strings.HasPrefix(folderPath, prefix) {
+			anchor, folderPath, _ = strings.Cut(folderPath, "/")
+			break
+		}
+	}
+
+	var folders []string
+	for _, name := range strings.Split(folderPath, "/") {
+		if name != "" {
+			folders = append(folders, name)
+		}
+	}
+	return anchor, folders
+}
+
+// folderCacheKey builds the normalized cache key of an anchored path
+func folderCacheKey(anchor string, folders []string) string {
+	return anchor + "/" + strings.Join(folders, "/")
+}
+
+func (r *FolderResolver) lookup(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.cache[key]
+	return id, ok
+}
+
+// store caches a resolved folder and persists the cache if enabled
+func (r *FolderResolver) store(key string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache[key] == id {
+		return nil
+	}
+	r.cache[key] = id
+	if r.cacheFile == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(r.cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.cacheFile, b, 0600); err != nil {
+		return fmt.Errorf("unable to write folder cache: %v", err)
+	}
+	return nil
+}
+
+// resolveAnchor returns the ID of the folder an anchor points at
+func (r *FolderResolver) resolveAnchor(ctx context.Context, anchor string) (string, error) {
+	switch {
+	case anchor == "":
+		return "root", nil
+	case strings.HasPrefix(anchor, idPrefix):
+		// Trust the ID, a wrong one fails on first use
+		id := strings.TrimPrefix(anchor, idPrefix)
+		if id == "" {
+			return "", fmt.Errorf("folder ID is empty")
+		}
+		return id, nil
+	case strings.HasPrefix(anchor, starredPrefix):
+		return findStarredFolder(ctx, r.api, strings.TrimPrefix(anchor, starredPrefix))
+	case strings.HasPrefix(anchor, computersPrefix):
+		return findComputerFolder(ctx, r.api, strings.TrimPrefix(anchor, computersPrefix))
+	default:
+		return findSharedDrive(ctx, r.api, strings.TrimPrefix(anchor, drivePrefix))
+	}
+}
+
+// FindOrCreate resolves a folder path, starting from its deepest cached ancestor
+func (r *FolderResolver) FindOrCreate(ctx context.Context, folderPath string, createMode string) (string, error) {
+	id, _, err := r.resolve(ctx, folderPath, createMode, false)
+	return id, err
+}
+
+// Plan resolves a folder path without creating anything, for dry runs. If
+// the folder is missing it returns an empty ID and the paths of the folders
+// that would be created.
+func (r *FolderResolver) Plan(ctx context.Context, folderPath string, createMode string) (string, []string, error) {
+	return r.resolve(ctx, folderPath, createMode, true)
+}
+
+func (r *FolderResolver) resolve(ctx context.Context, folderPath string, createMode string, dryRun bool) (string, []string, error) {
+	anchor, folders := splitFolderPath(folderPath)
+
+	start := -1
+	var parentID string
+	for i := len(folders); i >= 0; i-- {
+		if id, ok := r.lookup(folderCacheKey(anchor, folders[:i])); ok {
+			parentID, start = id, i
+			break
+		}
+	}
+	if start < 0 {
+		id, err := r.resolveAnchor(ctx, anchor)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := r.store(folderCacheKey(anchor, nil), id); err != nil {
+			return "", nil, err
+		}
+		parentID, start = id, 0
+	}
+
+	for i := start; i < len(folders); i++ {
+		folderName := folders[i]
+
+		// Any type matches, so shortcuts to folders are found too
+		query := buildQuery(
+			"name = "+quoteQuery(folderName),
+			quoteQuery(parentID)+" in parents",
+			"trashed = false",
+		)
+
+		// Add error handling and logging
+		logger.Debug("Searching folder", "name", folderName)
+
+		files, err := r.api.ListFiles(ctx, query, "id, name, mimeType, createdTime, shortcutDetails(targetId, targetMimeType)", 0, 0)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to search folder: %w", classifyAPIError(err))
+		}
+
+		// Add logging to view search results
+		logger.Debug("Found matching files", "name", folderName, "count", len(files))
+
+		id, err := r.chooseFolder(folderCacheKey(anchor, folders[:i+1]), folderCandidates(files))
+		if err != nil {
+			return "", nil, err
+		}
+		if id != "" {
+			parentID = id
+			logger.Info("Using existing folder", "name", folderName, "id", parentID)
+		} else {
+			// If folder doesn't exist, create it unless the create mode forbids it
+			if createMode == createNone || (createMode == createLeaf && i < len(folders)-1) {
+				return "", nil, fmt.Errorf("%w: %s does not exist and -create-mode=%s forbids creating it", ErrFolderNotFound, folderName, createMode)
+			}
+			if dryRun {
+				planned, err := plannedFolders(anchor, folders, i, createMode)
+				return "", planned, err
+			}
+			id, err := r.createFolder(ctx, parentID, folderName)
+			if err != nil {
+				return "", nil, err
+			}
+			parentID = id
+		}
+
+		if err := r.store(folderCacheKey(anchor, folders[:i+1]), parentID); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return parentID, nil, nil
+}
+
+// folderCandidates returns the folders in files, or else the shortcuts to
+// folders with their Id set to the target. A shortcut lets a path run
+// through a folder shared by someone else.
+func folderCandidates(files []*drive.File) []*drive.File {
+	var folders []*drive.File
+	for _, f := range files {
+		if f.MimeType == folderMimeType {
+			folders = append(folders, f)
+		}
+	}
+	if len(folders) > 0 {
+		return folders
+	}
+	for _, f := range files {
+		if f.MimeType == shortcutMimeType && f.ShortcutDetails != nil && f.ShortcutDetails.TargetMimeType == folderMimeType {
+			logger.Debug("Following shortcut", "name", f.Name, "id", f.Id, "target", f.ShortcutDetails.TargetId)
+			target := *f
+			target.Id = f.ShortcutDetails.TargetId
+			folders = append(folders, &target)
+		}
+	}
+	return folders
+}
+
+// chooseFolder returns the ID of the folder at folderPath among candidates,
+// or "" if there is none. Several folders may share a name; -prefer picks
+// one, -strict refuses to guess, and otherwise the first listed is used.
+func (r *FolderResolver) chooseFolder(folderPath string, candidates []*drive.File) (string, error) {
+	switch len(candidates) {
+	case 0:
+		return "", nil
+	case 1:
+		return candidates[0].Id, nil
+	}
+
+	switch {
+	case r.prefer == preferNewest || r.prefer == preferOldest:
+		sorted := slices.Clone(candidates)
+		// RFC 3339 times in UTC sort as strings
+		slices.SortStableFunc(sorted, func(a, b *drive.File) int {
+			return strings.Compare(a.CreatedTime, b.CreatedTime)
+		})
+		chosen := sorted[0]
+		if r.prefer == preferNewest {
+			chosen = sorted[len(sorted)-1]
+		}
+		logger.Info("Several folders share a name, using the "+r.prefer, "path", folderPath, "id", chosen.Id)
+		return chosen.Id, nil
+	case strings.HasPrefix(r.prefer, preferIDPrefix):
+		id := strings.TrimPrefix(r.prefer, preferIDPrefix)
+		for _, f := range candidates {
+			if f.Id == id {
+				return id, nil
+			}
+		}
+	case !r.strict:
+		logger.Warn("Several folders share a name, using the first one; pass -strict or -prefer to choose", "path", folderPath, "id", candidates[0].Id, "count", len(candidates))
+		return candidates[0].Id, nil
+	}
+
+	var lines []string
+	for _, f := range candidates {
+		lines = append(lines, fmt.Sprintf("  %s (created %s)", f.Id, f.CreatedTime))
+	}
+	return "", fmt.Errorf("%w: %d folders are at %s, choose one with -prefer=newest, -prefer=oldest or -prefer=id:<id>:\n%s",
+		ErrAmbiguousFolder, len(candidates), folderPath, strings.Join(lines, "\n"))
+}
+
+// plannedFolders returns the paths of folders[from:], which a dry run would
+// create, or an error if the create mode forbids one of them
+func plannedFolders(anchor string, folders []string, from int, createMode string) ([]string, error) {
+	var paths []string
+	for i := from; i < len(folders); i++ {
+		if createMode == createNone || (createMode == createLeaf && i < len(folders)-1) {
+			return nil, fmt.Errorf("%w: %s does not exist and -create-mode=%s forbids creating it", ErrFolderNotFound, folders[i], createMode)
+		}
+		paths = append(paths, anchor+"/"+strings.Join(folders[:i+1], "/"))
+	}
+	return paths, nil
+}
+
+// findStarredFolder looks up a starred folder by name
+func findStarredFolder(ctx context.Context, api DriveAPI, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("starred folder name is empty")
+	}
+
+	query := buildQuery(
+		"name = "+quoteQuery(name),
+		"mimeType = "+quoteQuery(folderMimeType),
+		"starred = true",
+		"trashed = false",
+	)
+
+	logger.Debug("Searching starred folder", "name", name)
+
+	files, err := api.ListFiles(ctx, query, "id, name", 0, 0)
+	if err != nil {
+		return "", fmt.Errorf("unable to search starred folder: %w", classifyAPIError(err))
+	}
+
+	switch len(files) {
+	case 0:
+		return "", fmt.Errorf("no starred folder named %s", name)
+	case 1:
+		logger.Info("Using starred folder", "name", name, "id", files[0].Id)
+		return files[0].Id, nil
+	default:
+		return "", fmt.Errorf("%d starred folders named %s, unstar the extras or use a full path", len(files), name)
+	}
+}
+
+// findComputerFolder looks up a machine folder from the "Computers" section.
+// These are top-level folders outside My Drive, so they have no parents.
+func findComputerFolder(ctx context.Context, api DriveAPI, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("computer name is empty")
+	}
+
+	query := buildQuery(
+		"name = "+quoteQuery(name),
+		"mimeType = "+quoteQuery(folderMimeType),
+		"'me' in owners",
+		"trashed = false",
+	)
+
+	logger.Debug("Searching computer folder", "name", name)
+
+	files, err := api.ListFiles(ctx, query, "id, name, parents", 0, 0)
+	if err != nil {
+		return "", fmt.Errorf("unable to search computer folder: %w", classifyAPIError(err))
+	}
+
+	var ids []string
+	for _, file := range files {
+		if len(file.Parents) == 0 {
+			ids = append(ids, file.Id)
+		}
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no computer named %s", name)
+	case 1:
+		logger.Info("Using computer folder", "name", name, "id", ids[0])
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("%d computers named %s, rename one in the Backup and Sync settings", len(ids), name)
+	}
+}
+
+// findSharedDrive resolves a shared drive by ID or name. The root folder of
+// a shared drive has the same ID as the drive itself.
+func findSharedDrive(ctx context.Context, api DriveAPI, nameOrID string) (string, error) {
+	if nameOrID == "" {
+		return "", fmt.Errorf("shared drive name is empty")
+	}
+
+	logger.Debug("Searching shared drive", "name", nameOrID)
+
+	drives, err := api.SharedDrives(ctx, nameOrID)
+	if err != nil {
+		return "", fmt.Errorf("unable to search shared drive: %w", classifyAPIError(err))
+	}
+
+	switch len(drives) {
+	case 0:
+		return "", fmt.Errorf("no shared drive named %s", nameOrID)
+	case 1:
+		logger.Info("Using shared drive", "name", nameOrID, "id", drives[0].Id)
+		return drives[0].Id, nil
+	default:
+		return "", fmt.Errorf("%d shared drives named %s, use the drive ID instead", len(drives), nameOrID)
+	}
+}
+
+// resolveDriveFile finds the file an argument names: a Drive path such as
+// /reports/2024/summary or starred:Reports/summary, or a bare file ID. A
+// path that ends at an anchor (e.g. id:<id>) names the anchor's folder.
+func resolveDriveFile(ctx context.Context, svc *Services, arg string) (*drive.File, error) {
+	const fields = "id, name, mimeType, parents"
+
+	arg = cleanDrivePath(arg)
+	anchor, folders := splitFolderPath(arg)
+	if !strings.Contains(arg, "/") && anchor == "" {
+		f, err := svc.Files.GetFile(ctx, arg, fields)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s: %w", arg, classifyAPIError(err))
+		}
+		return f, nil
+	}
+	if len(folders) == 0 {
+		id, err := svc.Folders.resolveAnchor(ctx, anchor)
+		if err != nil {
+			return nil, err
+		}
+		f, err := svc.Files.GetFile(ctx, id, fields)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get %s: %w", arg, classifyAPIError(err))
+		}
+		return f, nil
+	}
+
+	name := folders[len(folders)-1]
+	parentID, err := svc.Folders.FindOrCreate(ctx, folderCacheKey(anchor, folders[:len(folders)-1]), createNone)
+	if err != nil {
+		return nil, err
+	}
+	query := buildQuery(
+		"name = "+quoteQuery(name),
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
+	files, err := svc.Files.ListFiles(ctx, query, fields, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search %s: %w", arg, classifyAPIError(err))
+	}
+	switch len(files) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s does not exist", ErrFileNotFound, arg)
+	case 1:
+		return files[0], nil
+	default:
+		return nil, fmt.Errorf("%d files are named %s, use the file ID instead", len(files), arg)
+	}
+}
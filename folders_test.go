@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestFindOrCreateNestedPath(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	r, err := NewFolderResolver(fake, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := r.FindOrCreate(ctx, "/reports/2024/Q1", createAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders, err := fake.ListFiles(ctx, "mimeType = "+quoteQuery(folderMimeType), "id", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 3 {
+		t.Fatalf("created %d folders, want 3", len(folders))
+	}
+
+	// A fresh resolver finds the folders instead of creating them again
+	r, err = NewFolderResolver(fake, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := r.FindOrCreate(ctx, `reports//2024/Q1/`, createNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id {
+		t.Errorf("resolved %s, want %s", again, id)
+	}
+}
+
+func TestFindOrCreateQuotedNames(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	r, err := NewFolderResolver(fake, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A folder whose name only differs by the quote must not match
+	if _, err := fake.CreateFile(ctx, &drive.File{Name: "OBrien", MimeType: folderMimeType}, nil, UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := r.FindOrCreate(ctx, "/O'Brien", createAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fake.GetFile(ctx, id, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "O'Brien" {
+		t.Errorf("resolved folder %q, want O'Brien", f.Name)
+	}
+}
+
+func TestFindOrCreateModes(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	r, err := NewFolderResolver(fake, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.FindOrCreate(ctx, "/missing", createNone); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("createNone: got %v, want ErrFolderNotFound", err)
+	}
+	if _, err := r.FindOrCreate(ctx, "/missing/leaf", createLeaf); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("createLeaf with a missing parent: got %v, want ErrFolderNotFound", err)
+	}
+
+	id, planned, err := r.Plan(ctx, "/a/b", createAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "" || !slices.Equal(planned, []string{"/a", "/a/b"}) {
+		t.Errorf("Plan = %q, %q, want the folders /a and /a/b planned", id, planned)
+	}
+	if files, _ := fake.ListFiles(ctx, "trashed = false", "id", 0, 0); len(files) != 0 {
+		t.Errorf("Plan created %d files", len(files))
+	}
+}
+
+func TestResolveDriveFile(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	folders, err := NewFolderResolver(fake, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &Services{Files: fake, Folders: folders}
+
+	parentID, err := folders.FindOrCreate(ctx, "/reports", createAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := fake.CreateFile(ctx, &drive.File{Name: "summary", MimeType: docMimeType, Parents: []string{parentID}}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arg := range []string{"/reports/summary", doc.Id} {
+		f, err := resolveDriveFile(ctx, svc, arg)
+		if err != nil {
+			t.Errorf("resolveDriveFile(%q): %v", arg, err)
+			continue
+		}
+		if f.Id != doc.Id {
+			t.Errorf("resolveDriveFile(%q) = %s, want %s", arg, f.Id, doc.Id)
+		}
+	}
+	if _, err := resolveDriveFile(ctx, svc, "/reports/nothing"); exitCode(err) != exitNotFound {
+		t.Errorf("resolveDriveFile of a missing file: got %v, want exit code %d", err, exitNotFound)
+	}
+}
+
+func TestCleanDrivePath(t *testing.T) {
+	defer func(saved bool) { backslashSeparates = saved }(backslashSeparates)
+
+	tests := []struct {
+		path      string
+		backslash bool
+		want      string
+	}{
+		{"/reports//2024/", false, "/reports/2024"},
+		{"/", false, "/"},
+		{`/reports\2024`, false, `/reports\2024`},
+		{`a\b`, false, `a\b`},
+		{`\reports\2024\`, true, "/reports/2024"},
+		{`reports\\2024`, true, "reports/2024"},
+	}
+	for _, tt := range tests {
+		backslashSeparates = tt.backslash
+		if got := cleanDrivePath(tt.path); got != tt.want {
+			t.Errorf("cleanDrivePath(%q) with backslashSeparates %v = %q, want %q", tt.path, tt.backslash, got, tt.want)
+		}
+	}
+}
+
+func TestFolderRetryBackoff(t *testing.T) {
+	want := []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second, 2 * time.Second}
+	for i, w := range want {
+		if got := folderRetryBackoff(i + 1); got != w {
+			t.Errorf("folderRetryBackoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+	// Every pause fits well within the lock marker's lifetime
+	if folderRetryMaxDelay*folderCreateAttempts >= lockTTL {
+		t.Errorf("retries may outlast the folder lock")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// importFormatsTTL is how long the cached import formats of Drive are used
+// before they are fetched again
+const importFormatsTTL = 7 * 24 * time.Hour
+
+// importFormatsCache is the layout of the import formats cache file
+type importFormatsCache struct {
+	FetchedAt time.Time           `json:"fetched_at"`
+	Formats   map[string][]string `json:"formats"`
+}
+
+// ImportFormats knows which source MIME types Drive converts into which
+// Google Workspace types, from about.importFormats. They are fetched once
+// per run, or read from a cache file while it is fresh.
+type ImportFormats struct {
+	srv       *drive.Service
+	cacheFile string
+
+	mu      sync.Mutex
+	loaded  bool
+	formats map[string][]string
+}
+
+// NewImportFormats creates the import formats of srv, cached in cacheFile
+// if it is set
+func NewImportFormats(srv *drive.Service, cacheFile string) *ImportFormats {
+	return &ImportFormats{srv: srv, cacheFile: cacheFile}
+}
+
+// Check fails with ErrUnsupportedFileType if Drive cannot convert
+// sourceMime into targetMime. When the formats cannot be fetched it only
+// warns, leaving the decision to the upload.
+func (f *ImportFormats) Check(ctx context.Context, sourceMime string, targetMime string) error {
+	formats := f.load(ctx)
+	if formats == nil {
+		return nil
+	}
+	targets, ok := formats[sourceMime]
+	if !ok {
+		return fmt.Errorf("%w: Drive cannot convert %s files (use -force to upload anyway)", ErrUnsupportedFileType, sourceMime)
+	}
+	if !slices.Contains(targets, targetMime) {
+		names := make([]string, len(targets))
+		for i, t := range targets {
+			names[i] = formatName(t)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("%w: Drive converts %s only into %s, not %s (use -force to upload anyway)",
+			ErrUnsupportedFileType, sourceMime, strings.Join(names, ", "), formatName(targetMime))
+	}
+	return nil
+}
+
+// load returns the import formats, or nil if they are unknown
+func (f *ImportFormats) load(ctx context.Context) map[string][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.loaded {
+		return f.formats
+	}
+	f.loaded = true
+
+	cached, err := f.readCache()
+	if err != nil {
+		logger.Warn("Unable to read import formats cache", "err", err)
+	}
+	if cached != nil && time.Since(cached.FetchedAt) < importFormatsTTL {
+		f.formats = cached.Formats
+		return f.formats
+	}
+
+	about, err := f.srv.About.Get().Fields("importFormats").Context(ctx).Do()
+	if err != nil {
+		// A stale cache is still better than no check
+		logger.Warn("Unable to fetch the import formats of Drive", "err", classifyAPIError(err))
+		if cached != nil {
+			f.formats = cached.Formats
+		}
+		return f.formats
+	}
+	f.formats = about.ImportFormats
+	if err := f.writeCache(); err != nil {
+		logger.Warn("Unable to write import formats cache", "err", err)
+	}
+	return f.formats
+}
+
+// readCache returns the cache file's contents, or nil if there is none
+func (f *ImportFormats) readCache() (*importFormatsCache, error) {
+	if f.cacheFile == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(f.cacheFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cache importFormatsCache
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", f.cacheFile, err)
+	}
+	if len(cache.Formats) == 0 {
+		return nil, nil
+	}
+	return &cache, nil
+}
+
+func (f *ImportFormats) writeCache() error {
+	if f.cacheFile == "" || len(f.formats) == 0 {
+		return nil
+	}
+	b, err := json.MarshalIndent(importFormatsCache{FetchedAt: time.Now().UTC(), Formats: f.formats}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.cacheFile), 0700); err != nil {
+		return err
+	}
+	tmp := f.cacheFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.cacheFile)
+}
+
+// defaultImportFormatsFile is import-formats.json in the config directory
+func defaultImportFormatsFile() string {
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "import-formats.json")
+	}
+	return ""
+}
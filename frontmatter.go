@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatterDelimiter opens and closes a YAML front matter block
+const frontMatterDelimiter = "---"
+
+// tagsProperty is the Drive property holding the comma-separated tags
+const tagsProperty = "tags"
+
+// FrontMatter holds the front matter fields used when converting Markdown
+type FrontMatter struct {
+	// Title names the document, with ConvertOptions.FrontMatter
+	Title string `yaml:"title"`
+	// Folder is a subfolder of the destination, with ConvertOptions.FrontMatter
+	Folder string `yaml:"folder"`
+	// Tags become Drive properties, with ConvertOptions.FrontMatter
+	Tags frontMatterTags `yaml:"tags"`
+	// DocKey names a logical document, e.g. "doc_key: onboarding-guide".
+	// The registry, a bucket of the state database, maps it to a fixed Doc
+	// ID, so links survive renames and moves of the source file.
+	DocKey string `yaml:"doc_key"`
+}
+
+// frontMatterTags is a YAML list of tags, or a single comma-separated
+// string of them
+type frontMatterTags []string
+
+// UnmarshalYAML accepts both "tags: [a, b]" and "tags: a, b"
+func (t *frontMatterTags) UnmarshalYAML(node *yaml.Node) error {
+	var items []string
+	switch node.Kind {
+	case yaml.SequenceNode:
+		if err := node.Decode(&items); err != nil {
+			return err
+		}
+	case yaml.ScalarNode:
+		items = strings.Split(node.Value, ",")
+	default:
+		return fmt.Errorf("line %d: tags must be a list or a string", node.Line)
+	}
+	*t = nil
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			*t = append(*t, item)
+		}
+	}
+	return nil
+}
+
+// splitFrontMatter splits a leading "---" delimited block from Markdown
+// content. Without a complete block the whole content is the body.
+func splitFrontMatter(content string) (block string, body string, ok bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	first, rest, found := strings.Cut(content, "\n")
+	if !found || strings.TrimSpace(first) != frontMatterDelimiter {
+		return "", content, false
+	}
+	var lines []string
+	for {
+		var line string
+		line, rest, found = strings.Cut(rest, "\n")
+		if strings.TrimSpace(line) == frontMatterDelimiter {
+			return strings.Join(lines, "\n"), rest, true
+		}
+		if !found {
+			// Unterminated block, treat the whole file as body
+			return "", content, false
+		}
+		lines = append(lines, line)
+	}
+}
+
+// parseFrontMatter decodes the front matter of Markdown content, returning
+// it with the remaining body. Content without front matter gives nil.
+func parseFrontMatter(content string) (*FrontMatter, string, error) {
+	block, body, ok := splitFrontMatter(content)
+	if !ok {
+		return nil, body, nil
+	}
+	var fm FrontMatter
+	if err := yaml.Unmarshal([]byte(block), &fm); err != nil {
+		return nil, body, fmt.Errorf("invalid front matter: %v", err)
+	}
+	return &fm, body, nil
+}
+
+// readFrontMatter parses the front matter of a file and rewinds it
+func readFrontMatter(file *os.File) (*FrontMatter, error) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	fm, _, err := parseFrontMatter(string(content))
+	return fm, err
+}
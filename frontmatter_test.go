@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *FrontMatter
+		body    string
+	}{
+		{
+			name:    "no front matter",
+			content: "# Notes\n",
+			body:    "# Notes\n",
+		},
+		{
+			name:    "unterminated block",
+			content: "---\ntitle: Notes\n",
+			body:    "---\ntitle: Notes\n",
+		},
+		{
+			name:    "fields",
+			content: "---\ntitle: Release notes\nfolder: /eng/\ndoc_key: notes\n---\n# Notes\n",
+			want:    &FrontMatter{Title: "Release notes", Folder: "/eng/", DocKey: "notes"},
+			body:    "# Notes\n",
+		},
+		{
+			name:    "escaped quotes",
+			content: "---\ntitle: \"The \\\"new\\\" plan\"\n---\n",
+			want:    &FrontMatter{Title: `The "new" plan`},
+		},
+		{
+			name:    "block scalar",
+			content: "---\ntitle: >-\n  A long\n  title\n---\nbody\n",
+			want:    &FrontMatter{Title: "A long title"},
+			body:    "body\n",
+		},
+		{
+			name:    "number as title",
+			content: "---\ntitle: 2024\n---\n",
+			want:    &FrontMatter{Title: "2024"},
+		},
+		{
+			name:    "tag list keeps commas",
+			content: "---\ntags:\n  - \"a, b\"\n  - c\n---\n",
+			want:    &FrontMatter{Tags: frontMatterTags{"a, b", "c"}},
+		},
+		{
+			name:    "inline tag list",
+			content: "---\ntags: [a, b]\n---\n",
+			want:    &FrontMatter{Tags: frontMatterTags{"a", "b"}},
+		},
+		{
+			name:    "comma-separated tags",
+			content: "---\ntags: a, b,\n---\n",
+			want:    &FrontMatter{Tags: frontMatterTags{"a", "b"}},
+		},
+		{
+			name:    "byte order mark",
+			content: "\ufeff---\ntitle: Notes\n---\n",
+			want:    &FrontMatter{Title: "Notes"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, body, err := parseFrontMatter(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("front matter = %+v, want %+v", got, tt.want)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatterInvalid(t *testing.T) {
+	for _, content := range []string{
+		"---\ntitle: [unclosed\n---\n",
+		"---\ntags:\n  team: eng\n---\n",
+	} {
+		if _, _, err := parseFrontMatter(content); err == nil {
+			t.Errorf("parseFrontMatter(%q) succeeded, want an error", content)
+		}
+	}
+}
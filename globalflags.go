@@ -0,0 +1,71 @@
+package main
+
+import "strings"
+
+// globalFlag is a flag every subcommand accepts. splitGlobalFlags removes
+// it from the arguments before the subcommand parses them.
+type globalFlag struct {
+	// isBool flags take no separate value, but accept -name=false
+	isBool bool
+	set    func(value string) error
+}
+
+// stringFlag stores the last value given in p
+func stringFlag(p *string) globalFlag {
+	return globalFlag{set: func(value string) error {
+		*p = value
+		return nil
+	}}
+}
+
+// boolFlag stores in p whether the flag is set
+func boolFlag(p *bool) globalFlag {
+	return globalFlag{isBool: true, set: func(value string) error {
+		*p = value == "true"
+		return nil
+	}}
+}
+
+// splitGlobalFlags removes the flags named in tables from args, given as
+// -name value, -name=value or with two dashes, and passes their values to
+// the handlers. Arguments from "--" on are left alone. A failing handler
+// doesn't stop the others; the first error is returned.
+func splitGlobalFlags(args []string, tables ...map[string]globalFlag) ([]string, error) {
+	var rest []string
+	var firstErr error
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		f, ok := findGlobalFlag(tables, name)
+		if !strings.HasPrefix(arg, "-") || !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		switch {
+		case hasValue:
+		case f.isBool:
+			value = "true"
+		case i+1 < len(args):
+			i++
+			value = args[i]
+		}
+		if err := f.set(value); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return rest, firstErr
+}
+
+// findGlobalFlag looks a flag up in the tables
+func findGlobalFlag(tables []map[string]globalFlag, name string) (globalFlag, bool) {
+	for _, table := range tables {
+		if f, ok := table[name]; ok {
+			return f, true
+		}
+	}
+	return globalFlag{}, false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitGlobalFlags(t *testing.T) {
+	var config Config
+	var profile string
+	logOpts := LogOptions{Format: "text"}
+	args := []string{
+		"-profile", "work", "sync", "./notes", "--qps=2.5", "-vv", "-path", "/notes",
+		"-debug-http", "-share-upload-rate=false", "-log-format", "json",
+		"-http-timeout", "30s", "--", "-qps", "9",
+	}
+	rest, err := splitGlobalFlags(args,
+		map[string]globalFlag{"profile": stringFlag(&profile)},
+		logFlags(&logOpts), rateFlags(&config), httpFlags(&config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"sync", "./notes", "-path", "/notes", "--", "-qps", "9"}
+	if !reflect.DeepEqual(rest, want) {
+		t.Errorf("rest = %q, want %q", rest, want)
+	}
+	if profile != "work" {
+		t.Errorf("profile = %q", profile)
+	}
+	if logOpts != (LogOptions{Verbosity: 2, Format: "json"}) {
+		t.Errorf("log options = %+v", logOpts)
+	}
+	if config.QPS != 2.5 || !config.DebugHTTP || config.ShareUploadRate || config.HTTPTimeout != 30*time.Second {
+		t.Errorf("config: qps %v, debug-http %v, share-upload-rate %v, http-timeout %v",
+			config.QPS, config.DebugHTTP, config.ShareUploadRate, config.HTTPTimeout)
+	}
+}
+
+func TestSplitGlobalFlagsAppliesAllBeforeFailing(t *testing.T) {
+	var config Config
+	var report string
+	rest, err := splitGlobalFlags([]string{"-qps", "fast", "list", "-errors-json", "errors.json"},
+		map[string]globalFlag{"errors-json": stringFlag(&report)}, rateFlags(&config))
+	if err == nil {
+		t.Error("an invalid -qps was accepted")
+	}
+	// The report still goes where asked, so the failure is recorded
+	if report != "errors.json" {
+		t.Errorf("errors-json = %q after a failing flag", report)
+	}
+	if !reflect.DeepEqual(rest, []string{"list"}) {
+		t.Errorf("rest = %q", rest)
+	}
+}
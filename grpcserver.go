@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	doc2gdocpb "github.com/programzheng/doc2gdoc/proto"
+)
+
+// exportChunkSize is the size of the chunks Export streams
+const exportChunkSize = 64 << 10
+
+// grpcCodes map the HTTP statuses of errorStatus to gRPC codes
+var grpcCodes = map[int]codes.Code{
+	http.StatusNotFound:             codes.NotFound,
+	http.StatusUnsupportedMediaType: codes.InvalidArgument,
+	http.StatusTooManyRequests:      codes.ResourceExhausted,
+	http.StatusServiceUnavailable:   codes.Unavailable,
+}
+
+// grpcServer serves the Doc2Gdoc service of proto/doc2gdoc.proto on the
+// job queue and Drive client of the HTTP API
+type grpcServer struct {
+	doc2gdocpb.UnimplementedDoc2GdocServer
+	s *server
+}
+
+// newGRPCServer creates the gRPC server, checking the bearer token in the
+// authorization metadata like the HTTP API
+func (s *server) newGRPCServer() *grpc.Server {
+	g := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := s.authenticateGRPC(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := s.authenticateGRPC(stream.Context())
+			if err != nil {
+				return err
+			}
+			return handler(srv, tenantStream{ServerStream: stream, ctx: ctx})
+		}),
+	)
+	doc2gdocpb.RegisterDoc2GdocServer(g, grpcServer{s: s})
+	return g
+}
+
+// authenticateGRPC checks the bearer token and, in multi-tenant mode,
+// returns ctx with the tenant named by the x-api-key metadata
+func (s *server) authenticateGRPC(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if s.authToken != "" {
+		token, _ := strings.CutPrefix(header("authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.authToken)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+		}
+	}
+	if s.tenants == nil {
+		return ctx, nil
+	}
+	tenant, err := s.tenants.tenant(header)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return withTenant(ctx, tenant), nil
+}
+
+// tenantStream carries the context of authenticateGRPC into a stream
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tenantStream) Context() context.Context {
+	return s.ctx
+}
+
+// Convert spools the streamed source and queues its job
+func (g grpcServer) Convert(stream doc2gdocpb.Doc2Gdoc_ConvertServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	meta := first.GetMetadata()
+	if meta == nil {
+		return status.Error(codes.InvalidArgument, "the first message must carry the metadata")
+	}
+	drivePath := meta.Path
+	if drivePath == "" {
+		drivePath = g.s.defaultPath
+	}
+	opts, err := g.s.convertOptions(meta.OnConflict, meta.Target, meta.Title)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	tenant := tenantFrom(stream.Context())
+	if _, err := g.s.servicesFor(tenant); err != nil {
+		return grpcError(err)
+	}
+
+	job := g.s.queue.NewJob(uploadName(meta.Filename), drivePath, opts)
+	job.Tenant = tenant
+	localPath := g.s.queue.SpoolPath(job)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	size, err := g.spool(stream, localPath)
+	if err != nil {
+		os.RemoveAll(filepath.Dir(localPath))
+		return err
+	}
+	job.BytesTotal = size
+	if err := g.s.queue.Enqueue(job); err != nil {
+		os.RemoveAll(filepath.Dir(localPath))
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return stream.SendAndClose(jobMessage(job))
+}
+
+// spool writes the chunks of a Convert stream to localPath
+func (g grpcServer) spool(stream doc2gdocpb.Doc2Gdoc_ConvertServer, localPath string) (int64, error) {
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "unable to save upload: %v", err)
+	}
+	defer dst.Close()
+	var size int64
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		chunk := req.GetChunk()
+		size += int64(len(chunk))
+		if size > g.s.maxUpload {
+			return 0, status.Errorf(codes.ResourceExhausted, "upload exceeds %d MB", g.s.maxUpload>>20)
+		}
+		if _, err := dst.Write(chunk); err != nil {
+			return 0, status.Errorf(codes.Internal, "unable to save upload: %v", err)
+		}
+	}
+	if err := dst.Close(); err != nil {
+		return 0, status.Errorf(codes.Internal, "unable to save upload: %v", err)
+	}
+	return size, nil
+}
+
+func (g grpcServer) GetJob(ctx context.Context, req *doc2gdocpb.GetJobRequest) (*doc2gdocpb.Job, error) {
+	job, ok := g.s.queue.Get(req.Id)
+	if !ok || job.Tenant != tenantFrom(ctx) {
+		return nil, status.Errorf(codes.NotFound, "no job %s", req.Id)
+	}
+	return jobMessage(job), nil
+}
+
+func (g grpcServer) ListFolders(ctx context.Context, req *doc2gdocpb.ListFoldersRequest) (*doc2gdocpb.ListFoldersResponse, error) {
+	drivePath := req.Path
+	if drivePath == "" {
+		drivePath = g.s.defaultPath
+	}
+	parentID, files, err := g.s.listFolders(ctx, drivePath)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &doc2gdocpb.ListFoldersResponse{Path: drivePath, Id: parentID}
+	for _, f := range files {
+		resp.Folders = append(resp.Folders, &doc2gdocpb.Folder{Id: f.Id, Name: f.Name})
+	}
+	return resp, nil
+}
+
+func (g grpcServer) Export(req *doc2gdocpb.ExportRequest, stream doc2gdocpb.Doc2Gdoc_ExportServer) error {
+	ctx := stream.Context()
+	svc, err := g.s.servicesFor(tenantFrom(ctx))
+	if err != nil {
+		return grpcError(err)
+	}
+	file, err := svc.Files.GetFile(ctx, req.FileId, "id, mimeType")
+	if err != nil {
+		return grpcError(fmt.Errorf("unable to get %s: %w", req.FileId, classifyAPIError(err)))
+	}
+	if !strings.HasPrefix(file.MimeType, "application/vnd.google-apps.") {
+		return status.Errorf(codes.InvalidArgument, "%s is not a Google Workspace document", req.FileId)
+	}
+	format, err := exportFormat(file.MimeType, req.Format)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	body, err := svc.Files.Export(ctx, file.Id, format.mimeType)
+	if err != nil {
+		return grpcError(fmt.Errorf("unable to export: %w", classifyAPIError(err)))
+	}
+	defer body.Close()
+
+	buf := make([]byte, exportChunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&doc2gdocpb.ExportChunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return grpcError(fmt.Errorf("unable to export: %w", classifyAPIError(err)))
+		}
+	}
+}
+
+// grpcError gives err the gRPC code matching its HTTP status
+func grpcError(err error) error {
+	code, ok := grpcCodes[errorStatus(err)]
+	if !ok {
+		code = codes.Unknown
+	}
+	return status.Error(code, err.Error())
+}
+
+// jobMessage converts a job into its gRPC message
+func jobMessage(job Job) *doc2gdocpb.Job {
+	msg := &doc2gdocpb.Job{
+		Id:            job.ID,
+		Status:        job.Status,
+		Source:        job.Source,
+		DrivePath:     job.DrivePath,
+		BytesUploaded: job.BytesUploaded,
+		BytesTotal:    job.BytesTotal,
+		Error:         job.Error,
+		CreatedAt:     timestamppb.New(job.CreatedAt),
+		StartedAt:     timestampMessage(job.StartedAt),
+		FinishedAt:    timestampMessage(job.FinishedAt),
+	}
+	if r := job.Result; r != nil {
+		msg.Result = &doc2gdocpb.ConvertResult{
+			Status:   r.Status,
+			Name:     r.Name,
+			FileId:   r.FileID,
+			Link:     r.Link,
+			Location: r.Location,
+		}
+	}
+	return msg
+}
+
+func timestampMessage(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
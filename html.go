@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// htmlLinkRe matches <link> tags, whose stylesheets are inlined
+	htmlLinkRe = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	// htmlSrcRe matches the src of <img> tags and the VML images of Word
+	htmlSrcRe = regexp.MustCompile(`(?is)(<(?:img|v:imagedata)\b[^>]*?\bsrc\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+	// htmlAttrRe matches an attribute of a tag
+	htmlAttrRe = regexp.MustCompile(`(?is)\b(rel|href)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// isHTML reports whether path is an HTML file by its extension
+func isHTML(path string) bool {
+	return sourceMimeTypes[strings.ToLower(filepath.Ext(path))] == "text/html"
+}
+
+// htmlAssetsDir returns the folder Word and browsers save the images and
+// styles of a "web page" export to, e.g. report_files for report.htm, or ""
+// if there is none
+func htmlAssetsDir(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, suffix := range []string{"_files", ".fld", "-Dateien", "_archivos", "_fichiers"} {
+		if info, err := os.Stat(base + suffix); err == nil && info.IsDir() {
+			return base + suffix
+		}
+	}
+	return ""
+}
+
+// bundleHTML inlines the local stylesheets and images an HTML file links to,
+// which Drive cannot resolve, into a copy in a temporary directory: styles
+// become <style> elements and images data: URLs. Remote resources are left
+// as they are. It returns the copy and a cleanup function removing it.
+func bundleHTML(path string) (string, func(), error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Dir(path)
+
+	inlined := 0
+	content := htmlLinkRe.ReplaceAllFunc(b, func(tag []byte) []byte {
+		attrs := htmlAttrs(tag)
+		if !strings.EqualFold(attrs["rel"], "stylesheet") {
+			return tag
+		}
+		css, ok := readLocalAsset(dir, attrs["href"])
+		if !ok {
+			return tag
+		}
+		inlined++
+		return []byte("<style>\n" + string(css) + "\n</style>")
+	})
+	content = htmlSrcRe.ReplaceAllFunc(content, func(m []byte) []byte {
+		sub := htmlSrcRe.FindSubmatch(m)
+		src := string(sub[2]) + string(sub[3])
+		data, ok := readLocalAsset(dir, src)
+		if !ok {
+			return m
+		}
+		inlined++
+		mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(src)))
+		if mimeType == "" {
+			mimeType = http.DetectContentType(data)
+		}
+		return []byte(fmt.Sprintf(`%s"data:%s;base64,%s"`, sub[1], mimeType, base64.StdEncoding.EncodeToString(data)))
+	})
+	logger.Info("Bundled HTML assets", "file", path, "assets", inlined)
+
+	tmp, err := os.MkdirTemp("", "doc2gdoc-html-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create temporary directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	out := filepath.Join(tmp, filepath.Base(path))
+	if err := os.WriteFile(out, content, 0600); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("unable to write bundled HTML: %v", err)
+	}
+	return out, cleanup, nil
+}
+
+// htmlAttrs returns the rel and href attributes of a tag
+func htmlAttrs(tag []byte) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range htmlAttrRe.FindAllSubmatch(tag, -1) {
+		attrs[strings.ToLower(string(m[1]))] = string(m[2]) + string(m[3]) + string(m[4])
+	}
+	return attrs
+}
+
+// readLocalAsset reads a relative or file: URL of an HTML file in dir. It
+// reports false for remote and data: URLs and missing files.
+func readLocalAsset(dir string, ref string) ([]byte, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || ref == "" || u.Host != "" || (u.Scheme != "" && u.Scheme != "file") {
+		return nil, false
+	}
+	p := filepath.FromSlash(u.Path)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		logger.Warn("Unable to inline HTML asset", "asset", ref, "err", err)
+		return nil, false
+	}
+	return data, true
+}
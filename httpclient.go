@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// sensitiveParams are query parameters -debug-http never logs the value of.
+// A resumable upload's upload_id grants access on its own.
+var sensitiveParams = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"client_secret": true,
+	"code":          true,
+	"key":           true,
+	"upload_id":     true,
+}
+
+// httpFlags are -proxy, -ca-cert, -http-timeout and -debug-http, which
+// every subcommand honors
+func httpFlags(config *Config) map[string]globalFlag {
+	flags := map[string]globalFlag{"debug-http": boolFlag(&config.DebugHTTP)}
+	for _, name := range []string{"proxy", "ca-cert", "http-timeout"} {
+		name := name
+		flags[name] = globalFlag{set: func(value string) error {
+			return setHTTPOption(config, name, value)
+		}}
+	}
+	return flags
+}
+
+// setHTTPOption parses a proxy, ca-cert or http-timeout value from a flag,
+// the config file or the environment
+func setHTTPOption(config *Config, name string, value string) error {
+	switch name {
+	case "proxy":
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid proxy %q, expected a URL like http://proxy:3128", value)
+		}
+		config.Proxy = value
+	case "ca-cert":
+		setPath(&config.CACertFile, value, "")
+	case "http-timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid http-timeout %q, expected a duration like 30s", value)
+		}
+		config.HTTPTimeout = d
+	}
+	return nil
+}
+
+// baseHTTPClient is the client under the authorization: config.HTTPClient
+// if one was injected, or one built from the proxy, CA and timeout
+// settings. Without -proxy, HTTPS_PROXY and NO_PROXY apply.
+func baseHTTPClient(config Config) (*http.Client, error) {
+	client := config.HTTPClient
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if config.Proxy != "" {
+			u, err := url.Parse(config.Proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy: %v", err)
+			}
+			transport.Proxy = http.ProxyURL(u)
+		}
+		if config.CACertFile != "" {
+			pool, err := loadCACerts(config.CACertFile)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		}
+		client = &http.Client{Transport: transport, Timeout: config.HTTPTimeout}
+	}
+	if config.DebugHTTP {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		debug := *client
+		debug.Transport = debugTransport{base: base, logger: newLogger(slog.LevelDebug, logFormat)}
+		client = &debug
+	}
+	return client, nil
+}
+
+// loadCACerts adds the PEM certificates of file to the system roots
+func loadCACerts(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA certificates: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no PEM certificates in %s", file)
+	}
+	return pool, nil
+}
+
+// debugTransport logs the metadata of every request and response. Bodies
+// and headers, which carry tokens and document contents, are left out.
+type debugTransport struct {
+	base   http.RoundTripper
+	logger *slog.Logger
+}
+
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	attrs := []any{
+		"method", req.Method,
+		"url", sanitizeURL(req.URL),
+		"duration", time.Since(start).Round(time.Millisecond),
+	}
+	if req.ContentLength > 0 {
+		attrs = append(attrs, "request_bytes", req.ContentLength)
+	}
+	if err != nil {
+		t.logger.Debug("HTTP request failed", append(attrs, "err", err)...)
+		return resp, err
+	}
+	attrs = append(attrs, "status", resp.StatusCode)
+	if resp.ContentLength >= 0 {
+		attrs = append(attrs, "response_bytes", resp.ContentLength)
+	}
+	t.logger.Debug("HTTP request", attrs...)
+	return resp, nil
+}
+
+// sanitizeURL returns u with the values of sensitiveParams redacted
+func sanitizeURL(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	query := clean.Query()
+	for name := range query {
+		if sensitiveParams[name] {
+			query.Set(name, "REDACTED")
+		}
+	}
+	clean.RawQuery = query.Encode()
+	return clean.String()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Languages of the CLI output. Messages are looked up by their English
+// format string; missing translations stay English.
+var (
+	traditionalChinese = language.MustParse("zh-TW")
+	supportedLanguages = []language.Tag{language.English, traditionalChinese}
+	languageMatcher    = language.NewMatcher(supportedLanguages)
+)
+
+// catalogs hold the translated format strings by language. Translations
+// may reorder arguments with explicit indexes such as %[2]s.
+var catalogs = map[language.Tag]map[string]string{
+	traditionalChinese: {
+		// Prompts
+		"Please visit this URL and authorize the application:\n%v\n": "請開啟此網址並授權應用程式：\n%v\n",
+		"Enter the authorization code: ":                             "請輸入授權碼：",
+		"%s %d file(s)?":                                             "要%s %d 個檔案嗎？",
+		"Move to trash":                                              "移至垃圾桶",
+		"Permanently delete":                                         "永久刪除",
+		"standard input is not a terminal, use -yes to confirm":      "標準輸入不是終端機，請使用 -yes 確認",
+
+		// Progress and results
+		"Skipped %s, unchanged since last upload (File ID: %s)\n": "已略過 %s，自上次上傳後未變更（檔案 ID：%s）\n",
+		"Skipped %s, already exists (File ID: %s)\n":              "已略過 %s，檔案已存在（檔案 ID：%s）\n",
+		"Successfully updated %s in %s\n":                         "已更新 %[2]s 中的 %[1]s\n",
+		"Successfully converted %s to %s\n":                       "已將 %s 轉換為 %s\n",
+		"File ID: %s\n":                                           "檔案 ID：%s\n",
+		"Location: Google Drive:%s\n":                             "位置：Google Drive:%s\n",
+		"Link: %s\n":                                              "連結：%s\n",
+		"Earlier revisions: doc2gdoc revisions %s\n":              "先前的版本：doc2gdoc revisions %s\n",
+		"Existing folder list:\n":                                 "現有資料夾：\n",
+		"\rUploading %s [%s%s] %s / %s":                           "\r正在上傳 %s [%s%s] %s / %s",
+		"[%d/%d] %s (%d converted, %d failed)\n":                  "[%d/%d] %s（已轉換 %d 個，失敗 %d 個）\n",
+		"%d of %d file(s) converted\n":                            "%[2]d 個檔案中已轉換 %[1]d 個\n",
+		"Nothing removed\n":                                       "未移除任何檔案\n",
+		"Deleted %s (ID: %s)\n":                                   "已刪除 %s（ID：%s）\n",
+		"Trashed %s (ID: %s)\n":                                   "已將 %s 移至垃圾桶（ID：%s）\n",
+		"Verified %s: %s\n":                                       "已驗證 %s：%s\n",
+		"%d of %d words found (%.1f%%), %d characters in the source, %d in the Doc": "%d／%d 個字詞相符（%.1f%%），來源 %d 個字元，文件 %d 個字元",
+		"Appended %s to %s: %s\n":    "已將 %s 附加到 %s：%s\n",
+		"Logged in as profile %s\n":  "已登入設定檔 %s\n",
+		"Logged out of profile %s\n": "已登出設定檔 %s\n",
+		"No profiles, create one with \"doc2gdoc auth login -profile <name>\"\n":                             "沒有任何設定檔，請以 \"doc2gdoc auth login -profile <name>\" 建立\n",
+		"%s changed locally and on Drive: keep [l]ocal, keep [r]emote, keep [b]oth, show [d]iff or [s]kip? ": "%s 在本機與雲端硬碟上都有變更：保留本機 [l]、保留雲端 [r]、兩者都保留 [b]、顯示差異 [d] 或略過 [s]？",
+		"No diff for %s files, open %s and %s to compare\n":                                                  "無法顯示 %s 檔案的差異，請開啟 %s 與 %s 比較\n",
+		"Stopped after %d consecutive transient failures, the rest were not started\n":                       "連續 %d 次暫時性失敗後停止，其餘檔案尚未開始\n",
+		"\nRe-authentication required: the stored token was revoked or expired\n":                            "\n需要重新驗證：儲存的權杖已被撤銷或過期\n",
+		"Re-authentication required: log in again and rerun with -resume to convert the rest\n":              "需要重新驗證：請重新登入後加上 -resume 再次執行以轉換其餘檔案\n",
+		"Re-authentication required: log in again and rerun\n":                                               "需要重新驗證：請重新登入後再次執行\n",
+		"Kept the previous version as %s (File ID: %s)\n":                                                    "已將先前的版本保留為 %s（檔案 ID：%s）\n",
+
+		// Dry runs
+		"[dry-run] append %s (%d bytes) to %s: %s\n": "[dry-run] 將 %s（%d 位元組）附加到 %s：%s\n",
+		"[dry-run] add tab %s from %s\n":             "[dry-run] 從 %[2]s 新增分頁 %[1]s\n",
+		"[dry-run] create folder Google Drive:%s\n":  "[dry-run] 建立資料夾 Google Drive:%s\n",
+		"[dry-run] %s %s as %s in Google Drive:%s\n": "[dry-run] %[1]s %[2]s（%[3]s）於 Google Drive:%[4]s\n",
+		"create":                                               "建立",
+		"update":                                               "更新",
+		"keep a version of and update":                         "保留版本並更新",
+		"[dry-run] publish to Google Drive:%s\n":               "[dry-run] 發佈到 Google Drive:%s\n",
+		"[dry-run] update %s (ID: %s)\n":                       "[dry-run] 更新 %s（ID：%s）\n",
+		"[dry-run] would update %d files\n":                    "[dry-run] 將更新 %d 個檔案\n",
+		"[dry-run] retry %s in Google Drive:%s (attempt %d)\n": "[dry-run] 重試 %s 至 Google Drive:%s（第 %d 次嘗試）\n",
+		"[dry-run] move %s to Google Drive:%s/%s\n":            "[dry-run] 將 %s 移動到 Google Drive:%s/%s\n",
+		"[dry-run] copy %s to Google Drive:%s/%s\n":            "[dry-run] 將 %s 複製到 Google Drive:%s/%s\n",
+		"[dry-run] trash %s (ID: %s)\n":                        "[dry-run] 將 %s 移至垃圾桶（ID：%s）\n",
+		"[dry-run] delete %s (ID: %s)\n":                       "[dry-run] 永久刪除 %s（ID：%s）\n",
+
+		// Commands
+		"Import formats:\n":                                            "匯入格式：\n",
+		"Export formats:\n":                                            "匯出格式：\n",
+		"No audit log entries\n":                                       "沒有稽核紀錄\n",
+		"Added %d tabs to %s\n":                                        "已在 %[2]s 新增 %[1]d 個分頁\n",
+		"Running %d job(s), logs in %s\n":                              "正在執行 %d 個工作，記錄檔位於 %s\n",
+		"Daemon started %s (PID %d)\n\n":                               "背景服務啟動於 %s（PID %d）\n\n",
+		"%d exported, %d unchanged, %d failed":                         "已匯出 %d 個，未變更 %d 個，失敗 %d 個",
+		", %d modified before -since":                                  "，%d 個在 -since 之前修改",
+		", %d other file(s) not exported":                              "，%d 個其他檔案未匯出",
+		"Export interrupted after %s\n":                                "匯出中斷，已完成：%s\n",
+		"Export finished: %s\n":                                        "匯出完成：%s\n",
+		"Exported %s to %s\n":                                          "已將 %s 匯出至 %s\n",
+		"%d file(s)\n":                                                 "%d 個檔案\n",
+		"%d file(s) OK\n":                                              "%d 個檔案正常\n",
+		"Cleared the journal in %s\n":                                  "已清除 %s 中的進度紀錄\n",
+		"Interrupted, %d row(s) not started\n":                         "已中斷，%d 列尚未開始\n",
+		"[row %d] %s -> %s\n":                                          "[第 %d 列] %s -> %s\n",
+		"[row %d] done in an earlier run (File ID: %s)\n":              "[第 %d 列] 已於先前執行完成（檔案 ID：%s）\n",
+		"[row %d] failed: %v\n":                                        "[第 %d 列] 失敗：%v\n",
+		"%d row(s) not started\n":                                      "%d 列尚未開始\n",
+		"[row %d] ok\n":                                                "[第 %d 列] 完成\n",
+		"Manifest finished: %d converted, %d failed, %d total\n":       "清單轉換完成：已轉換 %d 個，失敗 %d 個，共 %d 個\n",
+		"No files match %s\n":                                          "沒有符合 %s 的檔案\n",
+		"Updated %s (ID: %s)\n":                                        "已更新 %s（ID：%s）\n",
+		"Updated %d files\n":                                           "已更新 %d 個檔案\n",
+		"Copied %s to Google Drive:%s/%s (File ID: %s)\n":              "已將 %s 複製到 Google Drive:%s/%s（檔案 ID：%s）\n",
+		"Moved %s to Google Drive:%s/%s (File ID: %s)\n":               "已將 %s 移動到 Google Drive:%s/%s（檔案 ID：%s）\n",
+		"Already linked in Google Drive:%s/%s (Shortcut ID: %s)\n":     "已有 Google Drive:%s/%s 的捷徑（捷徑 ID：%s）\n",
+		"Linked in Google Drive:%s/%s (Shortcut ID: %s)\n":             "已在 Google Drive:%s/%s 建立捷徑（捷徑 ID：%s）\n",
+		"Copied to Google Drive:%s/%s (File ID: %s)\n":                 "已複製到 Google Drive:%s/%s（檔案 ID：%s）\n",
+		"Updated the copy in Google Drive:%s/%s (File ID: %s)\n":       "已更新 Google Drive:%s/%s 中的副本（檔案 ID：%s）\n",
+		"Watching Google Drive:%s, exporting to %s\n":                  "正在監看 Google Drive:%s，匯出至 %s\n",
+		"Stopped watching Google Drive:%s\n":                           "已停止監看 Google Drive:%s\n",
+		"Pulled %s to %s\n":                                            "已將 %s 下載至 %s\n",
+		"Removed %s\n":                                                 "已移除 %s\n",
+		"Retry queue is empty\n":                                       "重試佇列是空的\n",
+		"Waiting: %s (attempt %d, next at %s)\n":                       "等待中：%s（第 %d 次嘗試，下次於 %s）\n",
+		"Retried: %s\n":                                                "已重試：%s\n",
+		"Interrupted: %s\n":                                            "已中斷：%s\n",
+		"Failed again: %s (attempt %d): %v\n":                          "再次失敗：%s（第 %d 次嘗試）：%v\n",
+		"Giving up: %s after %d attempts: %v\n":                        "放棄：%s，已嘗試 %d 次：%v\n",
+		"%d revision(s) of %s\n":                                       "%[2]s 有 %[1]d 個版本\n",
+		"Exported revision %s of %s to %s\n":                           "已將 %[2]s 的版本 %[1]s 匯出至 %[3]s\n",
+		"Serving gRPC on %s\n":                                         "gRPC 服務位於 %s\n",
+		"Listening on %s\n":                                            "正在監聽 %s\n",
+		"Shared with %s as %s\n":                                       "已以%[2]s權限與 %[1]s 共用\n",
+		"Shared with anyone with the link as %s\n":                     "已以%s權限與知道連結的任何人共用\n",
+		"%d record(s) in %s\n":                                         "%[2]s 中有 %[1]d 筆紀錄\n",
+		"%d created, %d updated, %d deleted, %d unchanged, %d skipped": "已建立 %d 個，已更新 %d 個，已刪除 %d 個，未變更 %d 個，已略過 %d 個",
+		"Sync interrupted after %s\n":                                  "同步中斷，已完成：%s\n",
+		"Sync finished: %s\n":                                          "同步完成：%s\n",
+		"%d uploaded, %d downloaded, %d duplicated, %d removed locally, %d trashed, %d unchanged, %d conflicts": "已上傳 %d 個，已下載 %d 個，已保留兩份 %d 個，已在本機移除 %d 個，已移至垃圾桶 %d 個，未變更 %d 個，衝突 %d 個",
+		"Saved the remote version as %s\n":             "已將雲端版本儲存為 %s\n",
+		"Failed %s: %v\n":                              "%s 失敗：%v\n",
+		"Converted %s to Google Drive:%s (%s)\n":       "已將 %s 轉換至 Google Drive:%s（%s）\n",
+		"Watching %s, publishing to Google Drive:%s\n": "正在監看 %s，發佈至 Google Drive:%s\n",
+		"Stopped watching %s\n":                        "已停止監看 %s\n",
+		"Pruned %d of %d record(s)\n":                  "已清除 %[2]d 筆紀錄中的 %[1]d 筆\n",
+		"Would prune %d of %d record(s)\n":             "將清除 %[2]d 筆紀錄中的 %[1]d 筆\n",
+
+		// Errors
+		"Please specify the file path to convert":     "請指定要轉換的檔案路徑",
+		"Specify either files or -manifest, not both": "請指定檔案或 -manifest，不能同時使用",
+		"-title can only be used with a single file":  "-title 只能用於單一檔案",
+		"Unable to initialize client":                 "無法初始化用戶端",
+		"Unable to find target path":                  "找不到目標路徑",
+		"Unable to list folders":                      "無法列出資料夾",
+		"About failed":                                "查詢帳戶失敗",
+		"Append failed":                               "附加失敗",
+		"Audit failed":                                "查詢稽核紀錄失敗",
+		"Auth failed":                                 "驗證失敗",
+		"Batch failed":                                "批次轉換失敗",
+		"Completion failed":                           "產生補全指令碼失敗",
+		"Conversion failed":                           "轉換失敗",
+		"Copy failed":                                 "複製失敗",
+		"Daemon failed":                               "背景服務失敗",
+		"Export failed":                               "匯出失敗",
+		"Find failed":                                 "搜尋失敗",
+		"Jobs failed":                                 "查詢工作失敗",
+		"Lint failed":                                 "檢查失敗",
+		"List failed":                                 "列出失敗",
+		"Manifest failed":                             "清單轉換失敗",
+		"Meta failed":                                 "更新中繼資料失敗",
+		"Move failed":                                 "移動失敗",
+		"Provenance failed":                           "查詢來源紀錄失敗",
+		"Pull failed":                                 "下載失敗",
+		"Remove failed":                               "移除失敗",
+		"Retry failed":                                "重試失敗",
+		"Revisions failed":                            "查詢版本失敗",
+		"Serve failed":                                "服務執行失敗",
+		"State failed":                                "查詢狀態失敗",
+		"Sync failed":                                 "同步失敗",
+		"UI failed":                                   "介面執行失敗",
+		"Watch failed":                                "監看失敗",
+
+		// Usage errors
+		"Specify either -drive or -folder-id, not both":                                                     "請指定 -drive 或 -folder-id，不能同時使用",
+		"-verify-threshold must be between 0 and 1":                                                         "-verify-threshold 必須介於 0 與 1 之間",
+		"-break-after must not be negative":                                                                 "-break-after 不能是負數",
+		"-tabs names the spreadsheet and its tabs, it cannot be used with -manifest, -title or -sheet-name": "-tabs 指定試算表與其分頁，不能與 -manifest、-title 或 -sheet-name 一起使用",
+	},
+}
+
+// catalog is the catalog of the selected language, nil for English
+var catalog map[string]string
+
+// tr formats a message in the selected language
+func tr(format string, args ...any) string {
+	if t, ok := catalog[format]; ok {
+		format = t
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// setupLanguage selects the language of the output: lang if it is set,
+// else the DOC2GDOC_LANG, LC_ALL, LC_MESSAGES and LANG environment
+// variables in that order. Only an unsupported lang is an error; a locale
+// from the environment without translations falls back to English.
+func setupLanguage(lang string) error {
+	if lang != "" {
+		tag, ok := matchLanguage(lang)
+		if !ok {
+			return fmt.Errorf("unsupported language %q, expected en or zh-TW", lang)
+		}
+		catalog = catalogs[tag]
+		return nil
+	}
+	for _, name := range []string{"DOC2GDOC_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			tag, _ := matchLanguage(v)
+			catalog = catalogs[tag]
+			return nil
+		}
+	}
+	return nil
+}
+
+// matchLanguage maps a language tag or POSIX locale such as zh_TW.UTF-8 to
+// a supported language, English if there is no close match
+func matchLanguage(s string) (language.Tag, bool) {
+	// Drop the encoding and modifier of POSIX locales
+	s, _, _ = strings.Cut(s, ".")
+	s, _, _ = strings.Cut(s, "@")
+	if s == "C" || s == "POSIX" {
+		return language.English, true
+	}
+	tag, err := language.Parse(strings.ReplaceAll(s, "_", "-"))
+	if err != nil {
+		return language.English, false
+	}
+	_, i, confidence := languageMatcher.Match(tag)
+	if confidence < language.High {
+		return language.English, false
+	}
+	return supportedLanguages[i], true
+}
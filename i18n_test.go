@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// formatVerbRe matches a verb of a format string, with its explicit
+// argument index if any
+var formatVerbRe = regexp.MustCompile(`%(?:\[(\d+)\])?[-+# 0]*\d*(?:\.\d+)?([a-zA-Z%])`)
+
+// formatArgs maps the arguments of a format string to their verbs
+func formatArgs(format string) map[int]string {
+	args := map[int]string{}
+	next := 1
+	for _, m := range formatVerbRe.FindAllStringSubmatch(format, -1) {
+		if m[2] == "%" {
+			continue
+		}
+		if m[1] != "" {
+			next, _ = strconv.Atoi(m[1])
+		}
+		args[next] = m[2]
+		next++
+	}
+	return args
+}
+
+func TestCatalogsKeepArguments(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for format, translated := range catalog {
+			if want, got := formatArgs(format), formatArgs(translated); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %q takes %v, its translation %q takes %v", lang, format, want, translated, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// jobQueueSize is how many jobs may wait before new ones are refused
+const jobQueueSize = 1024
+
+// Finished jobs are kept for jobRetention, and at most jobHistory of them,
+// so GET /jobs/{id} still answers for a while without the list growing for
+// the life of the server
+const (
+	jobRetention = 24 * time.Hour
+	jobHistory   = 1000
+)
+
+// errQueueFull is returned by Enqueue when jobQueueSize jobs are waiting
+var errQueueFull = errors.New("job queue is full")
+
+// Job is a conversion queued through the HTTP API. Its options, which may
+// hold the server's preprocess commands and filters, are not sent to API
+// callers.
+type Job struct {
+	ID            string         `json:"id"`
+	Status        string         `json:"status"`
+	Source        string         `json:"source"`
+	DrivePath     string         `json:"drive_path"`
+	Tenant        string         `json:"tenant,omitempty"`
+	Options       ConvertOptions `json:"-"`
+	BytesUploaded int64          `json:"bytes_uploaded"`
+	BytesTotal    int64          `json:"bytes_total"`
+	Result        *ConvertResult `json:"result,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	StartedAt     *time.Time     `json:"started_at,omitempty"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+}
+
+// savedJob is a job in the state file, where its options are kept
+type savedJob struct {
+	*Job
+	Options ConvertOptions `json:"options"`
+}
+
+// jobRunner converts the spooled source of a job, reporting upload progress
+type jobRunner func(ctx context.Context, job Job, localPath string, progress func(current int64)) (*ConvertResult, error)
+
+// JobQueue runs conversions on a pool of workers. Sources wait in a spool
+// directory until their job finishes. With a state file, jobs survive a
+// restart: whatever was queued or running is queued again.
+type JobQueue struct {
+	stateFile string
+	spoolDir  string
+	run       jobRunner
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	pending chan string
+}
+
+// NewJobQueue creates a queue, loading stateFile if it is set
+func NewJobQueue(stateFile string, spoolDir string, run jobRunner) (*JobQueue, error) {
+	q := &JobQueue{
+		stateFile: stateFile,
+		spoolDir:  spoolDir,
+		run:       run,
+		jobs:      map[string]*Job{},
+	}
+	jobs, err := loadJobs(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Restored jobs are queued oldest first. The queue grows to hold them
+	// all, as no worker runs yet to make room.
+	var restored []*Job
+	for _, job := range jobs {
+		if job.Status == jobQueued || job.Status == jobRunning {
+			job.Status, job.StartedAt, job.BytesUploaded = jobQueued, nil, 0
+			restored = append(restored, job)
+		}
+		q.jobs[job.ID] = job
+	}
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].CreatedAt.Before(restored[j].CreatedAt)
+	})
+	q.pending = make(chan string, max(jobQueueSize, len(restored)))
+	for _, job := range restored {
+		q.pending <- job.ID
+	}
+	q.prune(time.Now())
+	return q, nil
+}
+
+// loadJobs reads the jobs of a state file, none if it is unset or missing
+func loadJobs(stateFile string) ([]*Job, error) {
+	if stateFile == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read job state: %v", err)
+	}
+	var saved []savedJob
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("unable to parse job state: %v", err)
+	}
+	jobs := make([]*Job, 0, len(saved))
+	for _, s := range saved {
+		if s.Job == nil {
+			continue
+		}
+		s.Job.Options = s.Options
+		jobs = append(jobs, s.Job)
+	}
+	return jobs, nil
+}
+
+// SpoolPath is where the source of a job is kept until it finishes
+func (q *JobQueue) SpoolPath(job Job) string {
+	return filepath.Join(q.spoolDir, job.ID, job.Source)
+}
+
+// NewJob returns a queued job with a fresh ID, not yet enqueued
+func (q *JobQueue) NewJob(source string, drivePath string, opts ConvertOptions) Job {
+	return Job{
+		ID:        newJobID(),
+		Status:    jobQueued,
+		Source:    source,
+		DrivePath: drivePath,
+		Options:   opts,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// Enqueue adds a job whose source is already at SpoolPath
+func (q *JobQueue) Enqueue(job Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.pending <- job.ID:
+	default:
+		return errQueueFull
+	}
+	q.jobs[job.ID] = &job
+	return q.save()
+}
+
+// Accepting reports whether Enqueue has room for another job
+func (q *JobQueue) Accepting() bool {
+	return len(q.pending) < cap(q.pending)
+}
+
+// Start runs workers until ctx is done
+func (q *JobQueue) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-q.pending:
+					q.process(ctx, id)
+				}
+			}
+		}()
+	}
+}
+
+// Get returns a copy of a job
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns copies of all jobs, oldest first
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+func (q *JobQueue) process(ctx context.Context, id string) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	job.Status, job.StartedAt = jobRunning, &started
+	if err := q.save(); err != nil {
+		logger.Error("Unable to save job state", "err", err)
+	}
+	snapshot := *job
+	q.mu.Unlock()
+
+	localPath := q.SpoolPath(snapshot)
+	progress := func(current int64) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		job.BytesUploaded = current
+	}
+	result, err := q.run(ctx, snapshot, localPath, progress)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Interrupted by shutdown: keep the source so the next start retries it
+	if ctx.Err() != nil && err != nil {
+		job.Status, job.StartedAt, job.BytesUploaded = jobQueued, nil, 0
+		if err := q.save(); err != nil {
+			logger.Error("Unable to save job state", "err", err)
+		}
+		return
+	}
+
+	finished := time.Now().UTC()
+	job.Result, job.FinishedAt = result, &finished
+	if err != nil {
+		job.Status, job.Error = jobFailed, err.Error()
+	} else {
+		job.Status, job.BytesUploaded = jobSucceeded, job.BytesTotal
+	}
+	if err := os.RemoveAll(filepath.Dir(localPath)); err != nil {
+		logger.Warn("Unable to remove spooled source", "job", id, "err", err)
+	}
+	q.prune(finished)
+	if err := q.save(); err != nil {
+		logger.Error("Unable to save job state", "err", err)
+	}
+}
+
+// prune forgets finished jobs older than jobRetention and the oldest ones
+// beyond jobHistory; the caller holds q.mu
+func (q *JobQueue) prune(now time.Time) {
+	var finished []*Job
+	for id, job := range q.jobs {
+		if job.FinishedAt == nil {
+			continue
+		}
+		if now.Sub(*job.FinishedAt) > jobRetention {
+			delete(q.jobs, id)
+			continue
+		}
+		finished = append(finished, job)
+	}
+	if len(finished) <= jobHistory {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.After(*finished[j].FinishedAt)
+	})
+	for _, job := range finished[jobHistory:] {
+		delete(q.jobs, job.ID)
+	}
+}
+
+// save writes the state file if enabled; the caller holds q.mu
+func (q *JobQueue) save() error {
+	if q.stateFile == "" {
+		return nil
+	}
+	jobs := make([]savedJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, savedJob{Job: job, Options: job.Options})
+	}
+	b, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename, so a crash never leaves a truncated state file
+	tmp := q.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("unable to write job state: %v", err)
+	}
+	return os.Rename(tmp, q.stateFile)
+}
+
+// newJobID returns a random job ID
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func noJobRunner(context.Context, Job, string, func(int64)) (*ConvertResult, error) {
+	return nil, nil
+}
+
+func TestJobOptionsKeptPrivate(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := NewJobQueue(stateFile, t.TempDir(), noJobRunner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := q.NewJob("notes.md", "/docs", ConvertOptions{Filters: []FilterRule{{Name: "secret-filter"}}})
+	if err := q.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret-filter") {
+		t.Errorf("a job as sent to API callers holds its options: %s", b)
+	}
+
+	// The options still survive a restart
+	q, err = NewJobQueue(stateFile, t.TempDir(), noJobRunner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := q.Get(job.ID)
+	if !ok {
+		t.Fatal("the job was not restored")
+	}
+	if len(restored.Options.Filters) != 1 || restored.Options.Filters[0].Name != "secret-filter" {
+		t.Errorf("restored options = %+v", restored.Options)
+	}
+}
+
+func TestJobQueueRestoresMoreThanItsSize(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "jobs.json")
+	var saved []savedJob
+	created := time.Now().UTC()
+	for i := 0; i < jobQueueSize+10; i++ {
+		saved = append(saved, savedJob{Job: &Job{
+			ID:        fmt.Sprintf("job-%d", i),
+			Status:    jobRunning,
+			CreatedAt: created.Add(time.Duration(i) * time.Second),
+		}})
+	}
+	b, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stateFile, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan *JobQueue)
+	go func() {
+		q, err := NewJobQueue(stateFile, t.TempDir(), noJobRunner)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- q
+	}()
+	var q *JobQueue
+	select {
+	case q = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewJobQueue hangs restoring more jobs than the queue holds")
+	}
+	if q == nil {
+		return
+	}
+	if len(q.pending) != len(saved) {
+		t.Errorf("%d jobs pending, want %d", len(q.pending), len(saved))
+	}
+	if id := <-q.pending; id != "job-0" {
+		t.Errorf("first restored job = %s, want the oldest", id)
+	}
+	if job, _ := q.Get("job-1"); job.Status != jobQueued {
+		t.Errorf("a running job is restored as %s, want %s", job.Status, jobQueued)
+	}
+}
+
+func TestJobQueuePrune(t *testing.T) {
+	q, err := NewJobQueue("", t.TempDir(), noJobRunner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	finishedAt := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	q.jobs["expired"] = &Job{ID: "expired", Status: jobSucceeded, FinishedAt: finishedAt(jobRetention + time.Minute)}
+	q.jobs["queued"] = &Job{ID: "queued", Status: jobQueued}
+	for i := 0; i < jobHistory+1; i++ {
+		id := fmt.Sprintf("done-%d", i)
+		q.jobs[id] = &Job{ID: id, Status: jobFailed, FinishedAt: finishedAt(time.Duration(i) * time.Second)}
+	}
+
+	q.prune(now)
+	if _, ok := q.jobs["expired"]; ok {
+		t.Error("a job finished before the retention period is kept")
+	}
+	if _, ok := q.jobs["queued"]; !ok {
+		t.Error("an unfinished job was pruned")
+	}
+	if _, ok := q.jobs[fmt.Sprintf("done-%d", jobHistory)]; ok {
+		t.Error("the oldest finished job beyond the history limit is kept")
+	}
+	if len(q.jobs) != jobHistory+1 {
+		t.Errorf("%d jobs kept, want %d", len(q.jobs), jobHistory+1)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// runJobsCommand implements "doc2gdoc jobs [-server url] [id]", showing the
+// jobs of a running "doc2gdoc serve"
+func runJobsCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("jobs", flag.ExitOnError)
+	serverURL := flags.String("server", "http://localhost:8080", "Base URL of the doc2gdoc server")
+	authToken := flags.String("auth-token", os.Getenv("DOC2GDOC_SERVE_TOKEN"), "Bearer token of the server (env DOC2GDOC_SERVE_TOKEN)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc jobs [-server http://localhost:8080] [-auth-token token] [job ID]")
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		flags.Usage()
+		return fmt.Errorf("please specify at most one job ID")
+	}
+
+	base := strings.TrimSuffix(*serverURL, "/")
+	if len(positional) == 1 {
+		var job Job
+		if err := fetchJSON(ctx, base+"/jobs/"+positional[0], *authToken, &job); err != nil {
+			return err
+		}
+		printJob(job)
+		return nil
+	}
+
+	var jobs []Job
+	if err := fetchJSON(ctx, base+"/jobs", *authToken, &jobs); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tSOURCE\tDRIVE PATH\tPROGRESS\tFILE ID")
+	for _, job := range jobs {
+		fileID := "-"
+		if job.Result != nil && job.Result.FileID != "" {
+			fileID = job.Result.FileID
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Status, job.Source, job.DrivePath, jobProgress(job), fileID)
+	}
+	return tw.Flush()
+}
+
+func printJob(job Job) {
+	fmt.Printf("ID:         %s\n", job.ID)
+	fmt.Printf("Status:     %s\n", job.Status)
+	fmt.Printf("Source:     %s\n", job.Source)
+	fmt.Printf("Drive path: %s\n", job.DrivePath)
+	fmt.Printf("Progress:   %s\n", jobProgress(job))
+	fmt.Printf("Created:    %s\n", job.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	if job.FinishedAt != nil {
+		fmt.Printf("Finished:   %s\n", job.FinishedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	if job.Result != nil && job.Result.FileID != "" {
+		fmt.Printf("File ID:    %s\n", job.Result.FileID)
+		fmt.Printf("Link:       %s\n", job.Result.Link)
+	}
+	if job.Error != "" {
+		fmt.Printf("Error:      %s\n", job.Error)
+	}
+}
+
+// jobProgress formats the uploaded bytes of a job, e.g. 1.0 MB / 4.0 MB
+func jobProgress(job Job) string {
+	if job.BytesTotal <= 0 {
+		return "-"
+	}
+	return formatBytes(job.BytesUploaded) + " / " + formatBytes(job.BytesTotal)
+}
+
+// fetchJSON GETs url and decodes the JSON response into v
+func fetchJSON(ctx context.Context, url string, authToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach server: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("server answered %s: %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("unable to parse server response: %v", err)
+	}
+	return nil
+}
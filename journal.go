@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// JournalEntry is a batch item that was converted
+type JournalEntry struct {
+	Source      string    `json:"source"`
+	DrivePath   string    `json:"drive_path"`
+	FileID      string    `json:"file_id"`
+	Hash        string    `json:"hash"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// Journal records the completed items of batch and manifest runs in the
+// state database, so a run that died halfway can continue with -resume. A
+// nil Journal records nothing.
+type Journal struct {
+	stateFile string
+	resume    bool
+	entries   map[string]JournalEntry
+}
+
+// openJournal loads the journal of the state database. Only with resume
+// are recorded items skipped.
+func openJournal(stateFile string, resume bool) (*Journal, error) {
+	j := &Journal{stateFile: stateFile, resume: resume, entries: map[string]JournalEntry{}}
+	err := scanState(stateFile, journalBucket, func(key string, data []byte) error {
+		var e JournalEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("unable to parse journal entry: %v", err)
+		}
+		j.entries[key] = e
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read journal: %v", err)
+	}
+	return j, nil
+}
+
+// resetJournal clears the journal
+func resetJournal(stateFile string) error {
+	if err := dropState(stateFile, journalBucket); err != nil {
+		return fmt.Errorf("unable to clear journal: %v", err)
+	}
+	return nil
+}
+
+// Completed reports whether a resumed run can skip source: it was converted
+// to drivePath before and its content hash hasn't changed since. It also
+// returns the current hash for Record.
+func (j *Journal) Completed(source string, drivePath string) (JournalEntry, string, bool) {
+	if j == nil || source == stdinPath {
+		return JournalEntry{}, "", false
+	}
+	hash, err := localFileSHA256(source)
+	if err != nil {
+		// The conversion will report the unreadable file
+		return JournalEntry{}, "", false
+	}
+	e, ok := j.entries[journalKey(source, drivePath)]
+	return e, hash, ok && j.resume && e.Hash == hash
+}
+
+// Record adds a converted item and saves the journal right away, so it
+// survives the run being killed
+func (j *Journal) Record(source string, drivePath string, hash string, result *ConvertResult) error {
+	if j == nil || source == stdinPath || result == nil || result.FileID == "" {
+		return nil
+	}
+	key := journalKey(source, drivePath)
+	j.entries[key] = JournalEntry{
+		Source:      absPath(source),
+		DrivePath:   drivePath,
+		FileID:      result.FileID,
+		Hash:        hash,
+		CompletedAt: time.Now().UTC(),
+	}
+	if err := putState(j.stateFile, journalBucket, key, j.entries[key]); err != nil {
+		return fmt.Errorf("unable to write journal: %v", err)
+	}
+	return nil
+}
+
+// journalKey identifies an item by its absolute source and destination, so
+// a resumed run may be started from another directory
+func journalKey(source string, drivePath string) string {
+	return absPath(source) + "\x00" + drivePath
+}
+
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
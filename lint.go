@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxTableColumns is the widest table the Docs API can insert
+const maxTableColumns = 20
+
+// mdRefRe matches inline links and images anywhere in a line
+var mdRefRe = regexp.MustCompile(`(!?)\[[^\]]*\]\(([^)\s]+)(\s+"[^"]*")?\)`)
+
+// lintProblem is one issue found in a source file
+type lintProblem struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (p lintProblem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.Path, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// runLintCommand implements "doc2gdoc lint <file>...", checking sources
+// without uploading anything
+func runLintCommand(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc lint <file>...")
+		flags.PrintDefaults()
+	}
+	files, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		flags.Usage()
+		return fmt.Errorf("please specify at least one file to lint")
+	}
+
+	// Relative links may point at any file linted together
+	batch := map[string]bool{}
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			batch[abs] = true
+		}
+	}
+
+	var problems []lintProblem
+	for _, f := range files {
+		problems = append(problems, lintFile(f, batch)...)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found", len(problems))
+	}
+	fmt.Print(tr("%d file(s) OK\n", len(files)))
+	return nil
+}
+
+// lintFile checks that a file can be converted within the size budget, and
+// for Markdown also checks its content
+func lintFile(filePath string, batch map[string]bool) []lintProblem {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return []lintProblem{{Path: filePath, Message: err.Error()}}
+	}
+	defer file.Close()
+
+	sourceMime, err := detectSourceMimeType(filePath, file)
+	if err != nil {
+		return []lintProblem{{Path: filePath, Message: err.Error()}}
+	}
+	targetMime, err := detectTargetMimeType(filePath, "")
+	if err != nil {
+		return []lintProblem{{Path: filePath, Message: err.Error()}}
+	}
+
+	var problems []lintProblem
+	if targetMime == docMimeType {
+		warnings, err := checkBudget(file, sourceMime)
+		if err != nil {
+			return []lintProblem{{Path: filePath, Message: err.Error()}}
+		}
+		for _, w := range warnings {
+			problems = append(problems, lintProblem{Path: filePath, Message: w})
+		}
+	}
+	if sourceMime != "text/markdown" {
+		return problems
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return []lintProblem{{Path: filePath, Message: err.Error()}}
+	}
+	return append(problems, lintMarkdown(filePath, string(content), batch)...)
+}
+
+// lintMarkdown checks image paths, local link targets, table widths and
+// skipped heading levels
+func lintMarkdown(filePath string, content string, batch map[string]bool) []lintProblem {
+	var problems []lintProblem
+	report := func(line int, format string, args ...any) {
+		problems = append(problems, lintProblem{Path: filePath, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	dir := filepath.Dir(filePath)
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	prevLevel := 0
+	var fence string
+
+	for i, line := range lines {
+		n := i + 1
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		if m := mdHeadingRe.FindStringSubmatch(trimmed); m != nil {
+			level := len(m[1])
+			if level > prevLevel+1 {
+				report(n, "heading level %d follows level %d (use -normalize-headings to fix)", level, prevLevel)
+			}
+			prevLevel = level
+		}
+
+		if i+1 < len(lines) && strings.Contains(trimmed, "|") && mdTableSepRe.MatchString(strings.TrimSpace(lines[i+1])) {
+			if cols := len(splitTableRow(trimmed)); cols > maxTableColumns {
+				report(n, "table has %d columns, at most %d are supported", cols, maxTableColumns)
+			}
+		}
+
+		for _, m := range mdRefRe.FindAllStringSubmatch(line, -1) {
+			image, target := m[1] == "!", m[2]
+			u, err := url.Parse(target)
+			if err != nil {
+				report(n, "invalid link %q", target)
+				continue
+			}
+			if u.Scheme != "" || u.Path == "" {
+				continue
+			}
+			p, err := url.PathUnescape(u.Path)
+			if err != nil {
+				p = u.Path
+			}
+			abs, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(p)))
+			if err != nil {
+				continue
+			}
+			switch {
+			case image:
+				if _, err := os.Stat(abs); err != nil {
+					report(n, "image %s not found", target)
+				}
+			case !batch[abs]:
+				report(n, "link target %s is not part of this batch", target)
+			}
+		}
+	}
+	return problems
+}
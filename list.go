@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// listFields are the file fields shown by "doc2gdoc list"
+const listFields = "id, name, mimeType, modifiedTime, size, owners(displayName, emailAddress)"
+
+// listTypes maps -type values to the MIME type they select
+var listTypes = map[string]string{
+	"doc":    docMimeType,
+	"sheet":  sheetMimeType,
+	"slide":  slideMimeType,
+	"folder": folderMimeType,
+}
+
+// listNode is a listed file and, for folders listed recursively, its children
+type listNode struct {
+	file     *drive.File
+	children []*listNode
+	// keep is set when the node matches the filters or has a kept child
+	keep bool
+}
+
+// runListCommand implements "doc2gdoc list [flags] [drive path]"
+func runListCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	fileType := flags.String("type", "all", "Only show files of this type: doc, sheet, slide, folder or all")
+	recursive := flags.Bool("recursive", false, "List subfolders too, as a tree")
+	name := flags.String("name", "", "Only show files whose name matches this glob, e.g. '*report*'")
+	maxResults := flags.Int("max-results", 0, "Stop listing a folder after this many results (0 means no limit)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc list [-type doc|sheet|slide|folder|all] [-recursive] [-name glob] [drive path]")
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		flags.Usage()
+		return fmt.Errorf("please specify at most one Drive path")
+	}
+	drivePath := config.DefaultPath
+	if len(positional) == 1 {
+		drivePath = positional[0]
+	}
+	if *fileType != "all" {
+		if _, ok := listTypes[*fileType]; !ok {
+			return fmt.Errorf("unknown type %q, expected doc, sheet, slide, folder or all", *fileType)
+		}
+	}
+	if _, err := path.Match(*name, ""); err != nil {
+		return fmt.Errorf("invalid -name pattern %q: %v", *name, err)
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	parentID, err := svc.Folders.FindOrCreate(ctx, drivePath, createNone)
+	if err != nil {
+		return fmt.Errorf("unable to find %s: %w", drivePath, err)
+	}
+
+	nodes, err := listTree(ctx, svc.Files, parentID, *recursive, *maxResults)
+	if err != nil {
+		return err
+	}
+	match := func(f *drive.File) bool {
+		if *fileType != "all" && f.MimeType != listTypes[*fileType] {
+			return false
+		}
+		ok, _ := path.Match(*name, f.Name)
+		return *name == "" || ok
+	}
+	shown := markListNodes(nodes, match)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tID\tMODIFIED\tSIZE\tOWNER")
+	printListNodes(tw, nodes, 0)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Print(tr("%d file(s)\n", shown))
+	return nil
+}
+
+// listTree lists a folder, descending into subfolders if recursive.
+// Shortcuts are not followed, so the tree cannot loop.
+func listTree(ctx context.Context, api DriveAPI, parentID string, recursive bool, maxResults int) ([]*listNode, error) {
+	query := buildQuery(
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
+	files, err := api.ListFiles(ctx, query, listFields, 0, maxResults)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files: %w", classifyAPIError(err))
+	}
+
+	nodes := make([]*listNode, 0, len(files))
+	for _, f := range files {
+		node := &listNode{file: f}
+		if recursive && f.MimeType == folderMimeType {
+			if node.children, err = listTree(ctx, api, f.Id, recursive, maxResults); err != nil {
+				return nil, err
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// markListNodes sets keep on nodes matching the filter and on their
+// ancestors, so the tree still shows where a match lives. It returns the
+// number of matches.
+func markListNodes(nodes []*listNode, match func(*drive.File) bool) int {
+	matched := 0
+	for _, n := range nodes {
+		childMatches := markListNodes(n.children, match)
+		matched += childMatches
+		if match(n.file) {
+			matched++
+			n.keep = true
+		}
+		n.keep = n.keep || childMatches > 0
+	}
+	return matched
+}
+
+func printListNodes(tw *tabwriter.Writer, nodes []*listNode, depth int) {
+	for _, n := range nodes {
+		if !n.keep {
+			continue
+		}
+		f := n.file
+		name := strings.Repeat("  ", depth) + f.Name
+		if f.MimeType == folderMimeType {
+			name += "/"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", name, listTypeName(f.MimeType), f.Id,
+			listModified(f.ModifiedTime), listSize(f), listOwner(f))
+		printListNodes(tw, n.children, depth+1)
+	}
+}
+
+// listTypeName returns the -type name of a MIME type, or the MIME type
+func listTypeName(mimeType string) string {
+	for name, t := range listTypes {
+		if t == mimeType {
+			return name
+		}
+	}
+	if mimeType == shortcutMimeType {
+		return "shortcut"
+	}
+	return mimeType
+}
+
+func listModified(modified string) string {
+	t, err := time.Parse(time.RFC3339, modified)
+	if err != nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// listSize formats the stored size; Google Workspace files have none
+func listSize(f *drive.File) string {
+	if f.Size == 0 && strings.HasPrefix(f.MimeType, "application/vnd.google-apps.") {
+		return "-"
+	}
+	return formatBytes(f.Size)
+}
+
+// listOwner names the first owner; files in shared drives have none
+func listOwner(f *drive.File) string {
+	if len(f.Owners) == 0 {
+		return "-"
+	}
+	if o := f.Owners[0]; o.EmailAddress != "" {
+		return o.EmailAddress
+	}
+	return f.Owners[0].DisplayName
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// logger writes diagnostics to stderr, keeping stdout for results. It is
+// replaced by setupLogging once the logging flags are known.
+var logger = newLogger(slog.LevelWarn, "text")
+
+// logFormat is the -log-format, for loggers of their own like -debug-http's
+var logFormat = "text"
+
+// LogOptions are the global logging flags, accepted before or after the
+// subcommand like -profile
+type LogOptions struct {
+	// Verbosity is 1 for -v and 2 for -vv
+	Verbosity int
+	Quiet     bool
+	Format    string
+}
+
+// level maps the flags to a minimum level: warnings by default, errors
+// only with -quiet
+func (o LogOptions) level() slog.Level {
+	switch {
+	case o.Quiet:
+		return slog.LevelError
+	case o.Verbosity >= 2:
+		return slog.LevelDebug
+	case o.Verbosity == 1:
+		return slog.LevelInfo
+	}
+	return slog.LevelWarn
+}
+
+// logFlags are -v, -vv, -quiet and -log-format
+func logFlags(opts *LogOptions) map[string]globalFlag {
+	return map[string]globalFlag{
+		"v": {isBool: true, set: func(string) error {
+			opts.Verbosity = max(opts.Verbosity, 1)
+			return nil
+		}},
+		"vv": {isBool: true, set: func(string) error {
+			opts.Verbosity = 2
+			return nil
+		}},
+		"quiet":      boolFlag(&opts.Quiet),
+		"log-format": stringFlag(&opts.Format),
+	}
+}
+
+// setupLogging replaces logger according to opts
+func setupLogging(opts LogOptions) error {
+	if opts.Format != "text" && opts.Format != "json" {
+		return fmt.Errorf("unknown -log-format %q, expected text or json", opts.Format)
+	}
+	logger = newLogger(opts.level(), opts.Format)
+	logFormat = opts.Format
+	return nil
+}
+
+func newLogger(level slog.Level, format string) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	}
+	// Timestamps are noise on an interactive terminal
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
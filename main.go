@@ -3,51 +3,325 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/docs/v1"
 	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/sheets/v4"
 )
 
 // Config structure for storing credential information
 type Config struct {
 	CredentialsFile string
 	TokenFile       string
+	FolderCacheFile string
+	// FileTimeout bounds the conversion of each file (0 means no limit)
+	FileTimeout time.Duration
+	// BreakAfter stops batch and manifest runs after this many consecutive
+	// transient failures (0 means never)
+	BreakAfter int
+	// StateFile is the database of converted files and their documents
+	StateFile string
+	// ImportFormatsFile caches the formats Drive can convert
+	ImportFormatsFile string
+	// AuditLogFile records every create, update, delete and share
+	// (empty means disabled)
+	AuditLogFile string
+	// FolderLock makes concurrent runners take turns creating folders
+	FolderLock bool
+	// StrictFolders fails on folders sharing a name that PreferFolder
+	// doesn't settle: newest, oldest or id:<folder id>
+	StrictFolders bool
+	PreferFolder  string
+	// DefaultPath is the Drive path used when -path is not given
+	DefaultPath string
+	// Profile names the account profile whose token is used
+	Profile string
+	// TokenStorage selects where the token is kept: file or keyring
+	TokenStorage string
+	// WebhookURL receives a JSON notification after each conversion,
+	// signed with WebhookSecret if it is set
+	WebhookURL    string
+	WebhookSecret string
+	// QPS limits Google API requests per second, allowing Burst at once
+	// (0 means no limit)
+	QPS   float64
+	Burst int
+	// Preprocess are the per-extension rules from the config file
+	Preprocess []PreprocessRule
+	// Styles maps Markdown elements to Docs named styles and fonts
+	Styles map[string]StyleRule
+	// Filters redact text sources before upload, recording what they
+	// redacted in RedactionReport if it is set
+	Filters         []FilterRule
+	RedactionReport string
+	// Order ranks the files of a batch and sets which wait for others
+	Order []OrderRule
+	// Destinations are the folders conversions are also published to
+	Destinations []Destination
+	// MaxUploadRate limits each upload to this many bytes per second, or all
+	// uploads together with ShareUploadRate (0 means no limit)
+	MaxUploadRate   int64
+	ShareUploadRate bool
+	// Proxy is the URL of the proxy for Google APIs (default: HTTPS_PROXY)
+	Proxy string
+	// CACertFile holds PEM certificates trusted besides the system roots
+	CACertFile string
+	// HTTPTimeout bounds each request (0 means no limit)
+	HTTPTimeout time.Duration
+	// DebugHTTP logs the method, URL, status and timing of every request
+	DebugHTTP bool
+	// HTTPClient, if set, is used under the authorization instead of a
+	// client built from Proxy, CACertFile and HTTPTimeout
+	HTTPClient *http.Client
+	// DaemonJobs are the recurring jobs of "doc2gdoc daemon", which keeps
+	// their outcome in DaemonStateFile and their logs in DaemonLogDir
+	DaemonJobs      []DaemonJob
+	DaemonStateFile string
+	DaemonLogDir    string
+}
+
+// ConvertOptions controls how a local file is converted
+type ConvertOptions struct {
+	// SourceMimeType overrides the detected MIME type of the source file
+	SourceMimeType string
+	// Target forces the Google Workspace type: doc, sheet or slide
+	Target string
+	// CreateMode restricts which missing folders may be created: all, leaf or none
+	CreateMode string
+	// SkipUnchanged skips files whose hash matches the existing document,
+	// and overwrites it otherwise unless OnConflict says else
+	SkipUnchanged bool
+	// OnConflict decides what happens when the document already exists:
+	// skip, overwrite, rename or version (empty always creates a new one)
+	OnConflict string
+	// Destinations are additional folders the document is published to
+	Destinations []Destination
+	// StateFile records each conversion, so reruns overwriting documents
+	// find them even after they were renamed, and maps front matter doc_key
+	// values to stable Doc IDs
+	StateFile string
+	// NormalizeHeadings fixes skipped heading levels in Markdown sources
+	NormalizeHeadings bool
+	// NumberHeadings prefixes Markdown headings with outline numbers
+	NumberHeadings bool
+	// Direction sets the paragraph direction of Docs: auto, rtl or ltr
+	// (empty keeps what the import produced)
+	Direction string
+	// Shares are users the document is shared with after conversion
+	Shares []Share
+	// ShareAnyone shares the document with anyone who has the link in this role
+	ShareAnyone string
+	// Open launches the converted document in the default browser
+	Open bool
+	// Provenance records the source commit and builder in appProperties
+	Provenance bool
+	// ProvenanceKey is an ed25519 private key file used to sign the provenance
+	ProvenanceKey string
+	// ProvenanceFooter appends the provenance as a footer line to Docs
+	ProvenanceFooter bool
+	// Strict fails instead of warning when a Doc would exceed the size budget,
+	// or when verification finds content missing
+	Strict bool
+	// Verify exports created Docs as text and compares them with the source,
+	// warning when less than VerifyThreshold of the source words are found
+	Verify          bool
+	VerifyThreshold float64
+	// Force uploads sources Drive does not list as convertible into the
+	// target type
+	Force bool
+	// Title names the document on Drive instead of the local file name
+	// without its extension
+	Title string
+	// Description and Starred are set on newly created documents
+	Description string
+	Starred     bool
+	// DryRun prints what would be created or updated without changing Drive
+	DryRun bool
+	// OCR converts a scanned PDF or image into a Doc through Drive's text
+	// recognition, hinted by OCRLanguage (e.g. zh-TW) if set
+	OCR         bool
+	OCRLanguage string
+	// Template is the ID of a Doc copied for new Docs, whose styles, header
+	// and footer the converted content then uses
+	Template string
+	// PostProcess edits converted Docs: title, contents, header, footer
+	PostProcess PostProcess
+	// FrontMatter takes the title, a destination subfolder and tags from
+	// Markdown front matter; -title still wins
+	FrontMatter bool
+	// Preprocess transforms matching sources with external commands first
+	Preprocess []PreprocessRule
+	// Filters redact patterns from text sources right before upload
+	Filters []FilterRule
+	// Styles overrides the named style, font, size and colors of Markdown
+	// elements
+	Styles map[string]StyleRule
+	// CSV controls how CSV and TSV sources are read into Sheets
+	CSV CSVOptions
+	// BundleHTML inlines the local stylesheets and images of HTML sources,
+	// which is always done for exports with an assets folder
+	BundleHTML bool
+	// Progress, if set, is told how many bytes of the source were uploaded
+	Progress func(current, total int64) `json:"-"`
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Services bundles the Google API clients sharing one authorized HTTP client
+type Services struct {
+	Drive *drive.Service
+	// Files is the file access used by folder resolution and conversion
+	Files   DriveAPI
+	Docs    *docs.Service
+	Sheets  *sheets.Service
+	Folders *FolderResolver
+	// Formats are the source types Drive converts, checked before uploads
+	Formats *ImportFormats
+	// HTTP is the authorized client, for links the API returns
+	HTTP *http.Client
+	// Audit records mutations made outside of Files in the audit log
+	Audit *auditor
 }
 
 // Initialize Google Drive client
-func initClient(config Config) (*drive.Service, error) {
-	b, err := os.ReadFile(config.CredentialsFile)
+func initClient(ctx context.Context, config Config) (*Services, error) {
+	client, err := newHTTPClient(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read credentials file: %v", err)
+		return nil, err
 	}
+	return newServices(config, client)
+}
 
-	// Configure credentials
-	oauthConfig, err := google.ConfigFromJSON(b, drive.DriveFileScope)
+// newServices creates the API clients on an authorized HTTP client
+func newServices(config Config, client *http.Client) (*Services, error) {
+	// Create Drive service
+	srv, err := drive.New(client)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+		return nil, fmt.Errorf("unable to create Drive service: %v", err)
 	}
 
-	// Read or generate token
-	client, err := getClient(oauthConfig, config.TokenFile)
+	// Create Docs service, used to write formatted Markdown
+	docsSrv, err := docs.New(client)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get client: %v", err)
+		return nil, fmt.Errorf("unable to create Docs service: %v", err)
 	}
 
-	// Create Drive service
-	srv, err := drive.New(client)
+	// Create Sheets service, used to name and add tabs of CSV imports
+	sheetsSrv, err := sheets.New(client)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create Drive service: %v", err)
+		return nil, fmt.Errorf("unable to create Sheets service: %v", err)
 	}
 
-	return srv, nil
+	audit := &auditor{srv: srv}
+	api := driveAdapter{srv: srv, upload: newUploadThrottle(config), audit: audit}
+	folders, err := NewFolderResolver(api, config.FolderCacheFile)
+	if err != nil {
+		return nil, err
+	}
+	folders.locking = config.FolderLock
+	folders.strict = config.StrictFolders
+	folders.prefer = config.PreferFolder
+
+	return &Services{
+		Drive:   srv,
+		Files:   api,
+		Docs:    docsSrv,
+		Sheets:  sheetsSrv,
+		Folders: folders,
+		Formats: NewImportFormats(srv, config.ImportFormatsFile),
+		HTTP:    client,
+		Audit:   audit,
+	}, nil
+}
+
+// newHTTPClient authorizes with the credentials file and stored token, or
+// with Application Default Credentials (e.g. workload identity on GCE, GKE
+// or Cloud Run) when there is no credentials file
+func newHTTPClient(ctx context.Context, config Config) (*http.Client, error) {
+	// Token requests go through the base client too
+	base, err := baseHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+
+	if _, err := os.Stat(config.CredentialsFile); errors.Is(err, os.ErrNotExist) {
+		creds, err := google.FindDefaultCredentials(ctx, drive.DriveFileScope)
+		if err != nil {
+			return nil, fmt.Errorf("%w: no credentials file %s and no application default credentials: %v", ErrCredentialsMissing, config.CredentialsFile, err)
+		}
+		client := oauth2.NewClient(ctx, creds.TokenSource)
+		client.Transport = wrapTransport(config, reloginHint(config), client.Transport)
+		client.Timeout = base.Timeout
+		return client, nil
+	}
+
+	oauthConfig, err := readOAuthConfig(config.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newTokenStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read or generate token
+	client, err := getClient(ctx, config, oauthConfig, store)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get client: %w", err)
+	}
+	client.Transport = wrapTransport(config, reloginHint(config), client.Transport)
+	client.Timeout = base.Timeout
+	return client, nil
+}
+
+// wrapTransport adds error mapping, metrics and rate limiting to the
+// authorized transport. The limiter is outermost, so waiting for it doesn't
+// count as API latency. relogin tells how to log in again once the token
+// can no longer be refreshed.
+func wrapTransport(config Config, relogin string, base http.RoundTripper) http.RoundTripper {
+	var t http.RoundTripper = metricsTransport{base: tokenErrorTransport{base: base, relogin: relogin}}
+	if config.QPS > 0 {
+		t = rateLimitTransport{base: t, limiter: newRateLimiter(config.QPS, config.Burst)}
+	}
+	return t
+}
+
+// readOAuthConfig reads the OAuth client from a credentials file
+func readOAuthConfig(credentialsFile string) (*oauth2.Config, error) {
+	b, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials file: %v", err)
+	}
+	oauthConfig, err := google.ConfigFromJSON(b, drive.DriveFileScope)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse credentials: %v", err)
+	}
+	return oauthConfig, nil
 }
 
 // tokenFromFile reads token from file
@@ -64,6 +338,9 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 
 // saveToken saves token to file
 func saveToken(path string, token *oauth2.Token) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create token directory: %v", err)
+	}
 	f, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("unable to create token file: %v", err)
@@ -73,178 +350,1061 @@ func saveToken(path string, token *oauth2.Token) error {
 }
 
 // getTokenFromWeb gets new token from web
-func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Please visit this URL and authorize the application:\n%v\n", authURL)
-	fmt.Print("Enter the authorization code: ")
+	fmt.Print(tr("Please visit this URL and authorize the application:\n%v\n", authURL))
+	fmt.Print(tr("Enter the authorization code: "))
 
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
 		return nil, fmt.Errorf("unable to read authorization code: %v", err)
 	}
 
-	tok, err := config.Exchange(context.Background(), authCode)
+	tok, err := config.Exchange(ctx, authCode)
 	if err != nil {
 		return nil, fmt.Errorf("unable to exchange token: %v", err)
 	}
 	return tok, nil
 }
 
-// Get OAuth2 client
-func getClient(config *oauth2.Config, tokenFile string) (*http.Client, error) {
-	tok, err := tokenFromFile(tokenFile)
+// Get OAuth2 client. An expired access token is refreshed right away, so a
+// revoked refresh token fails here rather than in the middle of an upload.
+func getClient(ctx context.Context, config Config, oauthConfig *oauth2.Config, store TokenStore) (*http.Client, error) {
+	tok, err := store.Load()
 	if err != nil {
-		tok, err = getTokenFromWeb(config)
+		tok, err = getTokenFromWeb(ctx, oauthConfig)
 		if err != nil {
 			return nil, err
 		}
-		if err := saveToken(tokenFile, tok); err != nil {
+		if err := store.Save(tok); err != nil {
 			return nil, err
 		}
 	}
-	return config.Client(context.Background(), tok), nil
+	source := newSavingTokenSource(ctx, oauthConfig, store, tok)
+	source.interactive = true
+	source.relogin = reloginHint(config)
+	if !tok.Valid() {
+		if _, err := source.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return oauth2.NewClient(ctx, source), nil
+}
+
+// uploadFields are the fields returned for an uploaded document
+const uploadFields = "id, webViewLink, modifiedTime, version"
+
+// Conversion outcomes reported in ConvertResult.Status
+const (
+	convertCreated = "created"
+	convertUpdated = "updated"
+	convertSkipped = "skipped"
+	// convertPlanned is a dry run's create or update
+	convertPlanned = "planned"
+)
+
+// ConvertResult describes the document a conversion produced
+type ConvertResult struct {
+	Status string `json:"status"`
+	Name   string `json:"name"`
+	FileID string `json:"file_id,omitempty"`
+	Link   string `json:"link,omitempty"`
+	// Location is the Drive path of the document
+	Location string `json:"location"`
 }
 
 // Convert file to Google Docs
-func convertToGoogleDocs(srv *drive.Service, filePath string, drivePath string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("unable to open file: %v", err)
+func convertToGoogleDocs(ctx context.Context, svc *Services, filePath string, drivePath string, opts ConvertOptions) (*ConvertResult, error) {
+	if filePath == stdinPath && opts.Title == "" {
+		return nil, fmt.Errorf("reading from standard input needs -title")
+	}
+	ctx = withAuditSource(ctx, filePath)
+	// A changed file updates the document it was compared with, rather
+	// than adding another one on every edit
+	if opts.SkipUnchanged && opts.OnConflict == "" {
+		opts.OnConflict = conflictOverwrite
 	}
-	defer file.Close()
 
-	// Get or create target folder
-	parentID, err := findOrCreateFolder(srv, drivePath)
+	// The source hash is of the original file, which sync and -skip-unchanged
+	// compare against, not of what preprocessing and filters make of it
+	var sourceHash string
+	if filePath != stdinPath {
+		var err error
+		sourceHash, err = localFileSHA256(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to hash file: %v", err)
+		}
+	}
+
+	// A preprocessed source is uploaded in place of the original, which
+	// still names the document
+	uploadPath := filePath
+	if rule, ok := matchPreprocess(opts.Preprocess, filePath); ok && filePath != stdinPath {
+		out, cleanup, err := runPreprocess(ctx, rule, filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		uploadPath = out
+	}
+	// Drive only imports UTF-8 with commas or tabs, so other delimiters and
+	// encodings are rewritten first
+	if isCSV(uploadPath) && (opts.CSV.Delimiter != "" || opts.CSV.Encoding != "") {
+		out, cleanup, err := normalizeCSV(uploadPath, opts.CSV)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		uploadPath = out
+	}
+	if isHTML(uploadPath) && (opts.BundleHTML || htmlAssetsDir(uploadPath) != "") {
+		out, cleanup, err := bundleHTML(uploadPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to bundle HTML: %v", err)
+		}
+		defer cleanup()
+		uploadPath = out
+	}
+
+	// Filters run last, on exactly what is uploaded
+	if len(opts.Filters) > 0 {
+		out, cleanup, err := applyFilters(uploadPath, filePath, opts.Filters)
+		if err != nil {
+			return nil, err
+		}
+		if out != "" {
+			defer cleanup()
+			uploadPath = out
+		}
+	}
+
+	file, cleanup, err := openSnapshot(uploadPath)
 	if err != nil {
-		return fmt.Errorf("unable to process target folder: %v", err)
+		return nil, fmt.Errorf("unable to open file: %w", err)
 	}
+	defer cleanup()
 
-	filename := filepath.Base(filePath)
-	f := &drive.File{
-		Name:     filename,
-		MimeType: "application/vnd.google-apps.document",
-		Parents:  []string{parentID},
+	sourceMime := opts.SourceMimeType
+	if sourceMime == "" {
+		sourceMime, err = detectSourceMimeType(uploadPath, file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to detect source MIME type: %w", err)
+		}
 	}
 
-	res, err := srv.Files.Create(f).Media(file).Do()
+	targetMime, err := detectTargetMimeType(uploadPath, opts.Target)
 	if err != nil {
-		return fmt.Errorf("unable to upload file: %v", err)
+		return nil, err
+	}
+	if opts.OCR {
+		if !ocrMimeTypes[sourceMime] {
+			return nil, fmt.Errorf("%w: -ocr needs a PDF or a PNG, JPEG or GIF image, not %s", ErrUnsupportedFileType, sourceMime)
+		}
+		if targetMime != docMimeType {
+			return nil, fmt.Errorf("-ocr can only convert into a Google Doc")
+		}
+	}
+	// Markdown is written through the Docs API rather than imported
+	if !opts.Force && svc.Formats != nil && !(sourceMime == "text/markdown" && targetMime == docMimeType) {
+		if err := svc.Formats.Check(ctx, sourceMime, targetMime); err != nil {
+			return nil, err
+		}
 	}
 
-	fmt.Printf("Successfully converted %s to Google Docs\n", filename)
-	fmt.Printf("File ID: %s\n", res.Id)
-	fmt.Printf("Location: Google Drive:%s/%s\n", drivePath, filename)
-	return nil
-}
+	if targetMime == docMimeType {
+		warnings, err := checkBudget(file, sourceMime)
+		if err != nil {
+			return nil, fmt.Errorf("unable to check document size: %v", err)
+		}
+		for _, w := range warnings {
+			logger.Warn(w, "file", filepath.Base(filePath))
+		}
+		if len(warnings) > 0 {
+			if opts.Strict {
+				return nil, fmt.Errorf("%s exceeds the document budget", filepath.Base(filePath))
+			}
+			logger.Warn(budgetAdvice)
+		}
+	}
 
-func findOrCreateFolder(srv *drive.Service, folderPath string) (string, error) {
-	if folderPath == "" || folderPath == "/" {
-		return "root", nil
+	// Markdown front matter may name the document, a subfolder of the
+	// destination and tags, which become Drive properties
+	frontMatter := &FrontMatter{}
+	var properties map[string]string
+	if sourceMime == "text/markdown" && (opts.FrontMatter || opts.StateFile != "") {
+		fm, err := readFrontMatter(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read front matter: %v", err)
+		}
+		if fm != nil {
+			frontMatter = fm
+		}
+	}
+	if opts.FrontMatter {
+		if folder := strings.Trim(frontMatter.Folder, "/"); folder != "" {
+			drivePath = strings.TrimSuffix(drivePath, "/") + "/" + folder
+		}
+		if len(frontMatter.Tags) > 0 {
+			properties = map[string]string{tagsProperty: strings.Join(frontMatter.Tags, ",")}
+		}
 	}
 
-	folders := strings.Split(strings.Trim(folderPath, "/"), "/")
-	parentID := "root"
+	// Get or create target folder
+	var parentID string
+	if opts.DryRun {
+		var planned []string
+		parentID, planned, err = svc.Folders.Plan(ctx, drivePath, opts.CreateMode)
+		for _, p := range planned {
+			fmt.Print(tr("[dry-run] create folder Google Drive:%s\n", p))
+		}
+	} else {
+		parentID, err = svc.Folders.FindOrCreate(ctx, drivePath, opts.CreateMode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to process target folder: %w", err)
+	}
 
-	for _, folderName := range folders {
-		// Modify query conditions, remove single quotes to avoid special character issues
-		query := fmt.Sprintf(`name = "%s" and mimeType = "application/vnd.google-apps.folder" and parents in "%s" and trashed = false`,
-			folderName, parentID)
+	filename := documentName(filePath)
+	if title := frontMatter.Title; opts.FrontMatter && title != "" {
+		filename = title
+	}
+	if opts.Title != "" {
+		filename = opts.Title
+	}
 
-		// Add error handling and logging
-		fmt.Printf("Searching folder: %s\n", folderName)
+	if sourceHash == "" {
+		sourceHash, err = fileSHA256(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to hash file: %v", err)
+		}
+	}
+	appProperties := sourceProperties(filePath, sourceHash)
 
-		files, err := srv.Files.List().
-			Q(query).
-			Fields("files(id, name)").
-			Do()
+	var prov *Provenance
+	if opts.Provenance {
+		prov, err = newProvenance(filePath, sourceHash, opts.ProvenanceKey)
 		if err != nil {
-			return "", fmt.Errorf("unable to search folder: %v", err)
+			return nil, err
+		}
+		for k, v := range prov.properties() {
+			appProperties[k] = v
+		}
+	}
+
+	// A doc_key in the front matter pins the source to one document
+	docKey := frontMatter.DocKey
+
+	var existing, registered *drive.File
+	if docKey != "" {
+		registered, err = lookupRegisteredDoc(ctx, svc.Files, opts.StateFile, docKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Check for an existing document with the same name
+	if registered != nil {
+		existing = registered
+	} else if opts.OnConflict != "" && parentID != "" {
+		if opts.OnConflict == conflictOverwrite || opts.OnConflict == conflictVersion {
+			existing, err = lookupStateDoc(ctx, svc.Files, opts.StateFile, filePath, drivePath, parentID, targetMime)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if existing == nil {
+			existing, err = findExistingFile(ctx, svc.Files, parentID, filename, targetMime)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if existing != nil {
+		if opts.SkipUnchanged && existing.AppProperties[sourceHashProperty] == sourceHash {
+			fmt.Print(tr("Skipped %s, unchanged since last upload (File ID: %s)\n", filename, existing.Id))
+			return &ConvertResult{Status: convertSkipped, Name: filename, FileID: existing.Id, Location: drivePath + "/" + filename}, nil
+		}
+		switch {
+		case registered != nil:
+			// Always update in place, following the source if it moved
+			if opts.DryRun {
+				break
+			}
+			if err := moveDriveFile(ctx, svc, registered, filename, parentID); err != nil {
+				return nil, err
+			}
+		case opts.OnConflict == "":
+			existing = nil
+		case opts.OnConflict == conflictSkip:
+			fmt.Print(tr("Skipped %s, already exists (File ID: %s)\n", filename, existing.Id))
+			return &ConvertResult{Status: convertSkipped, Name: filename, FileID: existing.Id, Location: drivePath + "/" + filename}, nil
+		case opts.OnConflict == conflictRename:
+			filename, err = uniqueName(ctx, svc.Files, parentID, filename, targetMime)
+			if err != nil {
+				return nil, err
+			}
+			existing = nil
+		}
+	}
+
+	if opts.DryRun {
+		action := tr("create")
+		if existing != nil {
+			action = tr("update")
+		}
+		if existing != nil && opts.OnConflict == conflictVersion {
+			action = tr("keep a version of and update")
 		}
+		fmt.Print(tr("[dry-run] %s %s as %s in Google Drive:%s\n", action, filename, targetNames[targetMime], drivePath))
+		for _, dest := range opts.Destinations {
+			fmt.Print(tr("[dry-run] publish to Google Drive:%s\n", dest.Path))
+		}
+		return &ConvertResult{Status: convertPlanned, Name: filename, Location: drivePath + "/" + filename}, nil
+	}
+
+	if existing != nil && opts.OnConflict == conflictVersion {
+		if err := keepVersion(ctx, svc, existing, filename, parentID); err != nil {
+			return nil, err
+		}
+	}
 
-		// Add logging to view search results
-		fmt.Printf("Found %d matching folders\n", len(files.Files))
+	isMarkdown := sourceMime == "text/markdown" && targetMime == docMimeType
 
-		if len(files.Files) > 0 {
-			parentID = files.Files[0].Id
-			fmt.Printf("Using existing folder ID: %s\n", parentID)
-			continue
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	progress, progressDone := uploadProgress(filename, size)
+	if opts.Progress != nil {
+		progress = func(current, _ int64) { opts.Progress(current, size) }
+	}
+
+	var res *drive.File
+	switch {
+	case opts.Template != "" && targetMime == docMimeType:
+		newFile := &drive.File{
+			Name:          filename,
+			Parents:       []string{parentID},
+			AppProperties: appProperties,
+			Properties:    properties,
+			Description:   opts.Description,
+			Starred:       opts.Starred,
+		}
+		existingID := ""
+		if existing != nil {
+			existingID = existing.Id
+		}
+		res, err = convertWithTemplate(ctx, svc, file, sourceMime, newFile, existingID, opts)
+		if err == nil && existing != nil {
+			res, err = svc.Files.UpdateFile(ctx, existing.Id, &drive.File{AppProperties: appProperties, Properties: properties}, nil,
+				UploadOptions{Fields: uploadFields})
 		}
+	case existing != nil && isMarkdown:
+		res, err = convertMarkdown(ctx, svc, file, nil, existing.Id, opts)
+		if err == nil {
+			res, err = svc.Files.UpdateFile(ctx, existing.Id, &drive.File{AppProperties: appProperties, Properties: properties}, nil,
+				UploadOptions{Fields: uploadFields})
+		}
+	case existing != nil:
+		res, err = svc.Files.UpdateFile(ctx, existing.Id, &drive.File{AppProperties: appProperties, Properties: properties}, file, UploadOptions{
+			MediaType:   sourceMime,
+			Fields:      uploadFields,
+			OCRLanguage: opts.OCRLanguage,
+			Progress:    progress,
+		})
+	case isMarkdown:
+		res, err = convertMarkdown(ctx, svc, file, &drive.File{
+			Name:          filename,
+			MimeType:      targetMime,
+			Parents:       []string{parentID},
+			AppProperties: appProperties,
+			Properties:    properties,
+			Description:   opts.Description,
+			Starred:       opts.Starred,
+		}, "", opts)
+	default:
+		res, err = svc.Files.CreateFile(ctx, &drive.File{
+			Name:          filename,
+			MimeType:      targetMime,
+			Parents:       []string{parentID},
+			AppProperties: appProperties,
+			Properties:    properties,
+			Description:   opts.Description,
+			Starred:       opts.Starred,
+		}, file, UploadOptions{MediaType: sourceMime, Fields: uploadFields, OCRLanguage: opts.OCRLanguage, Progress: progress})
+	}
+	progressDone()
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload file: %w", classifyAPIError(err))
+	}
+	metrics.uploaded(size)
+	if err := recordState(opts.StateFile, StateRecord{
+		Source:       filePath,
+		DrivePath:    drivePath,
+		FileID:       res.Id,
+		Hash:         sourceHash,
+		ModifiedTime: res.ModifiedTime,
+		Version:      res.Version,
+	}); err != nil {
+		logger.Warn("Unable to record conversion in state database", "err", err)
+	}
+
+	// From here on the document exists, so failures still return it
+	result := &ConvertResult{
+		Status:   convertCreated,
+		Name:     filename,
+		FileID:   res.Id,
+		Link:     res.WebViewLink,
+		Location: drivePath + "/" + filename,
+	}
+	if existing != nil {
+		result.Status = convertUpdated
+	}
 
-		// If folder doesn't exist, create it
-		folder := &drive.File{
-			Name:     folderName,
-			MimeType: "application/vnd.google-apps.folder",
-			Parents:  []string{parentID},
+	// Verified before post-processing adds text the source doesn't have
+	if opts.Verify && targetMime == docMimeType {
+		if err := verifyDoc(ctx, svc.Files, file, sourceMime, filename, res.Id, opts.VerifyThreshold, opts.Strict); err != nil {
+			return result, err
+		}
+	}
+	if opts.Direction != "" && targetMime == docMimeType {
+		if err := applyTextDirection(ctx, svc.Docs, res.Id, opts.Direction); err != nil {
+			return result, err
+		}
+	}
+	if opts.PostProcess.enabled() && targetMime == docMimeType {
+		if err := applyPostProcess(ctx, svc.Docs, res.Id, filename, filepath.Base(filePath), opts.PostProcess); err != nil {
+			return result, err
 		}
+	}
+	if (opts.CSV.SheetName != "" || opts.CSV.Header) && targetMime == sheetMimeType {
+		if err := formatSheet(ctx, svc.Sheets, res.Id, opts.CSV); err != nil {
+			return result, err
+		}
+	}
+	if prov != nil && opts.ProvenanceFooter && targetMime == docMimeType {
+		if err := appendProvenanceFooter(ctx, svc.Docs, res.Id, prov); err != nil {
+			return result, err
+		}
+	}
 
-		createdFolder, err := srv.Files.Create(folder).Fields("id").Do()
+	if existing != nil {
+		fmt.Print(tr("Successfully updated %s in %s\n", filename, targetNames[targetMime]))
+	} else {
+		fmt.Print(tr("Successfully converted %s to %s\n", filename, targetNames[targetMime]))
+	}
+	fmt.Print(tr("File ID: %s\n", res.Id))
+	fmt.Print(tr("Location: Google Drive:%s\n", result.Location))
+	fmt.Print(tr("Link: %s\n", res.WebViewLink))
+	if existing != nil {
+		// Updates add a revision instead of replacing the document
+		fmt.Print(tr("Earlier revisions: doc2gdoc revisions %s\n", res.Id))
+	}
+
+	if len(opts.Shares) > 0 || opts.ShareAnyone != "" {
+		if err := shareFile(ctx, svc, res.Id, opts.Shares, opts.ShareAnyone); err != nil {
+			return result, err
+		}
+	}
+
+	if opts.Open && res.WebViewLink != "" {
+		if err := openBrowser(res.WebViewLink); err != nil {
+			logger.Warn("Unable to open browser", "err", err)
+		}
+	}
+
+	if docKey != "" {
+		if err := recordRegisteredDoc(opts.StateFile, docKey, res.Id, filePath); err != nil {
+			return result, err
+		}
+	}
+
+	if len(opts.Destinations) > 0 {
+		if err := publishToDestinations(ctx, svc, res, filename, targetMime, opts.Destinations, opts.CreateMode); err != nil {
+			return result, fmt.Errorf("unable to publish to all destinations: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// documentName is the default name of the document converted from a local
+// file: the file name without its extension
+func documentName(filePath string) string {
+	name := filepath.Base(filePath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// convertMarkdown fills a Google Doc with the formatted Markdown content
+// through the Docs API, instead of uploading raw text. It creates the
+// document described by f, or clears and rewrites existingID if set.
+func convertMarkdown(ctx context.Context, svc *Services, file *os.File, f *drive.File, existingID string, opts ConvertOptions) (*drive.File, error) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file: %v", err)
+	}
+
+	res := &drive.File{Id: existingID}
+	if existingID == "" {
+		res, err = svc.Files.CreateFile(ctx, f, nil, UploadOptions{Fields: uploadFields})
 		if err != nil {
-			return "", fmt.Errorf("unable to create folder %s: %v", folderName, err)
+			return nil, err
 		}
+	}
 
-		parentID = createdFolder.Id
-		fmt.Printf("Created new folder ID: %s\n", parentID)
+	w, err := newDocWriter(ctx, svc.Docs, res.Id, opts.Styles)
+	if err != nil {
+		return nil, err
 	}
+	if existingID != "" {
+		if err := w.clear(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.writeMarkdown(markdownBlocks(string(content), opts)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
-	return parentID, nil
+// markdownBlocks parses Markdown without its front matter, applying the
+// heading options
+func markdownBlocks(content string, opts ConvertOptions) []mdBlock {
+	_, body, _ := splitFrontMatter(content)
+	blocks := parseMarkdown(body)
+	if opts.NormalizeHeadings {
+		normalizeHeadingLevels(blocks)
+	}
+	if opts.NumberHeadings {
+		numberHeadings(blocks)
+	}
+	return blocks
 }
 
 // Add a helper function to list all folders under specified folder
-func listFolders(srv *drive.Service, parentID string) error {
-	query := fmt.Sprintf(`mimeType = "application/vnd.google-apps.folder" and parents in "%s" and trashed = false`, parentID)
+func listFolders(ctx context.Context, api DriveAPI, parentID string, pageSize int64, maxResults int) error {
+	query := buildQuery(
+		"mimeType = "+quoteQuery(folderMimeType),
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
 
-	files, err := srv.Files.List().
-		Q(query).
-		Fields("files(id, name)").
-		Do()
+	files, err := api.ListFiles(ctx, query, "id, name", pageSize, maxResults)
 	if err != nil {
-		return fmt.Errorf("unable to list folders: %v", err)
+		return fmt.Errorf("unable to list folders: %w", err)
 	}
 
-	fmt.Println("Existing folder list:")
-	for _, file := range files.Files {
+	fmt.Print(tr("Existing folder list:\n"))
+	for _, file := range files {
 		fmt.Printf("- %s (ID: %s)\n", file.Name, file.Id)
 	}
 
 	return nil
 }
 
+// parseInterspersed parses flags that may appear before or after positional
+// arguments, e.g. "sync ./notes -path /notes", and returns the positionals
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
 func main() {
+	config, err := loadConfig()
+	if err != nil {
+		fatal("", err)
+	}
+	// Global flags can be given with any command
+	var profile, lang string
+	logOpts := LogOptions{Format: "text"}
+	args, flagErr := splitGlobalFlags(os.Args[1:],
+		map[string]globalFlag{
+			"profile":     stringFlag(&profile),
+			"errors-json": stringFlag(&errorReport.file),
+			"lang":        stringFlag(&lang),
+		},
+		logFlags(&logOpts), rateFlags(&config), httpFlags(&config))
+	// Failures exit through fatal, which writes the report itself
+	defer errorReport.finish(nil, 0)
+	if err := setupLanguage(lang); err != nil {
+		fatal("", err)
+	}
+	if flagErr != nil {
+		fatal("", flagErr)
+	}
+	if err := setupLogging(logOpts); err != nil {
+		fatal("", err)
+	}
+	setupProgress(logOpts.Quiet)
+	if profile == "" {
+		profile = config.Profile
+	}
+	if profile != "" {
+		if err := applyProfile(&config, profile); err != nil {
+			fatal("", err)
+		}
+	}
+	redactionReport.file = config.RedactionReport
+	auditLog.file = config.AuditLogFile
+
+	// Ctrl-C cancels in-flight requests; a second one exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Subcommands
+	if len(args) > 0 {
+		switch args[0] {
+		case "auth":
+			if err := runAuthCommand(ctx, config, args[1:]); err != nil {
+				fatal("Auth failed", err)
+			}
+			return
+		case "sync":
+			if err := runSyncCommand(ctx, config, args[1:]); err != nil {
+				fatal("Sync failed", err)
+			}
+			return
+		case "meta":
+			if err := runMetaCommand(ctx, config, args[1:]); err != nil {
+				fatal("Meta failed", err)
+			}
+			return
+		case "retry":
+			if err := runRetryCommand(ctx, config, args[1:]); err != nil {
+				fatal("Retry failed", err)
+			}
+			return
+		case "provenance":
+			if err := runProvenanceCommand(ctx, config, args[1:]); err != nil {
+				fatal("Provenance failed", err)
+			}
+			return
+		case "lint":
+			if err := runLintCommand(args[1:]); err != nil {
+				fatal("Lint failed", err)
+			}
+			return
+		case "list":
+			if err := runListCommand(ctx, config, args[1:]); err != nil {
+				fatal("List failed", err)
+			}
+			return
+		case "rm":
+			if err := runRmCommand(ctx, config, args[1:]); err != nil {
+				fatal("Remove failed", err)
+			}
+			return
+		case "mv":
+			if err := runMvCommand(ctx, config, args[1:]); err != nil {
+				fatal("Move failed", err)
+			}
+			return
+		case "cp":
+			if err := runCpCommand(ctx, config, args[1:]); err != nil {
+				fatal("Copy failed", err)
+			}
+			return
+		case "serve":
+			if err := runServeCommand(ctx, config, args[1:]); err != nil {
+				fatal("Serve failed", err)
+			}
+			return
+		case "jobs":
+			if err := runJobsCommand(ctx, args[1:]); err != nil {
+				fatal("Jobs failed", err)
+			}
+			return
+		case "watch":
+			if err := runWatchCommand(ctx, config, args[1:]); err != nil {
+				fatal("Watch failed", err)
+			}
+			return
+		case "audit":
+			if err := runAuditCommand(config, args[1:]); err != nil {
+				fatal("Audit failed", err)
+			}
+			return
+		case "about":
+			if err := runAboutCommand(ctx, config, args[1:]); err != nil {
+				fatal("About failed", err)
+			}
+			return
+		case "revisions":
+			if err := runRevisionsCommand(ctx, config, args[1:]); err != nil {
+				fatal("Revisions failed", err)
+			}
+			return
+		case "ui":
+			if err := runUICommand(ctx, config, args[1:]); err != nil {
+				fatal("UI failed", err)
+			}
+			return
+		case "completion":
+			if err := runCompletionCommand(args[1:]); err != nil {
+				fatal("Completion failed", err)
+			}
+			return
+		case "__complete":
+			runCompleteCommand(ctx, config, args[1:])
+			return
+		case "find":
+			if err := runFindCommand(ctx, config, args[1:]); err != nil {
+				fatal("Find failed", err)
+			}
+			return
+		case "state":
+			if err := runStateCommand(ctx, config, args[1:]); err != nil {
+				fatal("State failed", err)
+			}
+			return
+		case "daemon":
+			if err := runDaemonCommand(ctx, config, args[1:]); err != nil {
+				fatal("Daemon failed", err)
+			}
+			return
+		case "append":
+			if err := runAppendCommand(ctx, config, args[1:]); err != nil {
+				fatal("Append failed", err)
+			}
+			return
+		case "export-tree":
+			if err := runExportTreeCommand(ctx, config, args[1:]); err != nil {
+				fatal("Export failed", err)
+			}
+			return
+		case "pull":
+			if err := runPullCommand(ctx, config, args[1:]); err != nil {
+				fatal("Pull failed", err)
+			}
+			return
+		}
+	}
+
+	// "upload" names the default mode explicitly
+	if len(args) > 0 && args[0] == "upload" {
+		args = args[1:]
+	}
+
 	var (
-		drivePath = flag.String("path", "", "Target path on Google Drive (e.g.: /documents/project)")
-		listOnly  = flag.Bool("list", false, "Only list folders under target path")
+		drivePath  = flag.String("path", config.DefaultPath, "Target path on Google Drive (e.g.: /documents/project, starred:Reports/2024, computers:My Laptop/Documents, drive:Team/Specs or id:<folder id>/Specs)")
+		sharedDrv  = flag.String("drive", "", "Shared drive name or ID that -path is relative to")
+		folderID   = flag.String("folder-id", "", "ID of the target folder, e.g. from a share link; -path is relative to it")
+		credsFile  = flag.String("credentials", config.CredentialsFile, "OAuth client credentials file (env DOC2GDOC_CREDENTIALS)")
+		tokenFile  = flag.String("token", config.TokenFile, "File the OAuth token is stored in (env DOC2GDOC_TOKEN)")
+		tokenStore = flag.String("token-store", config.TokenStorage, "Where to keep the OAuth token: file or keyring (env DOC2GDOC_TOKEN_STORE)")
+		cacheFile  = flag.String("folder-cache", config.FolderCacheFile, "Persist resolved folder IDs in this file to skip lookups on later runs")
+		folderLock = flag.Bool("folder-lock", false, "Coordinate folder creation with other runners publishing to the same tree")
+		prefer     = flag.String("prefer", "", "Pick among folders sharing a name: newest, oldest or id:<folder id>")
+		listOnly   = flag.Bool("list", false, "Only list folders under target path (see \"doc2gdoc list\" for files and trees)")
+		pageSize   = flag.Int64("page-size", 100, "Number of results fetched per API request when listing (max 1000)")
+		maxResults = flag.Int("max-results", 0, "Stop listing after this many results (0 means no limit)")
+		sourceMime = flag.String("source-mime", "", "Override the detected MIME type of the source file (e.g.: text/html)")
+		target     = flag.String("target", "", "Google Workspace type to convert into: doc, sheet or slide (default: by extension)")
+		noCreate   = flag.Bool("no-create-folders", false, "Fail instead of creating missing folders (same as -create-mode=none)")
+		createMode = flag.String("create-mode", createAll, "Which missing folders may be created: all, leaf (only the last one) or none")
+		skipSame   = flag.Bool("skip-unchanged", false, "Skip files whose content hash matches the existing document, and update it otherwise (implies -on-conflict overwrite)")
+		normalize  = flag.Bool("normalize-headings", false, "Fix skipped heading levels in Markdown (e.g. # followed by ###)")
+		numbering  = flag.Bool("number-headings", false, "Number Markdown headings as 1., 1.1, 1.1.1")
+		direction  = flag.String("direction", "", "Paragraph direction for Docs: auto (detect Hebrew/Arabic), rtl or ltr (default: as imported)")
+		rtl        = flag.Bool("rtl", false, "Shorthand for -direction=rtl")
+		timeout    = flag.Duration("timeout", 0, "Abort if the conversion takes longer than this, e.g. 5m (0 means no limit)")
+		provenance = flag.Bool("provenance", false, "Record the source commit and builder in the document's properties")
+		provKey    = flag.String("provenance-key", "", "Sign the provenance with this ed25519 private key (PEM), implies -provenance")
+		provFooter = flag.Bool("provenance-footer", false, "Also append the provenance as a footer line to Docs, implies -provenance")
+		strict     = flag.Bool("strict", false, "Fail instead of warning when a Doc would exceed practical size limits, or when several folders on the path share a name that -prefer doesn't settle, or when -verify finds content missing")
+		verify     = flag.Bool("verify", false, "Export converted Docs as text and warn when words of the source are missing")
+		verifyMin  = flag.Float64("verify-threshold", defaultVerifyThreshold, "Share of source words -verify expects in the Doc, between 0 and 1")
+		force      = flag.Bool("force", false, "Upload even if Drive does not list the source type as convertible into the target")
+		openDoc    = flag.Bool("open", false, "Open the converted document in the default browser")
+		anyoneRole = flag.String("share-anyone", "", "Share with anyone who has the link: reader, commenter or writer")
+		title      = flag.String("title", "", "Name of the document on Drive (default: the file name without extension, required when the file is - for stdin)")
+		descr      = flag.String("description", "", "Description of newly created documents")
+		starred    = flag.Bool("starred", false, "Star newly created documents")
+		dryRun     = flag.Bool("dry-run", false, "Only show which folders and documents would be created or updated")
+		manifest   = flag.String("manifest", "", "Convert the rows of a CSV or JSON manifest (path, drive_path, title, on_conflict)")
+		ocr        = flag.Bool("ocr", false, "Recognize the text of a scanned PDF or PNG, JPEG or GIF image into a Google Doc")
+		ocrLang    = flag.String("ocr-language", "", "Language hint for -ocr as an ISO 639 code, e.g. en or zh-TW, implies -ocr")
+		webhookURL = flag.String("webhook", config.WebhookURL, "POST a JSON notification to this URL after each conversion (env DOC2GDOC_WEBHOOK_URL, signed with env DOC2GDOC_WEBHOOK_SECRET)")
+		resume     = flag.Bool("resume", false, "Skip files the journal records as converted and unchanged since")
+		resetJrnl  = flag.Bool("reset", false, "Clear the journal before running, or on its own to just clear it")
+		preprocess = flag.String("preprocess", "", "Transform every source with this command first, e.g. 'pandoc -f rst -t docx -o {out} {in}'")
+		template   = flag.String("template", "", "ID of a Google Doc to copy for new Docs, so they get its styles, header and footer")
+		addTitle   = flag.Bool("add-title", false, "Insert the document name as a title at the top of Docs")
+		addTOC     = flag.Bool("add-toc", false, "Insert a table of contents linking the headings at the top of Docs")
+		header     = flag.String("header", "", "Set the header of Docs, e.g. 'Confidential' ({date} and {file} are replaced)")
+		footer     = flag.String("footer", "", "Set the footer of Docs, e.g. '{file}, {date}'")
+		prepend    = flag.String("prepend", "", "Insert boilerplate text at the top of Docs, or @file to read it from a file")
+		noFrontMat = flag.Bool("no-front-matter", false, "Ignore the title, folder and tags in Markdown front matter")
+		preprocOut = flag.String("preprocess-output", "", "Extension of the file -preprocess writes to {out}, e.g. .docx (default: the source's)")
+		delimiter  = flag.String("delimiter", "", "Field delimiter of CSV and TSV sources, e.g. ; or \\t (default: tab for .tsv, comma otherwise)")
+		encoding   = flag.String("encoding", "", "Character set of CSV and TSV sources, e.g. big5, shift_jis or windows-1252 (default: utf-8)")
+		csvHeader  = flag.Bool("csv-header", false, "Bold and freeze the first row of spreadsheets converted from CSV and TSV")
+		sheetName  = flag.String("sheet-name", "", "Name of the tab a CSV or TSV source is converted into (default: the file name)")
+		bundleHTML = flag.Bool("bundle-html", false, "Inline the local stylesheets and images HTML sources link to (always done for exports with a _files folder)")
+		tabs       = flag.String("tabs", "", "Convert all CSV and TSV files into one spreadsheet of this name, one tab per file")
+		fileLimit  = flag.Duration("file-timeout", 0, "Give up on a file after this long and queue it for \"doc2gdoc retry\", e.g. 10m (0 means no limit)")
+		breakAfter = flag.Int("break-after", 5, "Stop a batch or manifest after this many consecutive transient failures (0 means never)")
+		onConflict = flag.String("on-conflict", "", "What to do when the document already exists: skip, overwrite, rename or version, which keeps a copy of the document before overwriting it (default: always create a new one)")
 	)
-	flag.Parse()
+	var alsoPublish stringList
+	flag.Var(&alsoPublish, "also-publish", "Also publish to this Drive path as a shortcut, or as a copy with a copy: prefix, besides the destinations of the config file (repeatable)")
+	var alsoLinkIn stringList
+	flag.Var(&alsoLinkIn, "also-link-in", "Also show the document in this Drive folder through a shortcut (repeatable)")
+	var shareWith stringList
+	flag.Var(&shareWith, "share", "Share the document with a user as email:role, role being reader, commenter or writer (repeatable)")
+	flag.String("profile", profile, "Account profile to use, see \"doc2gdoc auth list\" (env DOC2GDOC_PROFILE)")
+	flag.Bool("v", false, "Log progress details to stderr")
+	flag.Bool("vv", false, "Log API lookups and other debugging details to stderr")
+	flag.Bool("quiet", false, "Only log errors and hide progress bars")
+	flag.String("log-format", "text", "Format of log output on stderr: text or json")
+	flag.Float64("qps", config.QPS, "Limit Google API requests per second, e.g. 2 or 0.5 (env DOC2GDOC_QPS, 0 means no limit)")
+	flag.Int("burst", max(config.Burst, 1), "Requests allowed at once before -qps applies (env DOC2GDOC_BURST)")
+	flag.String("proxy", config.Proxy, "Proxy URL for Google APIs, e.g. http://proxy:3128 (default: env HTTPS_PROXY)")
+	flag.String("ca-cert", config.CACertFile, "PEM file of CA certificates to trust besides the system ones (env DOC2GDOC_CA_CERT)")
+	flag.Duration("http-timeout", config.HTTPTimeout, "Abort API requests taking longer than this, e.g. 60s (env DOC2GDOC_HTTP_TIMEOUT, 0 means no limit)")
+	flag.Bool("debug-http", config.DebugHTTP, "Log the method, URL, status and timing of every API request, without headers or bodies")
+	flag.String("max-upload-rate", "", "Limit the upload bandwidth of each file, e.g. 5MB/s (env DOC2GDOC_MAX_UPLOAD_RATE)")
+	flag.Bool("share-upload-rate", config.ShareUploadRate, "Apply -max-upload-rate to all concurrent uploads together instead of to each")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: doc2gdoc [upload] [flags] <file or glob>...")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), "\nExit codes: 1 failure, 2 invalid flags, 3 authorization, 4 not found, 5 quota, 6 some files of a batch failed, 7 unsupported format.\nAny command takes -errors-json <file> to write its failures as JSON, and -lang en|zh-TW to pick the language of its output (default: from LANG).")
+	}
+	files, err := parseInterspersed(flag.CommandLine, args)
+	if err != nil {
+		fatal("", err)
+	}
+
+	if *noCreate {
+		*createMode = createNone
+	}
+	if *sharedDrv != "" && *folderID != "" {
+		fatal("", usageErr(errors.New(tr("Specify either -drive or -folder-id, not both"))))
+	}
+	*drivePath = cleanDrivePath(*drivePath)
+	if *sharedDrv != "" {
+		*drivePath = drivePrefix + *sharedDrv + "/" + strings.TrimPrefix(*drivePath, "/")
+	}
+	if *folderID != "" {
+		// A -path from the config file names a different folder, so only an
+		// explicit -path is taken as relative to the ID
+		relPath := ""
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "path" {
+				relPath = *drivePath
+			}
+		})
+		*drivePath = idPrefix + *folderID + "/" + strings.TrimPrefix(relPath, "/")
+	}
+	if err := validateCreateMode(*createMode); err != nil {
+		fatal("", usageErr(err))
+	}
+	if *verifyMin < 0 || *verifyMin > 1 {
+		fatal("", usageErr(errors.New(tr("-verify-threshold must be between 0 and 1"))))
+	}
+	if *breakAfter < 0 {
+		fatal("", usageErr(errors.New(tr("-break-after must not be negative"))))
+	}
 
-	config := Config{
-		CredentialsFile: "credentials.json",
-		TokenFile:       "token.json",
+	config.CredentialsFile = *credsFile
+	config.TokenFile = *tokenFile
+	config.TokenStorage = *tokenStore
+	config.FolderCacheFile = *cacheFile
+	config.FolderLock = *folderLock
+	if err := validatePrefer(*prefer); err != nil {
+		fatal("", usageErr(err))
 	}
+	config.StrictFolders, config.PreferFolder = *strict, *prefer
+	config.WebhookURL = *webhookURL
+	config.FileTimeout, config.BreakAfter = *fileLimit, *breakAfter
 
-	srv, err := initClient(config)
+	if *resetJrnl {
+		if err := resetJournal(config.StateFile); err != nil {
+			fatal("", err)
+		}
+		if len(files) == 0 && *manifest == "" {
+			fmt.Print(tr("Cleared the journal in %s\n", config.StateFile))
+			return
+		}
+	}
+
+	svc, err := initClient(ctx, config)
 	if err != nil {
-		log.Fatalf("Unable to initialize client: %v", err)
+		fatal("Unable to initialize client", err)
 	}
 
 	// If in list mode, only list folders
 	if *listOnly {
-		parentID, err := findOrCreateFolder(srv, *drivePath)
+		parentID, err := svc.Folders.FindOrCreate(ctx, *drivePath, *createMode)
 		if err != nil {
-			log.Fatalf("Unable to find target path: %v", err)
+			fatal("Unable to find target path", err)
 		}
-		if err := listFolders(srv, parentID); err != nil {
-			log.Fatalf("Unable to list folders: %v", err)
+		if err := listFolders(ctx, svc.Files, parentID, *pageSize, *maxResults); err != nil {
+			fatal("Unable to list folders", err)
 		}
 		return
 	}
 
-	args := flag.Args()
-	if len(args) < 1 {
-		log.Fatal("Please specify the file path to convert")
+	var rows []ManifestRow
+	if *manifest != "" {
+		if len(files) > 0 {
+			fatal("", usageErr(errors.New(tr("Specify either files or -manifest, not both"))))
+		}
+		if rows, err = loadManifest(*manifest); err != nil {
+			fatal("", err)
+		}
 	}
-
-	err = convertToGoogleDocs(srv, args[0], *drivePath)
+	files, err = expandFileArgs(files)
+	if err != nil {
+		fatal("", err)
+	}
+	if len(files) < 1 && *manifest == "" {
+		fatal("", usageErr(errors.New(tr("Please specify the file path to convert"))))
+	}
+	if *title != "" && len(files) > 1 {
+		fatal("", usageErr(errors.New(tr("-title can only be used with a single file"))))
+	}
+	if err := validateConflictStrategy(*onConflict); err != nil {
+		fatal("", usageErr(err))
+	}
+	if *rtl {
+		*direction = directionRTL
+	}
+	if err := validateDirection(*direction); err != nil {
+		fatal("", usageErr(err))
+	}
+	destinations := slices.Clone(config.Destinations)
+	for _, spec := range alsoPublish {
+		destinations = append(destinations, parseDestination(spec))
+	}
+	for _, p := range alsoLinkIn {
+		destinations = append(destinations, Destination{Path: p})
+	}
+	var shares []Share
+	for _, spec := range shareWith {
+		share, err := parseShare(spec)
+		if err != nil {
+			fatal("", err)
+		}
+		shares = append(shares, share)
+	}
+	if *anyoneRole != "" {
+		if err := validateShareRole(*anyoneRole); err != nil {
+			fatal("", usageErr(err))
+		}
+	}
+	if err := validateOCRLanguage(*ocrLang); err != nil {
+		fatal("", usageErr(err))
+	}
+	if _, err := splitCommand(*preprocess); err != nil {
+		fatal("", usageErr(err))
+	}
+	csvOpts := CSVOptions{Delimiter: *delimiter, Encoding: *encoding, Header: *csvHeader, SheetName: *sheetName}
+	if err := validateCSVOptions(csvOpts); err != nil {
+		fatal("", usageErr(err))
+	}
+	if *tabs != "" && (*manifest != "" || *title != "" || *sheetName != "") {
+		fatal("", usageErr(errors.New(tr("-tabs names the spreadsheet and its tabs, it cannot be used with -manifest, -title or -sheet-name"))))
+	}
+	boilerplate, err := readBoilerplate(*prepend)
 	if err != nil {
-		log.Fatalf("Conversion failed: %v", err)
+		fatal("", err)
+	}
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	opts := ConvertOptions{
+		SourceMimeType: *sourceMime,
+		Target:         *target,
+		CreateMode:     *createMode,
+		SkipUnchanged:  *skipSame,
+		OnConflict:     *onConflict,
+		Destinations:   destinations,
+		StateFile:      config.StateFile,
+
+		NormalizeHeadings: *normalize,
+		NumberHeadings:    *numbering,
+		Direction:         *direction,
+		Shares:            shares,
+		ShareAnyone:       *anyoneRole,
+		Open:              *openDoc,
+		Provenance:        *provenance || *provKey != "" || *provFooter,
+		ProvenanceKey:     *provKey,
+		ProvenanceFooter:  *provFooter,
+		Strict:            *strict,
+		Verify:            *verify,
+		VerifyThreshold:   *verifyMin,
+		Force:             *force,
+		Title:             *title,
+		Description:       *descr,
+		Starred:           *starred,
+		DryRun:            *dryRun,
+		OCR:               *ocr || *ocrLang != "",
+		OCRLanguage:       *ocrLang,
+		Preprocess:        config.Preprocess,
+		Filters:           config.Filters,
+		Styles:            config.Styles,
+		CSV:               csvOpts,
+		BundleHTML:        *bundleHTML,
+		FrontMatter:       !*noFrontMat,
+		Template:          *template,
+		PostProcess: PostProcess{
+			Title:   *addTitle,
+			TOC:     *addTOC,
+			Header:  *header,
+			Footer:  *footer,
+			Prepend: boilerplate,
+		},
+	}
+	// The command line rule wins over the config file's
+	if *preprocess != "" {
+		opts.Preprocess = append([]PreprocessRule{{Command: *preprocess, Output: *preprocOut}}, opts.Preprocess...)
+	}
+	// Single files need no journal, and a dry run completes nothing
+	var journal *Journal
+	if (*manifest != "" || len(files) > 1) && *tabs == "" && !*dryRun {
+		if journal, err = openJournal(config.StateFile, *resume); err != nil {
+			fatal("", err)
+		}
+	}
+	if *manifest != "" {
+		if err := runManifest(ctx, svc, config, journal, rows, *drivePath, opts); err != nil {
+			fatal("Manifest failed", err)
+		}
+		return
+	}
+	if *tabs != "" {
+		if err := convertCSVTabs(ctx, svc, config, files, *drivePath, *tabs, opts); err != nil {
+			fatal("Conversion failed", err)
+		}
+		return
+	}
+	if files, err = orderBatch(files, config.Order); err != nil {
+		fatal("Batch failed", err)
+	}
+	if len(files) == 1 {
+		if _, err := convertOrQueue(ctx, svc, config, files[0], *drivePath, opts); err != nil {
+			fatal("Conversion failed", err)
+		}
+		return
+	}
+	if err := convertBatch(ctx, svc, config, journal, files, *drivePath, opts); err != nil {
+		fatal("Batch failed", err)
 	}
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestRow is one conversion in a -manifest file
+type ManifestRow struct {
+	Path       string `json:"path"`
+	DrivePath  string `json:"drive_path"`
+	Title      string `json:"title"`
+	OnConflict string `json:"on_conflict"`
+}
+
+// loadManifest reads a CSV manifest with a header row (path, drive_path,
+// title, on_conflict) or a JSON array of rows. Relative paths are resolved
+// against the manifest's directory.
+func loadManifest(manifestFile string) ([]ManifestRow, error) {
+	f, err := os.Open(manifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open manifest: %v", err)
+	}
+	defer f.Close()
+
+	var rows []ManifestRow
+	if strings.EqualFold(filepath.Ext(manifestFile), ".json") {
+		if err := json.NewDecoder(f).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("unable to parse manifest: %v", err)
+		}
+	} else {
+		rows, err = readManifestCSV(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse manifest: %v", err)
+		}
+	}
+
+	dir := filepath.Dir(manifestFile)
+	for i := range rows {
+		if rows[i].Path == "" {
+			return nil, fmt.Errorf("manifest row %d has no path", i+1)
+		}
+		if !filepath.IsAbs(rows[i].Path) {
+			rows[i].Path = filepath.Join(dir, rows[i].Path)
+		}
+		if err := validateConflictStrategy(rows[i].OnConflict); err != nil {
+			return nil, fmt.Errorf("manifest row %d: %v", i+1, err)
+		}
+	}
+	return rows, nil
+}
+
+func readManifestCSV(r io.Reader) ([]ManifestRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		return nil, fmt.Errorf("header has no path column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []ManifestRow
+	for _, record := range records[1:] {
+		rows = append(rows, ManifestRow{
+			Path:       field(record, "path"),
+			DrivePath:  field(record, "drive_path"),
+			Title:      field(record, "title"),
+			OnConflict: field(record, "on_conflict"),
+		})
+	}
+	return rows, nil
+}
+
+// runManifest converts every manifest row and prints its status. Rows
+// without a conflict strategy overwrite in place and skip unchanged
+// sources, so re-running a manifest is idempotent. Converted rows are
+// recorded in journal, and skipped if it resumes a run.
+func runManifest(ctx context.Context, svc *Services, config Config, journal *Journal, rows []ManifestRow, drivePath string, opts ConvertOptions) error {
+	var errs []error
+	converted, failed := 0, 0
+	brk := breaker{limit: config.BreakAfter}
+	for i, row := range rows {
+		if ctx.Err() != nil {
+			fmt.Print(tr("Interrupted, %d row(s) not started\n", len(rows)-i))
+			break
+		}
+
+		rowOpts := opts
+		rowOpts.Title = row.Title
+		rowOpts.OnConflict = row.OnConflict
+		if rowOpts.OnConflict == "" {
+			rowOpts.OnConflict = conflictOverwrite
+			rowOpts.SkipUnchanged = true
+		}
+		target := row.DrivePath
+		if target == "" {
+			target = drivePath
+		}
+
+		fmt.Print(tr("[row %d] %s -> %s\n", i+1, row.Path, target))
+		entry, hash, done := journal.Completed(row.Path, target)
+		if done {
+			fmt.Print(tr("[row %d] done in an earlier run (File ID: %s)\n", i+1, entry.FileID))
+			converted++
+			continue
+		}
+		res, err := convertOrQueue(ctx, svc, config, row.Path, target, rowOpts)
+		brk.record(ctx, err)
+		if err != nil {
+			fmt.Print(tr("[row %d] failed: %v\n", i+1, err))
+			errs = append(errs, err)
+			failed++
+			if errors.Is(err, ErrTokenExpired) || brk.tripped() {
+				fmt.Print(tr("%d row(s) not started\n", len(rows)-i-1))
+				break
+			}
+			continue
+		}
+		if err := journal.Record(row.Path, target, hash, res); err != nil {
+			logger.Error("Unable to record in journal", "row", i+1, "err", err)
+		}
+		fmt.Print(tr("[row %d] ok\n", i+1))
+		converted++
+	}
+
+	fmt.Print(tr("Manifest finished: %d converted, %d failed, %d total\n", converted, failed, len(rows)))
+	brk.report()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := stoppedForAuth(journal, errs); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &BatchError{Failed: failed, Total: len(rows), Unit: "row(s)", Errs: errs}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mdBlockKind identifies the type of a Markdown block
+type mdBlockKind int
+
+const (
+	mdParagraph mdBlockKind = iota
+	mdHeading
+	mdListItem
+	mdCode
+	mdTable
+	mdRule
+	mdQuote
+)
+
+// mdBlock is a single block-level Markdown element
+type mdBlock struct {
+	Kind mdBlockKind
+	// Level is the heading level (1-6) or the list nesting depth (0-based)
+	Level int
+	// Ordered marks numbered list items
+	Ordered bool
+	// Text holds the raw inline text, or the contents of a code block
+	Text string
+	// Rows holds table cells, the first row being the header
+	Rows [][]string
+}
+
+// mdRun is a span of inline text sharing the same formatting
+type mdRun struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	Code   bool
+	Link   string
+}
+
+var (
+	mdHeadingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*?)(\s+#+)?\s*$`)
+	mdListRe     = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	mdRuleRe     = regexp.MustCompile(`^((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	mdTableSepRe = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+	mdLinkRe     = regexp.MustCompile(`^\[([^\]]*)\]\(([^)\s]+)(\s+"[^"]*")?\)`)
+)
+
+// mdEscapable lists the characters that can be backslash-escaped
+const mdEscapable = "\\`*_{}[]()#+-.!|>"
+
+// parseMarkdown splits Markdown source into blocks
+func parseMarkdown(src string) []mdBlock {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var blocks []mdBlock
+	var para []string
+	flushPara := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, mdBlock{Kind: mdParagraph, Text: strings.Join(para, " ")})
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flushPara()
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flushPara()
+			fence := trimmed[:3]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, mdBlock{Kind: mdCode, Text: strings.Join(code, "\n")})
+
+		case mdHeadingRe.MatchString(trimmed):
+			flushPara()
+			m := mdHeadingRe.FindStringSubmatch(trimmed)
+			blocks = append(blocks, mdBlock{Kind: mdHeading, Level: len(m[1]), Text: m[2]})
+
+		case mdRuleRe.MatchString(trimmed):
+			flushPara()
+			blocks = append(blocks, mdBlock{Kind: mdRule})
+
+		case strings.Contains(trimmed, "|") && i+1 < len(lines) && mdTableSepRe.MatchString(strings.TrimSpace(lines[i+1])):
+			flushPara()
+			rows := [][]string{splitTableRow(trimmed)}
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|"); i++ {
+				rows = append(rows, splitTableRow(strings.TrimSpace(lines[i])))
+			}
+			i--
+			blocks = append(blocks, mdBlock{Kind: mdTable, Rows: rows})
+
+		case mdListRe.MatchString(line):
+			flushPara()
+			m := mdListRe.FindStringSubmatch(line)
+			indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+			blocks = append(blocks, mdBlock{
+				Kind:    mdListItem,
+				Level:   indent / 2,
+				Ordered: m[2][0] >= '0' && m[2][0] <= '9',
+				Text:    m[3],
+			})
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushPara()
+			blocks = append(blocks, mdBlock{Kind: mdQuote, Text: strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))})
+
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+
+	return blocks
+}
+
+// splitTableRow splits a pipe table row into trimmed cells
+func splitTableRow(row string) []string {
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	row = strings.ReplaceAll(row, `\|`, "\x00")
+	cells := strings.Split(row, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(strings.ReplaceAll(cell, "\x00", "|"))
+	}
+	return cells
+}
+
+// parseInline splits inline Markdown into formatted runs
+func parseInline(s string) []mdRun {
+	var runs []mdRun
+	var buf strings.Builder
+	emit := func() {
+		if buf.Len() > 0 {
+			runs = append(runs, mdRun{Text: buf.String()})
+			buf.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(mdEscapable, s[i+1]) >= 0:
+			buf.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end >= 0 {
+				emit()
+				runs = append(runs, mdRun{Text: s[i+1 : i+1+end], Code: true})
+				i += end + 2
+				continue
+			}
+
+		case c == '[':
+			if m := mdLinkRe.FindStringSubmatch(s[i:]); m != nil {
+				emit()
+				inner := parseInline(m[1])
+				for j := range inner {
+					inner[j].Link = m[2]
+				}
+				runs = append(runs, inner...)
+				i += len(m[0])
+				continue
+			}
+
+		case c == '*' || c == '_':
+			n := 1
+			for n < 3 && i+n < len(s) && s[i+n] == c {
+				n++
+			}
+			// Underscores inside words (snake_case) are not emphasis
+			if c == '_' && i > 0 && isWordByte(s[i-1]) {
+				break
+			}
+			delim := s[i : i+n]
+			if end := strings.Index(s[i+n:], delim); end > 0 {
+				emit()
+				inner := parseInline(s[i+n : i+n+end])
+				for j := range inner {
+					if n >= 2 {
+						inner[j].Bold = true
+					}
+					if n != 2 {
+						inner[j].Italic = true
+					}
+				}
+				runs = append(runs, inner...)
+				i += 2*n + end
+				continue
+			}
+		}
+		buf.WriteByte(c)
+		i++
+	}
+	emit()
+
+	return runs
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// plainText joins the text of runs without formatting
+func plainText(runs []mdRun) string {
+	var b strings.Builder
+	for _, r := range runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+// normalizeHeadingLevels removes skipped heading levels, so a heading is at
+// most one level deeper than the one before it (e.g. # then ### becomes # then ##)
+func normalizeHeadingLevels(blocks []mdBlock) {
+	prev := 0
+	for i := range blocks {
+		if blocks[i].Kind != mdHeading {
+			continue
+		}
+		if blocks[i].Level > prev+1 {
+			blocks[i].Level = prev + 1
+		}
+		prev = blocks[i].Level
+	}
+}
+
+// numberHeadings prefixes headings with outline numbers: "1.", "1.1", "1.1.1".
+// The shallowest heading level present is numbered first, so a document
+// starting at ## is not numbered "0.1".
+func numberHeadings(blocks []mdBlock) {
+	top := 0
+	for _, b := range blocks {
+		if b.Kind == mdHeading && (top == 0 || b.Level < top) {
+			top = b.Level
+		}
+	}
+	var counters [6]int
+	for i := range blocks {
+		if blocks[i].Kind != mdHeading {
+			continue
+		}
+		level := blocks[i].Level - top + 1
+		counters[level-1]++
+		for j := level; j < len(counters); j++ {
+			counters[j] = 0
+		}
+
+		parts := make([]string, level)
+		for j := 0; j < level; j++ {
+			parts[j] = strconv.Itoa(counters[j])
+		}
+		number := strings.Join(parts, ".")
+		if level == 1 {
+			number += "."
+		}
+		blocks[i].Text = number + " " + blocks[i].Text
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func headingTexts(blocks []mdBlock) []string {
+	var texts []string
+	for _, b := range blocks {
+		if b.Kind == mdHeading {
+			texts = append(texts, b.Text)
+		}
+	}
+	return texts
+}
+
+func TestNumberHeadings(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     []string
+	}{
+		{"from h1", "# A\n## B\n## C\n### D\n# E\n", []string{"1. A", "1.1 B", "1.2 C", "1.2.1 D", "2. E"}},
+		{"from h2", "## A\n### B\n## C\n", []string{"1. A", "1.1 B", "2. C"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := parseMarkdown(tt.markdown)
+			numberHeadings(blocks)
+			if got := headingTexts(blocks); !slices.Equal(got, tt.want) {
+				t.Errorf("numbered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHeadingLevels(t *testing.T) {
+	blocks := parseMarkdown("# A\n### B\n##### C\n## D\n")
+	normalizeHeadingLevels(blocks)
+	var levels []int
+	for _, b := range blocks {
+		if b.Kind == mdHeading {
+			levels = append(levels, b.Level)
+		}
+	}
+	if want := []int{1, 2, 3, 2}; !slices.Equal(levels, want) {
+		t.Errorf("levels %v, want %v", levels, want)
+	}
+}
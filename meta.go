@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// runMetaCommand implements "doc2gdoc meta set [flags] <drive path glob>..."
+func runMetaCommand(ctx context.Context, config Config, args []string) error {
+	if len(args) < 1 || args[0] != "set" {
+		return fmt.Errorf("usage: doc2gdoc meta set [-description text] [-prop key=value] [-star|-unstar] [-dry-run] <drive path glob>...")
+	}
+
+	flags := flag.NewFlagSet("meta set", flag.ExitOnError)
+	description := flags.String("description", "", "Set the description")
+	star := flags.Bool("star", false, "Star the matched files")
+	unstar := flags.Bool("unstar", false, "Unstar the matched files")
+	dryRun := flags.Bool("dry-run", false, "Only show which files would be updated")
+	var props stringList
+	flags.Var(&props, "prop", "Set an appProperties entry, key=value (repeatable, empty value removes the key)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc meta set [flags] <drive path glob>...")
+		fmt.Fprintln(flags.Output(), "Example: doc2gdoc meta set -prop team=eng -star '/reports/2024/*.docx'")
+		flags.PrintDefaults()
+	}
+
+	patterns, err := parseInterspersed(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		flags.Usage()
+		return fmt.Errorf("please specify at least one Drive path")
+	}
+	if *star && *unstar {
+		return fmt.Errorf("-star and -unstar are mutually exclusive")
+	}
+
+	update := &drive.File{}
+	var set bool
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "description" {
+			update.Description = *description
+			// An empty description must still be sent to clear it
+			if *description == "" {
+				update.ForceSendFields = append(update.ForceSendFields, "Description")
+			}
+			set = true
+		}
+	})
+	if len(props) > 0 {
+		update.AppProperties = map[string]string{}
+		for _, prop := range props {
+			key, value, ok := strings.Cut(prop, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("invalid -prop %q, expected key=value", prop)
+			}
+			update.AppProperties[key] = value
+			// A nil value deletes the property
+			if value == "" {
+				update.NullFields = append(update.NullFields, "AppProperties."+key)
+				delete(update.AppProperties, key)
+			}
+		}
+		set = true
+	}
+	if *star || *unstar {
+		update.Starred = *star
+		update.ForceSendFields = append(update.ForceSendFields, "Starred")
+		set = true
+	}
+	if !set {
+		return fmt.Errorf("nothing to change, use -description, -prop, -star or -unstar")
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+
+	updated := 0
+	for _, pattern := range patterns {
+		files, err := matchDriveFiles(ctx, svc, pattern)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			fmt.Print(tr("No files match %s\n", pattern))
+		}
+		for _, file := range files {
+			if *dryRun {
+				fmt.Print(tr("[dry-run] update %s (ID: %s)\n", path.Join(path.Dir(pattern), file.Name), file.Id))
+				updated++
+				continue
+			}
+			_, err := svc.Files.UpdateFile(ctx, file.Id, update, nil, UploadOptions{})
+			if err != nil {
+				return fmt.Errorf("unable to update %s: %w", file.Name, classifyAPIError(err))
+			}
+			fmt.Print(tr("Updated %s (ID: %s)\n", path.Join(path.Dir(pattern), file.Name), file.Id))
+			updated++
+		}
+	}
+
+	if *dryRun {
+		fmt.Print(tr("[dry-run] would update %d files\n", updated))
+		return nil
+	}
+	fmt.Print(tr("Updated %d files\n", updated))
+	return nil
+}
+
+// matchDriveFiles resolves a Drive path whose last element may be a glob,
+// e.g. "/reports/2024/*.docx", to the matching non-folder files
+func matchDriveFiles(ctx context.Context, svc *Services, pattern string) ([]*drive.File, error) {
+	dir, namePattern := path.Split(cleanDrivePath(pattern))
+	if _, err := path.Match(namePattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+	}
+
+	parentID, err := svc.Folders.FindOrCreate(ctx, dir, createNone)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find folder %s: %w", dir, err)
+	}
+
+	query := buildQuery(
+		quoteQuery(parentID)+" in parents",
+		"mimeType != "+quoteQuery(folderMimeType),
+		"trashed = false",
+	)
+
+	files, err := svc.Files.ListFiles(ctx, query, "id, name", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files: %w", classifyAPIError(err))
+	}
+
+	var matches []*drive.File
+	for _, file := range files {
+		if ok, _ := path.Match(namePattern, file.Name); ok {
+			matches = append(matches, file)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiLatencyBuckets are the upper bounds, in seconds, of the Google API
+// request duration histogram
+var apiLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metrics counts what the process did. It is always collected, and served
+// in the Prometheus text format by "doc2gdoc serve" on /metrics.
+var metrics = newMetricSet()
+
+// metricSet holds the counters; maps are keyed by label value
+type metricSet struct {
+	mu          sync.Mutex
+	conversions map[string]int64
+	uploadBytes int64
+	apiRequests map[[2]string]int64
+	apiErrors   map[string]int64
+	apiLatency  map[string]*histogram
+	retries     map[string]int64
+}
+
+type histogram struct {
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func newMetricSet() *metricSet {
+	return &metricSet{
+		conversions: map[string]int64{},
+		apiRequests: map[[2]string]int64{},
+		apiErrors:   map[string]int64{},
+		apiLatency:  map[string]*histogram{},
+		retries:     map[string]int64{},
+	}
+}
+
+// conversion counts a finished conversion by status
+func (m *metricSet) conversion(status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conversions[status]++
+}
+
+// uploaded counts source bytes sent to Drive
+func (m *metricSet) uploaded(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploadBytes += n
+}
+
+// retry counts a retried operation of the given kind: snapshot, webhook or queue
+func (m *metricSet) retry(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries[kind]++
+}
+
+// apiRequest records a Google API request. code is the HTTP status, or
+// "error" when no response arrived.
+func (m *metricSet) apiRequest(api string, code string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apiRequests[[2]string{api, code}]++
+	if code == "error" || code == "429" || code[0] == '5' {
+		m.apiErrors[api]++
+	}
+	h, ok := m.apiLatency[api]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(apiLatencyBuckets))}
+		m.apiLatency[api] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range apiLatencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// write renders the metrics in the Prometheus text exposition format
+func (m *metricSet) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP doc2gdoc_conversions_total Conversions by outcome.")
+	fmt.Fprintln(w, "# TYPE doc2gdoc_conversions_total counter")
+	for _, status := range sortedKeys(m.conversions) {
+		fmt.Fprintf(w, "doc2gdoc_conversions_total{status=%q} %d\n", status, m.conversions[status])
+	}
+
+	fmt.Fprintln(w, "# HELP doc2gdoc_upload_bytes_total Source bytes uploaded to Drive.")
+	fmt.Fprintln(w, "# TYPE doc2gdoc_upload_bytes_total counter")
+	fmt.Fprintf(w, "doc2gdoc_upload_bytes_total %d\n", m.uploadBytes)
+
+	fmt.Fprintln(w, "# HELP doc2gdoc_api_requests_total Google API requests by API and HTTP status.")
+	fmt.Fprintln(w, "# TYPE doc2gdoc_api_requests_total counter")
+	keys := make([][2]string, 0, len(m.apiRequests))
+	for k := range m.apiRequests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "doc2gdoc_api_requests_total{api=%q,code=%q} %d\n", k[0], k[1], m.apiRequests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP doc2gdoc_api_errors_total Google API requests that failed, were rate limited or hit a server error.")
+	fmt.Fprintln(w, "# TYPE doc2gdoc_api_errors_total counter")
+	for _, api := range sortedKeys(m.apiErrors) {
+		fmt.Fprintf(w, "doc2gdoc_api_errors_total{api=%q} %d\n", api, m.apiErrors[api])
+	}
+
+	fmt.Fprintln(w, "# HELP doc2gdoc_api_request_duration_seconds Google API request latency.")
+	fmt.Fprintln(w, "# TYPE doc2gdoc_api_request_duration_seconds histogram")
+	for _, api := range sortedKeys(m.apiLatency) {
+		h := m.apiLatency[api]
+		for i, bound := range apiLatencyBuckets {
+			fmt.Fprintf(w, "doc2gdoc_api_request_duration_seconds_bucket{api=%q,le=%q} %d\n",
+				api, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "doc2gdoc_api_request_duration_seconds_bucket{api=%q,le=\"+Inf\"} %d\n", api, h.count)
+		fmt.Fprintf(w, "doc2gdoc_api_request_duration_seconds_sum{api=%q} %g\n", api, h.sum)
+		fmt.Fprintf(w, "doc2gdoc_api_request_duration_seconds_count{api=%q} %d\n", api, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP doc2gdoc_retries_total Retried operations by kind.")
+	fmt.Fprintln(w, "# TYPE doc2gdoc_retries_total counter")
+	for _, kind := range sortedKeys(m.retries) {
+		fmt.Fprintf(w, "doc2gdoc_retries_total{kind=%q} %d\n", kind, m.retries[kind])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricsTransport records every Google API request in metrics
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.apiRequest(apiName(req), code, time.Since(start))
+	return resp, err
+}
+
+// apiName labels a request with the API it calls: drive, docs or other
+func apiName(req *http.Request) string {
+	switch {
+	case req.URL.Host == "docs.googleapis.com":
+		return "docs"
+	case strings.Contains(req.URL.Path, "/drive/"):
+		return "drive"
+	}
+	return "other"
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sourceMimeTypes maps file extensions to the MIME types Drive expects for import
+var sourceMimeTypes = map[string]string{
+	".docx":     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".doc":      "application/msword",
+	".odt":      "application/vnd.oasis.opendocument.text",
+	".rtf":      "application/rtf",
+	".html":     "text/html",
+	".htm":      "text/html",
+	".xhtml":    "text/html",
+	".shtml":    "text/html",
+	".txt":      "text/plain",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".xlsx":     "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".xls":      "application/vnd.ms-excel",
+	".ods":      "application/vnd.oasis.opendocument.spreadsheet",
+	".csv":      "text/csv",
+	".tsv":      "text/tab-separated-values",
+	".pptx":     "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".ppt":      "application/vnd.ms-powerpoint",
+	".odp":      "application/vnd.oasis.opendocument.presentation",
+	".pdf":      "application/pdf",
+	".png":      "image/png",
+	".jpg":      "image/jpeg",
+	".jpeg":     "image/jpeg",
+	".gif":      "image/gif",
+}
+
+// ocrMimeTypes are the source types Drive can recognize text in
+var ocrMimeTypes = map[string]bool{
+	"application/pdf": true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+}
+
+// ocrLanguageRe matches an ISO 639 code with an optional region, e.g. zh-TW
+var ocrLanguageRe = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})?$`)
+
+// validateOCRLanguage checks an -ocr-language value; empty means no hint
+func validateOCRLanguage(lang string) error {
+	if lang != "" && !ocrLanguageRe.MatchString(lang) {
+		return fmt.Errorf("invalid OCR language %q, expected an ISO 639 code such as en or zh-TW", lang)
+	}
+	return nil
+}
+
+// unknownMimeType is what content sniffing reports for unrecognised binary data
+const unknownMimeType = "application/octet-stream"
+
+// Google Workspace MIME types a file can be converted into
+const (
+	docMimeType   = "application/vnd.google-apps.document"
+	sheetMimeType = "application/vnd.google-apps.spreadsheet"
+	slideMimeType = "application/vnd.google-apps.presentation"
+)
+
+// targetMimeTypes maps -target values to Google Workspace MIME types
+var targetMimeTypes = map[string]string{
+	"doc":   docMimeType,
+	"sheet": sheetMimeType,
+	"slide": slideMimeType,
+}
+
+// targetNames maps Google Workspace MIME types to display names
+var targetNames = map[string]string{
+	docMimeType:   "Google Docs",
+	sheetMimeType: "Google Sheets",
+	slideMimeType: "Google Slides",
+}
+
+// extensionTargets lists extensions that convert to something other than a Doc
+var extensionTargets = map[string]string{
+	".xlsx": sheetMimeType,
+	".xls":  sheetMimeType,
+	".ods":  sheetMimeType,
+	".csv":  sheetMimeType,
+	".tsv":  sheetMimeType,
+	".pptx": slideMimeType,
+	".ppt":  slideMimeType,
+	".odp":  slideMimeType,
+}
+
+// detectTargetMimeType picks the Google Workspace type for a file; an explicit
+// target (doc, sheet, slide) wins over the file extension
+func detectTargetMimeType(filePath string, target string) (string, error) {
+	if target != "" {
+		mimeType, ok := targetMimeTypes[target]
+		if !ok {
+			return "", fmt.Errorf("unknown target %q, expected doc, sheet or slide", target)
+		}
+		return mimeType, nil
+	}
+	if mimeType, ok := extensionTargets[strings.ToLower(filepath.Ext(filePath))]; ok {
+		return mimeType, nil
+	}
+	return docMimeType, nil
+}
+
+// detectSourceMimeType guesses the MIME type of a local file, first by
+// extension and then by sniffing its content
+func detectSourceMimeType(filePath string, file *os.File) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if mimeType, ok := sourceMimeTypes[ext]; ok {
+		return mimeType, nil
+	}
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" && mimeType != unknownMimeType {
+		return mimeType, nil
+	}
+
+	// Sniff the first 512 bytes, then rewind so the upload reads the whole file
+	buf := make([]byte, 512)
+	n, err := file.Read(buf)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mimeType := http.DetectContentType(buf[:n])
+	if mimeType == unknownMimeType {
+		return "", fmt.Errorf("%w: %s is not a recognised document format (use -source-mime to override)", ErrUnsupportedFileType, filePath)
+	}
+	// Drive matches import formats without parameters such as charset, so
+	// sniffed HTML is text/html rather than text/html; charset=utf-8
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+	return mimeType, nil
+}
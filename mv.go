@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// runMvCommand implements "doc2gdoc mv [flags] <drive path or ID>... <dest folder>"
+func runMvCommand(ctx context.Context, config Config, args []string) error {
+	return runTransferCommand(ctx, config, "mv", args)
+}
+
+// runCpCommand implements "doc2gdoc cp [flags] <drive path or ID>... <dest folder>"
+func runCpCommand(ctx context.Context, config Config, args []string) error {
+	return runTransferCommand(ctx, config, "cp", args)
+}
+
+// runTransferCommand moves (mv) or copies (cp) files into a folder given as
+// a Drive path, creating it as -create-mode allows
+func runTransferCommand(ctx context.Context, config Config, command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	name := flags.String("name", "", "New name, only with a single source")
+	createMode := flags.String("create-mode", createAll, "Which missing destination folders may be created: all, leaf or none")
+	dryRun := flags.Bool("dry-run", false, "Only show what would be moved or copied")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: doc2gdoc %s [-name new name] [-create-mode all|leaf|none] [-dry-run] <drive path or file ID>... <destination folder>\n", command)
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 {
+		flags.Usage()
+		return fmt.Errorf("please specify a source and a destination folder")
+	}
+	sources, dest := positional[:len(positional)-1], positional[len(positional)-1]
+	if *name != "" && len(sources) > 1 {
+		return fmt.Errorf("-name can only be used with a single source")
+	}
+	if err := validateCreateMode(*createMode); err != nil {
+		return err
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+
+	var files []*drive.File
+	for _, source := range sources {
+		f, err := resolveDriveFile(ctx, svc, source)
+		if err != nil {
+			return err
+		}
+		if command == "cp" && f.MimeType == folderMimeType {
+			return fmt.Errorf("%s is a folder, Drive cannot copy folders", source)
+		}
+		files = append(files, f)
+	}
+	if *dryRun {
+		_, planned, err := svc.Folders.Plan(ctx, dest, *createMode)
+		if err != nil {
+			return fmt.Errorf("unable to process destination %s: %w", dest, err)
+		}
+		for _, p := range planned {
+			fmt.Print(tr("[dry-run] create folder Google Drive:%s\n", p))
+		}
+		format := "[dry-run] move %s to Google Drive:%s/%s\n"
+		if command == "cp" {
+			format = "[dry-run] copy %s to Google Drive:%s/%s\n"
+		}
+		for _, f := range files {
+			newName := f.Name
+			if *name != "" {
+				newName = *name
+			}
+			fmt.Print(tr(format, f.Name, dest, newName))
+		}
+		return nil
+	}
+	parentID, err := svc.Folders.FindOrCreate(ctx, dest, *createMode)
+	if err != nil {
+		return fmt.Errorf("unable to process destination %s: %w", dest, err)
+	}
+
+	for i, f := range files {
+		ctx := withAuditSource(ctx, sources[i])
+		newName := f.Name
+		if *name != "" {
+			newName = *name
+		}
+		if command == "cp" {
+			res, err := svc.Files.CopyFile(ctx, f.Id, &drive.File{
+				Name:    newName,
+				Parents: []string{parentID},
+			}, "id")
+			if err != nil {
+				return fmt.Errorf("unable to copy %s: %w", f.Name, classifyAPIError(err))
+			}
+			fmt.Print(tr("Copied %s to Google Drive:%s/%s (File ID: %s)\n", f.Name, dest, newName, res.Id))
+			continue
+		}
+		if err := moveDriveFile(ctx, svc, f, newName, parentID); err != nil {
+			return err
+		}
+		fmt.Print(tr("Moved %s to Google Drive:%s/%s (File ID: %s)\n", f.Name, dest, newName, f.Id))
+	}
+	return nil
+}
+
+// moveDriveFile renames file and makes parentID its only parent, keeping
+// the same ID. Nothing is sent if it is already there under that name.
+func moveDriveFile(ctx context.Context, svc *Services, file *drive.File, name string, parentID string) error {
+	var opts UploadOptions
+	inParent := slices.Contains(file.Parents, parentID)
+	if !inParent {
+		opts.AddParents = parentID
+		opts.RemoveParents = strings.Join(file.Parents, ",")
+	}
+	if file.Name == name && inParent {
+		return nil
+	}
+	_, err := svc.Files.UpdateFile(ctx, file.Id, &drive.File{Name: name}, nil, opts)
+	if err != nil {
+		return fmt.Errorf("unable to move %s: %w", file.Name, classifyAPIError(err))
+	}
+	return nil
+}
+
+// copyID returns the ID of a copy, empty if copying failed
+func copyID(res *drive.File) string {
+	if res == nil {
+		return ""
+	}
+	return res.Id
+}
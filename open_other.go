@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// openShared opens a file for reading. Other platforms have no mandatory
+// share locks, so changes are caught by the snapshot size/mtime re-check.
+func openShared(filePath string) (*os.File, error) {
+	return os.Open(filePath)
+}
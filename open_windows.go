@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxShortPath is the longest path Windows opens without the \\?\ prefix;
+// directories leave room for an 8.3 file name
+const maxShortPath = 248
+
+// longPath prefixes long paths with \\?\, which lifts the MAX_PATH limit
+// of the Windows API. The os package does this itself, but calls to
+// syscall don't go through it.
+func longPath(filePath string) string {
+	if strings.HasPrefix(filePath, `\\?\`) {
+		return filePath
+	}
+	// Relative paths are as long as the absolute path they stand for
+	abs, err := filepath.Abs(filePath)
+	if err != nil || len(abs) < maxShortPath {
+		return filePath
+	}
+	// The prefix turns off normalization, which Abs already did
+	if unc, ok := strings.CutPrefix(abs, `\\`); ok {
+		return `\\?\UNC\` + unc
+	}
+	return `\\?\` + abs
+}
+
+// openShared opens a file for reading without FILE_SHARE_WRITE, so editors
+// cannot write to it while the snapshot is taken
+func openShared(filePath string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(longPath(filePath))
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: filePath, Err: err}
+	}
+	return os.NewFile(uintptr(h), filePath), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// OrderRule places the batch files matching Match: files with a higher
+// Priority are converted first, and never before the files matching After.
+// Patterns are matched against the slash separated path as given, or
+// against the file name if they hold no slash.
+type OrderRule struct {
+	Match    string   `yaml:"match"`
+	Priority int      `yaml:"priority"`
+	After    []string `yaml:"after"`
+}
+
+// validateOrder checks the patterns of the order rules
+func validateOrder(rules []OrderRule) error {
+	for _, r := range rules {
+		for _, pattern := range append([]string{r.Match}, r.After...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("order: invalid pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// orderMatch reports whether file, a cleaned slash separated path,
+// matches pattern
+func orderMatch(pattern string, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		file = path.Base(file)
+	}
+	ok, _ := path.Match(pattern, file)
+	return ok
+}
+
+// orderBatch sorts files so that each comes after the files its rules name
+// in After, and otherwise by priority, keeping the order given among equals
+func orderBatch(files []string, rules []OrderRule) ([]string, error) {
+	if len(rules) == 0 {
+		return files, nil
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.ToSlash(filepath.Clean(f))
+	}
+
+	priority := make([]int, len(files))
+	// before[i] are the files i waits for, waiting[j] those waiting for j
+	before := make([]int, len(files))
+	waiting := make([][]int, len(files))
+	for i, name := range names {
+		matched := false
+		for _, r := range rules {
+			if !orderMatch(r.Match, name) {
+				continue
+			}
+			if !matched || r.Priority > priority[i] {
+				priority[i] = r.Priority
+			}
+			matched = true
+			for j, other := range names {
+				if j == i {
+					continue
+				}
+				for _, pattern := range r.After {
+					if orderMatch(pattern, other) {
+						before[i]++
+						waiting[j] = append(waiting[j], i)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	ordered := make([]string, 0, len(files))
+	done := make([]bool, len(files))
+	for len(ordered) < len(files) {
+		next := -1
+		for i := range files {
+			if !done[i] && before[i] == 0 && (next < 0 || priority[i] > priority[next]) {
+				next = i
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for i, f := range files {
+				if !done[i] {
+					cycle = append(cycle, f)
+				}
+			}
+			return nil, fmt.Errorf("the order rules leave no file to convert first among %s", strings.Join(cycle, ", "))
+		}
+		done[next] = true
+		ordered = append(ordered, files[next])
+		for _, i := range waiting[next] {
+			before[i]--
+		}
+	}
+	return ordered, nil
+}
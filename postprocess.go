@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// tocIndent is how far each heading level is indented in the contents
+const tocIndent = 18
+
+// PostProcess edits a converted Doc through the Docs API. Header and
+// Footer may contain {date} and {file}, the source file name.
+type PostProcess struct {
+	// Title inserts the document name as a title paragraph
+	Title bool
+	// TOC inserts a list of links to the document's headings
+	TOC     bool
+	Header  string
+	Footer  string
+	Prepend string
+}
+
+func (p PostProcess) enabled() bool {
+	return p.Title || p.TOC || p.Header != "" || p.Footer != "" || p.Prepend != ""
+}
+
+// readBoilerplate returns the -prepend text, read from a file when it
+// starts with @
+func readBoilerplate(value string) (string, error) {
+	path, ok := strings.CutPrefix(value, "@")
+	if !ok {
+		return value, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read boilerplate: %v", err)
+	}
+	return strings.TrimRight(string(b), "\n"), nil
+}
+
+// applyPostProcess runs the steps of p on a Doc. The title, boilerplate and
+// contents are inserted at the top in that order.
+func applyPostProcess(ctx context.Context, srv *docs.Service, docID string, name string, source string, p PostProcess) error {
+	doc, err := srv.Documents.Get(docID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to read document: %v", err)
+	}
+
+	placeholders := strings.NewReplacer("{date}", time.Now().Format("2006-01-02"), "{file}", source)
+	if p.Header != "" {
+		if err := setHeaderFooter(ctx, srv, doc, "header", placeholders.Replace(p.Header)); err != nil {
+			return err
+		}
+	}
+	if p.Footer != "" {
+		if err := setHeaderFooter(ctx, srv, doc, "footer", placeholders.Replace(p.Footer)); err != nil {
+			return err
+		}
+	}
+
+	// Headings are collected before anything is inserted above them
+	headings := collectHeadings(doc.Body.Content)
+
+	w := &docWriter{ctx: ctx, srv: srv, docID: docID, index: 1}
+	if p.Title {
+		w.paragraph([]mdRun{{Text: name}}, "TITLE")
+	}
+	if p.Prepend != "" {
+		for _, line := range strings.Split(p.Prepend, "\n") {
+			w.paragraph(parseInline(line), "NORMAL_TEXT")
+		}
+	}
+	if p.TOC && len(headings) > 0 {
+		w.paragraph([]mdRun{{Text: "Contents", Bold: true}}, "NORMAL_TEXT")
+		for _, h := range headings {
+			start, end := w.insertText(h.text)
+			w.styleText(start, end, &docs.TextStyle{Link: &docs.Link{HeadingId: h.id}})
+			w.insertText("\n")
+			w.styleParagraph(start, w.index, &docs.ParagraphStyle{
+				NamedStyleType: "NORMAL_TEXT",
+				IndentStart:    &docs.Dimension{Magnitude: float64((h.level - 1) * tocIndent), Unit: "PT"},
+			}, "namedStyleType,indentStart")
+		}
+	}
+	return w.flush()
+}
+
+type heading struct {
+	id    string
+	text  string
+	level int
+}
+
+// collectHeadings returns the HEADING_1 to HEADING_3 paragraphs of a body
+func collectHeadings(content []*docs.StructuralElement) []heading {
+	var headings []heading
+	for _, el := range content {
+		if el.Paragraph == nil || el.Paragraph.ParagraphStyle == nil {
+			continue
+		}
+		style := el.Paragraph.ParagraphStyle
+		level := 0
+		if n, ok := strings.CutPrefix(style.NamedStyleType, "HEADING_"); ok && len(n) == 1 && n >= "1" && n <= "3" {
+			level = int(n[0] - '0')
+		}
+		text := strings.TrimSpace(paragraphText(el.Paragraph))
+		if level == 0 || style.HeadingId == "" || text == "" {
+			continue
+		}
+		headings = append(headings, heading{id: style.HeadingId, text: text, level: level})
+	}
+	return headings
+}
+
+// setHeaderFooter replaces the default header or footer of doc with text,
+// creating it if the document has none
+func setHeaderFooter(ctx context.Context, srv *docs.Service, doc *docs.Document, kind string, text string) error {
+	var segmentID string
+	var content []*docs.StructuralElement
+	if kind == "header" {
+		segmentID = doc.DocumentStyle.DefaultHeaderId
+		if h, ok := doc.Headers[segmentID]; ok {
+			content = h.Content
+		}
+	} else {
+		segmentID = doc.DocumentStyle.DefaultFooterId
+		if f, ok := doc.Footers[segmentID]; ok {
+			content = f.Content
+		}
+	}
+
+	if segmentID == "" {
+		req := &docs.Request{}
+		if kind == "header" {
+			req.CreateHeader = &docs.CreateHeaderRequest{Type: "DEFAULT"}
+		} else {
+			req.CreateFooter = &docs.CreateFooterRequest{Type: "DEFAULT"}
+		}
+		res, err := srv.Documents.BatchUpdate(doc.DocumentId, &docs.BatchUpdateDocumentRequest{
+			Requests: []*docs.Request{req},
+		}).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("unable to create %s: %w", kind, classifyAPIError(err))
+		}
+		if reply := res.Replies[0]; kind == "header" {
+			segmentID = reply.CreateHeader.HeaderId
+		} else {
+			segmentID = reply.CreateFooter.FooterId
+		}
+	}
+
+	var requests []*docs.Request
+	// Keep the final newline, which cannot be deleted
+	if n := len(content); n > 0 && content[n-1].EndIndex-1 > 0 {
+		requests = append(requests, &docs.Request{
+			DeleteContentRange: &docs.DeleteContentRangeRequest{
+				Range: &docs.Range{SegmentId: segmentID, StartIndex: 0, EndIndex: content[n-1].EndIndex - 1},
+			},
+		})
+	}
+	requests = append(requests, &docs.Request{
+		InsertText: &docs.InsertTextRequest{
+			Location: &docs.Location{SegmentId: segmentID, Index: 0},
+			Text:     text,
+		},
+	})
+	_, err := srv.Documents.BatchUpdate(doc.DocumentId, &docs.BatchUpdateDocumentRequest{
+		Requests: requests,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to set %s: %w", kind, classifyAPIError(err))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// PreprocessRule transforms sources before upload with an external command,
+// e.g. "pandoc -f rst -t docx -o {out} {in}". {in} is the source, {out} the
+// file the command writes and {name} the source name without extension.
+type PreprocessRule struct {
+	// Ext selects sources by extension, e.g. .rst; empty matches any source
+	Ext     string `yaml:"ext" json:"ext"`
+	Command string `yaml:"command" json:"command"`
+	// Output is the extension of {out}, which picks the upload type
+	// (default: the source's extension)
+	Output string `yaml:"output" json:"output"`
+}
+
+// matchPreprocess returns the first rule for filePath
+func matchPreprocess(rules []PreprocessRule, filePath string) (PreprocessRule, bool) {
+	ext := filepath.Ext(filePath)
+	for _, r := range rules {
+		if r.Ext == "" || strings.EqualFold(normalizeExt(r.Ext), ext) {
+			return r, true
+		}
+	}
+	return PreprocessRule{}, false
+}
+
+// normalizeExt adds the leading dot rules may leave out
+func normalizeExt(ext string) string {
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		return "." + ext
+	}
+	return ext
+}
+
+// runPreprocess runs rule on filePath and returns the file it produced in a
+// temporary directory, and a cleanup function removing it
+func runPreprocess(ctx context.Context, rule PreprocessRule, filePath string) (string, func(), error) {
+	args, err := splitCommand(rule.Command)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("preprocess command is empty")
+	}
+
+	dir, err := os.MkdirTemp("", "doc2gdoc-preprocess-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create temporary directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	base := filepath.Base(filePath)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	ext := normalizeExt(rule.Output)
+	if ext == "" {
+		ext = filepath.Ext(base)
+	}
+	out := filepath.Join(dir, name+ext)
+	replacer := strings.NewReplacer("{in}", filePath, "{out}", out, "{name}", name)
+	for i := range args {
+		args[i] = replacer.Replace(args[i])
+	}
+
+	logger.Info("Preprocessing", "file", filePath, "command", args)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", nil, fmt.Errorf("preprocess command failed: %v: %s", err, msg)
+		}
+		return "", nil, fmt.Errorf("preprocess command failed: %v", err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("preprocess command did not write {out} (%s)", out)
+	}
+	return out, cleanup, nil
+}
+
+// splitCommand splits a command line into arguments like a POSIX shell
+// would, honouring single and double quotes and backslash escapes, but
+// without expanding anything. Placeholders with spaces in their values stay
+// single arguments this way.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command %q", s)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// progressWidth is the number of cells in an upload progress bar
+const progressWidth = 30
+
+// progressEnabled turns on progress bars. It is off with -quiet and when
+// stdout is redirected, so logs and pipes don't fill up with redraws.
+var progressEnabled bool
+
+// setupProgress enables progress bars unless quiet or stdout is not a terminal
+func setupProgress(quiet bool) {
+	progressEnabled = !quiet && isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// uploadProgress returns an updater drawing a byte progress bar for name,
+// and a function ending the line once the upload is done. Drive reports no
+// total for streamed media, so the caller passes the file size. Only
+// resumable uploads, which the client uses above one chunk (16 MB), report
+// progress at all.
+func uploadProgress(name string, size int64) (googleapi.ProgressUpdater, func()) {
+	if !progressEnabled || size <= 0 {
+		return nil, func() {}
+	}
+	drawn := false
+	update := func(current, _ int64) {
+		filled := int(current * progressWidth / size)
+		if filled > progressWidth {
+			filled = progressWidth
+		}
+		fmt.Print(tr("\rUploading %s [%s%s] %s / %s",
+			name, strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled),
+			formatBytes(current), formatBytes(size)))
+		drawn = true
+	}
+	done := func() {
+		if drawn {
+			fmt.Println()
+		}
+	}
+	return update, done
+}
+
+// formatBytes formats n with a binary unit, e.g. 12.3 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
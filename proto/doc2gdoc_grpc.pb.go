@@ -0,0 +1,247 @@
+// The gRPC API of "doc2gdoc serve -grpc". It mirrors the HTTP API: uploads
+// are queued as jobs and converted in the background.
+//
+// Regenerate the Go code with "make proto".
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: doc2gdoc.proto
+
+package doc2gdocpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Doc2Gdoc_Convert_FullMethodName     = "/doc2gdoc.v1.Doc2Gdoc/Convert"
+	Doc2Gdoc_GetJob_FullMethodName      = "/doc2gdoc.v1.Doc2Gdoc/GetJob"
+	Doc2Gdoc_ListFolders_FullMethodName = "/doc2gdoc.v1.Doc2Gdoc/ListFolders"
+	Doc2Gdoc_Export_FullMethodName      = "/doc2gdoc.v1.Doc2Gdoc/Export"
+)
+
+// Doc2GdocClient is the client API for Doc2Gdoc service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type Doc2GdocClient interface {
+	// Convert uploads a source: the first message carries its metadata, the
+	// following ones its content. It returns the queued job.
+	Convert(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ConvertRequest, Job], error)
+	// GetJob returns a job by ID.
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// ListFolders lists the folders in a Drive folder.
+	ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error)
+	// Export downloads a Google Workspace document in chunks.
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportChunk], error)
+}
+
+type doc2GdocClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDoc2GdocClient(cc grpc.ClientConnInterface) Doc2GdocClient {
+	return &doc2GdocClient{cc}
+}
+
+func (c *doc2GdocClient) Convert(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ConvertRequest, Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Doc2Gdoc_ServiceDesc.Streams[0], Doc2Gdoc_Convert_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ConvertRequest, Job]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Doc2Gdoc_ConvertClient = grpc.ClientStreamingClient[ConvertRequest, Job]
+
+func (c *doc2GdocClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Doc2Gdoc_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *doc2GdocClient) ListFolders(ctx context.Context, in *ListFoldersRequest, opts ...grpc.CallOption) (*ListFoldersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFoldersResponse)
+	err := c.cc.Invoke(ctx, Doc2Gdoc_ListFolders_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *doc2GdocClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Doc2Gdoc_ServiceDesc.Streams[1], Doc2Gdoc_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRequest, ExportChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Doc2Gdoc_ExportClient = grpc.ServerStreamingClient[ExportChunk]
+
+// Doc2GdocServer is the server API for Doc2Gdoc service.
+// All implementations must embed UnimplementedDoc2GdocServer
+// for forward compatibility.
+type Doc2GdocServer interface {
+	// Convert uploads a source: the first message carries its metadata, the
+	// following ones its content. It returns the queued job.
+	Convert(grpc.ClientStreamingServer[ConvertRequest, Job]) error
+	// GetJob returns a job by ID.
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// ListFolders lists the folders in a Drive folder.
+	ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error)
+	// Export downloads a Google Workspace document in chunks.
+	Export(*ExportRequest, grpc.ServerStreamingServer[ExportChunk]) error
+	mustEmbedUnimplementedDoc2GdocServer()
+}
+
+// UnimplementedDoc2GdocServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDoc2GdocServer struct{}
+
+func (UnimplementedDoc2GdocServer) Convert(grpc.ClientStreamingServer[ConvertRequest, Job]) error {
+	return status.Errorf(codes.Unimplemented, "method Convert not implemented")
+}
+func (UnimplementedDoc2GdocServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedDoc2GdocServer) ListFolders(context.Context, *ListFoldersRequest) (*ListFoldersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFolders not implemented")
+}
+func (UnimplementedDoc2GdocServer) Export(*ExportRequest, grpc.ServerStreamingServer[ExportChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedDoc2GdocServer) mustEmbedUnimplementedDoc2GdocServer() {}
+func (UnimplementedDoc2GdocServer) testEmbeddedByValue()                  {}
+
+// UnsafeDoc2GdocServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to Doc2GdocServer will
+// result in compilation errors.
+type UnsafeDoc2GdocServer interface {
+	mustEmbedUnimplementedDoc2GdocServer()
+}
+
+func RegisterDoc2GdocServer(s grpc.ServiceRegistrar, srv Doc2GdocServer) {
+	// If the following call pancis, it indicates UnimplementedDoc2GdocServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Doc2Gdoc_ServiceDesc, srv)
+}
+
+func _Doc2Gdoc_Convert_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(Doc2GdocServer).Convert(&grpc.GenericServerStream[ConvertRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Doc2Gdoc_ConvertServer = grpc.ClientStreamingServer[ConvertRequest, Job]
+
+func _Doc2Gdoc_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Doc2GdocServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Doc2Gdoc_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Doc2GdocServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Doc2Gdoc_ListFolders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFoldersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Doc2GdocServer).ListFolders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Doc2Gdoc_ListFolders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Doc2GdocServer).ListFolders(ctx, req.(*ListFoldersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Doc2Gdoc_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(Doc2GdocServer).Export(m, &grpc.GenericServerStream[ExportRequest, ExportChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Doc2Gdoc_ExportServer = grpc.ServerStreamingServer[ExportChunk]
+
+// Doc2Gdoc_ServiceDesc is the grpc.ServiceDesc for Doc2Gdoc service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Doc2Gdoc_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "doc2gdoc.v1.Doc2Gdoc",
+	HandlerType: (*Doc2GdocServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetJob",
+			Handler:    _Doc2Gdoc_GetJob_Handler,
+		},
+		{
+			MethodName: "ListFolders",
+			Handler:    _Doc2Gdoc_ListFolders_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Convert",
+			Handler:       _Doc2Gdoc_Convert_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Export",
+			Handler:       _Doc2Gdoc_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "doc2gdoc.proto",
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// appProperties keys recording where a published document came from. The
+// source hash is stored under sourceHashProperty.
+const (
+	provenanceCommitProperty    = "provenance_commit"
+	provenanceBuilderProperty   = "provenance_builder"
+	provenanceTimeProperty      = "provenance_time"
+	provenanceSignatureProperty = "provenance_sig"
+)
+
+// Provenance describes the source revision a document was published from
+type Provenance struct {
+	SourceSHA256 string
+	GitCommit    string
+	Builder      string
+	PublishedAt  time.Time
+	// Signature is an ed25519 signature over payload, base64 encoded
+	Signature string
+}
+
+// newProvenance collects provenance for a source file, signing it if
+// keyFile is set
+func newProvenance(filePath string, sourceHash string, keyFile string) (*Provenance, error) {
+	p := &Provenance{
+		SourceSHA256: sourceHash,
+		Builder:      builderIdentity(),
+		PublishedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	if filePath != stdinPath {
+		p.GitCommit = gitCommit(filePath)
+	}
+	if keyFile != "" {
+		key, err := readSigningKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		p.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, p.payload()))
+	}
+	return p, nil
+}
+
+// provenanceFromProperties reads provenance back from a file's appProperties
+func provenanceFromProperties(props map[string]string) (*Provenance, error) {
+	published, err := time.Parse(time.RFC3339, props[provenanceTimeProperty])
+	if err != nil {
+		return nil, fmt.Errorf("no provenance recorded")
+	}
+	return &Provenance{
+		SourceSHA256: props[sourceHashProperty],
+		GitCommit:    props[provenanceCommitProperty],
+		Builder:      props[provenanceBuilderProperty],
+		PublishedAt:  published,
+		Signature:    props[provenanceSignatureProperty],
+	}, nil
+}
+
+// payload is the canonical text that gets signed
+func (p *Provenance) payload() []byte {
+	return []byte(fmt.Sprintf("doc2gdoc-provenance-v1\nsha256=%s\ncommit=%s\nbuilder=%s\ntime=%s\n",
+		p.SourceSHA256, p.GitCommit, p.Builder, p.PublishedAt.Format(time.RFC3339)))
+}
+
+// properties returns the appProperties recording p
+func (p *Provenance) properties() map[string]string {
+	props := map[string]string{
+		provenanceCommitProperty:  p.GitCommit,
+		provenanceBuilderProperty: p.Builder,
+		provenanceTimeProperty:    p.PublishedAt.Format(time.RFC3339),
+	}
+	if p.Signature != "" {
+		props[provenanceSignatureProperty] = p.Signature
+	}
+	return props
+}
+
+// footer is the line appended to Docs when -provenance-footer is set
+func (p *Provenance) footer() string {
+	commit := p.GitCommit
+	if commit == "" {
+		commit = "none"
+	}
+	text := fmt.Sprintf("Published from commit %s (sha256 %s) by %s at %s",
+		commit, p.SourceSHA256, p.Builder, p.PublishedAt.Format(time.RFC3339))
+	if p.Signature != "" {
+		text += "\nSignature: " + p.Signature
+	}
+	return text
+}
+
+// gitCommit returns the commit checked out around filePath, suffixed with
+// "-dirty" if the file has uncommitted changes, or "" outside a repository
+func gitCommit(filePath string) string {
+	dir := filepath.Dir(filePath)
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--", filepath.Base(filePath)).Output()
+	if err == nil && len(strings.TrimSpace(string(status))) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+// builderIdentity names who published: DOC2GDOC_BUILDER if set, else user@host
+func builderIdentity() string {
+	if builder := os.Getenv("DOC2GDOC_BUILDER"); builder != "" {
+		return builder
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
+
+// readSigningKey reads a PKCS #8 PEM ed25519 private key, as written by
+// "openssl genpkey -algorithm ed25519"
+func readSigningKey(keyFile string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read signing key: %v", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", keyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing key: %v", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key in %s is not an ed25519 key", keyFile)
+	}
+	return edKey, nil
+}
+
+// readVerifyKey reads a PKIX PEM ed25519 public key, as written by
+// "openssl pkey -pubout"
+func readVerifyKey(keyFile string) (ed25519.PublicKey, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read public key: %v", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", keyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key: %v", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an ed25519 key", keyFile)
+	}
+	return edKey, nil
+}
+
+// runProvenanceCommand implements "doc2gdoc provenance verify -key <pem> <file id>..."
+func runProvenanceCommand(ctx context.Context, config Config, args []string) error {
+	if len(args) < 1 || args[0] != "verify" {
+		return fmt.Errorf("usage: doc2gdoc provenance verify [-key public.pem] <file id>...")
+	}
+
+	flags := flag.NewFlagSet("provenance verify", flag.ExitOnError)
+	keyFile := flags.String("key", "", "ed25519 public key (PEM) to check signatures with")
+	ids, err := parseInterspersed(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("please specify at least one file ID")
+	}
+
+	var pub ed25519.PublicKey
+	if *keyFile != "" {
+		if pub, err = readVerifyKey(*keyFile); err != nil {
+			return err
+		}
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		f, err := svc.Files.GetFile(ctx, id, "id, name, appProperties")
+		if err != nil {
+			return fmt.Errorf("unable to get %s: %v", id, err)
+		}
+		p, err := provenanceFromProperties(f.AppProperties)
+		if err != nil {
+			fmt.Printf("%s (%s): %v\n", f.Name, f.Id, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s (%s)\n  sha256:  %s\n  commit:  %s\n  builder: %s\n  time:    %s\n",
+			f.Name, f.Id, p.SourceSHA256, p.GitCommit, p.Builder, p.PublishedAt.Format(time.RFC3339))
+
+		if pub == nil {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(p.Signature)
+		switch {
+		case p.Signature == "":
+			fmt.Println("  signature: missing")
+			failed++
+		case err != nil || !ed25519.Verify(pub, p.payload(), sig):
+			fmt.Println("  signature: INVALID")
+			failed++
+		default:
+			fmt.Println("  signature: valid")
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d document(s) failed verification", failed)
+	}
+	return nil
+}
+
+// appendProvenanceFooter adds the provenance line to the end of a Doc
+func appendProvenanceFooter(ctx context.Context, srv *docs.Service, docID string, p *Provenance) error {
+	w, err := newDocWriter(ctx, srv, docID, nil)
+	if err != nil {
+		return err
+	}
+	start, end := w.paragraph([]mdRun{{Text: p.footer()}}, "NORMAL_TEXT")
+	w.styleText(start, end, &docs.TextStyle{Italic: true})
+	return w.flush()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	shortcutMimeType = "application/vnd.google-apps.shortcut"
+	// copyPrefix marks a destination that gets an independent copy, e.g.
+	// "copy:/customers/docs", so it can be shared differently
+	copyPrefix = "copy:"
+	// copyOfProperty is the appProperty pointing a copy at its document, so
+	// later runs update the copy instead of adding another
+	copyOfProperty = "copy_of"
+)
+
+// Destination is an additional folder a converted document is published
+// to. The config file lists destinations every conversion is published to,
+// and copies there may be shared differently from the document:
+//
+//	destinations:
+//	  - path: /Team/Docs
+//	  - path: /Customers/Docs
+//	    copy: true
+//	    share: [ann@example.com:reader]
+//	    share_anyone: reader
+type Destination struct {
+	Path string `yaml:"path"`
+	// Copy places an independent copy instead of a shortcut
+	Copy bool `yaml:"copy"`
+	// Share are email:role entries the copy is shared with, ShareAnyone
+	// the role anyone with the link gets on it
+	Share       []string `yaml:"share"`
+	ShareAnyone string   `yaml:"share_anyone"`
+}
+
+// validateDestinations checks the destinations of the config file. A
+// shortcut only links to the document, so only copies can be shared.
+func validateDestinations(dests []Destination) error {
+	for _, dest := range dests {
+		if dest.Path == "" {
+			return errors.New("destination without a path")
+		}
+		if !dest.Copy && (len(dest.Share) > 0 || dest.ShareAnyone != "") {
+			return fmt.Errorf("destination %s shares a shortcut, set copy: true to share a copy", dest.Path)
+		}
+		if _, err := dest.shares(); err != nil {
+			return fmt.Errorf("destination %s: %v", dest.Path, err)
+		}
+		if dest.ShareAnyone != "" {
+			if err := validateShareRole(dest.ShareAnyone); err != nil {
+				return fmt.Errorf("destination %s: %v", dest.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// shares parses the Share entries of a destination
+func (d Destination) shares() ([]Share, error) {
+	var shares []Share
+	for _, spec := range d.Share {
+		share, err := parseShare(spec)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// parseDestination parses "[copy:]<drive path>"
+func parseDestination(spec string) Destination {
+	if strings.HasPrefix(spec, copyPrefix) {
+		return Destination{Path: strings.TrimPrefix(spec, copyPrefix), Copy: true}
+	}
+	return Destination{Path: spec}
+}
+
+// publishToDestinations places a converted document of type mimeType in
+// every destination in parallel, reusing the single conversion: a shortcut
+// by default, or a copy
+func publishToDestinations(ctx context.Context, svc *Services, file *drive.File, name string, mimeType string, dests []Destination, createMode string) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(dests))
+
+	for i, dest := range dests {
+		wg.Add(1)
+		go func(i int, dest Destination) {
+			defer wg.Done()
+			errs[i] = publishTo(ctx, svc, file, name, mimeType, dest, createMode)
+		}(i, dest)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func publishTo(ctx context.Context, svc *Services, file *drive.File, name string, mimeType string, dest Destination, createMode string) error {
+	parentID, err := svc.Folders.FindOrCreate(ctx, dest.Path, createMode)
+	if err != nil {
+		return fmt.Errorf("unable to process destination %s: %w", dest.Path, err)
+	}
+
+	if dest.Copy {
+		copyID, err := publishCopy(ctx, svc, file, name, mimeType, parentID, dest.Path)
+		if err != nil {
+			return err
+		}
+		shares, err := dest.shares()
+		if err != nil {
+			return err
+		}
+		if len(shares) > 0 || dest.ShareAnyone != "" {
+			if err := shareFile(ctx, svc, copyID, shares, dest.ShareAnyone); err != nil {
+				return fmt.Errorf("unable to share the copy in %s: %w", dest.Path, err)
+			}
+		}
+		return nil
+	}
+
+	// Updates publish again, which must not pile up shortcuts
+	existing, err := findShortcut(ctx, svc.Files, parentID, file.Id)
+	if err != nil {
+		return fmt.Errorf("unable to check for a shortcut in %s: %w", dest.Path, err)
+	}
+	if existing != nil {
+		fmt.Print(tr("Already linked in Google Drive:%s/%s (Shortcut ID: %s)\n", dest.Path, existing.Name, existing.Id))
+		return nil
+	}
+
+	res, err := svc.Files.CreateFile(ctx, &drive.File{
+		Name:            name,
+		MimeType:        shortcutMimeType,
+		Parents:         []string{parentID},
+		ShortcutDetails: &drive.FileShortcutDetails{TargetId: file.Id},
+	}, nil, UploadOptions{Fields: "id"})
+	if err != nil {
+		return fmt.Errorf("unable to create shortcut in %s: %w", dest.Path, classifyAPIError(err))
+	}
+	fmt.Print(tr("Linked in Google Drive:%s/%s (Shortcut ID: %s)\n", dest.Path, name, res.Id))
+	return nil
+}
+
+// publishCopy copies a document into the folder parentID, or, when an
+// earlier run copied it there, replaces the content of that copy with the
+// document's, keeping the copy's ID and sharing. It returns the copy's ID.
+func publishCopy(ctx context.Context, svc *Services, file *drive.File, name string, mimeType string, parentID string, destPath string) (string, error) {
+	existing, err := findCopy(ctx, svc.Files, parentID, file.Id)
+	if err != nil {
+		return "", fmt.Errorf("unable to check for a copy in %s: %w", destPath, err)
+	}
+	if existing == nil {
+		res, err := svc.Files.CopyFile(ctx, file.Id, &drive.File{
+			Name:          name,
+			Parents:       []string{parentID},
+			AppProperties: map[string]string{copyOfProperty: file.Id},
+		}, "id")
+		if err != nil {
+			return "", fmt.Errorf("unable to copy to %s: %w", destPath, classifyAPIError(err))
+		}
+		fmt.Print(tr("Copied to Google Drive:%s/%s (File ID: %s)\n", destPath, name, res.Id))
+		return res.Id, nil
+	}
+
+	// Drive converts an upload into an existing document, so the copy takes
+	// the document's content through its Office export
+	format, err := exportFormat(mimeType, "")
+	if err != nil {
+		return "", fmt.Errorf("unable to update the copy in %s: %w", destPath, err)
+	}
+	body, err := svc.Files.Export(ctx, file.Id, format.mimeType)
+	if err != nil {
+		return "", fmt.Errorf("unable to export for the copy in %s: %w", destPath, classifyAPIError(err))
+	}
+	defer body.Close()
+	_, err = svc.Files.UpdateFile(ctx, existing.Id, &drive.File{Name: name}, body, UploadOptions{MediaType: format.mimeType, Fields: "id"})
+	if err != nil {
+		return "", fmt.Errorf("unable to update the copy in %s: %w", destPath, classifyAPIError(err))
+	}
+	fmt.Print(tr("Updated the copy in Google Drive:%s/%s (File ID: %s)\n", destPath, name, existing.Id))
+	return existing.Id, nil
+}
+
+// findCopy returns the copy of targetID in the folder parentID, or nil
+func findCopy(ctx context.Context, api DriveAPI, parentID string, targetID string) (*drive.File, error) {
+	query := buildQuery(quoteQuery(parentID)+" in parents", "trashed = false")
+	files, err := api.ListFiles(ctx, query, "id, name, appProperties", 0, 0)
+	if err != nil {
+		return nil, classifyAPIError(err)
+	}
+	for _, f := range files {
+		if f.AppProperties[copyOfProperty] == targetID {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+// findShortcut returns a shortcut to targetID in the folder parentID, or nil
+func findShortcut(ctx context.Context, api DriveAPI, parentID string, targetID string) (*drive.File, error) {
+	query := buildQuery(
+		"mimeType = "+quoteQuery(shortcutMimeType),
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
+	files, err := api.ListFiles(ctx, query, "id, name, shortcutDetails(targetId)", 0, 0)
+	if err != nil {
+		return nil, classifyAPIError(err)
+	}
+	for _, f := range files {
+		if f.ShortcutDetails != nil && f.ShortcutDetails.TargetId == targetID {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPublishCopyIsReused(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := newTestServices(t, fake)
+	dir := t.TempDir()
+	source := writeSource(t, dir, "notes.txt", "first")
+	opts := ConvertOptions{
+		OnConflict: conflictOverwrite,
+		Destinations: []Destination{
+			{Path: "/team"},
+			{Path: "/customers", Copy: true, Share: []string{"ann@example.com:reader"}},
+		},
+	}
+
+	doc, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSource(t, dir, "notes.txt", "second")
+	if _, err := convertToGoogleDocs(ctx, svc, source, "/docs", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	customers, err := svc.Folders.FindOrCreate(ctx, "/customers", createNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := fake.ListFiles(ctx, buildQuery(quoteQuery(customers)+" in parents", "trashed = false"), "id", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("customers folder holds %d files after two runs, want one copy", len(files))
+	}
+	copied := files[0]
+	if copied.AppProperties[copyOfProperty] != doc.FileID {
+		t.Errorf("copy points at %q, want %s", copied.AppProperties[copyOfProperty], doc.FileID)
+	}
+	if got := string(fake.Content(copied.Id)); got != "second" {
+		t.Errorf("copy holds %q, want the updated document", got)
+	}
+	// The copy is shared on its own, the document is not
+	if perms := fake.Permissions(copied.Id); len(perms) == 0 || perms[0].EmailAddress != "ann@example.com" {
+		t.Errorf("copy permissions = %v, want ann@example.com", perms)
+	}
+	if perms := fake.Permissions(doc.FileID); len(perms) != 0 {
+		t.Errorf("document was shared with %d users, want none", len(perms))
+	}
+}
+
+func TestValidateDestinations(t *testing.T) {
+	tests := []struct {
+		name string
+		dest Destination
+		ok   bool
+	}{
+		{"shortcut", Destination{Path: "/team"}, true},
+		{"shared copy", Destination{Path: "/c", Copy: true, Share: []string{"a@example.com:reader"}, ShareAnyone: "reader"}, true},
+		{"shared shortcut", Destination{Path: "/c", Share: []string{"a@example.com:reader"}}, false},
+		{"bad share", Destination{Path: "/c", Copy: true, Share: []string{"a@example.com"}}, false},
+		{"bad anyone role", Destination{Path: "/c", Copy: true, ShareAnyone: "owner"}, false},
+		{"no path", Destination{Copy: true}, false},
+	}
+	for _, tt := range tests {
+		if err := validateDestinations([]Destination{tt.dest}); (err == nil) != tt.ok {
+			t.Errorf("%s: validateDestinations = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// pullStateName is the default state file of "doc2gdoc pull", kept in the
+// local directory
+const pullStateName = ".doc2gdoc-pull.json"
+
+// changeFields are the change fields "doc2gdoc pull -watch" needs
+const changeFields = "nextPageToken, newStartPageToken, changes(fileId, removed, file(id, name, mimeType, parents, trashed, modifiedTime))"
+
+// pullFormat is an export format of Docs
+type pullFormat struct {
+	mimeType string
+	ext      string
+}
+
+// pullFormats maps -format values to export formats
+var pullFormats = map[string]pullFormat{
+	"md":   {"text/markdown", ".md"},
+	"docx": {sourceMimeTypes[".docx"], ".docx"},
+	"odt":  {sourceMimeTypes[".odt"], ".odt"},
+	"html": {"text/html", ".html"},
+	"txt":  {"text/plain", ".txt"},
+	"pdf":  {"application/pdf", ".pdf"},
+}
+
+// pullState remembers what was exported and where the Changes API left off
+type pullState struct {
+	// PageToken is the Changes API position the next poll starts from
+	PageToken string `json:"page_token,omitempty"`
+	// Files are the exported Docs by ID
+	Files map[string]pulledFile `json:"files"`
+}
+
+type pulledFile struct {
+	// Path is relative to the local directory
+	Path         string `json:"path"`
+	ModifiedTime string `json:"modified_time"`
+}
+
+// puller exports the Docs of a Drive folder tree into a local directory
+type puller struct {
+	svc       *Services
+	localDir  string
+	format    pullFormat
+	statePath string
+	state     pullState
+	// delete removes local files of Docs trashed or moved out of the tree
+	delete bool
+	// folders maps the IDs of the tree's folders to local directories,
+	// relative to localDir
+	folders map[string]string
+}
+
+// runPullCommand implements "doc2gdoc pull <local dir> -path <drive path>"
+func runPullCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("pull", flag.ExitOnError)
+	drivePath := flags.String("path", config.DefaultPath, "Drive folder to export Docs from")
+	format := flags.String("format", "md", "Export format: md, docx, odt, html, txt or pdf")
+	watch := flags.Bool("watch", false, "Keep running and export Docs as they are edited")
+	interval := flags.Duration("interval", 30*time.Second, "How often -watch polls Drive for changes")
+	deleteLocal := flags.Bool("delete", false, "Remove local files of Docs that were trashed or moved out of the folder")
+	statePath := flags.String("state", "", "File remembering exported Docs and the last change seen (default: "+pullStateName+" in the local directory)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc pull <local dir> -path <drive path> [-format md|docx|odt|html|txt|pdf] [-watch] [-delete]")
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		flags.Usage()
+		return fmt.Errorf("please specify one local directory to export into")
+	}
+	f, ok := pullFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, expected md, docx, odt, html, txt or pdf", *format)
+	}
+	if *interval < time.Second {
+		return fmt.Errorf("-interval must be at least 1s")
+	}
+	localDir := positional[0]
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %v", err)
+	}
+	if *statePath == "" {
+		*statePath = filepath.Join(localDir, pullStateName)
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	rootID, err := svc.Folders.FindOrCreate(ctx, *drivePath, createNone)
+	if err != nil {
+		return fmt.Errorf("unable to find Drive folder: %w", err)
+	}
+
+	p := &puller{svc: svc, localDir: localDir, format: f, statePath: *statePath, delete: *deleteLocal}
+	if err := p.load(); err != nil {
+		return err
+	}
+
+	// The start token is taken before the scan, so edits made while it runs
+	// are seen by the first poll
+	if *watch && p.state.PageToken == "" {
+		start, err := svc.Drive.Changes.GetStartPageToken().SupportsAllDrives(true).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("unable to start watching changes: %w", classifyAPIError(err))
+		}
+		p.state.PageToken = start.StartPageToken
+	}
+	if err := p.scan(ctx, rootID); err != nil {
+		return err
+	}
+	if !*watch {
+		return nil
+	}
+
+	fmt.Print(tr("Watching Google Drive:%s, exporting to %s\n", *drivePath, localDir))
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Print(tr("Stopped watching Google Drive:%s\n", *drivePath))
+			return nil
+		case <-ticker.C:
+			if err := p.poll(ctx); err != nil && ctx.Err() == nil {
+				logger.Error("Unable to pull changes", "err", err)
+			}
+		}
+	}
+}
+
+// load reads the state file; a missing file is an empty state
+func (p *puller) load() error {
+	p.state = pullState{Files: map[string]pulledFile{}}
+	b, err := os.ReadFile(p.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read pull state: %v", err)
+	}
+	if err := json.Unmarshal(b, &p.state); err != nil {
+		return fmt.Errorf("unable to parse pull state %s: %v", p.statePath, err)
+	}
+	if p.state.Files == nil {
+		p.state.Files = map[string]pulledFile{}
+	}
+	return nil
+}
+
+func (p *puller) save() error {
+	b, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.statePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("unable to write pull state: %v", err)
+	}
+	return os.Rename(tmp, p.statePath)
+}
+
+// scan exports every Doc of the tree under rootID that changed since the
+// last pull, and with -delete removes the files of Docs no longer in it
+func (p *puller) scan(ctx context.Context, rootID string) error {
+	nodes, err := listTree(ctx, p.svc.Files, rootID, true, 0)
+	if err != nil {
+		return err
+	}
+	p.folders = map[string]string{rootID: ""}
+	seen := map[string]bool{}
+	var exportErr error
+	var walk func(nodes []*listNode, dir string)
+	walk = func(nodes []*listNode, dir string) {
+		for _, n := range nodes {
+			switch n.file.MimeType {
+			case folderMimeType:
+				sub := filepath.Join(dir, pullFileName(n.file.Name))
+				p.folders[n.file.Id] = sub
+				walk(n.children, sub)
+			case docMimeType:
+				seen[n.file.Id] = true
+				if err := p.export(ctx, n.file, dir); err != nil {
+					logger.Error("Unable to export", "doc", n.file.Name, "err", err)
+					exportErr = err
+				}
+			}
+		}
+	}
+	walk(nodes, "")
+
+	if p.delete {
+		var gone []string
+		for id := range p.state.Files {
+			if !seen[id] {
+				gone = append(gone, id)
+			}
+		}
+		sort.Strings(gone)
+		for _, id := range gone {
+			p.remove(id)
+		}
+	}
+	if err := p.save(); err != nil {
+		return err
+	}
+	if exportErr != nil {
+		return fmt.Errorf("some Docs could not be exported: %w", exportErr)
+	}
+	return nil
+}
+
+// poll applies the changes since the saved page token
+func (p *puller) poll(ctx context.Context) error {
+	token := p.state.PageToken
+	for token != "" {
+		list, err := p.svc.Drive.Changes.List(token).
+			Fields(changeFields).
+			IncludeRemoved(true).
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			Context(ctx).
+			Do()
+		if err != nil {
+			return fmt.Errorf("unable to list changes: %w", classifyAPIError(err))
+		}
+		for _, c := range list.Changes {
+			p.apply(ctx, c)
+		}
+		if list.NewStartPageToken != "" {
+			p.state.PageToken = list.NewStartPageToken
+			break
+		}
+		token = list.NextPageToken
+		p.state.PageToken = token
+	}
+	return p.save()
+}
+
+// apply exports a changed Doc of the tree, follows new and renamed
+// folders, and with -delete removes Docs that left the tree
+func (p *puller) apply(ctx context.Context, c *drive.Change) {
+	f := c.File
+	if c.Removed || f == nil || f.Trashed {
+		if p.delete {
+			p.remove(c.FileId)
+		}
+		return
+	}
+	dir, inTree := "", false
+	for _, parent := range f.Parents {
+		if dir, inTree = p.folders[parent]; inTree {
+			break
+		}
+	}
+
+	switch f.MimeType {
+	case folderMimeType:
+		// Docs in the renamed folder are exported to the new place when
+		// they are next edited
+		if inTree {
+			p.folders[f.Id] = filepath.Join(dir, pullFileName(f.Name))
+		}
+	case docMimeType:
+		if !inTree {
+			if p.delete {
+				p.remove(f.Id)
+			}
+			return
+		}
+		if err := p.export(ctx, f, dir); err != nil {
+			logger.Error("Unable to export", "doc", f.Name, "err", err)
+		}
+	}
+}
+
+// export writes a Doc into dir, relative to the local directory, unless it
+// is unchanged since the last export. A renamed or moved Doc replaces its
+// old file.
+func (p *puller) export(ctx context.Context, f *drive.File, dir string) error {
+	rel := filepath.Join(dir, pullFileName(f.Name)+p.format.ext)
+	local := filepath.Join(p.localDir, rel)
+	prev, ok := p.state.Files[f.Id]
+	if ok && prev.Path == rel && prev.ModifiedTime == f.ModifiedTime {
+		if _, err := os.Stat(local); err == nil {
+			return nil
+		}
+	}
+
+	if err := exportToFile(ctx, p.svc.Files, f.Id, p.format.mimeType, local); err != nil {
+		return err
+	}
+
+	if ok && prev.Path != rel {
+		if err := os.Remove(filepath.Join(p.localDir, prev.Path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("Unable to remove old export", "file", prev.Path, "err", err)
+		}
+	}
+	p.state.Files[f.Id] = pulledFile{Path: rel, ModifiedTime: f.ModifiedTime}
+	fmt.Print(tr("Pulled %s to %s\n", f.Name, local))
+	return nil
+}
+
+// exportToFile exports a Google Workspace file as mimeType into local,
+// through a temporary file so an interrupted export leaves no partial file
+func exportToFile(ctx context.Context, api DriveAPI, fileID string, mimeType string, local string) error {
+	body, err := api.Export(ctx, fileID, mimeType)
+	if err != nil {
+		return fmt.Errorf("unable to export: %w", classifyAPIError(err))
+	}
+	defer body.Close()
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return fmt.Errorf("unable to create directory: %v", err)
+	}
+	tmp := local + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("unable to write file: %v", err)
+	}
+	if _, err := io.Copy(out, body); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("unable to export: %w", classifyAPIError(err))
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to write file: %v", err)
+	}
+	if err := os.Rename(tmp, local); err != nil {
+		return fmt.Errorf("unable to write file: %v", err)
+	}
+	return nil
+}
+
+// remove deletes the local file of a Doc that is no longer in the tree
+func (p *puller) remove(id string) {
+	prev, ok := p.state.Files[id]
+	if !ok {
+		return
+	}
+	local := filepath.Join(p.localDir, prev.Path)
+	if err := os.Remove(local); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Warn("Unable to remove", "file", local, "err", err)
+		return
+	}
+	delete(p.state.Files, id)
+	fmt.Print(tr("Removed %s\n", local))
+}
+
+// pullFileName makes a Doc or folder name safe as a local file name
+func pullFileName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
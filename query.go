@@ -0,0 +1,20 @@
+package main
+
+import "strings"
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// queryEscaper escapes the characters that are special inside a quoted
+// Drive query string
+var queryEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// quoteQuery quotes a value for a Drive search query, so names like
+// O'Brien "draft" \ notes match literally instead of breaking the query
+func quoteQuery(value string) string {
+	return "'" + queryEscaper.Replace(value) + "'"
+}
+
+// buildQuery joins query clauses with "and"
+func buildQuery(clauses ...string) string {
+	return strings.Join(clauses, " and ")
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestQuoteQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"plain", "notes", `'notes'`},
+		{"empty", "", `''`},
+		{"single quote", "O'Brien", `'O\'Brien'`},
+		{"double quotes", `"draft"`, `'"draft"'`},
+		{"backslash", `a\b`, `'a\\b'`},
+		{"trailing backslash", `notes\`, `'notes\\'`},
+		{"escaped quote", `\'`, `'\\\''`},
+		{"mixed", `O'Brien "draft" \ notes`, `'O\'Brien "draft" \\ notes'`},
+		{"unicode", "會議記錄", `'會議記錄'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quoteQuery(tt.value); got != tt.want {
+				t.Errorf("quoteQuery(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteQueryRoundTrip(t *testing.T) {
+	for _, value := range []string{`O'Brien "draft" \ notes`, `\\'`, `''`, `a\'b`} {
+		got, ok := unquoteQuery(quoteQuery(value))
+		if !ok || got != value {
+			t.Errorf("unquoteQuery(quoteQuery(%q)) = %q, %v", value, got, ok)
+		}
+		clauses, err := splitQueryClauses(buildQuery("name = "+quoteQuery(value+" and x"), "trashed = false"))
+		if err != nil {
+			t.Errorf("splitQueryClauses: %v", err)
+			continue
+		}
+		if len(clauses) != 2 {
+			t.Errorf("query for %q split into %d clauses, want 2", value, len(clauses))
+		}
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	got := buildQuery("name = "+quoteQuery("a'b"), "'root' in parents", "trashed = false")
+	want := `name = 'a\'b' and 'root' in parents and trashed = false`
+	if got != want {
+		t.Errorf("buildQuery = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateFlags are -qps, -burst, -max-upload-rate and -share-upload-rate,
+// overriding config. Like -profile they apply to every subcommand.
+func rateFlags(config *Config) map[string]globalFlag {
+	flags := map[string]globalFlag{"share-upload-rate": boolFlag(&config.ShareUploadRate)}
+	for _, name := range []string{"qps", "burst", "max-upload-rate"} {
+		name := name
+		flags[name] = globalFlag{set: func(value string) error {
+			return setRateOption(config, name, value)
+		}}
+	}
+	return flags
+}
+
+// setRateOption parses a qps, burst or max-upload-rate value from a flag,
+// the config file or the environment
+func setRateOption(config *Config, name string, value string) error {
+	switch name {
+	case "max-upload-rate":
+		rate, err := parseByteRate(value)
+		if err != nil {
+			return err
+		}
+		config.MaxUploadRate = rate
+		return nil
+	case "qps":
+		qps, err := strconv.ParseFloat(value, 64)
+		if err != nil || qps < 0 {
+			return fmt.Errorf("invalid qps %q, expected requests per second like 5 or 0.5", value)
+		}
+		config.QPS = qps
+		return nil
+	}
+	burst, err := strconv.Atoi(value)
+	if err != nil || burst < 1 {
+		return fmt.Errorf("invalid burst %q, expected a positive number of requests", value)
+	}
+	config.Burst = burst
+	return nil
+}
+
+// rateLimiter is a token bucket allowing qps requests per second on
+// average and up to burst at once
+type rateLimiter struct {
+	qps   float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(qps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{qps: qps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available or ctx is done. n must not
+// exceed the burst.
+func (l *rateLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.qps)
+	l.last = now
+	// Taking the tokens up front queues concurrent callers behind each other
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.qps * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	logger.Debug("Rate limited, waiting", "delay", wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens += float64(n)
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimitTransport holds every Google API request until the limiter
+// allows it
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// byteUnits are the suffixes accepted by parseByteRate, binary like formatBytes
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// parseByteRate parses a rate like 5MB/s, 512KB or 1.5M into bytes per
+// second; 0 means no limit
+func parseByteRate(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "/S")
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSuffix(s, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid upload rate %q, expected e.g. 5MB/s or 512KB/s", value)
+	}
+	rate := int64(n * float64(unit))
+	if n > 0 && rate < 1 {
+		rate = 1
+	}
+	return rate, nil
+}
+
+// uploadThrottle limits the bandwidth of uploads: each upload gets its own
+// limiter at rate bytes per second, or all of them share one
+type uploadThrottle struct {
+	rate   int64
+	shared *rateLimiter
+}
+
+// newUploadThrottle returns nil when config sets no upload rate
+func newUploadThrottle(config Config) *uploadThrottle {
+	if config.MaxUploadRate <= 0 {
+		return nil
+	}
+	t := &uploadThrottle{rate: config.MaxUploadRate}
+	if config.ShareUploadRate {
+		t.shared = t.newLimiter()
+	}
+	return t
+}
+
+// newLimiter allows one second worth of bytes at once
+func (t *uploadThrottle) newLimiter() *rateLimiter {
+	return newRateLimiter(float64(t.rate), int(t.rate))
+}
+
+// reader wraps an upload's media; a nil throttle leaves it alone
+func (t *uploadThrottle) reader(ctx context.Context, r io.Reader) io.Reader {
+	if t == nil || r == nil {
+		return r
+	}
+	limiter := t.shared
+	if limiter == nil {
+		limiter = t.newLimiter()
+	}
+	return &throttledReader{ctx: ctx, r: r, limiter: limiter, chunk: int(min(t.rate, 32<<10))}
+}
+
+// throttledReader reads at most chunk bytes at a time, each after the
+// limiter allowed them
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+	chunk   int
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	if err := r.limiter.WaitN(r.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// RegistryEntry records the document a doc_key is published as
+type RegistryEntry struct {
+	FileID     string    `json:"file_id"`
+	SourcePath string    `json:"source_path"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// lookupRegisteredDoc returns the live document registered for docKey, or
+// nil if there is none or it was deleted or trashed
+func lookupRegisteredDoc(ctx context.Context, api DriveAPI, stateFile string, docKey string) (*drive.File, error) {
+	var entry RegistryEntry
+	found, err := getState(stateFile, registryBucket, docKey, &entry)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	file, err := api.GetFile(ctx, entry.FileID, "id, name, parents, appProperties, trashed")
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == 404 {
+		logger.Warn("Registered document no longer exists, creating a new one", "source", docKey)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registered document: %v", err)
+	}
+	if file.Trashed {
+		logger.Warn("Registered document is trashed, creating a new one", "source", docKey)
+		return nil, nil
+	}
+	return file, nil
+}
+
+// recordRegisteredDoc stores the document a doc_key was published as
+func recordRegisteredDoc(stateFile string, docKey string, fileID string, sourcePath string) error {
+	entry := RegistryEntry{FileID: fileID, SourcePath: sourcePath, UpdatedAt: time.Now()}
+	if err := putState(stateFile, registryBucket, docKey, entry); err != nil {
+		return fmt.Errorf("unable to write registry: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// retryBaseDelay is the backoff after the first failure, doubled per attempt
+	retryBaseDelay = time.Minute
+	// retryMaxDelay caps the backoff between attempts
+	retryMaxDelay = 6 * time.Hour
+)
+
+// errFileTimeout is returned when a file took longer than -file-timeout
+var errFileTimeout = errors.New("file timed out")
+
+// RetryEntry is a failed conversion waiting to be retried
+type RetryEntry struct {
+	FilePath    string         `json:"file_path"`
+	DrivePath   string         `json:"drive_path"`
+	Options     ConvertOptions `json:"options"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"last_error"`
+	NextAttempt time.Time      `json:"next_attempt"`
+}
+
+// isRetryable reports whether a failure is transient: rate limits, server
+// errors, network timeouts, connections refused, reset or cut short, files
+// that timed out, or a source that was still being written. Runs that were
+// interrupted or ran out of time, ctx being done, are not retried, nor
+// certificate and other TLS failures, which fail the same next time.
+func isRetryable(ctx context.Context, err error) bool {
+	if errors.Is(err, errFileTimeout) {
+		return true
+	}
+	// A revoked token fails the same until the user logs in again, and a
+	// deadline of the whole run has passed for good. Requests running into
+	// -http-timeout also exceed a deadline, but only their own.
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrTokenExpired) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == 429 || apiErr.Code >= 500 {
+			return true
+		}
+		for _, e := range apiErr.Errors {
+			if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+		return false
+	}
+	if errors.Is(err, errFileChanging) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, connErr := range connErrors {
+		if errors.Is(err, connErr) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryBackoff returns the delay before the next attempt
+func retryBackoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// loadRetryQueue returns the entries queued in the state database, those
+// due first
+func loadRetryQueue(stateFile string) ([]RetryEntry, error) {
+	var entries []RetryEntry
+	err := scanState(stateFile, retryBucket, func(_ string, data []byte) error {
+		var e RetryEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("unable to parse retry entry: %v", err)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read retry queue: %v", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].NextAttempt.Before(entries[j].NextAttempt)
+	})
+	return entries, nil
+}
+
+// retryKey identifies an entry by its file and destination
+func retryKey(e RetryEntry) string {
+	return journalKey(e.FilePath, e.DrivePath)
+}
+
+// enqueueRetry records a failed conversion, replacing an earlier entry for
+// the same file and destination. The file is queued by its absolute path,
+// so "doc2gdoc retry" may run from another directory.
+func enqueueRetry(stateFile string, filePath string, drivePath string, opts ConvertOptions, cause error) error {
+	entry := RetryEntry{FilePath: absPath(filePath), DrivePath: drivePath, Options: opts}
+	var earlier RetryEntry
+	if _, err := getState(stateFile, retryBucket, retryKey(entry), &earlier); err != nil {
+		return err
+	}
+	entry.Attempts = earlier.Attempts + 1
+	entry.LastError = cause.Error()
+	entry.NextAttempt = time.Now().Add(retryBackoff(entry.Attempts))
+	if err := putState(stateFile, retryBucket, retryKey(entry), entry); err != nil {
+		return fmt.Errorf("unable to write retry queue: %v", err)
+	}
+	return nil
+}
+
+// runRetryCommand implements "doc2gdoc retry", converting queued files whose
+// backoff has elapsed
+func runRetryCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("retry", flag.ExitOnError)
+	maxAttempts := flags.Int("max-attempts", 5, "Drop entries that failed this many times")
+	all := flags.Bool("all", false, "Retry every entry, ignoring backoff")
+	timeout := flags.Duration("timeout", 0, "Stop retrying after this long (0 means no limit)")
+	dryRun := flags.Bool("dry-run", false, "Only show which entries would be retried, leaving the queue as it is")
+	if _, err := parseInterspersed(flags, args); err != nil {
+		return err
+	}
+
+	entries, err := loadRetryQueue(config.StateFile)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Print(tr("Retry queue is empty\n"))
+		return nil
+	}
+	if *dryRun {
+		now := time.Now()
+		for _, entry := range entries {
+			if !*all && entry.NextAttempt.After(now) {
+				fmt.Print(tr("Waiting: %s (attempt %d, next at %s)\n", entry.FilePath, entry.Attempts+1, entry.NextAttempt.Format(time.RFC3339)))
+				continue
+			}
+			fmt.Print(tr("[dry-run] retry %s in Google Drive:%s (attempt %d)\n", entry.FilePath, entry.DrivePath, entry.Attempts+1))
+		}
+		return nil
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// Each outcome is saved right away, so entries queued meanwhile by
+	// other runs are kept, as are those not reached yet
+	now := time.Now()
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if !*all && entry.NextAttempt.After(now) {
+			fmt.Print(tr("Waiting: %s (attempt %d, next at %s)\n", entry.FilePath, entry.Attempts+1, entry.NextAttempt.Format(time.RFC3339)))
+			continue
+		}
+
+		metrics.retry("queue")
+		_, err := convertToGoogleDocs(ctx, svc, entry.FilePath, entry.DrivePath, entry.Options)
+		var qerr error
+		switch {
+		case err == nil:
+			fmt.Print(tr("Retried: %s\n", entry.FilePath))
+			qerr = deleteStateKeys(config.StateFile, retryBucket, retryKey(entry))
+		case ctx.Err() != nil:
+			fmt.Print(tr("Interrupted: %s\n", entry.FilePath))
+		case isRetryable(ctx, err) && entry.Attempts+1 < *maxAttempts:
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.NextAttempt = time.Now().Add(retryBackoff(entry.Attempts))
+			fmt.Print(tr("Failed again: %s (attempt %d): %v\n", entry.FilePath, entry.Attempts, err))
+			qerr = putState(config.StateFile, retryBucket, retryKey(entry), entry)
+		default:
+			fmt.Print(tr("Giving up: %s after %d attempts: %v\n", entry.FilePath, entry.Attempts+1, err))
+			qerr = deleteStateKeys(config.StateFile, retryBucket, retryKey(entry))
+		}
+		if qerr != nil {
+			return fmt.Errorf("unable to write retry queue: %v", qerr)
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// connErrors are the errors of connections refused or reset by the peer
+var connErrors = []error{syscall.ECONNREFUSED, syscall.ECONNRESET}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsRetryable(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://www.googleapis.com/upload/drive/v3/files", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"file timeout", fmt.Errorf("%w after 1m0s: %v", errFileTimeout, context.DeadlineExceeded), true},
+		{"rate limit", &googleapi.Error{Code: 429}, true},
+		{"server error", &googleapi.Error{Code: 503}, true},
+		{"user rate limit", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, true},
+		{"forbidden", &googleapi.Error{Code: 403}, false},
+		{"network timeout", urlErr(&net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}), true},
+		{"connection refused", urlErr(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), true},
+		{"connection reset", urlErr(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"EOF", urlErr(io.EOF), true},
+		{"unexpected EOF", urlErr(io.ErrUnexpectedEOF), true},
+		{"file changing", fmt.Errorf("unable to open file: %w", errFileChanging), true},
+		{"unknown authority", urlErr(x509.UnknownAuthorityError{}), false},
+		{"bad hostname", urlErr(x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}), false},
+		{"request deadline", urlErr(context.DeadlineExceeded), true},
+		{"canceled", urlErr(context.Canceled), false},
+		{"token expired", fmt.Errorf("%w: run doc2gdoc auth login", ErrTokenExpired), false},
+		{"other", errors.New("unable to parse file"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(context.Background(), tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryableDeadlines(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	// -http-timeout cuts a request short, which is worth another try
+	client := &http.Client{Timeout: 10 * time.Millisecond}
+	_, err := client.Get(srv.URL)
+	if err == nil {
+		t.Fatal("request did not time out")
+	}
+	if !isRetryable(context.Background(), err) {
+		t.Errorf("isRetryable(%v) = false for a client timeout", err)
+	}
+
+	// The run's own deadline has passed for good
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	_, err = http.DefaultClient.Do(req)
+	if err == nil {
+		t.Fatal("request did not time out")
+	}
+	if isRetryable(ctx, err) {
+		t.Errorf("isRetryable(%v) = true after the run's deadline", err)
+	}
+}
+
+func TestRetryDryRunKeepsQueue(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.db")
+	if err := enqueueRetry(stateFile, "a.md", "/docs", ConvertOptions{}, errors.New("503")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run needs no client, so a failing login would show up here
+	config := Config{StateFile: stateFile}
+	if err := runRetryCommand(context.Background(), config, []string{"-dry-run", "-all"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := loadRetryQueue(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Attempts != 1 {
+		t.Errorf("queue after a dry run = %+v, want the entry untouched", entries)
+	}
+}
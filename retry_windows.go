@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// wsaeconnrefused is the Winsock error of a refused connection, which
+// syscall doesn't define
+const wsaeconnrefused syscall.Errno = 10061
+
+// connErrors are the errors of connections refused or reset by the peer.
+// Winsock reports them with its own codes, which don't match the POSIX ones.
+var connErrors = []error{syscall.ECONNREFUSED, syscall.ECONNRESET, wsaeconnrefused, syscall.WSAECONNRESET}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// revisionFields are the revision fields shown by "doc2gdoc revisions"
+const revisionFields = "nextPageToken, revisions(id, modifiedTime, lastModifyingUser(displayName, emailAddress), keepForever, size)"
+
+// revisionFormats are the -format values of "revisions export" for Sheets
+// and Slides; Docs use pullFormats
+var revisionFormats = map[string]pullFormat{
+	"xlsx": {sourceMimeTypes[".xlsx"], ".xlsx"},
+	"ods":  {sourceMimeTypes[".ods"], ".ods"},
+	"csv":  {sourceMimeTypes[".csv"], ".csv"},
+	"pptx": {sourceMimeTypes[".pptx"], ".pptx"},
+	"odp":  {sourceMimeTypes[".odp"], ".odp"},
+}
+
+// defaultRevisionFormats are the export formats used without -format
+var defaultRevisionFormats = map[string]string{
+	docMimeType:   "docx",
+	sheetMimeType: "xlsx",
+	slideMimeType: "pptx",
+}
+
+// exportFormat looks up a -format name for a Google Workspace type, the
+// type's default if name is empty
+func exportFormat(mimeType string, name string) (pullFormat, error) {
+	if name == "" {
+		name = defaultRevisionFormats[mimeType]
+	}
+	if f, ok := pullFormats[name]; ok {
+		return f, nil
+	}
+	if f, ok := revisionFormats[name]; ok {
+		return f, nil
+	}
+	return pullFormat{}, fmt.Errorf("unknown format %q", name)
+}
+
+// runRevisionsCommand implements "doc2gdoc revisions <drive path or ID>"
+// and "doc2gdoc revisions export -rev <ID> <drive path or ID>"
+func runRevisionsCommand(ctx context.Context, config Config, args []string) error {
+	if len(args) > 0 && args[0] == "export" {
+		return runRevisionsExport(ctx, config, args[1:])
+	}
+
+	flags := flag.NewFlagSet("revisions", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the revisions as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc revisions [-json] <drive path or file ID>")
+		fmt.Fprintln(flags.Output(), "       doc2gdoc revisions export -rev <revision ID> [-format name] [-o file] <drive path or file ID>")
+		flags.PrintDefaults()
+	}
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		flags.Usage()
+		return fmt.Errorf("please specify one Drive path or file ID")
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	file, err := resolveDriveFile(ctx, svc, positional[0])
+	if err != nil {
+		return err
+	}
+	var revisions []*drive.Revision
+	err = svc.Drive.Revisions.List(file.Id).
+		Fields(revisionFields).
+		PageSize(1000).
+		Pages(ctx, func(list *drive.RevisionList) error {
+			revisions = append(revisions, list.Revisions...)
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("unable to list revisions: %w", classifyAPIError(err))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if revisions == nil {
+			revisions = []*drive.Revision{}
+		}
+		return enc.Encode(revisions)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REV\tMODIFIED\tBY\tKEPT")
+	for _, rev := range revisions {
+		by := "-"
+		if u := rev.LastModifyingUser; u != nil {
+			by = u.DisplayName
+			if u.EmailAddress != "" {
+				by = u.EmailAddress
+			}
+		}
+		kept := "-"
+		if rev.KeepForever {
+			kept = "forever"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rev.Id, listModified(rev.ModifiedTime), by, kept)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Print(tr("%d revision(s) of %s\n", len(revisions), file.Name))
+	return nil
+}
+
+// runRevisionsExport downloads one revision of a file, exporting Google
+// Workspace documents in a format of their type
+func runRevisionsExport(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("revisions export", flag.ExitOnError)
+	revID := flags.String("rev", "", "ID of the revision to download, as listed by \"doc2gdoc revisions\"")
+	format := flags.String("format", "", "Export format of Google Workspace documents: md, docx, odt, html, txt or pdf for Docs, xlsx, ods or csv for Sheets, pptx, odp or pdf for Slides (default: docx, xlsx or pptx)")
+	output := flags.String("o", "", "File to write, or - for standard output (default: the document name with the revision and extension)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc revisions export -rev <revision ID> [-format name] [-o file] <drive path or file ID>")
+		flags.PrintDefaults()
+	}
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 || *revID == "" {
+		flags.Usage()
+		return fmt.Errorf("please specify -rev and one Drive path or file ID")
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	file, err := resolveDriveFile(ctx, svc, positional[0])
+	if err != nil {
+		return err
+	}
+	rev, err := svc.Drive.Revisions.Get(file.Id, *revID).Fields("id, mimeType, exportLinks").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to get revision %s: %w", *revID, classifyAPIError(err))
+	}
+
+	var body io.ReadCloser
+	ext := ""
+	if strings.HasPrefix(file.MimeType, "application/vnd.google-apps.") {
+		f, err := exportFormat(file.MimeType, *format)
+		if err != nil {
+			return err
+		}
+		link, ok := rev.ExportLinks[f.mimeType]
+		if !ok {
+			return fmt.Errorf("%s cannot be exported as %s", targetNames[file.MimeType], strings.TrimPrefix(f.ext, "."))
+		}
+		if body, err = downloadExportLink(ctx, svc.HTTP, link); err != nil {
+			return err
+		}
+		ext = f.ext
+	} else {
+		if *format != "" {
+			return fmt.Errorf("-format only applies to Google Workspace documents")
+		}
+		resp, err := svc.Drive.Revisions.Get(file.Id, rev.Id).Context(ctx).Download()
+		if err != nil {
+			return fmt.Errorf("unable to download revision: %w", classifyAPIError(err))
+		}
+		body = resp.Body
+	}
+	defer body.Close()
+
+	if *output == "-" {
+		_, err := io.Copy(os.Stdout, body)
+		return err
+	}
+	if *output == "" {
+		base := pullFileName(file.Name)
+		if ext == "" {
+			// Binary files keep their extension at the end
+			ext = filepath.Ext(base)
+			base = strings.TrimSuffix(base, ext)
+		}
+		*output = fmt.Sprintf("%s (rev %s)%s", base, rev.Id, ext)
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("unable to write file: %v", err)
+	}
+	if _, err := io.Copy(out, body); err != nil {
+		out.Close()
+		return fmt.Errorf("unable to download revision: %w", classifyAPIError(err))
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("unable to write file: %v", err)
+	}
+	fmt.Print(tr("Exported revision %s of %s to %s\n", rev.Id, file.Name, *output))
+	return nil
+}
+
+// downloadExportLink fetches an export link of a revision; unlike files,
+// revisions of Google Workspace documents have no export method
+func downloadExportLink(ctx context.Context, client *http.Client, link string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to export revision: %w", classifyAPIError(err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to export revision: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
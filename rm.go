@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// runRmCommand implements "doc2gdoc rm [-permanent] [-recursive] [-yes] [-dry-run] <drive path or ID>..."
+func runRmCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	permanent := flags.Bool("permanent", false, "Delete permanently instead of moving to the trash")
+	recursive := flags.Bool("recursive", false, "Allow removing folders with everything in them")
+	yes := flags.Bool("yes", false, "Do not ask for confirmation")
+	dryRun := flags.Bool("dry-run", false, "Only show which files would be removed")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc rm [-permanent] [-recursive] [-yes] [-dry-run] <drive path or file ID>...")
+		flags.PrintDefaults()
+	}
+
+	targets, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		flags.Usage()
+		return fmt.Errorf("please specify at least one Drive path or file ID")
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+
+	// Resolve everything first, so a typo doesn't leave a half-done removal
+	var files []*drive.File
+	for _, target := range targets {
+		f, err := resolveDriveFile(ctx, svc, target)
+		if err != nil {
+			return err
+		}
+		if f.MimeType == folderMimeType && !*recursive {
+			return fmt.Errorf("%s is a folder, use -recursive to remove it with its contents", target)
+		}
+		files = append(files, f)
+	}
+
+	action := tr("Move to trash")
+	if *permanent {
+		action = tr("Permanently delete")
+	}
+	if *dryRun {
+		format := "[dry-run] trash %s (ID: %s)\n"
+		if *permanent {
+			format = "[dry-run] delete %s (ID: %s)\n"
+		}
+		for _, f := range files {
+			fmt.Print(tr(format, f.Name, f.Id))
+		}
+		return nil
+	}
+	if !*yes {
+		for _, f := range files {
+			fmt.Printf("  %s (ID: %s)\n", f.Name, f.Id)
+		}
+		ok, err := confirm(tr("%s %d file(s)?", action, len(files)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Print(tr("Nothing removed\n"))
+			return nil
+		}
+	}
+
+	for _, f := range files {
+		if *permanent {
+			err = svc.Files.DeleteFile(ctx, f.Id)
+		} else {
+			_, err = svc.Files.UpdateFile(ctx, f.Id, &drive.File{Trashed: true}, nil, UploadOptions{Fields: "id"})
+		}
+		if err != nil {
+			return fmt.Errorf("unable to remove %s: %w", f.Name, classifyAPIError(err))
+		}
+		if *permanent {
+			fmt.Print(tr("Deleted %s (ID: %s)\n", f.Name, f.Id))
+		} else {
+			fmt.Print(tr("Trashed %s (ID: %s)\n", f.Name, f.Id))
+		}
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal there
+// is nobody to answer, so it fails and points at -yes.
+func confirm(question string) (bool, error) {
+	if !isTerminal(os.Stdin) {
+		return false, errors.New(tr("standard input is not a terminal, use -yes to confirm"))
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("unable to read answer: %v", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes" || answer == "是", nil
+}
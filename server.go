@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// serveShutdownTimeout is how long requests get to finish after the server
+// is asked to stop
+const serveShutdownTimeout = 30 * time.Second
+
+const (
+	// tokenCheckInterval is how long a token check answers health probes
+	// before Drive is asked again
+	tokenCheckInterval = 30 * time.Second
+	// tokenCheckTimeout bounds the Drive request behind a token check
+	tokenCheckTimeout = 10 * time.Second
+)
+
+// server serves the HTTP API. Conversions are queued as jobs and run in the
+// background through convertToGoogleDocs, like on the command line.
+type server struct {
+	// svc is nil in multi-tenant mode, where tenants has the clients
+	svc         *Services
+	tenants     *tenants
+	config      Config
+	defaultPath string
+	authToken   string
+	maxUpload   int64
+	queue       *JobQueue
+
+	tokenMu        sync.Mutex
+	tokenCheckedAt time.Time
+	tokenErr       error
+}
+
+// runServeCommand implements "doc2gdoc serve [-addr :8080]"
+func runServeCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "Address to listen on")
+	drivePath := flags.String("path", config.DefaultPath, "Drive path used when a request names none")
+	maxUpload := flags.Int64("max-upload-mb", 512, "Largest accepted upload in MB")
+	authToken := flags.String("auth-token", os.Getenv("DOC2GDOC_SERVE_TOKEN"), "Require this bearer token on every request (env DOC2GDOC_SERVE_TOKEN)")
+	workers := flags.Int("workers", 2, "Number of conversions run at the same time")
+	jobsFile := flags.String("jobs-file", "", "Keep jobs in this file so queued ones survive a restart")
+	grpcAddr := flags.String("grpc", "", "Also serve the gRPC API of proto/doc2gdoc.proto on this address, e.g. :9090")
+	tenantStore := flags.String("tenant-store", "", "Serve many Google accounts, keeping their tokens in dir:<directory>, sqlite:<file> or redis://<host>")
+	tenantKeys := flags.String("tenant-keys", "", "YAML file mapping API keys to tenants, required with -tenant-store; requests name their tenant with X-API-Key")
+	publicURL := flags.String("public-url", "", "URL the server is reached at, for the OAuth redirect to /auth/callback in multi-tenant mode")
+	webhookURL := flags.String("webhook", config.WebhookURL, "POST a JSON notification to this URL after each job (env DOC2GDOC_WEBHOOK_URL, signed with env DOC2GDOC_WEBHOOK_SECRET)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc serve [-addr :8080] [-grpc :9090] [-path <default drive path>] [-auth-token token] [-workers 2] [-jobs-file jobs.json] [-tenant-store spec -public-url URL -tenant-keys keys.yaml]")
+		flags.PrintDefaults()
+	}
+	if _, err := parseInterspersed(flags, args); err != nil {
+		return err
+	}
+	if *workers < 1 {
+		return fmt.Errorf("-workers must be at least 1")
+	}
+	if *authToken == "" {
+		logger.Warn("Serving without -auth-token, anyone who can reach the server can publish to Drive")
+	}
+
+	config.WebhookURL = *webhookURL
+
+	s := &server{
+		config:      config,
+		defaultPath: *drivePath,
+		authToken:   *authToken,
+		maxUpload:   *maxUpload << 20,
+	}
+	var err error
+	if *tenantStore != "" {
+		if *publicURL == "" {
+			return fmt.Errorf("-tenant-store needs -public-url for the OAuth redirect")
+		}
+		// Without keys any caller could act as any tenant
+		if *tenantKeys == "" {
+			return fmt.Errorf("-tenant-store needs -tenant-keys to tell the tenants apart")
+		}
+		tokens, err := openTenantTokens(*tenantStore)
+		if err != nil {
+			return err
+		}
+		defer tokens.Close()
+		if s.tenants, err = newTenants(ctx, config, tokens, *publicURL, *tenantKeys); err != nil {
+			return err
+		}
+	} else if s.svc, err = initClient(ctx, config); err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	// Redrawn progress bars and login prompts would only garble the server log
+	progressEnabled = false
+	authPromptEnabled = false
+
+	// Uploads wait next to the jobs file, so a restart can still convert
+	// them; without one they only need to outlive the process
+	spoolDir := *jobsFile + ".spool"
+	if *jobsFile == "" {
+		if spoolDir, err = os.MkdirTemp("", "doc2gdoc-serve-*"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(spoolDir)
+	}
+	if s.queue, err = NewJobQueue(*jobsFile, spoolDir, s.runJob); err != nil {
+		return err
+	}
+	s.queue.Start(ctx, *workers)
+	httpServer := &http.Server{Addr: *addr, Handler: s.routes()}
+
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return fmt.Errorf("unable to listen for gRPC: %v", err)
+		}
+		grpcServer := s.newGRPCServer()
+		go func() {
+			<-ctx.Done()
+			// Streams still running after the timeout are cut off
+			timer := time.AfterFunc(serveShutdownTimeout, grpcServer.Stop)
+			grpcServer.GracefulStop()
+			timer.Stop()
+		}()
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				logger.Error("gRPC server failed", "err", err)
+			}
+		}()
+		fmt.Print(tr("Serving gRPC on %s\n", *grpcAddr))
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Unable to shut down cleanly", "err", err)
+		}
+	}()
+
+	fmt.Print(tr("Listening on %s\n", *addr))
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// routes serves the API behind the bearer token, and the probes and metrics
+// without it so monitoring needs no secret
+func (s *server) routes() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/convert", s.handleConvert)
+	api.HandleFunc("/jobs", s.handleJobs)
+	api.HandleFunc("/jobs/", s.handleJob)
+	api.HandleFunc("/folders", s.handleFolders)
+
+	mux := http.NewServeMux()
+	if s.tenants != nil {
+		api.HandleFunc("/auth/start", s.tenants.handleStart)
+		// Google redirects the user's browser here, without credentials
+		mux.HandleFunc("/auth/callback", s.tenants.handleCallback)
+	}
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.Handle("/", s.authenticate(api))
+	return mux
+}
+
+// authenticate checks the bearer token if one is configured, and names the
+// tenant of the request in multi-tenant mode
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.authToken != "" {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.authToken)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+		if s.tenants != nil {
+			tenant, err := s.tenants.tenant(r.Header.Get)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, err)
+				return
+			}
+			r = r.WithContext(withTenant(r.Context(), tenant))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleConvert implements POST /convert, a multipart upload with the
+// source in "file" and optional "path", "title", "target" and "on_conflict"
+// fields. It answers 202 with the queued job.
+func (s *server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid upload: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	src, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("missing file field"))
+		return
+	}
+	defer src.Close()
+
+	// A tenant that has not authorized yet learns it now, not from a
+	// failed job
+	tenant := tenantFrom(r.Context())
+	if _, err := s.servicesFor(tenant); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	drivePath := r.FormValue("path")
+	if drivePath == "" {
+		drivePath = s.defaultPath
+	}
+	opts, err := s.convertOptions(r.FormValue("on_conflict"), r.FormValue("target"), r.FormValue("title"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	job := s.queue.NewJob(uploadName(header.Filename), drivePath, opts)
+	job.Tenant = tenant
+	job.BytesTotal = header.Size
+	localPath := s.queue.SpoolPath(job)
+	if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := saveUpload(src, localPath); err != nil {
+		os.RemoveAll(filepath.Dir(localPath))
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.queue.Enqueue(job); err != nil {
+		os.RemoveAll(filepath.Dir(localPath))
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// convertOptions are the options of an uploaded conversion
+func (s *server) convertOptions(onConflict string, target string, title string) (ConvertOptions, error) {
+	if err := validateConflictStrategy(onConflict); err != nil {
+		return ConvertOptions{}, err
+	}
+	return ConvertOptions{
+		CreateMode: createAll,
+		OnConflict: onConflict,
+		Target:     target,
+		Title:      title,
+		Preprocess: s.config.Preprocess,
+		Filters:    s.config.Filters,
+		Styles:     s.config.Styles,
+	}, nil
+}
+
+// uploadName is the file name an upload is spooled under. It picks the
+// document name and source type, so it is kept in a directory of its own.
+func uploadName(filename string) string {
+	name := filepath.Base(filepath.Clean("/" + filename))
+	if name == "/" || name == "." {
+		return "upload"
+	}
+	return name
+}
+
+// servicesFor returns the API clients of a tenant, or the server's own
+// outside multi-tenant mode
+func (s *server) servicesFor(tenant string) (*Services, error) {
+	if s.tenants == nil {
+		return s.svc, nil
+	}
+	return s.tenants.servicesFor(tenant)
+}
+
+// runJob converts a queued upload
+func (s *server) runJob(ctx context.Context, job Job, localPath string, progress func(current int64)) (*ConvertResult, error) {
+	svc, err := s.servicesFor(job.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	opts := job.Options
+	opts.Progress = func(current, _ int64) { progress(current) }
+	start := time.Now()
+	result, err := convertToGoogleDocs(ctx, svc, localPath, job.DrivePath, opts)
+	if ctx.Err() == nil {
+		reportConversion(ctx, s.config, job.Source, result, err, time.Since(start))
+	}
+	if err != nil {
+		logger.Warn("Job failed", "job", job.ID, "source", job.Source, "err", err)
+	} else {
+		logger.Info("Job succeeded", "job", job.ID, "source", job.Source, "file_id", result.FileID)
+	}
+	return result, err
+}
+
+// handleJobs implements GET /jobs, listing the tenant's jobs oldest first
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+		return
+	}
+	tenant := tenantFrom(r.Context())
+	jobs := []Job{}
+	for _, job := range s.queue.List() {
+		if job.Tenant == tenant {
+			jobs = append(jobs, job)
+		}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleJob implements GET /jobs/{id}
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	job, ok := s.queue.Get(id)
+	if !ok || job.Tenant != tenantFrom(r.Context()) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleFolders implements GET /folders?path=, listing the folders in a
+// Drive folder
+func (s *server) handleFolders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+		return
+	}
+	drivePath := r.URL.Query().Get("path")
+	if drivePath == "" {
+		drivePath = s.defaultPath
+	}
+	parentID, files, err := s.listFolders(r.Context(), drivePath)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	type folder struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	folders := []folder{}
+	for _, f := range files {
+		folders = append(folders, folder{ID: f.Id, Name: f.Name})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"path": drivePath, "id": parentID, "folders": folders})
+}
+
+// listFolders returns the ID of a Drive folder of the request's tenant and
+// the folders in it
+func (s *server) listFolders(ctx context.Context, drivePath string) (string, []*drive.File, error) {
+	svc, err := s.servicesFor(tenantFrom(ctx))
+	if err != nil {
+		return "", nil, err
+	}
+	parentID, err := svc.Folders.FindOrCreate(ctx, drivePath, createNone)
+	if err != nil {
+		return "", nil, err
+	}
+	query := buildQuery(
+		"mimeType = "+quoteQuery(folderMimeType),
+		quoteQuery(parentID)+" in parents",
+		"trashed = false",
+	)
+	files, err := svc.Files.ListFiles(ctx, query, "id, name", 0, 0)
+	if err != nil {
+		return "", nil, classifyAPIError(err)
+	}
+	return parentID, files, nil
+}
+
+// handleHealthz implements GET /healthz: the server is up and its token
+// still works
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkToken(r.Context()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz implements GET /readyz: like /healthz, and the job queue
+// still takes new jobs
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkToken(r.Context()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if !s.queue.Accepting() {
+		writeError(w, http.StatusServiceUnavailable, errQueueFull)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// handleMetrics implements GET /metrics in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.write(w)
+}
+
+// checkToken verifies the token with a cheap Drive request. The outcome is
+// reused for tokenCheckInterval, so frequent probes don't use up quota.
+// Tenants' tokens aren't checked: one tenant's revoked token doesn't make
+// the server unhealthy.
+func (s *server) checkToken(ctx context.Context) error {
+	if s.svc == nil {
+		return nil
+	}
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+	if !s.tokenCheckedAt.IsZero() && time.Since(s.tokenCheckedAt) < tokenCheckInterval {
+		return s.tokenErr
+	}
+	ctx, cancel := context.WithTimeout(ctx, tokenCheckTimeout)
+	defer cancel()
+	_, err := s.svc.Drive.About.Get().Fields("user(emailAddress)").Context(ctx).Do()
+	if err != nil {
+		err = fmt.Errorf("unable to reach Drive: %w", classifyAPIError(err))
+	}
+	s.tokenCheckedAt, s.tokenErr = time.Now(), err
+	return err
+}
+
+func saveUpload(src io.Reader, localPath string) error {
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("unable to save upload: %v", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("unable to save upload: %v", err)
+	}
+	return dst.Close()
+}
+
+// errorStatus maps a conversion error to an HTTP status
+func errorStatus(err error) int {
+	var quotaErr *QuotaError
+	switch {
+	case errors.Is(err, ErrFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUnsupportedFileType):
+		return http.StatusUnsupportedMediaType
+	case errors.As(err, &quotaErr):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrTokenExpired), errors.Is(err, ErrCredentialsMissing):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("Unable to write response", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
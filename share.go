@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Share grants a user access to a converted document
+type Share struct {
+	Email string
+	Role  string
+}
+
+// validateShareRole checks a Drive permission role that can be granted
+func validateShareRole(role string) error {
+	switch role {
+	case "reader", "commenter", "writer":
+		return nil
+	}
+	return fmt.Errorf("unknown share role %q, expected reader, commenter or writer", role)
+}
+
+// parseShare parses "<email>:<role>"
+func parseShare(spec string) (Share, error) {
+	email, role, ok := strings.Cut(spec, ":")
+	if !ok || email == "" {
+		return Share{}, fmt.Errorf("invalid -share %q, expected email:role", spec)
+	}
+	if err := validateShareRole(role); err != nil {
+		return Share{}, err
+	}
+	return Share{Email: email, Role: role}, nil
+}
+
+// shareFile creates permissions for each user, and for anyone with the link
+// if anyoneRole is set
+func shareFile(ctx context.Context, svc *Services, fileID string, shares []Share, anyoneRole string) error {
+	for _, share := range shares {
+		err := svc.Files.CreatePermission(ctx, fileID, &drive.Permission{
+			Type:         "user",
+			Role:         share.Role,
+			EmailAddress: share.Email,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to share with %s: %w", share.Email, err)
+		}
+		fmt.Print(tr("Shared with %s as %s\n", share.Email, share.Role))
+	}
+
+	if anyoneRole != "" {
+		err := svc.Files.CreatePermission(ctx, fileID, &drive.Permission{
+			Type: "anyone",
+			Role: anyoneRole,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to share with anyone: %w", err)
+		}
+		fmt.Print(tr("Shared with anyone with the link as %s\n", anyoneRole))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// snapshotAttempts is how often a file that keeps changing is re-read
+	snapshotAttempts = 3
+	// snapshotRetryDelay gives an editor time to finish saving
+	snapshotRetryDelay = 500 * time.Millisecond
+)
+
+// stdinPath is the file argument that reads the source from standard input
+const stdinPath = "-"
+
+// errFileChanging is returned when a file is still being written after all attempts
+var errFileChanging = errors.New("file changed while being read")
+
+// openSnapshot copies a file to a private temporary file and verifies that
+// its size and modification time did not change during the copy, so a
+// document saved mid-upload is never published half-written. The returned
+// cleanup function closes and removes the snapshot.
+func openSnapshot(filePath string) (*os.File, func(), error) {
+	if filePath == stdinPath {
+		return snapshotStdin()
+	}
+	for attempt := 1; ; attempt++ {
+		snap, cleanup, err := trySnapshot(filePath)
+		if !errors.Is(err, errFileChanging) || attempt == snapshotAttempts {
+			return snap, cleanup, err
+		}
+		logger.Warn("File changed while being read, retrying", "file", filePath, "attempt", attempt, "max_attempts", snapshotAttempts)
+		metrics.retry("snapshot")
+		time.Sleep(snapshotRetryDelay)
+	}
+}
+
+func trySnapshot(filePath string) (*os.File, func(), error) {
+	src, err := openShared(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer src.Close()
+
+	before, err := src.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snap, err := os.CreateTemp("", "doc2gdoc-*"+filepath.Ext(filePath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create snapshot: %v", err)
+	}
+	cleanup := func() {
+		snap.Close()
+		os.Remove(snap.Name())
+	}
+
+	if _, err := io.Copy(snap, src); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("unable to copy file: %v", err)
+	}
+
+	after, err := os.Stat(filePath)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		cleanup()
+		return nil, nil, fmt.Errorf("%w: %s", errFileChanging, filePath)
+	}
+
+	if _, err := snap.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return snap, cleanup, nil
+}
+
+// snapshotStdin buffers standard input in a temporary file, since the
+// source is read more than once (sniffing, hashing, uploading)
+func snapshotStdin() (*os.File, func(), error) {
+	snap, err := os.CreateTemp("", "doc2gdoc-stdin-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create snapshot: %v", err)
+	}
+	cleanup := func() {
+		snap.Close()
+		os.Remove(snap.Name())
+	}
+	if _, err := io.Copy(snap, os.Stdin); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("unable to read standard input: %v", err)
+	}
+	if _, err := snap.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return snap, cleanup, nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Buckets of the state database. stateBucket holds the StateRecords, keyed
+// like the journal by absolute source path and Drive path; the others hold
+// the journal of batch runs, the doc_key registry, the retry queue and the
+// state of two-way syncs. The folder cache and the server's job queue are
+// kept apart, in files of their own: the cache is opt-in and per account,
+// and the queue lives in the spool directory next to the uploads it refers
+// to.
+var (
+	stateBucket    = []byte("files")
+	journalBucket  = []byte("journal")
+	registryBucket = []byte("registry")
+	retryBucket    = []byte("retry")
+	syncBucket     = []byte("sync")
+)
+
+// stateLockTimeout is how long to wait for another run holding the state
+// database
+const stateLockTimeout = 5 * time.Second
+
+// StateRecord is what the state database knows about a converted file
+type StateRecord struct {
+	Source    string `json:"source"`
+	DrivePath string `json:"drive_path"`
+	FileID    string `json:"file_id"`
+	// Hash is the SHA-256 of the source when it was converted
+	Hash string `json:"hash"`
+	// ModifiedTime and Version identify the document's revision after the
+	// upload
+	ModifiedTime string    `json:"modified_time,omitempty"`
+	Version      int64     `json:"version,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// openState opens the state database, creating it and its directory. It
+// is opened per use rather than per run, so concurrent runs only wait for
+// each other briefly.
+func openState(stateFile string) (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create state directory: %v", err)
+	}
+	db, err := bolt.Open(stateFile, 0600, &bolt.Options{Timeout: stateLockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("state database %s is in use by another run", stateFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open state database: %v", err)
+	}
+	return db, nil
+}
+
+// viewState runs fn on a bucket for reading. A missing database or bucket
+// is empty and fn is not called.
+func viewState(stateFile string, bucket []byte, fn func(b *bolt.Bucket) error) error {
+	if stateFile == "" {
+		return nil
+	}
+	if _, err := os.Stat(stateFile); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	db, err := openState(stateFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return fn(b)
+	})
+}
+
+// updateState runs fn on a bucket for writing, creating it. An empty
+// stateFile disables the state database and fn is not called.
+func updateState(stateFile string, bucket []byte, fn func(b *bolt.Bucket) error) error {
+	if stateFile == "" {
+		return nil
+	}
+	db, err := openState(stateFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// getState decodes the JSON value of key into v and reports whether it
+// was found
+func getState(stateFile string, bucket []byte, key string, v any) (bool, error) {
+	var found bool
+	err := viewState(stateFile, bucket, func(b *bolt.Bucket) error {
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to read state database: %v", err)
+	}
+	return found, nil
+}
+
+// putState stores v as JSON under key
+func putState(stateFile string, bucket []byte, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return updateState(stateFile, bucket, func(b *bolt.Bucket) error {
+		return b.Put([]byte(key), data)
+	})
+}
+
+// deleteStateKeys removes keys from a bucket
+func deleteStateKeys(stateFile string, bucket []byte, keys ...string) error {
+	return updateState(stateFile, bucket, func(b *bolt.Bucket) error {
+		for _, key := range keys {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scanState calls fn with each key and JSON value of a bucket, in key order
+func scanState(stateFile string, bucket []byte, fn func(key string, data []byte) error) error {
+	return viewState(stateFile, bucket, func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// dropState removes a bucket and everything in it
+func dropState(stateFile string, bucket []byte) error {
+	if stateFile == "" {
+		return nil
+	}
+	if _, err := os.Stat(stateFile); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	db, err := openState(stateFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(bucket); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// recordState stores a converted file; an empty stateFile disables the
+// state database
+func recordState(stateFile string, rec StateRecord) error {
+	if rec.Source == stdinPath {
+		return nil
+	}
+	rec.Source = absPath(rec.Source)
+	rec.UpdatedAt = time.Now().UTC()
+	return putState(stateFile, stateBucket, journalKey(rec.Source, rec.DrivePath), rec)
+}
+
+// loadState returns all records, sorted by source
+func loadState(stateFile string) ([]StateRecord, error) {
+	var records []StateRecord
+	err := scanState(stateFile, stateBucket, func(_ string, data []byte) error {
+		var rec StateRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("unable to parse state record: %v", err)
+		}
+		records = append(records, rec)
+		return nil
+	})
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Source != records[j].Source {
+			return records[i].Source < records[j].Source
+		}
+		return records[i].DrivePath < records[j].DrivePath
+	})
+	return records, err
+}
+
+// deleteState removes records
+func deleteState(stateFile string, records []StateRecord) error {
+	keys := make([]string, len(records))
+	for i, rec := range records {
+		keys[i] = journalKey(rec.Source, rec.DrivePath)
+	}
+	return deleteStateKeys(stateFile, stateBucket, keys...)
+}
+
+// lookupStateDoc returns the live document of mimeType in parentID that
+// source was last converted into, or nil. A rerun updates it this way even
+// after it was renamed on Drive.
+func lookupStateDoc(ctx context.Context, api DriveAPI, stateFile string, source string, drivePath string, parentID string, mimeType string) (*drive.File, error) {
+	if source == stdinPath {
+		return nil, nil
+	}
+	var rec StateRecord
+	found, err := getState(stateFile, stateBucket, journalKey(source, drivePath), &rec)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	file, err := api.GetFile(ctx, rec.FileID, "id, name, mimeType, parents, appProperties, trashed")
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read previous document: %w", classifyAPIError(err))
+	}
+	if file.Trashed || file.MimeType != mimeType || !slices.Contains(file.Parents, parentID) {
+		return nil, nil
+	}
+	return file, nil
+}
+
+// runStateCommand implements "doc2gdoc state ls|prune"
+func runStateCommand(ctx context.Context, config Config, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: doc2gdoc state ls|prune [-json] [-remote] [-dry-run]")
+	}
+	switch args[0] {
+	case "ls":
+		flags := flag.NewFlagSet("state ls", flag.ExitOnError)
+		asJSON := flags.Bool("json", false, "Print the records as JSON")
+		if _, err := parseInterspersed(flags, args[1:]); err != nil {
+			return err
+		}
+		records, err := loadState(config.StateFile)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if records == nil {
+				records = []StateRecord{}
+			}
+			return enc.Encode(records)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SOURCE\tDRIVE PATH\tFILE ID\tUPDATED")
+		for _, rec := range records {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rec.Source, rec.DrivePath, rec.FileID, rec.UpdatedAt.Local().Format("2006-01-02 15:04"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Print(tr("%d record(s) in %s\n", len(records), config.StateFile))
+		return nil
+
+	case "prune":
+		flags := flag.NewFlagSet("state prune", flag.ExitOnError)
+		remote := flags.Bool("remote", false, "Also prune records whose document was deleted or trashed on Drive")
+		dryRun := flags.Bool("dry-run", false, "Only show which records would be pruned")
+		if _, err := parseInterspersed(flags, args[1:]); err != nil {
+			return err
+		}
+		records, err := loadState(config.StateFile)
+		if err != nil {
+			return err
+		}
+		var svc *Services
+		if *remote {
+			if svc, err = initClient(ctx, config); err != nil {
+				return fmt.Errorf("unable to initialize client: %w", err)
+			}
+		}
+
+		var stale []StateRecord
+		for _, rec := range records {
+			reason, err := staleReason(ctx, svc, rec)
+			if err != nil {
+				return err
+			}
+			if reason == "" {
+				continue
+			}
+			stale = append(stale, rec)
+			prefix := ""
+			if *dryRun {
+				prefix = "[dry-run] "
+			}
+			fmt.Printf("%sprune %s -> %s (%s)\n", prefix, rec.Source, rec.DrivePath, reason)
+		}
+		if !*dryRun && len(stale) > 0 {
+			if err := deleteState(config.StateFile, stale); err != nil {
+				return err
+			}
+		}
+		format := "Pruned %d of %d record(s)\n"
+		if *dryRun {
+			format = "Would prune %d of %d record(s)\n"
+		}
+		fmt.Print(tr(format, len(stale), len(records)))
+		return nil
+	}
+	return fmt.Errorf("unknown state command %q, expected ls or prune", args[0])
+}
+
+// staleReason tells why a record no longer matters: its source is gone, or
+// with svc, its document. It returns "" for live records.
+func staleReason(ctx context.Context, svc *Services, rec StateRecord) (string, error) {
+	if _, err := os.Stat(rec.Source); errors.Is(err, os.ErrNotExist) {
+		return "source removed", nil
+	}
+	if svc == nil {
+		return "", nil
+	}
+	file, err := svc.Files.GetFile(ctx, rec.FileID, "trashed")
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == 404 {
+		return "document deleted", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read document %s: %w", rec.FileID, classifyAPIError(err))
+	}
+	if file.Trashed {
+		return "document trashed", nil
+	}
+	return "", nil
+}
+
+// defaultStateFile is state.db in the config directory
+func defaultStateFile() string {
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "state.db")
+	}
+	return "state.db"
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestJournalInStateDatabase(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.db")
+	source := filepath.Join(dir, "notes.md")
+	if err := os.WriteFile(source, []byte("# Notes\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := openJournal(stateFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hash, done := j.Completed(source, "/docs")
+	if done {
+		t.Fatal("an empty journal completed a file")
+	}
+	if err := j.Record(source, "/docs", hash, &ConvertResult{FileID: "doc-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = openJournal(stateFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _, done := j.Completed(source, "/docs"); !done || e.FileID != "doc-1" {
+		t.Errorf("reopened journal: completed %v with %q, want doc-1", done, e.FileID)
+	}
+	if _, _, done := j.Completed(source, "/other"); done {
+		t.Error("the journal completed the file for another destination")
+	}
+
+	if err := resetJournal(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	if j, err = openJournal(stateFile, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, done := j.Completed(source, "/docs"); done {
+		t.Error("the journal still completes the file after a reset")
+	}
+}
+
+func TestRetryQueueInStateDatabase(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.db")
+	cause := errors.New("503")
+
+	if entries, err := loadRetryQueue(stateFile); err != nil || len(entries) != 0 {
+		t.Fatalf("loadRetryQueue without a database = %v, %v", entries, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := enqueueRetry(stateFile, "a.md", "/docs", ConvertOptions{}, cause); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enqueueRetry(stateFile, "b.md", "/docs", ConvertOptions{}, cause); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := loadRetryQueue(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("queued %d entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		if !filepath.IsAbs(e.FilePath) {
+			t.Errorf("queued %s, want an absolute path", e.FilePath)
+		}
+		want := 1
+		if filepath.Base(e.FilePath) == "a.md" {
+			want = 2
+		}
+		if e.Attempts != want {
+			t.Errorf("%s has %d attempts, want %d", e.FilePath, e.Attempts, want)
+		}
+	}
+}
+
+func TestRegistryInStateDatabase(t *testing.T) {
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "state.db")
+	fake := NewFakeDrive()
+
+	if doc, err := lookupRegisteredDoc(ctx, fake, stateFile, "guide"); err != nil || doc != nil {
+		t.Fatalf("lookup of an unregistered key = %v, %v", doc, err)
+	}
+	doc, err := fake.CreateFile(ctx, &drive.File{Name: "Guide", MimeType: docMimeType}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recordRegisteredDoc(stateFile, "guide", doc.Id, "guide.md"); err != nil {
+		t.Fatal(err)
+	}
+	found, err := lookupRegisteredDoc(ctx, fake, stateFile, "guide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.Id != doc.Id {
+		t.Errorf("lookup = %v, want %s", found, doc.Id)
+	}
+
+	// A trashed document is forgotten, so a new one is created
+	if _, err := fake.UpdateFile(ctx, doc.Id, &drive.File{Trashed: true}, nil, UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := lookupRegisteredDoc(ctx, fake, stateFile, "guide"); err != nil || found != nil {
+		t.Errorf("lookup of a trashed document = %v, %v", found, err)
+	}
+}
+
+func TestTwoWayStateInStateDatabase(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.db")
+
+	state, err := loadTwoWayState(stateFile, dir, "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Files) != 0 {
+		t.Fatalf("a first sync starts with %d files", len(state.Files))
+	}
+	state.Files["notes.md"] = twoWayEntry{FileID: "doc-1", Hash: "abc"}
+	if err := saveTwoWayState(stateFile, dir, "/docs", state); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = loadTwoWayState(stateFile, dir, "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := state.Files["notes.md"]; e.FileID != "doc-1" || e.Hash != "abc" {
+		t.Errorf("loaded %+v, want doc-1 with hash abc", e)
+	}
+	// Syncing the directory elsewhere keeps its own state
+	if state, err = loadTwoWayState(stateFile, dir, "/elsewhere"); err != nil || len(state.Files) != 0 {
+		t.Errorf("state of another destination = %v, %v", state.Files, err)
+	}
+	// Nothing from the sync is left in the directory
+	if _, err := os.Stat(filepath.Join(dir, ".doc2gdoc-sync.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sync state file in the directory: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// StyleRule sets how a Markdown element looks in a Doc, from the styles
+// section of config.yaml, e.g.
+//
+//	styles:
+//	  h1: {named_style: HEADING_1, font: Noto Sans TC}
+//	  code: {font: Courier New, size: 10, background: "#f3f3f3"}
+type StyleRule struct {
+	// NamedStyle replaces the element's paragraph style, e.g. HEADING_2
+	NamedStyle string  `yaml:"named_style"`
+	Font       string  `yaml:"font"`
+	Size       float64 `yaml:"size"`
+	// Color and Background are hex colors like #1a73e8
+	Color      string `yaml:"color"`
+	Background string `yaml:"background"`
+}
+
+// styleElements are the Markdown elements a StyleRule can be set for
+var styleElements = map[string]bool{
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"paragraph": true, "quote": true, "list": true, "table": true,
+	"code": true, "inline_code": true,
+}
+
+// namedStyleTypes are the paragraph styles of the Docs API
+var namedStyleTypes = map[string]bool{
+	"NORMAL_TEXT": true, "TITLE": true, "SUBTITLE": true,
+	"HEADING_1": true, "HEADING_2": true, "HEADING_3": true,
+	"HEADING_4": true, "HEADING_5": true, "HEADING_6": true,
+}
+
+// validateStyles checks the element names, named styles and colors
+func validateStyles(styles map[string]StyleRule) error {
+	for element, rule := range styles {
+		if !styleElements[element] {
+			names := make([]string, 0, len(styleElements))
+			for name := range styleElements {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown style element %q, expected one of %s", element, strings.Join(names, ", "))
+		}
+		if rule.NamedStyle != "" && !namedStyleTypes[rule.NamedStyle] {
+			return fmt.Errorf("style %s: unknown named_style %q, expected e.g. NORMAL_TEXT or HEADING_1", element, rule.NamedStyle)
+		}
+		if rule.Size < 0 {
+			return fmt.Errorf("style %s: size must be positive", element)
+		}
+		for _, c := range []string{rule.Color, rule.Background} {
+			if _, err := parseHexColor(c); err != nil {
+				return fmt.Errorf("style %s: %v", element, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseHexColor parses #rrggbb or #rgb; an empty string is no color
+func parseHexColor(s string) (*docs.OptionalColor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return nil, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	return &docs.OptionalColor{Color: &docs.Color{RgbColor: &docs.RgbColor{
+		Red:   float64(v>>16&0xff) / 255,
+		Green: float64(v>>8&0xff) / 255,
+		Blue:  float64(v&0xff) / 255,
+	}}}, nil
+}
+
+// apply sets the font, size and color of the rule on style
+func (r StyleRule) apply(style *docs.TextStyle) {
+	if r.Font != "" {
+		style.WeightedFontFamily = &docs.WeightedFontFamily{FontFamily: r.Font}
+	}
+	if r.Size > 0 {
+		style.FontSize = &docs.Dimension{Magnitude: r.Size, Unit: "PT"}
+	}
+	// Colors were validated when the config was loaded
+	if color, _ := parseHexColor(r.Color); color != nil {
+		style.ForegroundColor = color
+	}
+}
+
+// namedStyle returns the rule's named style, or def
+func (r StyleRule) namedStyle(def string) string {
+	if r.NamedStyle != "" {
+		return r.NamedStyle
+	}
+	return def
+}
+
+// styleElement returns the styles key of a Markdown block
+func styleElement(b mdBlock) string {
+	switch b.Kind {
+	case mdHeading:
+		return fmt.Sprintf("h%d", b.Level)
+	case mdParagraph:
+		return "paragraph"
+	case mdQuote:
+		return "quote"
+	case mdListItem:
+		return "list"
+	case mdTable:
+		return "table"
+	case mdCode:
+		return "code"
+	}
+	return ""
+}
+
+// shading returns the rule's background as paragraph shading, or nil
+func (r StyleRule) shading() *docs.Shading {
+	bg, _ := parseHexColor(r.Background)
+	if bg == nil {
+		return nil
+	}
+	return &docs.Shading{BackgroundColor: bg}
+}
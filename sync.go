@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// SyncOptions controls how a local directory is mirrored to Drive
+type SyncOptions struct {
+	// Delete trashes remote documents whose local source was removed
+	Delete bool
+	// DryRun only prints the planned actions
+	DryRun bool
+	// StateFile records converted files, see ConvertOptions, and queues
+	// those that failed with a transient error
+	StateFile string
+	// Conflict resolves files changed on both sides in two-way sync:
+	// prefer-local, prefer-remote or duplicate (default: report them)
+	Conflict string
+	// Interactive asks about each conflict Conflict doesn't resolve
+	Interactive bool
+	// Format is what two-way sync downloads new Docs as, see pullFormats
+	Format string
+	// Filters redact text sources before upload, see ConvertOptions
+	Filters []FilterRule
+}
+
+// syncConvertOptions updates documents in place, so a rerun never duplicates
+// them. A file paired with a remote document updates it under its current
+// name, which for trees synced by earlier versions still has the extension.
+func syncConvertOptions(opts SyncOptions, remote *drive.File) ConvertOptions {
+	convertOpts := ConvertOptions{OnConflict: conflictOverwrite, StateFile: opts.StateFile, Filters: opts.Filters}
+	if remote != nil {
+		convertOpts.Title = remote.Name
+	}
+	return convertOpts
+}
+
+// Sync actions
+const (
+	syncCreate    = "create"
+	syncUpdate    = "update"
+	syncDelete    = "delete"
+	syncUnchanged = "unchanged"
+	syncSkipped   = "skipped"
+	// syncMkdir is a folder a dry run would create
+	syncMkdir = "mkdir"
+)
+
+// syncAction is one planned change to the remote tree
+type syncAction struct {
+	Kind      string
+	LocalPath string
+	DrivePath string
+	Remote    *drive.File
+	// ParentID is the folder a document is deleted from
+	ParentID string
+}
+
+// runSyncCommand implements "doc2gdoc sync <dir> -path <drive path>"
+func runSyncCommand(ctx context.Context, config Config, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	drivePath := fs.String("path", config.DefaultPath, "Target folder on Google Drive")
+	deleteRemote := fs.Bool("delete", false, "Trash remote documents whose local file was removed")
+	dryRun := fs.Bool("dry-run", false, "Only show planned actions without changing Drive")
+	folderLock := fs.Bool("folder-lock", false, "Coordinate folder creation with other runners publishing to the same tree")
+	strict := fs.Bool("strict", false, "Fail when several folders on the path share a name, listing their IDs, unless -prefer picks one")
+	prefer := fs.String("prefer", "", "Pick among folders sharing a name: newest, oldest or id:<folder id>")
+	timeout := fs.Duration("timeout", 0, "Stop syncing after this long (0 means no limit)")
+	twoWay := fs.Bool("two-way", false, "Also download documents edited on Drive, tracking both sides in the state database")
+	preferLoc := fs.Bool(preferLocal, false, "With -two-way, upload files changed on both sides")
+	preferRem := fs.Bool(preferRemote, false, "With -two-way, download files changed on both sides")
+	duplicate := fs.Bool(duplicateConflict, false, "With -two-way, keep the remote version of files changed on both sides as a conflict copy, then upload (default: ask on a terminal, else report them)")
+	format := fs.String("format", "md", "With -two-way, format of new Docs downloaded: md, docx, odt, html or txt")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: doc2gdoc sync <local dir> -path <drive path> [-delete] [-dry-run] [-two-way [-prefer-local|-prefer-remote|-duplicate]]")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("please specify one local directory to sync")
+	}
+
+	var conflict string
+	for name, set := range map[string]bool{preferLocal: *preferLoc, preferRemote: *preferRem, duplicateConflict: *duplicate} {
+		if !set {
+			continue
+		}
+		if conflict != "" {
+			return fmt.Errorf("specify only one of -prefer-local, -prefer-remote and -duplicate")
+		}
+		conflict = name
+	}
+	if conflict != "" && !*twoWay {
+		return fmt.Errorf("-%s needs -two-way", conflict)
+	}
+	// Downloads must be uploadable again, which rules out PDF
+	if f, ok := pullFormats[*format]; !ok || twoWayExports[f.ext] == "" {
+		return fmt.Errorf("unknown format %q, expected md, docx, odt, html or txt", *format)
+	}
+
+	if err := validatePrefer(*prefer); err != nil {
+		return err
+	}
+	config.FolderLock = *folderLock
+	config.StrictFolders, config.PreferFolder = *strict, *prefer
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	opts := SyncOptions{
+		Delete:      *deleteRemote,
+		DryRun:      *dryRun,
+		StateFile:   config.StateFile,
+		Filters:     config.Filters,
+		Conflict:    conflict,
+		Interactive: conflict == "" && isTerminal(os.Stdin) && isTerminal(os.Stdout),
+		Format:      *format,
+	}
+	if *twoWay {
+		return syncTwoWay(ctx, svc, positional[0], *drivePath, opts)
+	}
+	return syncDirectory(ctx, svc, positional[0], *drivePath, opts)
+}
+
+// syncDirectory mirrors localDir to drivePath and prints a summary
+func syncDirectory(ctx context.Context, svc *Services, localDir string, drivePath string, opts SyncOptions) error {
+	info, err := os.Stat(localDir)
+	if err != nil {
+		return fmt.Errorf("unable to read directory: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", localDir)
+	}
+
+	actions, err := planSync(ctx, svc, localDir, drivePath, opts)
+	if err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	planned := map[string]bool{}
+	var skipped []error
+	for _, action := range actions {
+		if ctx.Err() != nil {
+			break
+		}
+		if action.Kind == syncMkdir {
+			// Subdirectories repeat their missing parents
+			if !planned[action.DrivePath] {
+				fmt.Printf("[dry-run] %-6s %s\n", action.Kind, action.DrivePath)
+				planned[action.DrivePath] = true
+			}
+			continue
+		}
+		if action.Kind == syncUnchanged {
+			counts[action.Kind]++
+			continue
+		}
+
+		target := path.Join(action.DrivePath, documentName(action.LocalPath))
+		if action.Remote != nil {
+			target = path.Join(action.DrivePath, action.Remote.Name)
+		}
+		if opts.DryRun {
+			fmt.Printf("[dry-run] %-6s %s\n", action.Kind, target)
+			counts[action.Kind]++
+			continue
+		}
+
+		fmt.Printf("%-6s %s\n", action.Kind, target)
+		err := applySyncAction(ctx, svc, action, opts)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			errorReport.add(action.LocalPath, action.DrivePath, err)
+		}
+		if err != nil && isRetryable(ctx, err) && action.Kind != syncDelete {
+			// Transient failure, queue it and carry on with the rest
+			logger.Warn("Skipped file", "file", action.LocalPath, "err", err)
+			if qerr := enqueueRetry(opts.StateFile, action.LocalPath, action.DrivePath, syncConvertOptions(opts, action.Remote), err); qerr != nil {
+				logger.Error("Unable to queue for retry", "err", qerr)
+			}
+			skipped = append(skipped, err)
+			counts[syncSkipped]++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to %s %s: %w", action.Kind, target, err)
+		}
+		counts[action.Kind]++
+	}
+
+	summary := tr("%d created, %d updated, %d deleted, %d unchanged, %d skipped",
+		counts[syncCreate], counts[syncUpdate], counts[syncDelete], counts[syncUnchanged], counts[syncSkipped])
+	if err := ctx.Err(); err != nil {
+		fmt.Print(tr("Sync interrupted after %s\n", summary))
+		return err
+	}
+	fmt.Print(tr("Sync finished: %s\n", summary))
+	if counts[syncSkipped] > 0 {
+		total := counts[syncCreate] + counts[syncUpdate] + counts[syncDelete] + counts[syncUnchanged] + counts[syncSkipped]
+		return &BatchError{Failed: counts[syncSkipped], Total: total, Unit: "file(s)", Errs: skipped}
+	}
+	return nil
+}
+
+// planSync compares a local directory with its remote folder, recursing into
+// subdirectories
+func planSync(ctx context.Context, svc *Services, localDir string, drivePath string, opts SyncOptions) ([]syncAction, error) {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory: %v", err)
+	}
+
+	// A dry run must not create folders, so it reports the ones it would create
+	var actions []syncAction
+	var parentID string
+	if opts.DryRun {
+		var planned []string
+		parentID, planned, err = svc.Folders.Plan(ctx, drivePath, createAll)
+		for _, p := range planned {
+			actions = append(actions, syncAction{Kind: syncMkdir, DrivePath: p})
+		}
+	} else {
+		parentID, err = svc.Folders.FindOrCreate(ctx, drivePath, createAll)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to process target folder: %w", err)
+	}
+	remote := map[string]*drive.File{}
+	if parentID != "" {
+		remote, err = listConvertedFiles(ctx, svc.Files, parentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range entries {
+		// Skip hidden files and directories such as .git
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		localPath := filepath.Join(localDir, entry.Name())
+
+		if entry.IsDir() {
+			sub, err := planSync(ctx, svc, localPath, path.Join(drivePath, entry.Name()), opts)
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, sub...)
+			continue
+		}
+
+		// Documents are named without the extension, or with it if an
+		// earlier version synced them
+		action := syncAction{Kind: syncCreate, LocalPath: localPath, DrivePath: drivePath}
+		for _, name := range []string{documentName(localPath), entry.Name()} {
+			if existing, ok := remote[name]; ok && action.Remote == nil {
+				delete(remote, name)
+				action.Remote = existing
+			}
+		}
+		if existing := action.Remote; existing != nil {
+			hash, err := localFileSHA256(localPath)
+			if err != nil {
+				return nil, err
+			}
+			action.Kind = syncUpdate
+			if existing.AppProperties[sourceHashProperty] == hash {
+				action.Kind = syncUnchanged
+			}
+		}
+		actions = append(actions, action)
+	}
+
+	// Whatever is left on the remote side no longer exists locally
+	if opts.Delete {
+		for _, file := range remote {
+			actions = append(actions, syncAction{Kind: syncDelete, DrivePath: drivePath, Remote: file, ParentID: parentID})
+		}
+	}
+
+	return actions, nil
+}
+
+// applySyncAction performs a planned action against Drive
+func applySyncAction(ctx context.Context, svc *Services, action syncAction, opts SyncOptions) error {
+	switch action.Kind {
+	case syncCreate, syncUpdate:
+		_, err := convertToGoogleDocs(ctx, svc, action.LocalPath, action.DrivePath, syncConvertOptions(opts, action.Remote))
+		return err
+	case syncDelete:
+		// A document with a doc_key may have followed its moved source
+		// into another folder earlier in this run
+		current, err := svc.Files.GetFile(ctx, action.Remote.Id, "parents")
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(current.Parents, action.ParentID) {
+			return nil
+		}
+		_, err = svc.Files.UpdateFile(ctx, action.Remote.Id, &drive.File{Trashed: true}, nil, UploadOptions{Fields: "id"})
+		return err
+	}
+	return nil
+}
+
+// listConvertedFiles returns the documents in a folder that were converted by
+// this tool, keyed by name. Files without a source hash were not uploaded by
+// us and are never touched by sync, nor are versions kept by -on-conflict
+// version.
+func listConvertedFiles(ctx context.Context, api DriveAPI, parentID string) (map[string]*drive.File, error) {
+	query := buildQuery(
+		quoteQuery(parentID)+" in parents",
+		"mimeType != "+quoteQuery(folderMimeType),
+		"trashed = false",
+	)
+
+	list, err := api.ListFiles(ctx, query, "id, name, appProperties", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list remote files: %w", classifyAPIError(err))
+	}
+
+	files := map[string]*drive.File{}
+	for _, file := range list {
+		_, converted := file.AppProperties[sourceHashProperty]
+		if _, version := file.AppProperties[versionOfProperty]; converted && !version {
+			files[file.Name] = file
+		}
+	}
+	return files, nil
+}
+
+// localFileSHA256 hashes the file at filePath
+func localFileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("unable to open file: %v", err)
+	}
+	defer file.Close()
+	return fileSHA256(file)
+}
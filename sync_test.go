@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestSyncNamesDocumentsLikeConvert(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := newTestServices(t, fake)
+	dir := t.TempDir()
+	source := writeSource(t, dir, "notes.txt", "synced")
+	opts := SyncOptions{StateFile: filepath.Join(t.TempDir(), "state.db")}
+
+	if err := syncDirectory(ctx, svc, dir, "/docs", opts); err != nil {
+		t.Fatal(err)
+	}
+	// Converting the same file again finds the synced document
+	writeSource(t, dir, "notes.txt", "converted")
+	res, err := convertToGoogleDocs(ctx, svc, source, "/docs", ConvertOptions{OnConflict: conflictOverwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != convertUpdated || res.Name != "notes" {
+		t.Errorf("convert after sync: %s %q, want notes updated", res.Status, res.Name)
+	}
+	docs, err := fake.ListFiles(ctx, "mimeType = "+quoteQuery(docMimeType), "id", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Errorf("created %d documents, want 1", len(docs))
+	}
+}
+
+func TestSyncUpdatesDocumentsNamedWithExtension(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := newTestServices(t, fake)
+	dir := t.TempDir()
+	writeSource(t, dir, "old.txt", "changed")
+
+	folderID, err := svc.Folders.FindOrCreate(ctx, "/docs", createAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Synced by an earlier version, which kept the extension
+	legacy, err := fake.CreateFile(ctx, &drive.File{
+		Name:          "old.txt",
+		MimeType:      docMimeType,
+		Parents:       []string{folderID},
+		AppProperties: map[string]string{sourceHashProperty: "stale"},
+	}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := SyncOptions{Delete: true, StateFile: filepath.Join(t.TempDir(), "state.db")}
+	if err := syncDirectory(ctx, svc, dir, "/docs", opts); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := fake.ListFiles(ctx, buildQuery("mimeType = "+quoteQuery(docMimeType), "trashed = false"), "id", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].Id != legacy.Id {
+		t.Fatalf("sync left %d documents, want only %s", len(docs), legacy.Id)
+	}
+	if got := string(fake.Content(legacy.Id)); got != "changed" {
+		t.Errorf("document holds %q, want the changed file", got)
+	}
+}
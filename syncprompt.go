@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each change in a diff
+const diffContext = 3
+
+// maxDiffCells bounds the table of the line diff; files differing in more
+// lines are shown as removed and added as a whole
+const maxDiffCells = 4 << 20
+
+// promptConflict asks what to do with a file changed on both sides: keep
+// the local or the remote version, keep both, or see how they differ
+// first. Skipping leaves the conflict for a later run.
+func promptConflict(ctx context.Context, svc *Services, localDir string, item *twoWayItem) (string, error) {
+	localPath := filepath.Join(localDir, filepath.FromSlash(item.rel))
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print(tr("%s changed locally and on Drive: keep [l]ocal, keep [r]emote, keep [b]oth, show [d]iff or [s]kip? ", item.rel))
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("unable to read answer: %v", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "l", "local":
+			return syncUpload, nil
+		case "r", "remote":
+			return syncDownload, nil
+		case "b", "both":
+			return syncDuplicate, nil
+		case "s", "skip", "":
+			return syncConflict, nil
+		case "d", "diff":
+			if err := showConflictDiff(ctx, svc, item, localPath); err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// showConflictDiff prints how the local file differs from its document,
+// exported in the format of the local file. Only text formats are shown.
+func showConflictDiff(ctx context.Context, svc *Services, item *twoWayItem, localPath string) error {
+	mimeType := twoWayExports[strings.ToLower(filepath.Ext(localPath))]
+	if !strings.HasPrefix(mimeType, "text/") {
+		fmt.Print(tr("No diff for %s files, open %s and %s to compare\n", filepath.Ext(localPath), localPath, item.remote.WebViewLink))
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "doc2gdoc-diff-*")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	remotePath := filepath.Join(dir, filepath.Base(localPath))
+	if _, err := exportTwoWay(ctx, svc, item.remote, remotePath); err != nil {
+		return err
+	}
+
+	remote, err := os.ReadFile(remotePath)
+	if err != nil {
+		return fmt.Errorf("unable to read file: %v", err)
+	}
+	local, err := os.ReadFile(localPath)
+	if err != nil {
+		return fmt.Errorf("unable to read file: %v", err)
+	}
+	fmt.Printf("--- Google Drive: %s\n+++ %s\n", item.remote.Name, localPath)
+	printDiff(os.Stdout, diffLines(splitLines(string(remote)), splitLines(string(local))))
+	return nil
+}
+
+// splitLines splits text into lines, ignoring line ending differences
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines returns the edit script turning a into b: each line prefixed
+// with " " if both have it, "-" if only a has it or "+" if only b has it
+func diffLines(a []string, b []string) []string {
+	// The common prefix and suffix need no table
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	var out []string
+	for _, l := range a[:pre] {
+		out = append(out, " "+l)
+	}
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, l := range ma {
+			out = append(out, "-"+l)
+		}
+		for _, l := range mb {
+			out = append(out, "+"+l)
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of
+		// ma[i:] and mb[j:]
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				out = append(out, " "+ma[i])
+				i++
+				j++
+			case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+				out = append(out, "-"+ma[i])
+				i++
+			default:
+				out = append(out, "+"+mb[j])
+				j++
+			}
+		}
+	}
+	for _, l := range a[len(a)-suf:] {
+		out = append(out, " "+l)
+	}
+	return out
+}
+
+// printDiff prints the changed lines of an edit script with diffContext
+// lines around them, marking the unchanged lines left out with "..."
+func printDiff(w io.Writer, script []string) {
+	show := make([]bool, len(script))
+	for i, l := range script {
+		if l[0] == ' ' {
+			continue
+		}
+		for k := max(0, i-diffContext); k <= min(len(script)-1, i+diffContext); k++ {
+			show[k] = true
+		}
+	}
+	gap := false
+	for i, l := range script {
+		if !show[i] {
+			gap = true
+			continue
+		}
+		if gap {
+			fmt.Fprintln(w, "...")
+			gap = false
+		}
+		fmt.Fprintln(w, l)
+	}
+}
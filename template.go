@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v3"
+)
+
+// convertWithTemplate fills a copy of the template Doc with the converted
+// source, so the result keeps the template's styles, header and footer. A
+// new document is a copy of the template with the content appended after
+// its body; an existing one has its body replaced.
+//
+// Markdown is written directly. Other sources are imported into a
+// temporary Doc first, whose paragraphs, lists and tables are copied over
+// with basic formatting: bold, italic and links.
+func convertWithTemplate(ctx context.Context, svc *Services, file *os.File, sourceMime string, f *drive.File, existingID string, opts ConvertOptions) (*drive.File, error) {
+	res := &drive.File{Id: existingID}
+	if existingID == "" {
+		var err error
+		res, err = svc.Files.CopyFile(ctx, opts.Template, f, uploadFields)
+		if err != nil {
+			return nil, fmt.Errorf("unable to copy template %s: %w", opts.Template, classifyAPIError(err))
+		}
+	}
+
+	w, err := newDocWriter(ctx, svc.Docs, res.Id, opts.Styles)
+	if err != nil {
+		return nil, err
+	}
+	if existingID != "" {
+		if err := w.clear(); err != nil {
+			return nil, err
+		}
+	}
+
+	if sourceMime == "text/markdown" {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read file: %v", err)
+		}
+		return res, w.writeMarkdown(markdownBlocks(string(content), opts))
+	}
+
+	tmp, err := svc.Files.CreateFile(ctx, &drive.File{Name: f.Name + " (import)", MimeType: docMimeType}, file,
+		UploadOptions{MediaType: sourceMime, Fields: "id", OCRLanguage: opts.OCRLanguage})
+	if err != nil {
+		return nil, fmt.Errorf("unable to import file: %w", classifyAPIError(err))
+	}
+	defer func() {
+		if err := svc.Files.DeleteFile(ctx, tmp.Id); err != nil {
+			logger.Warn("Unable to delete temporary import", "id", tmp.Id, "err", err)
+		}
+	}()
+	doc, err := svc.Docs.Documents.Get(tmp.Id).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read imported document: %v", err)
+	}
+	return res, w.copyContent(doc.Body.Content)
+}
+
+// copyContent appends paragraphs, lists and tables read from another Doc
+func (w *docWriter) copyContent(content []*docs.StructuralElement) error {
+	for _, el := range content {
+		switch {
+		case el.Paragraph != nil:
+			p := el.Paragraph
+			namedStyle := "NORMAL_TEXT"
+			if p.ParagraphStyle != nil && p.ParagraphStyle.NamedStyleType != "" {
+				namedStyle = p.ParagraphStyle.NamedStyleType
+			}
+			start, end := w.paragraph(paragraphRuns(p), namedStyle)
+			if p.Bullet != nil {
+				w.requests = append(w.requests, &docs.Request{
+					CreateParagraphBullets: &docs.CreateParagraphBulletsRequest{
+						Range:        &docs.Range{StartIndex: start, EndIndex: end},
+						BulletPreset: "BULLET_DISC_CIRCLE_SQUARE",
+					},
+				})
+			}
+		case el.Table != nil:
+			var rows [][]string
+			for _, row := range el.Table.TableRows {
+				var cells []string
+				for _, cell := range row.TableCells {
+					var text []string
+					for _, p := range collectParagraphs(cell.Content) {
+						text = append(text, strings.TrimSuffix(paragraphText(p.Paragraph), "\n"))
+					}
+					cells = append(cells, strings.Join(text, " "))
+				}
+				rows = append(rows, cells)
+			}
+			if len(rows) > 0 {
+				if err := w.table(rows); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return w.flush()
+}
+
+// paragraphRuns returns the text runs of a paragraph without its final
+// newline, keeping bold, italic and links
+func paragraphRuns(p *docs.Paragraph) []mdRun {
+	var runs []mdRun
+	for _, el := range p.Elements {
+		if el.TextRun == nil {
+			continue
+		}
+		run := mdRun{Text: strings.TrimSuffix(el.TextRun.Content, "\n")}
+		if s := el.TextRun.TextStyle; s != nil {
+			run.Bold, run.Italic = s.Bold, s.Italic
+			if s.Link != nil {
+				run.Link = s.Link.Url
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+	"gopkg.in/yaml.v3"
+	_ "modernc.org/sqlite"
+)
+
+// tenantPattern limits tenant names, which also name token files
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+const (
+	// authStateTTL is how long an authorization link from /auth/start
+	// stays valid
+	authStateTTL = 10 * time.Minute
+	// tenantStoreTimeout bounds a token read or write of a remote store
+	tenantStoreTimeout = 5 * time.Second
+	// redisTokenPrefix prefixes the Redis keys of tenant tokens
+	redisTokenPrefix = "doc2gdoc:token:"
+)
+
+// TenantTokens is where the server keeps the OAuth token of each tenant
+type TenantTokens interface {
+	// Store returns the token store of a tenant
+	Store(tenant string) TokenStore
+	Close() error
+}
+
+// openTenantTokens opens a tenant token backend: dir:<directory>,
+// sqlite:<file> or a redis:// URL
+func openTenantTokens(spec string) (TenantTokens, error) {
+	switch {
+	case strings.HasPrefix(spec, "dir:"):
+		dir := strings.TrimPrefix(spec, "dir:")
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("unable to create tenant token directory: %v", err)
+		}
+		return dirTenantTokens{dir: dir}, nil
+	case strings.HasPrefix(spec, "sqlite:"):
+		db, err := sql.Open("sqlite", strings.TrimPrefix(spec, "sqlite:"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to open tenant token database: %v", err)
+		}
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS tokens (
+			tenant TEXT PRIMARY KEY,
+			token TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		)`)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("unable to create tenant token table: %v", err)
+		}
+		return sqliteTenantTokens{db: db}, nil
+	case strings.HasPrefix(spec, "redis://"), strings.HasPrefix(spec, "rediss://"):
+		opts, err := redis.ParseURL(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis URL: %v", err)
+		}
+		return redisTenantTokens{client: redis.NewClient(opts)}, nil
+	}
+	return nil, fmt.Errorf("unknown tenant store %q, expected dir:<directory>, sqlite:<file> or redis://<host>", spec)
+}
+
+// dirTenantTokens keeps each tenant's token in <tenant>.json
+type dirTenantTokens struct {
+	dir string
+}
+
+func (t dirTenantTokens) Store(tenant string) TokenStore {
+	return fileTokenStore{path: filepath.Join(t.dir, tenant+".json")}
+}
+
+func (t dirTenantTokens) Close() error {
+	return nil
+}
+
+// sqliteTenantTokens keeps the tokens in a SQLite table
+type sqliteTenantTokens struct {
+	db *sql.DB
+}
+
+func (t sqliteTenantTokens) Store(tenant string) TokenStore {
+	return sqliteTokenStore{db: t.db, tenant: tenant}
+}
+
+func (t sqliteTenantTokens) Close() error {
+	return t.db.Close()
+}
+
+type sqliteTokenStore struct {
+	db     *sql.DB
+	tenant string
+}
+
+func (s sqliteTokenStore) Load() (*oauth2.Token, error) {
+	var b string
+	err := s.db.QueryRow(`SELECT token FROM tokens WHERE tenant = ?`, s.tenant).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token: %v", err)
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal([]byte(b), tok); err != nil {
+		return nil, fmt.Errorf("unable to parse token: %v", err)
+	}
+	return tok, nil
+}
+
+func (s sqliteTokenStore) Save(token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO tokens (tenant, token, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (tenant) DO UPDATE SET token = excluded.token, updated_at = excluded.updated_at`,
+		s.tenant, string(b), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("unable to save token: %v", err)
+	}
+	return nil
+}
+
+func (s sqliteTokenStore) Delete() error {
+	res, err := s.db.Exec(`DELETE FROM tokens WHERE tenant = ?`, s.tenant)
+	if err != nil {
+		return fmt.Errorf("unable to delete token: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNoToken
+	}
+	return nil
+}
+
+// redisTenantTokens keeps the tokens in Redis, one key per tenant
+type redisTenantTokens struct {
+	client *redis.Client
+}
+
+func (t redisTenantTokens) Store(tenant string) TokenStore {
+	return redisTokenStore{client: t.client, key: redisTokenPrefix + tenant}
+}
+
+func (t redisTenantTokens) Close() error {
+	return t.client.Close()
+}
+
+type redisTokenStore struct {
+	client *redis.Client
+	key    string
+}
+
+func (s redisTokenStore) Load() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tenantStoreTimeout)
+	defer cancel()
+	b, err := s.client.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, errNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token from Redis: %v", err)
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(b, tok); err != nil {
+		return nil, fmt.Errorf("unable to parse token from Redis: %v", err)
+	}
+	return tok, nil
+}
+
+func (s redisTokenStore) Save(token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tenantStoreTimeout)
+	defer cancel()
+	if err := s.client.Set(ctx, s.key, b, 0).Err(); err != nil {
+		return fmt.Errorf("unable to save token to Redis: %v", err)
+	}
+	return nil
+}
+
+func (s redisTokenStore) Delete() error {
+	ctx, cancel := context.WithTimeout(context.Background(), tenantStoreTimeout)
+	defer cancel()
+	n, err := s.client.Del(ctx, s.key).Result()
+	if err != nil {
+		return fmt.Errorf("unable to delete token from Redis: %v", err)
+	}
+	if n == 0 {
+		return errNoToken
+	}
+	return nil
+}
+
+// tenants runs conversions of the server under the Google account of each
+// tenant. A tenant authorizes once through /auth/start and /auth/callback.
+type tenants struct {
+	// ctx outlives requests, for token refreshes of cached clients
+	ctx    context.Context
+	config Config
+	oauth  *oauth2.Config
+	tokens TenantTokens
+	// keys maps API keys to tenants, so a caller only reaches the tenants
+	// whose keys it holds
+	keys map[string]string
+
+	// loads makes concurrent first requests of a tenant share one token load
+	loads singleflight.Group
+
+	mu       sync.Mutex
+	services map[string]*Services
+	// authorized counts the authorizations of each tenant, so a load that
+	// raced with one doesn't cache the client of the replaced token
+	authorized map[string]int
+	// states are the pending authorizations by OAuth state
+	states map[string]authState
+}
+
+// tenantKey is the context key of the tenant a request runs for
+type tenantKey struct{}
+
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFrom returns the tenant of a request, "" outside multi-tenant mode
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+type authState struct {
+	tenant  string
+	expires time.Time
+}
+
+// newTenants sets up multi-tenant mode. Google redirects back to
+// publicURL/auth/callback, which must be a redirect URI of the OAuth client.
+func newTenants(ctx context.Context, config Config, tokens TenantTokens, publicURL string, keysFile string) (*tenants, error) {
+	oauthConfig, err := readOAuthConfig(config.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	oauthConfig.RedirectURL = strings.TrimSuffix(publicURL, "/") + "/auth/callback"
+	t := &tenants{
+		ctx:        ctx,
+		config:     config,
+		oauth:      oauthConfig,
+		tokens:     tokens,
+		services:   map[string]*Services{},
+		authorized: map[string]int{},
+		states:     map[string]authState{},
+	}
+	b, err := os.ReadFile(keysFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read tenant keys: %v", err)
+	}
+	if err := yaml.Unmarshal(b, &t.keys); err != nil {
+		return nil, fmt.Errorf("unable to parse tenant keys %s: %v", keysFile, err)
+	}
+	if len(t.keys) == 0 {
+		return nil, fmt.Errorf("no tenant keys in %s", keysFile)
+	}
+	for key, tenant := range t.keys {
+		if key == "" || !tenantPattern.MatchString(tenant) {
+			return nil, fmt.Errorf("invalid tenant key entry for %q in %s", tenant, keysFile)
+		}
+	}
+	return t, nil
+}
+
+// tenant names the tenant of a request from its X-API-Key. header reads
+// HTTP headers or gRPC metadata.
+func (t *tenants) tenant(header func(name string) string) (string, error) {
+	tenant, ok := t.keys[header("X-API-Key")]
+	if !ok {
+		return "", errors.New("missing or unknown X-API-Key")
+	}
+	return tenant, nil
+}
+
+// servicesFor returns the API clients of a tenant, authorized with its
+// stored token. The token is loaded without holding the lock, so a slow
+// token store only delays the requests of that tenant.
+func (t *tenants) servicesFor(tenant string) (*Services, error) {
+	t.mu.Lock()
+	svc, ok := t.services[tenant]
+	t.mu.Unlock()
+	if ok {
+		return svc, nil
+	}
+	v, err, _ := t.loads.Do(tenant, func() (any, error) {
+		t.mu.Lock()
+		svc, ok := t.services[tenant]
+		authorized := t.authorized[tenant]
+		t.mu.Unlock()
+		if ok {
+			return svc, nil
+		}
+		svc, err := t.newServices(tenant)
+		if err != nil {
+			return nil, err
+		}
+		t.mu.Lock()
+		if t.authorized[tenant] == authorized {
+			t.services[tenant] = svc
+		}
+		t.mu.Unlock()
+		return svc, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Services), nil
+}
+
+// newServices loads the stored token of a tenant and returns API clients
+// authorized with it
+func (t *tenants) newServices(tenant string) (*Services, error) {
+	store := t.tokens.Store(tenant)
+	tok, err := store.Load()
+	if errors.Is(err, errNoToken) {
+		return nil, fmt.Errorf("%w: tenant %s has not authorized yet, see /auth/start", ErrCredentialsMissing, tenant)
+	}
+	if err != nil {
+		return nil, err
+	}
+	base, err := baseHTTPClient(t.config)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.WithValue(t.ctx, oauth2.HTTPClient, base)
+	source := newSavingTokenSource(ctx, t.oauth, store, tok)
+	source.relogin = "tenant " + tenant + " must authorize again, see /auth/start"
+	client := oauth2.NewClient(ctx, source)
+	client.Transport = wrapTransport(t.config, source.relogin, client.Transport)
+	client.Timeout = base.Timeout
+
+	// Folder IDs differ between accounts, so tenants share no cache file
+	config := t.config
+	config.FolderCacheFile = ""
+	return newServices(config, client)
+}
+
+// handleStart implements GET /auth/start: it answers the Google
+// authorization URL the tenant's user opens to grant access
+func (t *tenants) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+		return
+	}
+	tenant := tenantFrom(r.Context())
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	state := hex.EncodeToString(b)
+
+	t.mu.Lock()
+	for s, pending := range t.states {
+		if time.Now().After(pending.expires) {
+			delete(t.states, s)
+		}
+	}
+	t.states[state] = authState{tenant: tenant, expires: time.Now().Add(authStateTTL)}
+	t.mu.Unlock()
+
+	authURL := t.oauth.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+	writeJSON(w, http.StatusOK, map[string]string{"tenant": tenant, "auth_url": authURL})
+}
+
+// handleCallback implements GET /auth/callback, where Google sends the
+// user back with an authorization code. The state ties it to the tenant.
+func (t *tenants) handleCallback(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	t.mu.Lock()
+	pending, ok := t.states[state]
+	delete(t.states, state)
+	t.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		http.Error(w, "This authorization link is invalid or expired, request a new one from /auth/start.", http.StatusBadRequest)
+		return
+	}
+	if msg := r.URL.Query().Get("error"); msg != "" {
+		http.Error(w, "Authorization was not granted: "+msg, http.StatusForbidden)
+		return
+	}
+
+	base, err := baseHTTPClient(t.config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, base)
+	tok, err := t.oauth.Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		logger.Warn("Unable to exchange authorization code", "tenant", pending.tenant, "err", err)
+		http.Error(w, "Unable to complete the authorization, please try again.", http.StatusBadGateway)
+		return
+	}
+	if err := t.tokens.Store(pending.tenant).Save(tok); err != nil {
+		logger.Error("Unable to save tenant token", "tenant", pending.tenant, "err", err)
+		http.Error(w, "Unable to save the authorization.", http.StatusInternalServerError)
+		return
+	}
+
+	// Later conversions use the new token
+	t.mu.Lock()
+	delete(t.services, pending.tenant)
+	t.authorized[pending.tenant]++
+	t.mu.Unlock()
+	logger.Info("Tenant authorized", "tenant", pending.tenant)
+	fmt.Fprintf(w, "doc2gdoc is now authorized for %s. You can close this page.\n", pending.tenant)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeTenantTokens stores a token for every tenant; loads of the tenant
+// "slow" wait for release
+type fakeTenantTokens struct {
+	loads   atomic.Int32
+	release chan struct{}
+}
+
+func (f *fakeTenantTokens) Store(tenant string) TokenStore {
+	return fakeTenantStore{f: f, tenant: tenant}
+}
+
+func (f *fakeTenantTokens) Close() error { return nil }
+
+type fakeTenantStore struct {
+	f      *fakeTenantTokens
+	tenant string
+}
+
+func (s fakeTenantStore) Load() (*oauth2.Token, error) {
+	s.f.loads.Add(1)
+	if s.tenant == "slow" {
+		<-s.f.release
+	}
+	return &oauth2.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func (s fakeTenantStore) Save(*oauth2.Token) error { return nil }
+func (s fakeTenantStore) Delete() error            { return nil }
+
+func TestTenantsRequireKeys(t *testing.T) {
+	dir := t.TempDir()
+	creds := filepath.Join(dir, "credentials.json")
+	err := os.WriteFile(creds, []byte(`{"installed":{"client_id":"id","client_secret":"secret","auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := filepath.Join(dir, "keys.yaml")
+	if err := os.WriteFile(keys, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{CredentialsFile: creds}
+	tokens := &fakeTenantTokens{}
+	if _, err := newTenants(context.Background(), config, tokens, "https://d2g.example.com", ""); err == nil {
+		t.Error("newTenants without a keys file succeeded")
+	}
+	if _, err := newTenants(context.Background(), config, tokens, "https://d2g.example.com", keys); err == nil {
+		t.Error("newTenants with no keys succeeded")
+	}
+
+	if err := os.WriteFile(keys, []byte("k1: acme\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := newTenants(context.Background(), config, tokens, "https://d2g.example.com", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"X-Tenant": "acme"}
+	if _, err := ts.tenant(func(name string) string { return headers[name] }); err == nil {
+		t.Error("X-Tenant named a tenant without a key")
+	}
+	headers["X-API-Key"] = "k1"
+	if tenant, err := ts.tenant(func(name string) string { return headers[name] }); err != nil || tenant != "acme" {
+		t.Errorf("tenant of key k1 = %q, %v, want acme", tenant, err)
+	}
+}
+
+func TestServicesForLoadsOutsideLock(t *testing.T) {
+	tokens := &fakeTenantTokens{release: make(chan struct{})}
+	ts := &tenants{
+		ctx:        context.Background(),
+		oauth:      &oauth2.Config{},
+		tokens:     tokens,
+		services:   map[string]*Services{},
+		authorized: map[string]int{},
+	}
+
+	// Concurrent first requests of a slow tenant share one load
+	var wg sync.WaitGroup
+	slow := make([]*Services, 3)
+	for i := range slow {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			svc, err := ts.servicesFor("slow")
+			if err != nil {
+				t.Error(err)
+			}
+			slow[i] = svc
+		}(i)
+	}
+	for tokens.loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Meanwhile other tenants are served
+	done := make(chan error, 1)
+	go func() {
+		_, err := ts.servicesFor("fast")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow token load blocked another tenant")
+	}
+
+	close(tokens.release)
+	wg.Wait()
+	if slow[0] == nil || slow[1] != slow[0] || slow[2] != slow[0] {
+		t.Error("concurrent requests got different clients")
+	}
+	if n := tokens.loads.Load(); n != 2 {
+		t.Errorf("loaded %d tokens, want 2", n)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+// Token storage backends
+const (
+	tokenStoreFile    = "file"
+	tokenStoreKeyring = "keyring"
+)
+
+// keyringService is the service name tokens are stored under in the keyring
+const keyringService = "doc2gdoc"
+
+// errNoToken is returned when no token has been stored yet
+var errNoToken = errors.New("no stored token")
+
+// TokenStore persists the OAuth token
+type TokenStore interface {
+	Load() (*oauth2.Token, error)
+	Save(token *oauth2.Token) error
+	Delete() error
+}
+
+// newTokenStore returns the backend selected in config: token.json on disk,
+// or the OS keyring (macOS Keychain, Windows Credential Manager, libsecret)
+func newTokenStore(config Config) (TokenStore, error) {
+	switch config.TokenStorage {
+	case "", tokenStoreFile:
+		return fileTokenStore{path: config.TokenFile}, nil
+	case tokenStoreKeyring:
+		account := config.Profile
+		if account == "" {
+			account = "default"
+		}
+		return keyringTokenStore{account: account}, nil
+	}
+	return nil, fmt.Errorf("unknown token store %q, expected file or keyring", config.TokenStorage)
+}
+
+// fileTokenStore keeps the token in a JSON file
+type fileTokenStore struct {
+	path string
+}
+
+func (s fileTokenStore) Load() (*oauth2.Token, error) {
+	tok, err := tokenFromFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoToken
+	}
+	return tok, err
+}
+
+func (s fileTokenStore) Save(token *oauth2.Token) error {
+	return saveToken(s.path, token)
+}
+
+func (s fileTokenStore) Delete() error {
+	err := os.Remove(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return errNoToken
+	}
+	return err
+}
+
+// keyringTokenStore keeps the token in the OS keyring, one entry per profile
+type keyringTokenStore struct {
+	account string
+}
+
+func (s keyringTokenStore) Load() (*oauth2.Token, error) {
+	secret, err := keyring.Get(keyringService, s.account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, errNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token from keyring: %v", err)
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal([]byte(secret), tok); err != nil {
+		return nil, fmt.Errorf("unable to parse token from keyring: %v", err)
+	}
+	return tok, nil
+}
+
+func (s keyringTokenStore) Save(token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(keyringService, s.account, string(b)); err != nil {
+		return fmt.Errorf("unable to save token to keyring: %v", err)
+	}
+	return nil
+}
+
+func (s keyringTokenStore) Delete() error {
+	err := keyring.Delete(keyringService, s.account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return errNoToken
+	}
+	return err
+}
+
+// authPromptEnabled allows logging in again on the terminal when the refresh
+// token was revoked or expired. Commands that run unattended or draw on the
+// terminal turn it off once authorized.
+var authPromptEnabled = true
+
+// savingTokenSource stores refreshed tokens, so a restart doesn't fall back
+// to an expired access token. A refresh token that was revoked or expired
+// fails with ErrTokenExpired, or, if interactive and prompts are enabled,
+// logs in again on the terminal and carries on with the new token.
+type savingTokenSource struct {
+	ctx   context.Context
+	oauth *oauth2.Config
+	base  oauth2.TokenSource
+	store TokenStore
+	// interactive allows logging in again; relogin tells how to otherwise
+	interactive bool
+	relogin     string
+
+	mu   sync.Mutex
+	last string
+}
+
+// newSavingTokenSource returns a source refreshing tok with oauth
+func newSavingTokenSource(ctx context.Context, oauth *oauth2.Config, store TokenStore, tok *oauth2.Token) *savingTokenSource {
+	return &savingTokenSource{
+		ctx:   ctx,
+		oauth: oauth,
+		base:  oauth2.ReuseTokenSource(tok, oauth.TokenSource(ctx, tok)),
+		store: store,
+		last:  tok.AccessToken,
+	}
+}
+
+// Token returns a valid token. Holding the lock while refreshing makes
+// concurrent uploads wait for a single login rather than each asking.
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, err := s.base.Token()
+	if isInvalidGrant(err) {
+		logger.Debug("Unable to refresh token", "err", err)
+		if !s.interactive || !authPromptEnabled || !isTerminal(os.Stdin) {
+			return nil, fmt.Errorf("%w: re-authentication required, %s", ErrTokenExpired, s.relogin)
+		}
+		fmt.Print(tr("\nRe-authentication required: the stored token was revoked or expired\n"))
+		if tok, err = getTokenFromWeb(s.ctx, s.oauth); err != nil {
+			return nil, fmt.Errorf("%w: re-authentication failed: %v", ErrTokenExpired, err)
+		}
+		s.base = oauth2.ReuseTokenSource(tok, s.oauth.TokenSource(s.ctx, tok))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok.AccessToken != s.last {
+		s.last = tok.AccessToken
+		if err := s.store.Save(tok); err != nil {
+			logger.Warn("Unable to save refreshed token", "err", err)
+		}
+	}
+	return tok, nil
+}
+
+// isInvalidGrant reports whether err is the token endpoint rejecting a
+// refresh token that was revoked or expired
+func isInvalidGrant(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// Conflict strategies of two-way sync, for files changed on both sides
+const (
+	preferLocal  = "prefer-local"
+	preferRemote = "prefer-remote"
+	// duplicateConflict keeps the remote version as a conflict copy next
+	// to the local file, then uploads the local file
+	duplicateConflict = "duplicate"
+)
+
+// Two-way sync actions, besides syncUnchanged
+const (
+	syncUpload   = "upload"
+	syncDownload = "download"
+	// syncRemove deletes a local file whose document was trashed
+	syncRemove = "remove"
+	// syncTrash trashes a document whose local file was deleted
+	syncTrash     = "trash"
+	syncConflict  = "conflict"
+	syncDuplicate = "duplicate"
+)
+
+// twoWayExports maps local extensions to the format their documents are
+// downloaded in. Other files are only uploaded.
+var twoWayExports = map[string]string{
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".txt":      "text/plain",
+	".html":     "text/html",
+	".htm":      "text/html",
+	".rtf":      "application/rtf",
+	".docx":     sourceMimeTypes[".docx"],
+	".odt":      sourceMimeTypes[".odt"],
+	".xlsx":     sourceMimeTypes[".xlsx"],
+	".ods":      sourceMimeTypes[".ods"],
+	".csv":      "text/csv",
+	".tsv":      "text/tab-separated-values",
+	".pptx":     sourceMimeTypes[".pptx"],
+	".odp":      sourceMimeTypes[".odp"],
+}
+
+// twoWayEntry is a file as it was when both sides were last in sync
+type twoWayEntry struct {
+	FileID string `json:"file_id"`
+	// Hash is the SHA-256 of the local file
+	Hash string `json:"hash"`
+	// ModifiedTime and Version are those of the document
+	ModifiedTime string `json:"modified_time"`
+	Version      int64  `json:"version,omitempty"`
+}
+
+// twoWayState maps local paths, relative to the directory and slash
+// separated, to their last synced state
+type twoWayState struct {
+	Files map[string]twoWayEntry `json:"files"`
+}
+
+// twoWayItem is a file present on either side, or known from the state
+type twoWayItem struct {
+	rel    string
+	hash   string
+	local  bool
+	remote *drive.File
+	entry  *twoWayEntry
+	kind   string
+}
+
+// loadTwoWayState reads the state of syncing localDir with drivePath from
+// the state database; a first sync starts empty
+func loadTwoWayState(stateFile string, localDir string, drivePath string) (twoWayState, error) {
+	state := twoWayState{Files: map[string]twoWayEntry{}}
+	if _, err := getState(stateFile, syncBucket, journalKey(localDir, drivePath), &state); err != nil {
+		return state, fmt.Errorf("unable to read sync state: %v", err)
+	}
+	if state.Files == nil {
+		state.Files = map[string]twoWayEntry{}
+	}
+	return state, nil
+}
+
+func saveTwoWayState(stateFile string, localDir string, drivePath string, state twoWayState) error {
+	if err := putState(stateFile, syncBucket, journalKey(localDir, drivePath), state); err != nil {
+		return fmt.Errorf("unable to write sync state: %v", err)
+	}
+	return nil
+}
+
+// syncTwoWay uploads local changes and downloads remote ones. The state
+// database records each file's hash and its document's modifiedTime as of
+// the last sync of localDir with drivePath, so a side counts as changed
+// when it differs from that. Files changed on both sides are conflicts,
+// resolved by opts.Conflict, by asking if opts.Interactive, or else
+// reported and left alone. With opts.Delete, deletions on one side are
+// repeated on the other; otherwise the missing side is restored.
+func syncTwoWay(ctx context.Context, svc *Services, localDir string, drivePath string, opts SyncOptions) error {
+	info, err := os.Stat(localDir)
+	if err != nil {
+		return fmt.Errorf("unable to read directory: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", localDir)
+	}
+
+	if opts.StateFile == "" {
+		return fmt.Errorf("two-way sync needs the state database")
+	}
+	state, err := loadTwoWayState(opts.StateFile, localDir, drivePath)
+	if err != nil {
+		return err
+	}
+
+	var rootID string
+	if opts.DryRun {
+		rootID, _, err = svc.Folders.Plan(ctx, drivePath, createAll)
+	} else {
+		rootID, err = svc.Folders.FindOrCreate(ctx, drivePath, createAll)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to process target folder: %w", err)
+	}
+	remote := map[string]*drive.File{}
+	if rootID != "" {
+		if err := listTwoWayRemote(ctx, svc.Files, rootID, "", remote); err != nil {
+			return err
+		}
+	}
+	local, err := listTwoWayLocal(localDir)
+	if err != nil {
+		return err
+	}
+
+	// Forget files gone from both sides
+	remoteIDs := map[string]bool{}
+	for _, f := range remote {
+		remoteIDs[f.Id] = true
+	}
+	for rel, e := range state.Files {
+		if _, ok := local[rel]; !ok && !remoteIDs[e.FileID] {
+			delete(state.Files, rel)
+		}
+	}
+
+	items := planTwoWay(local, remote, state, opts)
+	counts := map[string]int{}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		if item.kind == syncUnchanged {
+			counts[item.kind]++
+			if !opts.DryRun && item.remote != nil {
+				// Adopt documents found by name and follow new IDs
+				state.Files[item.rel] = twoWayEntry{FileID: item.remote.Id, Hash: item.hash, ModifiedTime: item.remote.ModifiedTime, Version: item.remote.Version}
+			}
+			continue
+		}
+		if opts.DryRun {
+			fmt.Printf("[dry-run] %-9s %s\n", item.kind, item.rel)
+			counts[item.kind]++
+			continue
+		}
+		if item.kind == syncConflict && opts.Interactive {
+			if item.kind, err = promptConflict(ctx, svc, localDir, item); err != nil {
+				saveTwoWayState(opts.StateFile, localDir, drivePath, state)
+				return err
+			}
+		}
+		fmt.Printf("%-9s %s\n", item.kind, item.rel)
+		if item.kind == syncConflict {
+			counts[item.kind]++
+			continue
+		}
+		err := applyTwoWay(ctx, svc, localDir, drivePath, item, &state, opts)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			saveTwoWayState(opts.StateFile, localDir, drivePath, state)
+			return fmt.Errorf("unable to %s %s: %w", item.kind, item.rel, err)
+		}
+		counts[item.kind]++
+		if err := saveTwoWayState(opts.StateFile, localDir, drivePath, state); err != nil {
+			return err
+		}
+	}
+	if !opts.DryRun {
+		if err := saveTwoWayState(opts.StateFile, localDir, drivePath, state); err != nil {
+			return err
+		}
+	}
+
+	summary := tr("%d uploaded, %d downloaded, %d duplicated, %d removed locally, %d trashed, %d unchanged, %d conflicts",
+		counts[syncUpload], counts[syncDownload], counts[syncDuplicate], counts[syncRemove], counts[syncTrash], counts[syncUnchanged], counts[syncConflict])
+	if err := ctx.Err(); err != nil {
+		fmt.Print(tr("Sync interrupted after %s\n", summary))
+		return err
+	}
+	fmt.Print(tr("Sync finished: %s\n", summary))
+	if n := counts[syncConflict]; n > 0 {
+		return fmt.Errorf("%d files changed on both sides, rerun with -prefer-local, -prefer-remote or -duplicate", n)
+	}
+	return nil
+}
+
+// listTwoWayRemote collects the Google Workspace documents under a folder by
+// their path without extension, relative to the synced folder
+func listTwoWayRemote(ctx context.Context, api DriveAPI, parentID string, dir string, out map[string]*drive.File) error {
+	query := buildQuery(quoteQuery(parentID)+" in parents", "trashed = false")
+	files, err := api.ListFiles(ctx, query, "id, name, mimeType, modifiedTime, version, webViewLink, appProperties", 0, 0)
+	if err != nil {
+		return fmt.Errorf("unable to list remote files: %w", classifyAPIError(err))
+	}
+	for _, f := range files {
+		switch f.MimeType {
+		case folderMimeType:
+			if err := listTwoWayRemote(ctx, api, f.Id, path.Join(dir, f.Name), out); err != nil {
+				return err
+			}
+		case docMimeType, sheetMimeType, slideMimeType:
+			// Versions kept by -on-conflict version have no local file
+			if _, version := f.AppProperties[versionOfProperty]; !version {
+				out[path.Join(dir, f.Name)] = f
+			}
+		}
+	}
+	return nil
+}
+
+// listTwoWayLocal hashes the files under dir by their slash separated path,
+// skipping hidden files and directories
+func listTwoWayLocal(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hash, err := localFileSHA256(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory: %v", err)
+	}
+	return files, nil
+}
+
+// planTwoWay pairs local files with documents, by the state's file ID or
+// else by name, and decides what to do with each pair
+func planTwoWay(local map[string]string, remote map[string]*drive.File, state twoWayState, opts SyncOptions) []*twoWayItem {
+	byID := map[string]*drive.File{}
+	for _, f := range remote {
+		byID[f.Id] = f
+	}
+	claimed := map[string]bool{}
+	var items []*twoWayItem
+
+	rels := make([]string, 0, len(local))
+	for rel := range local {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		item := &twoWayItem{rel: rel, hash: local[rel], local: true}
+		if e, ok := state.Files[rel]; ok {
+			item.entry = &e
+			item.remote = byID[e.FileID]
+		}
+		// Documents are named like their file without the extension, or
+		// with it if an earlier version uploaded them
+		for _, name := range []string{trimExt(rel), rel} {
+			if f, ok := remote[name]; item.remote == nil && ok && !claimed[f.Id] {
+				item.remote = f
+			}
+		}
+		if item.remote != nil {
+			claimed[item.remote.Id] = true
+		}
+		items = append(items, item)
+	}
+
+	// Documents without a local file were either deleted locally, known
+	// from the state, or created on Drive
+	known := map[string]string{}
+	for rel, e := range state.Files {
+		if _, ok := local[rel]; !ok {
+			known[e.FileID] = rel
+		}
+	}
+	keys := make([]string, 0, len(remote))
+	for key := range remote {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f := remote[key]
+		if claimed[f.Id] {
+			continue
+		}
+		item := &twoWayItem{remote: f}
+		if rel, ok := known[f.Id]; ok {
+			e := state.Files[rel]
+			item.rel, item.entry = rel, &e
+		} else if _, named := twoWayExports[strings.ToLower(path.Ext(key))]; named {
+			// Named after the file it was uploaded from
+			item.rel = key
+		} else if f.MimeType == docMimeType {
+			item.rel = key + pullFormats[opts.Format].ext
+		} else {
+			// New sheets and slides have no local format to choose
+			continue
+		}
+		items = append(items, item)
+	}
+
+	for _, item := range items {
+		item.kind = decideTwoWay(item, opts)
+	}
+	return items
+}
+
+// decideTwoWay picks the action for a file from which sides changed since
+// the last sync
+func decideTwoWay(item *twoWayItem, opts SyncOptions) string {
+	e := item.entry
+	_, exportable := twoWayExports[strings.ToLower(path.Ext(item.rel))]
+	localChanged := item.local && (e == nil || e.Hash != item.hash)
+	remoteChanged := item.remote != nil && exportable && (e == nil || e.ModifiedTime != item.remote.ModifiedTime)
+
+	switch {
+	case item.local && item.remote == nil:
+		if e != nil && !localChanged && opts.Delete {
+			return syncRemove
+		}
+		return syncUpload
+	case !item.local:
+		if e != nil && !remoteChanged && opts.Delete {
+			return syncTrash
+		}
+		return syncDownload
+	case e == nil && item.remote.AppProperties[sourceHashProperty] == item.hash:
+		// Uploaded from this very file before there was a state
+		return syncUnchanged
+	case localChanged && remoteChanged:
+		switch opts.Conflict {
+		case preferLocal:
+			return syncUpload
+		case preferRemote:
+			return syncDownload
+		case duplicateConflict:
+			return syncDuplicate
+		}
+		return syncConflict
+	case localChanged:
+		return syncUpload
+	case remoteChanged:
+		return syncDownload
+	}
+	return syncUnchanged
+}
+
+// applyTwoWay performs a planned action and records the new state
+func applyTwoWay(ctx context.Context, svc *Services, localDir string, drivePath string, item *twoWayItem, state *twoWayState, opts SyncOptions) error {
+	localPath := filepath.Join(localDir, filepath.FromSlash(item.rel))
+	switch item.kind {
+	case syncDuplicate:
+		ext := path.Ext(item.rel)
+		copyPath := strings.TrimSuffix(localPath, ext) + " (conflict " + time.Now().Format("2006-01-02") + ")" + ext
+		if _, err := exportTwoWay(ctx, svc, item.remote, copyPath); err != nil {
+			return err
+		}
+		fmt.Print(tr("Saved the remote version as %s\n", copyPath))
+		fallthrough
+	case syncUpload:
+		dir := path.Dir(item.rel)
+		target := drivePath
+		if dir != "." {
+			target = path.Join(drivePath, dir)
+		}
+		res, err := convertToGoogleDocs(ctx, svc, localPath, target, syncConvertOptions(opts, item.remote))
+		if err != nil {
+			return err
+		}
+		f, err := svc.Files.GetFile(ctx, res.FileID, "modifiedTime, version")
+		if err != nil {
+			return fmt.Errorf("unable to read uploaded document: %w", classifyAPIError(err))
+		}
+		state.Files[item.rel] = twoWayEntry{FileID: res.FileID, Hash: item.hash, ModifiedTime: f.ModifiedTime, Version: f.Version}
+	case syncDownload:
+		hash, err := exportTwoWay(ctx, svc, item.remote, localPath)
+		if err != nil {
+			return err
+		}
+		state.Files[item.rel] = twoWayEntry{FileID: item.remote.Id, Hash: hash, ModifiedTime: item.remote.ModifiedTime, Version: item.remote.Version}
+	case syncRemove:
+		if err := os.Remove(localPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(state.Files, item.rel)
+	case syncTrash:
+		// The local file was deleted, which is why the document goes
+		_, err := svc.Files.UpdateFile(withAuditSource(ctx, localPath), item.remote.Id, &drive.File{Trashed: true}, nil, UploadOptions{Fields: "id"})
+		if err != nil {
+			return classifyAPIError(err)
+		}
+		delete(state.Files, item.rel)
+	}
+	return nil
+}
+
+// exportTwoWay downloads a document into localPath, in the format its
+// extension names, and returns the hash of the written file
+func exportTwoWay(ctx context.Context, svc *Services, f *drive.File, localPath string) (string, error) {
+	mimeType, ok := twoWayExports[strings.ToLower(filepath.Ext(localPath))]
+	if !ok {
+		return "", fmt.Errorf("%s cannot be downloaded into %s", f.Name, filepath.Ext(localPath))
+	}
+	if err := exportToFile(ctx, svc.Files, f.Id, mimeType, localPath); err != nil {
+		return "", err
+	}
+	return localFileSHA256(localPath)
+}
+
+// trimExt returns a path without its extension, the name of its document
+func trimExt(p string) string {
+	return strings.TrimSuffix(p, path.Ext(p))
+}
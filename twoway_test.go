@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// newTestServices returns services backed by fake, without the Docs and
+// Sheets APIs
+func newTestServices(t *testing.T, fake *FakeDrive) *Services {
+	t.Helper()
+	folders, err := NewFolderResolver(fake, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Services{Files: fake, Folders: folders}
+}
+
+func TestTwoWayRoundTripOfDriveDocument(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeDrive()
+	svc := newTestServices(t, fake)
+	dir := t.TempDir()
+	opts := SyncOptions{StateFile: filepath.Join(t.TempDir(), "state.db"), Format: "txt"}
+
+	folderID, err := svc.Folders.FindOrCreate(ctx, "/notes", createAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := fake.CreateFile(ctx, &drive.File{Name: "todo", MimeType: docMimeType, Parents: []string{folderID}}, nil, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.UpdateFile(ctx, doc.Id, &drive.File{}, strings.NewReader("from Drive"), UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A document created on Drive is downloaded
+	if err := syncTwoWay(ctx, svc, dir, "/notes", opts); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(dir, "todo.txt")
+	if b, err := os.ReadFile(local); err != nil || string(b) != "from Drive" {
+		t.Fatalf("downloaded %q, %v", b, err)
+	}
+
+	// A local edit updates that document instead of creating another
+	if err := os.WriteFile(local, []byte("edited locally"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncTwoWay(ctx, svc, dir, "/notes", opts); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := fake.ListFiles(ctx, buildQuery(quoteQuery(folderID)+" in parents", "trashed = false"), "id", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].Id != doc.Id {
+		t.Fatalf("folder holds %d documents, want only %s", len(docs), doc.Id)
+	}
+	if got := string(fake.Content(doc.Id)); got != "edited locally" {
+		t.Errorf("document holds %q, want the local edit", got)
+	}
+
+	// Nothing is left to do, and the local edit survives
+	if err := syncTwoWay(ctx, svc, dir, "/notes", opts); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(local); string(b) != "edited locally" {
+		t.Errorf("local file holds %q after a rerun", b)
+	}
+}
+
+func TestPlanTwoWayNames(t *testing.T) {
+	opts := SyncOptions{Format: "md"}
+	remote := map[string]*drive.File{
+		// Uploaded by an earlier version, named with the extension
+		"old.md": {Id: "1", Name: "old.md", MimeType: docMimeType, AppProperties: map[string]string{sourceHashProperty: "h-old"}},
+		// Uploaded by two-way sync or created on Drive
+		"new":     {Id: "2", Name: "new", MimeType: docMimeType},
+		"drive":   {Id: "3", Name: "drive", MimeType: docMimeType},
+		"file.md": {Id: "4", Name: "file.md", MimeType: docMimeType},
+	}
+	local := map[string]string{"old.md": "h-old", "new.md": "h-new"}
+	state := twoWayState{Files: map[string]twoWayEntry{"new.md": {FileID: "2", Hash: "h-new"}}}
+
+	kinds := map[string]string{}
+	for _, item := range planTwoWay(local, remote, state, opts) {
+		if prev, ok := kinds[item.rel]; ok {
+			t.Errorf("%s planned twice: %s and %s", item.rel, prev, item.kind)
+		}
+		kinds[item.rel] = item.kind
+	}
+	want := map[string]string{
+		"old.md":   syncUnchanged,
+		"new.md":   syncUnchanged,
+		"drive.md": syncDownload,
+		"file.md":  syncDownload,
+	}
+	for rel, kind := range want {
+		if kinds[rel] != kind {
+			t.Errorf("%s: planned %q, want %q", rel, kinds[rel], kind)
+		}
+	}
+	if len(kinds) != len(want) {
+		t.Errorf("planned %v, want %v", kinds, want)
+	}
+}
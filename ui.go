@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// uiQueueRows is how many uploads the queue shows
+const uiQueueRows = 6
+
+// uiEntry is a row of the local or the Drive browser
+type uiEntry struct {
+	name string
+	dir  bool
+	// id is the folder ID of Drive entries
+	id string
+}
+
+// uiFolder is an opened Drive folder
+type uiFolder struct {
+	id   string
+	name string
+}
+
+// uiUpload is a file in the upload queue; its status is a job state
+type uiUpload struct {
+	path      string
+	drivePath string
+	status    string
+	current   int64
+	total     int64
+	result    *ConvertResult
+	err       error
+}
+
+// uiJob is an upload handed to the worker
+type uiJob struct {
+	index     int
+	path      string
+	drivePath string
+}
+
+type uiDriveMsg struct {
+	id      string
+	entries []uiEntry
+	err     error
+}
+
+type uiProgressMsg struct {
+	index   int
+	current int64
+	total   int64
+}
+
+type uiDoneMsg struct {
+	index  int
+	result *ConvertResult
+	err    error
+}
+
+// uiModel is the state of "doc2gdoc ui": a local file browser, a Drive
+// folder browser and the upload queue
+type uiModel struct {
+	ctx  context.Context
+	svc  *Services
+	jobs chan<- uiJob
+
+	width  int
+	height int
+	// driveFocus is set while the Drive browser has the keyboard
+	driveFocus bool
+	status     string
+
+	localDir    string
+	local       []uiEntry
+	localCursor int
+	// selected are the absolute paths of the selected files
+	selected map[string]bool
+
+	// folders are the opened Drive folders, the root first
+	folders      []uiFolder
+	drive        []uiEntry
+	driveCursor  int
+	driveLoading bool
+
+	queue []uiUpload
+}
+
+// runUICommand implements "doc2gdoc ui [-path drive path] [local dir]"
+func runUICommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("ui", flag.ExitOnError)
+	drivePath := flags.String("path", config.DefaultPath, "Drive folder the Drive browser starts in")
+	onConflict := flags.String("on-conflict", "", "What to do when the document already exists: skip, overwrite, rename or version, which keeps a copy of the document before overwriting it (default: always create a new one)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc ui [-path drive path] [-on-conflict strategy] [local dir]")
+		flags.PrintDefaults()
+	}
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		flags.Usage()
+		return fmt.Errorf("please specify at most one local directory")
+	}
+	if err := validateConflictStrategy(*onConflict); err != nil {
+		return err
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("the ui needs a terminal")
+	}
+	localDir := "."
+	if len(positional) == 1 {
+		localDir = positional[0]
+	}
+	localDir, err = filepath.Abs(localDir)
+	if err != nil {
+		return err
+	}
+	if *drivePath == "" {
+		*drivePath = "/"
+	}
+
+	// Authorizing may need the terminal, so it happens before the ui takes it
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+	authPromptEnabled = false
+	rootID, err := svc.Folders.FindOrCreate(ctx, *drivePath, createNone)
+	if err != nil {
+		return fmt.Errorf("unable to find Drive folder: %w", err)
+	}
+
+	opts := ConvertOptions{
+		CreateMode:  createAll,
+		OnConflict:  *onConflict,
+		StateFile:   config.StateFile,
+		FrontMatter: true,
+		Preprocess:  config.Preprocess,
+		Filters:     config.Filters,
+		Styles:      config.Styles,
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan uiJob, jobQueueSize)
+	m := &uiModel{
+		ctx:      ctx,
+		svc:      svc,
+		jobs:     jobs,
+		localDir: localDir,
+		selected: map[string]bool{},
+		folders:  []uiFolder{{id: rootID, name: *drivePath}},
+	}
+	m.readLocal()
+
+	// Conversions print their results and log to the terminal, which the
+	// ui owns until it exits
+	tty := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	savedLogger := logger
+	os.Stdout = devNull
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	defer func() {
+		os.Stdout = tty
+		logger = savedLogger
+	}()
+
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx), tea.WithOutput(tty))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for job := range jobs {
+			p.Send(uiProgressMsg{index: job.index})
+			jobOpts := opts
+			jobOpts.Progress = func(current, total int64) {
+				p.Send(uiProgressMsg{index: job.index, current: current, total: total})
+			}
+			res, err := convertToGoogleDocs(ctx, svc, job.path, job.drivePath, jobOpts)
+			p.Send(uiDoneMsg{index: job.index, result: res, err: err})
+		}
+	}()
+
+	_, err = p.Run()
+	cancel()
+	close(jobs)
+	wg.Wait()
+	os.Stdout = tty
+	for _, u := range m.queue {
+		switch {
+		case u.err != nil:
+			fmt.Print(tr("Failed %s: %v\n", u.path, u.err))
+		case u.result != nil:
+			fmt.Print(tr("Converted %s to Google Drive:%s (%s)\n", u.path, u.result.Location, u.result.Link))
+		}
+	}
+	if err != nil && err != tea.ErrProgramKilled {
+		return err
+	}
+	return nil
+}
+
+func (m *uiModel) Init() tea.Cmd {
+	return m.listDrive()
+}
+
+func (m *uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case uiDriveMsg:
+		if msg.id != m.folders[len(m.folders)-1].id {
+			break
+		}
+		m.driveLoading = false
+		m.drive, m.driveCursor = msg.entries, 0
+		if msg.err != nil {
+			m.status = msg.err.Error()
+		}
+	case uiProgressMsg:
+		u := &m.queue[msg.index]
+		u.status = jobRunning
+		u.current, u.total = msg.current, msg.total
+	case uiDoneMsg:
+		u := &m.queue[msg.index]
+		u.result, u.err = msg.result, msg.err
+		u.status = jobSucceeded
+		if msg.err != nil {
+			u.status = jobFailed
+		}
+	case tea.KeyMsg:
+		return m, m.key(msg.String())
+	}
+	return m, nil
+}
+
+// key handles a key press
+func (m *uiModel) key(key string) tea.Cmd {
+	m.status = ""
+	switch key {
+	case "ctrl+c":
+		return tea.Quit
+	case "q":
+		if m.running() > 0 {
+			m.status = "Uploads are still running, press ctrl+c to abort them"
+			return nil
+		}
+		return tea.Quit
+	case "tab":
+		m.driveFocus = !m.driveFocus
+		return nil
+	case "u":
+		m.enqueue()
+		return nil
+	case "r":
+		m.readLocal()
+		return m.listDrive()
+	}
+
+	if m.driveFocus {
+		switch key {
+		case "up", "k":
+			m.driveCursor = max(m.driveCursor-1, 0)
+		case "down", "j":
+			m.driveCursor = min(m.driveCursor+1, len(m.drive)-1)
+		case "enter", "right", "l":
+			if m.driveCursor >= len(m.drive) {
+				break
+			}
+			e := m.drive[m.driveCursor]
+			if e.name == ".." {
+				return m.driveUp()
+			}
+			m.folders = append(m.folders, uiFolder{id: e.id, name: e.name})
+			return m.listDrive()
+		case "backspace", "left", "h":
+			return m.driveUp()
+		}
+		return nil
+	}
+
+	switch key {
+	case "up", "k":
+		m.localCursor = max(m.localCursor-1, 0)
+	case "down", "j":
+		m.localCursor = min(m.localCursor+1, len(m.local)-1)
+	case "enter", "right", "l":
+		if m.localCursor < len(m.local) && m.local[m.localCursor].dir {
+			m.localDir = filepath.Join(m.localDir, m.local[m.localCursor].name)
+			m.readLocal()
+		}
+	case "backspace", "left", "h":
+		m.localDir = filepath.Dir(m.localDir)
+		m.readLocal()
+	case " ":
+		if m.localCursor < len(m.local) && !m.local[m.localCursor].dir {
+			p := filepath.Join(m.localDir, m.local[m.localCursor].name)
+			m.selected[p] = !m.selected[p]
+			if !m.selected[p] {
+				delete(m.selected, p)
+			}
+			m.localCursor = min(m.localCursor+1, len(m.local)-1)
+		}
+	case "a":
+		for _, e := range m.local {
+			if !e.dir {
+				m.selected[filepath.Join(m.localDir, e.name)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// readLocal lists the local directory, folders first, without hidden files
+func (m *uiModel) readLocal() {
+	entries, err := os.ReadDir(m.localDir)
+	if err != nil {
+		m.status = err.Error()
+	}
+	m.local = nil
+	if filepath.Dir(m.localDir) != m.localDir {
+		m.local = append(m.local, uiEntry{name: "..", dir: true})
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		m.local = append(m.local, uiEntry{name: e.Name(), dir: e.IsDir()})
+	}
+	sortUIEntries(m.local)
+	m.localCursor = 0
+}
+
+// listDrive lists the folders of the open Drive folder in the background
+func (m *uiModel) listDrive() tea.Cmd {
+	m.driveLoading = true
+	folder := m.folders[len(m.folders)-1]
+	atRoot := len(m.folders) == 1
+	return func() tea.Msg {
+		query := buildQuery(
+			quoteQuery(folder.id)+" in parents",
+			"mimeType = "+quoteQuery(folderMimeType),
+			"trashed = false",
+		)
+		files, err := m.svc.Files.ListFiles(m.ctx, query, "id, name", 0, 0)
+		var entries []uiEntry
+		if !atRoot {
+			entries = append(entries, uiEntry{name: "..", dir: true})
+		}
+		for _, f := range files {
+			entries = append(entries, uiEntry{name: f.Name, dir: true, id: f.Id})
+		}
+		sortUIEntries(entries)
+		if err != nil {
+			err = fmt.Errorf("unable to list folders: %w", classifyAPIError(err))
+		}
+		return uiDriveMsg{id: folder.id, entries: entries, err: err}
+	}
+}
+
+func (m *uiModel) driveUp() tea.Cmd {
+	if len(m.folders) == 1 {
+		return nil
+	}
+	m.folders = m.folders[:len(m.folders)-1]
+	return m.listDrive()
+}
+
+// drivePath is the path of the open Drive folder
+func (m *uiModel) drivePath() string {
+	p := m.folders[0].name
+	for _, f := range m.folders[1:] {
+		p = strings.TrimSuffix(p, "/") + "/" + f.name
+	}
+	return p
+}
+
+// enqueue uploads the selected files, or the file under the cursor, into
+// the open Drive folder
+func (m *uiModel) enqueue() {
+	paths := make([]string, 0, len(m.selected))
+	for p := range m.selected {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 && m.localCursor < len(m.local) && !m.local[m.localCursor].dir {
+		paths = append(paths, filepath.Join(m.localDir, m.local[m.localCursor].name))
+	}
+	if len(paths) == 0 {
+		m.status = "Select files with space first"
+		return
+	}
+	drivePath := m.drivePath()
+	for _, p := range paths {
+		m.queue = append(m.queue, uiUpload{path: p, drivePath: drivePath, status: jobQueued})
+		m.jobs <- uiJob{index: len(m.queue) - 1, path: p, drivePath: drivePath}
+	}
+	m.selected = map[string]bool{}
+	m.status = fmt.Sprintf("Queued %d file(s) for Google Drive:%s", len(paths), drivePath)
+}
+
+// running counts the queued and running uploads
+func (m *uiModel) running() int {
+	n := 0
+	for _, u := range m.queue {
+		if u.status == jobQueued || u.status == jobRunning {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *uiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	paneWidth := (m.width - 3) / 2
+	rows := max(m.height-uiQueueRows-6, 3)
+
+	var b strings.Builder
+	b.WriteString(uiCell(" Local: "+m.localDir, paneWidth) + " │ " + uiCell("Drive: "+m.drivePath(), paneWidth) + "\n")
+	b.WriteString(strings.Repeat("─", paneWidth) + "─┼─" + strings.Repeat("─", paneWidth) + "\n")
+
+	left := uiRows(m.local, m.localCursor, rows, !m.driveFocus, func(e uiEntry) string {
+		switch {
+		case e.dir:
+			return "    " + e.name + "/"
+		case m.selected[filepath.Join(m.localDir, e.name)]:
+			return "[x] " + e.name
+		}
+		return "[ ] " + e.name
+	})
+	right := uiRows(m.drive, m.driveCursor, rows, m.driveFocus, func(e uiEntry) string {
+		return e.name + "/"
+	})
+	if m.driveLoading {
+		right = []string{"  Loading..."}
+	}
+	for i := 0; i < rows; i++ {
+		var l, r string
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		b.WriteString(uiCell(l, paneWidth) + " │ " + uiCell(r, paneWidth) + "\n")
+	}
+
+	done := len(m.queue) - m.running()
+	b.WriteString(uiCell(fmt.Sprintf(" Queue: %d of %d done", done, len(m.queue)), m.width) + "\n")
+	start := max(len(m.queue)-uiQueueRows, 0)
+	for i := 0; i < uiQueueRows; i++ {
+		line := ""
+		if start+i < len(m.queue) {
+			line = "  " + uiUploadLine(m.queue[start+i])
+		}
+		b.WriteString(uiCell(line, m.width) + "\n")
+	}
+	b.WriteString(uiCell(" "+m.status, m.width) + "\n")
+	b.WriteString(uiCell(" tab switch · space select · a all · u upload here · enter open · backspace up · r refresh · q quit", m.width))
+	return b.String()
+}
+
+// uiRows renders the entries around the cursor, marking it if focused
+func uiRows(entries []uiEntry, cursor int, rows int, focused bool, label func(uiEntry) string) []string {
+	start := 0
+	if cursor >= rows {
+		start = cursor - rows + 1
+	}
+	var lines []string
+	for i := start; i < len(entries) && i < start+rows; i++ {
+		mark := "  "
+		if i == cursor && focused {
+			mark = "> "
+		} else if i == cursor {
+			mark = "· "
+		}
+		lines = append(lines, mark+label(entries[i]))
+	}
+	return lines
+}
+
+// uiUploadLine describes an upload of the queue
+func uiUploadLine(u uiUpload) string {
+	name := filepath.Base(u.path)
+	switch u.status {
+	case jobRunning:
+		if u.total > 0 {
+			return fmt.Sprintf("↑ %s  %s / %s", name, formatBytes(u.current), formatBytes(u.total))
+		}
+		return "↑ " + name + "  uploading"
+	case jobSucceeded:
+		return fmt.Sprintf("✓ %s  %s %s", name, u.result.Status, u.result.Link)
+	case jobFailed:
+		return fmt.Sprintf("✗ %s  %v", name, u.err)
+	}
+	return "  " + name + "  queued for " + u.drivePath
+}
+
+// uiCell pads or truncates s to width terminal cells
+func uiCell(s string, width int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	return runewidth.FillRight(runewidth.Truncate(s, width, "…"), width)
+}
+
+// sortUIEntries puts .. and folders first, then sorts by name
+func sortUIEntries(entries []uiEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if (a.name == "..") != (b.name == "..") {
+			return a.name == ".."
+		}
+		if a.dir != b.dir {
+			return a.dir
+		}
+		return strings.ToLower(a.name) < strings.ToLower(b.name)
+	})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// defaultVerifyThreshold is the share of source words a Doc must contain
+const defaultVerifyThreshold = 0.9
+
+var (
+	// htmlHiddenRe matches elements whose text is not content
+	htmlHiddenRe = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>`)
+	// htmlTagRe matches tags and comments
+	htmlTagRe = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+)
+
+// verifyResult compares the words and characters of a source and its Doc
+type verifyResult struct {
+	SourceWords, DocWords int
+	// Matched is how many source words the Doc contains
+	Matched               int
+	SourceChars, DocChars int
+}
+
+// score is the share of source words found in the Doc
+func (r verifyResult) score() float64 {
+	if r.SourceWords == 0 {
+		return 1
+	}
+	return float64(r.Matched) / float64(r.SourceWords)
+}
+
+// verifyDoc exports the Doc docID as plain text and compares it with the
+// text of the source. Below threshold it warns, or fails if strict.
+// Sources whose text cannot be extracted are not verified.
+func verifyDoc(ctx context.Context, api DriveAPI, file *os.File, sourceMime string, name string, docID string, threshold float64, strict bool) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to read file: %v", err)
+	}
+	source, err := sourceText(file, sourceMime)
+	if errors.Is(err, ErrUnsupportedFileType) {
+		logger.Warn("Cannot verify this source type", "file", name, "mime_type", sourceMime)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read source text: %v", err)
+	}
+	body, err := api.Export(ctx, docID, "text/plain")
+	if err != nil {
+		return fmt.Errorf("unable to export for verification: %w", classifyAPIError(err))
+	}
+	defer body.Close()
+	exported, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("unable to export for verification: %w", classifyAPIError(err))
+	}
+
+	r := compareText(source, string(exported))
+	summary := tr("%d of %d words found (%.1f%%), %d characters in the source, %d in the Doc",
+		r.Matched, r.SourceWords, r.score()*100, r.SourceChars, r.DocChars)
+	if r.score() >= threshold {
+		fmt.Print(tr("Verified %s: %s\n", name, summary))
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("%s lost content in conversion: %s", name, summary)
+	}
+	logger.Warn("Conversion likely lost content", "file", name, "words", r.SourceWords, "found", r.Matched,
+		"score", fmt.Sprintf("%.3f", r.score()), "source_chars", r.SourceChars, "doc_chars", r.DocChars)
+	return nil
+}
+
+// compareText counts the words and characters of source and doc, and how
+// many source words doc contains, regardless of order
+func compareText(source string, doc string) verifyResult {
+	sourceWords, docWords := textWords(source), textWords(doc)
+	r := verifyResult{SourceWords: len(sourceWords), DocWords: len(docWords), SourceChars: textChars(source), DocChars: textChars(doc)}
+	counts := map[string]int{}
+	for _, w := range docWords {
+		counts[w]++
+	}
+	for _, w := range sourceWords {
+		if counts[w] > 0 {
+			counts[w]--
+			r.Matched++
+		}
+	}
+	return r
+}
+
+// textWords splits s into lower-case words. Ideographs, kana and Hangul
+// syllables count as a word each, since those scripts don't separate
+// words with spaces.
+func textWords(s string) []string {
+	var words []string
+	var cur strings.Builder
+	end := func() {
+		if cur.Len() > 0 {
+			words = append(words, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, c := range strings.ToLower(s) {
+		switch {
+		case unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			end()
+			words = append(words, string(c))
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			cur.WriteRune(c)
+		default:
+			end()
+		}
+	}
+	end()
+	return words
+}
+
+// textChars counts the characters of s that aren't white space
+func textChars(s string) int {
+	n := 0
+	for _, c := range s {
+		if !unicode.IsSpace(c) {
+			n++
+		}
+	}
+	return n
+}
+
+// sourceText extracts the text of a source, or returns
+// ErrUnsupportedFileType if it can't
+func sourceText(file *os.File, sourceMime string) (string, error) {
+	switch sourceMime {
+	case "text/plain":
+		b, err := io.ReadAll(file)
+		return string(b), err
+	case "text/markdown":
+		b, err := io.ReadAll(file)
+		if err != nil {
+			return "", err
+		}
+		return markdownText(markdownBlocks(string(b), ConvertOptions{})), nil
+	case "text/html":
+		b, err := io.ReadAll(file)
+		if err != nil {
+			return "", err
+		}
+		text := htmlTagRe.ReplaceAllString(htmlHiddenRe.ReplaceAllString(string(b), ""), " ")
+		return html.UnescapeString(text), nil
+	case sourceMimeTypes[".docx"]:
+		return zipXMLText(file, "word/document.xml")
+	case sourceMimeTypes[".odt"]:
+		return zipXMLText(file, "content.xml")
+	}
+	return "", ErrUnsupportedFileType
+}
+
+// markdownText is the text Markdown blocks render as, without markup
+func markdownText(blocks []mdBlock) string {
+	var sb strings.Builder
+	for _, b := range blocks {
+		switch {
+		case b.Kind == mdCode:
+			sb.WriteString(b.Text)
+		case b.Kind == mdTable:
+			for _, row := range b.Rows {
+				for _, cell := range row {
+					for _, r := range parseInline(cell) {
+						sb.WriteString(r.Text)
+					}
+					sb.WriteString(" ")
+				}
+			}
+		default:
+			for _, r := range parseInline(b.Text) {
+				sb.WriteString(r.Text)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// zipXMLText returns the character data of the XML document name in the
+// zip archive file, as in Office Open XML and OpenDocument files
+func zipXMLText(file *os.File, name string) (string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	zr, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return "", err
+	}
+	f, err := zr.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	dec := xml.NewDecoder(f)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			sb.Write(t)
+		case xml.EndElement:
+			// Paragraphs and table cells end words
+			if t.Name.Local == "p" || t.Name.Local == "h" || t.Name.Local == "tc" {
+				sb.WriteString("\n")
+			}
+		}
+	}
+}
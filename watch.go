@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// runWatchCommand implements "doc2gdoc watch <dir> -path <drive path>"
+func runWatchCommand(ctx context.Context, config Config, args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	drivePath := flags.String("path", config.DefaultPath, "Target folder on Google Drive")
+	debounce := flags.Duration("debounce", time.Second, "Wait this long after the last change before converting")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: doc2gdoc watch <local dir> -path <drive path> [-debounce 1s]")
+		flags.PrintDefaults()
+	}
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		flags.Usage()
+		return fmt.Errorf("please specify one local directory to watch")
+	}
+
+	svc, err := initClient(ctx, config)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client: %w", err)
+	}
+
+	return watchDirectory(ctx, svc, positional[0], *drivePath, *debounce, ConvertOptions{
+		OnConflict:    conflictOverwrite,
+		SkipUnchanged: true,
+		StateFile:     config.StateFile,
+		Filters:       config.Filters,
+	})
+}
+
+// watchDirectory converts files under localDir whenever they are created or
+// modified, until ctx is cancelled. Rapid saves of the same file are debounced
+// into a single conversion, and conversions run one at a time.
+func watchDirectory(ctx context.Context, svc *Services, localDir string, drivePath string, debounce time.Duration, opts ConvertOptions) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	// fsnotify is not recursive, so every directory is watched separately
+	if err := watchTree(watcher, localDir); err != nil {
+		return err
+	}
+	fmt.Print(tr("Watching %s, publishing to Google Drive:%s\n", localDir, drivePath))
+
+	d := newDebouncer(debounce)
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.stop()
+			fmt.Print(tr("Stopped watching %s\n", localDir))
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ignoredWatchPath(event.Name) || !event.Has(fsnotify.Create|fsnotify.Write) {
+				continue
+			}
+
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				if event.Has(fsnotify.Create) {
+					if err := watchTree(watcher, event.Name); err != nil {
+						logger.Warn("Unable to watch directory", "dir", event.Name, "err", err)
+					}
+				}
+				continue
+			}
+
+			d.touch(ctx, event.Name)
+
+		case name := <-d.ready:
+			if !d.fired(ctx, name) {
+				continue
+			}
+
+			rel, err := filepath.Rel(localDir, filepath.Dir(name))
+			if err != nil {
+				logger.Warn("Unable to resolve path", "file", name, "err", err)
+				continue
+			}
+			target := drivePath
+			if rel != "." {
+				target = path.Join(drivePath, filepath.ToSlash(rel))
+			}
+
+			_, err = convertToGoogleDocs(ctx, svc, name, target, opts)
+			if err != nil {
+				logger.Error("Conversion failed", "file", name, "err", err)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error("Watch error", "err", err)
+		}
+	}
+}
+
+// debouncer delays a file's conversion until it has not changed for a
+// while. Its timers send the file on ready; they run on their own goroutines,
+// while touch and fired are only called from the watch loop.
+type debouncer struct {
+	delay  time.Duration
+	ready  chan string
+	timers map[string]*time.Timer
+	// pending holds the files changed again after their timer fired, but
+	// before the loop received them from ready
+	pending map[string]bool
+}
+
+func newDebouncer(delay time.Duration) *debouncer {
+	return &debouncer{
+		delay:   delay,
+		ready:   make(chan string),
+		timers:  map[string]*time.Timer{},
+		pending: map[string]bool{},
+	}
+}
+
+// touch (re)starts the timer of a changed file
+func (d *debouncer) touch(ctx context.Context, name string) {
+	if t, ok := d.timers[name]; ok && !t.Stop() {
+		// The timer fired and its send is on the way; restarting it would
+		// convert the file twice
+		d.pending[name] = true
+		return
+	}
+	d.timers[name] = time.AfterFunc(d.delay, func() {
+		select {
+		case d.ready <- name:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// fired reports whether a file received from ready is due for conversion,
+// or restarts its timer if it changed since the timer fired
+func (d *debouncer) fired(ctx context.Context, name string) bool {
+	delete(d.timers, name)
+	if d.pending[name] {
+		delete(d.pending, name)
+		d.touch(ctx, name)
+		return false
+	}
+	return true
+}
+
+func (d *debouncer) stop() {
+	for _, t := range d.timers {
+		t.Stop()
+	}
+}
+
+// watchTree adds dir and all its non-hidden subdirectories to the watcher
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dir && ignoredWatchPath(p) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(p); err != nil {
+			return fmt.Errorf("unable to watch %s: %v", p, err)
+		}
+		return nil
+	})
+}
+
+// ignoredWatchPath skips hidden files and common editor temp files
+func ignoredWatchPath(p string) bool {
+	name := filepath.Base(p)
+	return strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, "~") ||
+		strings.HasSuffix(name, ".swp") ||
+		strings.HasSuffix(name, ".tmp") ||
+		strings.HasPrefix(name, "~$")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// receive waits for the debouncer's next file, or returns "" if none is due
+// within the timeout
+func receive(ctx context.Context, d *debouncer, timeout time.Duration) string {
+	select {
+	case name := <-d.ready:
+		if d.fired(ctx, name) {
+			return name
+		}
+		return receive(ctx, d, timeout)
+	case <-time.After(timeout):
+		return ""
+	}
+}
+
+func TestDebouncerCoalescesChanges(t *testing.T) {
+	ctx := context.Background()
+	d := newDebouncer(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		d.touch(ctx, "notes.md")
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := receive(ctx, d, time.Second); got != "notes.md" {
+		t.Fatalf("received %q, want notes.md", got)
+	}
+	if got := receive(ctx, d, 100*time.Millisecond); got != "" {
+		t.Errorf("received %q again", got)
+	}
+}
+
+func TestDebouncerChangeAfterFire(t *testing.T) {
+	ctx := context.Background()
+	d := newDebouncer(10 * time.Millisecond)
+	d.touch(ctx, "notes.md")
+	// The timer fires and blocks on ready until the file changes again
+	time.Sleep(50 * time.Millisecond)
+	d.touch(ctx, "notes.md")
+
+	if got := receive(ctx, d, time.Second); got != "notes.md" {
+		t.Fatalf("received %q, want notes.md", got)
+	}
+	if got := receive(ctx, d, 100*time.Millisecond); got != "" {
+		t.Errorf("converted %q twice", got)
+	}
+}
+
+func TestDebouncerStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newDebouncer(time.Millisecond)
+	d.touch(ctx, "notes.md")
+	cancel()
+
+	// The timer's goroutine must return instead of blocking on ready
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case name := <-d.ready:
+		t.Errorf("received %q after cancel", name)
+	default:
+	}
+}
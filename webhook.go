@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// webhookAttempts is how often a notification is sent before giving up
+	webhookAttempts = 3
+	// webhookRetryDelay is the wait after the first failed attempt, doubled
+	// per attempt
+	webhookRetryDelay = time.Second
+	// webhookTimeout bounds a single attempt
+	webhookTimeout = 10 * time.Second
+	// webhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// body, keyed with the webhook secret
+	webhookSignatureHeader = "X-Doc2gdoc-Signature"
+)
+
+// convertFailed is the webhook status of a conversion that returned an error
+const convertFailed = "failed"
+
+// WebhookEvent is the JSON body posted after each conversion
+type WebhookEvent struct {
+	Source   string `json:"source"`
+	Status   string `json:"status"`
+	Name     string `json:"name,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	Link     string `json:"web_view_link,omitempty"`
+	Location string `json:"location,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// DurationMS is how long the conversion took in milliseconds
+	DurationMS int64     `json:"duration_ms"`
+	Time       time.Time `json:"time"`
+}
+
+// newWebhookEvent describes the outcome of converting source
+func newWebhookEvent(source string, result *ConvertResult, err error, duration time.Duration) WebhookEvent {
+	event := WebhookEvent{
+		Source:     source,
+		DurationMS: duration.Milliseconds(),
+		Time:       time.Now().UTC(),
+	}
+	if result != nil {
+		event.Status = result.Status
+		event.Name = result.Name
+		event.FileID = result.FileID
+		event.Link = result.Link
+		event.Location = result.Location
+	}
+	if err != nil {
+		event.Status = convertFailed
+		event.Error = err.Error()
+	}
+	return event
+}
+
+// notifyWebhook posts event to the configured webhook, if any. Network
+// errors, 429 and 5xx answers are retried; a notification that still fails
+// is logged, it never fails the conversion itself.
+func notifyWebhook(ctx context.Context, config Config, event WebhookEvent) {
+	if config.WebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Unable to encode webhook event", "err", err)
+		return
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := postWebhook(ctx, config, body)
+		if err == nil {
+			logger.Debug("Webhook notified", "url", config.WebhookURL, "source", event.Source)
+			return
+		}
+		if !retry || attempt == webhookAttempts || ctx.Err() != nil {
+			logger.Warn("Unable to notify webhook", "url", config.WebhookURL, "source", event.Source, "err", err)
+			return
+		}
+		logger.Info("Webhook failed, retrying", "attempt", attempt, "max_attempts", webhookAttempts, "err", err)
+		metrics.retry("webhook")
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// postWebhook sends one notification and reports whether a failure is worth
+// retrying
+func postWebhook(ctx context.Context, config Config, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "doc2gdoc")
+	if config.WebhookSecret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(config.WebhookSecret, body))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook answered %s", resp.Status)
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body keyed with secret
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}